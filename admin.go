@@ -0,0 +1,25 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+func (cfg *apiConfig) isAdmin(userID uuid.UUID) bool {
+	return cfg.adminUserIDs[userID]
+}
+
+// requireAdmin authenticates the request and checks the caller is an admin,
+// writing the error response itself when they aren't.
+func (cfg *apiConfig) requireAdmin(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	userID, ok := cfg.requireSession(w, r)
+	if !ok {
+		return uuid.Nil, false
+	}
+	if !cfg.isAdmin(userID) {
+		respondWithError(w, http.StatusForbidden, "Admin access required", nil)
+		return uuid.Nil, false
+	}
+	return userID, true
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/google/uuid"
+)
+
+// API key scopes. A JWT carries every scope; an API key only the ones it
+// was created with.
+const (
+	scopeRead   = "read"
+	scopeWrite  = "write"
+	scopeUpload = "upload"
+	scopeDelete = "delete"
+)
+
+var validScopes = []string{scopeRead, scopeWrite, scopeUpload, scopeDelete}
+
+const apiKeyPrefix = "tubely_"
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// normalizeScopes validates and de-duplicates a requested scope list.
+func normalizeScopes(scopes []string) ([]string, error) {
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("at least one scope is required (%s)", strings.Join(validScopes, ", "))
+	}
+	var out []string
+	for _, scope := range scopes {
+		if !slices.Contains(validScopes, scope) {
+			return nil, fmt.Errorf("unknown scope %q (must be one of %s)", scope, strings.Join(validScopes, ", "))
+		}
+		if !slices.Contains(out, scope) {
+			out = append(out, scope)
+		}
+	}
+	return out, nil
+}
+
+// authenticate identifies the caller from either a Bearer JWT or an
+// "ApiKey" Authorization header, writing the error response itself when
+// it can't. API keys must also carry scope.
+func (cfg *apiConfig) authenticate(w http.ResponseWriter, r *http.Request, scope string) (uuid.UUID, bool) {
+	if strings.HasPrefix(r.Header.Get("Authorization"), "ApiKey ") {
+		key, err := auth.GetAPIKey(r.Header)
+		if err != nil {
+			respondWithError(w, http.StatusUnauthorized, "Couldn't find API key", err)
+			return uuid.Nil, false
+		}
+		apiKey, err := cfg.db.GetAPIKeyByHash(hashAPIKey(key))
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't look up API key", err)
+			return uuid.Nil, false
+		}
+		if apiKey.ID == uuid.Nil {
+			respondWithError(w, http.StatusUnauthorized, "Couldn't validate API key", nil)
+			return uuid.Nil, false
+		}
+		if !slices.Contains(apiKey.Scopes, scope) {
+			respondWithError(w, http.StatusForbidden, fmt.Sprintf("API key lacks the %q scope", scope), nil)
+			return uuid.Nil, false
+		}
+		return apiKey.UserID, true
+	}
+
+	return cfg.requireSession(w, r)
+}
+
+// requireSession authenticates with a JWT only. Key management goes
+// through here so an API key can't mint itself broader scopes.
+func (cfg *apiConfig) requireSession(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return uuid.Nil, false
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return uuid.Nil, false
+	}
+	return userID, true
+}
@@ -160,6 +160,11 @@ async function uploadVideoFile(videoID) {
       throw new Error(`Failed to upload video file. Error: ${data.error}`);
     }
 
+    if (res.status === 202) {
+      const job = await res.json();
+      console.log(`Video uploaded, processing as job ${job.job_id}`);
+      await waitForProcessing(job.status_url);
+    }
     console.log("Video uploaded!");
     await getVideo(videoID);
   } catch (error) {
@@ -167,6 +172,25 @@ async function uploadVideoFile(videoID) {
   }
 }
 
+async function waitForProcessing(statusURL) {
+  for (;;) {
+    const res = await fetch(statusURL, {
+      headers: {
+        Authorization: `Bearer ${localStorage.getItem("token")}`,
+      },
+    });
+    if (!res.ok) {
+      throw new Error("Failed to get processing status.");
+    }
+    const state = await res.json();
+    if (state.status === "ready") return;
+    if (state.status === "failed") {
+      throw new Error(`Processing failed: ${state.error}`);
+    }
+    await new Promise((resolve) => setTimeout(resolve, 2000));
+  }
+}
+
 async function getVideos() {
   try {
     const res = await fetch("/api/videos", {
@@ -180,7 +204,7 @@ async function getVideos() {
       throw new Error(`Failed to get videos. Error: ${data.error}`);
     }
 
-    const videos = await res.json();
+    const { items: videos } = await res.json();
     const videoList = document.getElementById("video-list");
     videoList.innerHTML = "";
     for (const video of videos) {
@@ -1,9 +1,12 @@
 package main
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/base64"
 	"fmt"
+	"log"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
@@ -16,21 +19,50 @@ func (cfg apiConfig) ensureAssetsDir() error {
 	return nil
 }
 
-func getAssetPath(mediaType string) string {
+func getAssetPath(mediaType string) (string, error) {
+	ext, err := mediaTypeToExt(mediaType)
+	if err != nil {
+		return "", err
+	}
 	bytes := make([]byte, 32)
-	_, err := rand.Read(bytes)
+	_, err = rand.Read(bytes)
 	if err != nil {
 		panic("failed to generate random bytes")
 	}
 	filename := base64.RawURLEncoding.EncodeToString(bytes)
-	ext := mediaTypeToExt(mediaType)
-	return fmt.Sprintf("%s%s", filename, ext)
+	return fmt.Sprintf("%s%s", filename, ext), nil
+}
+
+// versionedKey inserts a version suffix before the extension so every
+// upload of a video gets its own object and older ones stay addressable.
+func versionedKey(key string, version int) string {
+	ext := filepath.Ext(key)
+	return fmt.Sprintf("%s.v%d%s", strings.TrimSuffix(key, ext), version, ext)
 }
 
 func (cfg apiConfig) getObjectURL(key string) string {
-	//return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", cfg.s3Bucket, cfg.s3Region, key)
-	return fmt.Sprintf("%s/%s", cfg.s3CfDistribution, key)
-	//return fmt.Sprintf("%s,%s", cfg.s3Bucket, key)
+	return cfg.storage.ObjectURL(key)
+}
+
+// getVersionedObjectURL returns the object URL with the object's current
+// ETag as a query parameter. Objects such as generated thumbnails keep
+// their key when rewritten, so the changing parameter is what makes CDNs
+// and browsers fetch the new content. Without an ETag the plain URL is
+// returned.
+func (cfg *apiConfig) getVersionedObjectURL(ctx context.Context, key string) string {
+	objectURL := cfg.getObjectURL(key)
+	etag, err := cfg.objectETag(ctx, key)
+	if err != nil || etag == "" {
+		log.Printf("Serving %s without a content version: %v", key, err)
+		return objectURL
+	}
+	return objectURL + "?v=" + url.QueryEscape(etag)
+}
+
+// unversionedURL strips the content version added by getVersionedObjectURL.
+func unversionedURL(objectURL string) string {
+	base, _, _ := strings.Cut(objectURL, "?")
+	return base
 }
 
 func (cfg apiConfig) getAssetDiskPath(assetPath string) string {
@@ -41,10 +73,26 @@ func (cfg apiConfig) getAssetURL(assetPath string) string {
 	return fmt.Sprintf("http://localhost:%s/assets/%s", cfg.port, assetPath)
 }
 
-func mediaTypeToExt(mediaType string) string {
-	parts := strings.Split(mediaType, "/")
-	if len(parts) != 2 {
-		return ".bin"
+// mediaTypeExtensions pins the extension for the types uploads accept.
+// mime.ExtensionsByType can return several (".jpe", ".jpeg", ".jpg") and
+// its answer depends on the host's mime.types, so it isn't consulted and
+// keys are the same on every machine.
+var mediaTypeExtensions = map[string]string{
+	"video/mp4":        ".mp4",
+	"video/webm":       ".webm",
+	"video/quicktime":  ".mov",
+	"video/x-matroska": ".mkv",
+	"image/jpeg":       ".jpg",
+	"image/png":        ".png",
+	"image/webp":       ".webp",
+}
+
+// mediaTypeToExt returns the file extension for mediaType, or an error for
+// any type outside mediaTypeExtensions.
+func mediaTypeToExt(mediaType string) (string, error) {
+	ext, ok := mediaTypeExtensions[mediaType]
+	if !ok {
+		return "", fmt.Errorf("unsupported media type %q", mediaType)
 	}
-	return "." + parts[1]
+	return ext, nil
 }
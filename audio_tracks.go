@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const audioTrackFieldPrefix = "audio_"
+
+var languageCodePattern = regexp.MustCompile(`^[a-z]{2,3}$`)
+
+type audioTrack struct {
+	Language string
+	Path     string
+}
+
+// readAudioTracks spools every remaining audio_<lang> part (e.g. audio_es)
+// to a temp file. Other parts are discarded. Callers must remove the
+// returned files even when an error is returned.
+func readAudioTracks(parts *partReader) ([]audioTrack, error) {
+	tracks := []audioTrack{}
+	seen := map[string]bool{}
+	for {
+		part, err := parts.next()
+		if err == io.EOF {
+			return tracks, nil
+		}
+		if err != nil {
+			return tracks, err
+		}
+
+		language, isAudio := strings.CutPrefix(part.FormName(), audioTrackFieldPrefix)
+		if !isAudio {
+			if _, err := io.Copy(io.Discard, part); err != nil {
+				return tracks, err
+			}
+			continue
+		}
+		if !languageCodePattern.MatchString(language) {
+			return tracks, fmt.Errorf("invalid audio track language %q", language)
+		}
+		if seen[language] {
+			return tracks, fmt.Errorf("duplicate audio track for language %q", language)
+		}
+		seen[language] = true
+
+		tmp, err := os.CreateTemp("", "tubely-audio-*")
+		if err != nil {
+			return tracks, err
+		}
+		tracks = append(tracks, audioTrack{Language: language, Path: tmp.Name()})
+		_, err = io.Copy(tmp, part)
+		tmp.Close()
+		if err != nil {
+			return tracks, err
+		}
+	}
+}
+
+func removeAudioTracks(tracks []audioTrack) {
+	for _, track := range tracks {
+		os.Remove(track.Path)
+	}
+}
+
+// muxAudioTracks adds each track to the video as an extra AAC audio stream
+// tagged with its language, keeping the original video and audio streams.
+// It returns the path of the new file.
+func (cfg *apiConfig) muxAudioTracks(ctx context.Context, filePath string, originalLanguage string, hasAudio bool, tracks []audioTrack) (string, error) {
+	ctx, cancel := cfg.withCommandTimeout(ctx)
+	defer cancel()
+	outputPath := fmt.Sprintf("%s.muxed.mp4", filePath)
+	args := []string{"-i", filePath}
+	for _, track := range tracks {
+		args = append(args, "-i", track.Path)
+	}
+	args = append(args, "-map", "0:v")
+	audioIndex := 0
+	var metadata []string
+	if hasAudio {
+		args = append(args, "-map", "0:a")
+		metadata = append(metadata, "-metadata:s:a:0", "language="+originalLanguage)
+		audioIndex++
+	}
+	for i, track := range tracks {
+		args = append(args, "-map", strconv.Itoa(i+1)+":a:0")
+		metadata = append(metadata, "-metadata:s:a:"+strconv.Itoa(audioIndex), "language="+track.Language)
+		audioIndex++
+	}
+	args = append(args, "-c:v", "copy", "-c:a", "aac")
+	args = append(args, metadata...)
+	args = append(args, "-y", outputPath)
+
+	cmd := cfg.ffmpegCommand(ctx, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		os.Remove(outputPath)
+		return "", commandFailed(ctx, "error muxing audio tracks", stderr.String(), err)
+	}
+	return outputPath, nil
+}
+
+// audioLanguageOrUnd returns the primary audio language from a track list.
+func audioLanguageOrUnd(languages []string) string {
+	if len(languages) == 0 {
+		return undeterminedLanguage
+	}
+	return languages[0]
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func TestUploadWithAudioTracksReportsLanguages(t *testing.T) {
+	cfg := newTestConfig(t)
+	media := &fakeMedia{Width: 1920, Height: 1080}
+	installFakeMedia(t, media)
+	userID := createTestUser(t, cfg)
+	video := createTestVideo(t, cfg, userID, visibilityPublic)
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", `form-data; name="video"; filename="clip.mp4"`)
+	header.Set("Content-Type", "video/mp4")
+	part, err := mw.CreatePart(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(testMP4(512, 0))
+	for _, lang := range []string{"es", "fr"} {
+		part, err := mw.CreateFormFile(audioTrackFieldPrefix+lang, lang+".m4a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write([]byte("audio " + lang))
+	}
+	mw.Close()
+
+	req := newAuthedRequest(t, http.MethodPost, "/api/video_upload/"+video.ID.String(), &body, userID)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.SetPathValue("videoID", video.ID.String())
+	rec := httptest.NewRecorder()
+	cfg.handlerUploadVideo(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body)
+	}
+
+	got := decodeJSON[database.Video](t, rec)
+	if want := []string{"es", "fr"}; !slices.Equal(got.AudioLanguages, want) {
+		t.Errorf("audio languages = %q, want %q", got.AudioLanguages, want)
+	}
+	var muxed []string
+	for _, args := range media.ffmpegRuns(t) {
+		if slices.Contains(args, "-metadata:s:a:0") {
+			muxed = args
+		}
+	}
+	if muxed == nil {
+		t.Fatal("no ffmpeg run muxed the audio tracks")
+	}
+	for i, want := range []string{"language=es", "language=fr"} {
+		flag := slices.Index(muxed, "-metadata:s:a:"+strconv.Itoa(i))
+		if flag < 0 || muxed[flag+1] != want {
+			t.Errorf("mux args %q don't tag stream %d with %s", muxed, i, want)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+
+	"github.com/buckket/go-blurhash"
+)
+
+const (
+	blurhashXComponents = 4
+	blurhashYComponents = 3
+)
+
+// computeBlurhash encodes an image file as a BlurHash placeholder string.
+func computeBlurhash(imagePath string) (string, error) {
+	f, err := os.Open(imagePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return "", fmt.Errorf("could not decode image: %v", err)
+	}
+	hash, err := blurhash.Encode(blurhashXComponents, blurhashYComponents, img)
+	if err != nil {
+		return "", fmt.Errorf("could not encode blurhash: %v", err)
+	}
+	return hash, nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/buckket/go-blurhash"
+)
+
+func TestComputeBlurhashIsDecodable(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 64, 36))
+	for y := range 36 {
+		for x := range 64 {
+			img.Set(x, y, color.RGBA{R: uint8(x * 4), G: uint8(y * 7), B: 128, A: 255})
+		}
+	}
+	path := filepath.Join(t.TempDir(), "thumbnail.jpg")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := jpeg.Encode(f, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	hash, err := computeBlurhash(path)
+	if err != nil {
+		t.Fatalf("computeBlurhash: %v", err)
+	}
+	if hash == "" {
+		t.Fatal("got an empty blurhash")
+	}
+	decoded, err := blurhash.Decode(hash, 32, 18, 1)
+	if err != nil {
+		t.Fatalf("blurhash %q doesn't decode: %v", hash, err)
+	}
+	if b := decoded.Bounds(); b.Dx() != 32 || b.Dy() != 18 {
+		t.Errorf("decoded to %v, want 32x18", b)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// stallDeadlineReader pushes the connection's read deadline forward before
+// every read, so a slow but steady client can take as long as it needs while
+// one that stops sending bytes is cut off after the timeout.
+type stallDeadlineReader struct {
+	body    io.ReadCloser
+	rc      *http.ResponseController
+	timeout time.Duration
+}
+
+func newStallDeadlineReader(w http.ResponseWriter, body io.ReadCloser, timeout time.Duration) io.ReadCloser {
+	if timeout <= 0 {
+		return body
+	}
+	return &stallDeadlineReader{body: body, rc: http.NewResponseController(w), timeout: timeout}
+}
+
+func (s *stallDeadlineReader) Read(p []byte) (int, error) {
+	// Not every ResponseWriter supports deadlines; reading without one is
+	// still correct, just unprotected.
+	_ = s.rc.SetReadDeadline(time.Now().Add(s.timeout))
+	return s.body.Read(p)
+}
+
+func (s *stallDeadlineReader) Close() error {
+	return s.body.Close()
+}
+
+// clearBodyDeadline removes the per-read deadline once the body has been
+// consumed so it doesn't apply to processing that follows.
+func clearBodyDeadline(w http.ResponseWriter) {
+	_ = http.NewResponseController(w).SetReadDeadline(time.Time{})
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+var errNoCaptionTool = errors.New("no speech-to-text tool configured")
+
+func captionKey(videoID uuid.UUID, language string) string {
+	return fmt.Sprintf("captions/%s/%s.vtt", videoID, language)
+}
+
+// extractCaptionAudio writes the full audio track as 16 kHz mono WAV, the
+// format most speech-to-text tools expect.
+func (cfg *apiConfig) extractCaptionAudio(ctx context.Context, filePath string) (string, error) {
+	ctx, cancel := cfg.withCommandTimeout(ctx)
+	defer cancel()
+	out, err := os.CreateTemp("", "tubely-caption-*.wav")
+	if err != nil {
+		return "", err
+	}
+	out.Close()
+
+	var stderr bytes.Buffer
+	cmd := cfg.ffmpegCommand(ctx, "-y", "-i", filePath, "-vn", "-ac", "1", "-ar", "16000", out.Name())
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		os.Remove(out.Name())
+		return "", commandFailed(ctx, "error extracting audio for captions", stderr.String(), err)
+	}
+	return out.Name(), nil
+}
+
+// transcribeToVTT runs the configured tool as `<cmd> <wav> [language]` and
+// expects a WebVTT document on stdout.
+func (cfg *apiConfig) transcribeToVTT(wavPath, language string) ([]byte, error) {
+	if cfg.captionCmd == "" {
+		return nil, errNoCaptionTool
+	}
+	args := []string{wavPath}
+	if language != undeterminedLanguage {
+		args = append(args, language)
+	}
+	var out, stderr bytes.Buffer
+	cmd := exec.Command(cfg.captionCmd, args...)
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("speech-to-text failed: %s, %v", stderr.String(), err)
+	}
+	vtt := out.Bytes()
+	if !strings.HasPrefix(strings.TrimPrefix(string(vtt), "\ufeff"), "WEBVTT") {
+		return nil, errors.New("speech-to-text output isn't WebVTT")
+	}
+	return vtt, nil
+}
+
+// startAutoCaption extracts the audio from filePath right away, since the
+// caller removes its temp files when it returns, and then transcribes and
+// stores the captions in the background. Nothing here fails the upload:
+// videos without audio are skipped and tool errors are only logged.
+func (cfg *apiConfig) startAutoCaption(ctx context.Context, video database.Video, filePath string, hasAudio bool) {
+	if !hasAudio {
+		log.Printf("Skipping captions for video %s: no audio", video.ID)
+		return
+	}
+	if cfg.captionCmd == "" {
+		log.Printf("Skipping captions for video %s: %v", video.ID, errNoCaptionTool)
+		return
+	}
+	wavPath, err := cfg.extractCaptionAudio(ctx, filePath)
+	if err != nil {
+		log.Printf("Skipping captions for video %s: %v", video.ID, err)
+		return
+	}
+
+	go func() {
+		defer os.Remove(wavPath)
+		if err := cfg.generateCaptions(video, wavPath); err != nil {
+			log.Printf("Couldn't generate captions for video %s: %v", video.ID, err)
+		}
+	}()
+}
+
+func (cfg *apiConfig) generateCaptions(video database.Video, wavPath string) error {
+	language := video.AudioLanguage
+	if language == "" {
+		language = undeterminedLanguage
+	}
+	vtt, err := cfg.transcribeToVTT(wavPath, language)
+	if err != nil {
+		return err
+	}
+
+	key := captionKey(video.ID, language)
+	if err := cfg.putVideoObject(context.Background(), key, bytes.NewReader(vtt), "text/vtt"); err != nil {
+		return err
+	}
+	return cfg.db.UpsertVideoCaption(database.VideoCaption{
+		VideoID:   video.ID,
+		Language:  language,
+		Key:       key,
+		URL:       cfg.getVersionedObjectURL(context.Background(), key),
+		Generated: true,
+	})
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// fakeSTTScript prints a one-cue WebVTT naming the language it was given.
+const fakeSTTScript = `#!/bin/sh
+printf 'WEBVTT\n\n00:00.000 --> 00:01.000\nhello in %s\n' "$2"
+`
+
+func TestAutoCaptionStoresVTT(t *testing.T) {
+	cfg := newTestConfig(t)
+	installFakeMedia(t, &fakeMedia{Width: 1920, Height: 1080, AudioLanguages: []string{"en"}})
+	cfg.captionCmd = filepath.Join(t.TempDir(), "stt")
+	if err := os.WriteFile(cfg.captionCmd, []byte(fakeSTTScript), 0755); err != nil {
+		t.Fatal(err)
+	}
+	userID := createTestUser(t, cfg)
+	video := createTestVideo(t, cfg, userID, visibilityPublic)
+
+	req := uploadRequest(t, video.ID, userID, testMP4(512, 0), "video/mp4")
+	req.URL.RawQuery = "autocaption=true"
+	rec := httptest.NewRecorder()
+	cfg.handlerUploadVideo(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("upload: got status %d: %s", rec.Code, rec.Body)
+	}
+
+	// Transcription runs in the background after the response.
+	var captions []database.VideoCaption
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		var err error
+		captions, err = cfg.db.GetVideoCaptions(video.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(captions) > 0 {
+			break
+		}
+	}
+	if len(captions) != 1 {
+		t.Fatalf("got %d captions, want 1", len(captions))
+	}
+	caption := captions[0]
+	if caption.Language != "en" || !caption.Generated || caption.Key != captionKey(video.ID, "en") {
+		t.Errorf("caption = %+v, want a generated en track", caption)
+	}
+	if vtt := string(getTestObject(t, cfg, caption.Key)); !strings.HasPrefix(vtt, "WEBVTT") || !strings.Contains(vtt, "hello in en") {
+		t.Errorf("stored VTT = %q", vtt)
+	}
+}
+
+func TestAutoCaptionSkippedGracefully(t *testing.T) {
+	tests := []struct {
+		name      string
+		languages []string
+		tool      bool
+	}{
+		{"no audio", nil, true},
+		{"no tool", []string{"en"}, false},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestConfig(t)
+			installFakeMedia(t, &fakeMedia{Width: 1920, Height: 1080, AudioLanguages: tt.languages})
+			if tt.tool {
+				cfg.captionCmd = filepath.Join(t.TempDir(), "stt")
+				if err := os.WriteFile(cfg.captionCmd, []byte(fakeSTTScript), 0755); err != nil {
+					t.Fatal(err)
+				}
+			}
+			userID := createTestUser(t, cfg)
+			video := createTestVideo(t, cfg, userID, visibilityPublic)
+
+			req := uploadRequest(t, video.ID, userID, testMP4(512, byte(i)), "video/mp4")
+			req.URL.RawQuery = "autocaption=true"
+			rec := httptest.NewRecorder()
+			cfg.handlerUploadVideo(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("upload: got status %d: %s", rec.Code, rec.Body)
+			}
+			captions, err := cfg.db.GetVideoCaptions(video.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(captions) != 0 {
+				t.Errorf("got captions %+v, want none", captions)
+			}
+		})
+	}
+}
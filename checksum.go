@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// checksumHeader lets a client send the SHA-256 of the video it uploads,
+// as hex or base64 like S3's x-amz-checksum-sha256.
+const checksumHeader = "X-Content-SHA256"
+
+var errChecksumMismatch = errors.New("checksum mismatch")
+
+// parseExpectedChecksum returns the digest in a checksum header as
+// lowercase hex, or "" when the header wasn't sent.
+func parseExpectedChecksum(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", nil
+	}
+	if sum, err := hex.DecodeString(value); err == nil && len(sum) == sha256.Size {
+		return hex.EncodeToString(sum), nil
+	}
+	if sum, err := base64.StdEncoding.DecodeString(value); err == nil && len(sum) == sha256.Size {
+		return hex.EncodeToString(sum), nil
+	}
+	return "", errors.New("expected a hex or base64 SHA-256 digest")
+}
+
+// fileSHA256 returns the hex SHA-256 of the file at path.
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// checksumBase64 converts a hex digest to the base64 form S3 expects.
+func checksumBase64(sum string) (string, error) {
+	raw, err := hex.DecodeString(sum)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(raw), nil
+}
+
+// existingObjectFor returns the key of an object the user already stores
+// with digest sum, so an identical upload can point at it instead of
+// storing a second copy. It returns "" when there's nothing to reuse: no
+// match, a match whose object has gone missing, or one that doesn't share
+// key's quarantine status and so would carry the wrong expiry tag.
+func (cfg *apiConfig) existingObjectFor(ctx context.Context, userID uuid.UUID, sum, key string) (string, error) {
+	existing, err := cfg.db.GetVersionKeyBySHA256(userID, sum)
+	if err != nil || existing == "" {
+		return "", err
+	}
+	if isQuarantineKey(existing) != isQuarantineKey(key) {
+		return "", nil
+	}
+	exists, err := cfg.objectExists(ctx, existing)
+	if err != nil || !exists {
+		return "", err
+	}
+	return existing, nil
+}
+
+// deleteUnsharedObject deletes key unless a version outside excludeVideoID
+// still points at it, as deduplicated uploads share objects.
+func (cfg *apiConfig) deleteUnsharedObject(ctx context.Context, key string, excludeVideoID uuid.UUID) error {
+	refs, err := cfg.db.CountKeyReferences(key, excludeVideoID)
+	if err != nil {
+		return err
+	}
+	if refs > 0 {
+		return nil
+	}
+	return cfg.deleteObject(ctx, key)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func TestParseExpectedChecksum(t *testing.T) {
+	sum := sha256.Sum256([]byte("video"))
+	want := hex.EncodeToString(sum[:])
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{"", "", false},
+		{want, want, false},
+		{strings.ToUpper(want), want, false},
+		{base64.StdEncoding.EncodeToString(sum[:]), want, false},
+		{want[:32], "", true},
+		{"not a digest", "", true},
+	}
+	for _, tt := range tests {
+		got, err := parseExpectedChecksum(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseExpectedChecksum(%q) = %q, %v; want %q, error %v", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestDuplicateUploadSkipsPut(t *testing.T) {
+	cfg, fake := newTestS3Config(t, "tubely", "")
+	installFakeMedia(t, &fakeMedia{Width: 1920, Height: 1080})
+	userID := createTestUser(t, cfg)
+	body := testMP4(1024, 0)
+	sum := sha256.Sum256(body)
+
+	var keys []string
+	for range 2 {
+		video := createTestVideo(t, cfg, userID, visibilityPublic)
+		rec := uploadTestVideo(t, cfg, video.ID, userID, body)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("upload: got status %d: %s", rec.Code, rec.Body)
+		}
+		if got := decodeJSON[database.Video](t, rec); got.SHA256 != hex.EncodeToString(sum[:]) {
+			t.Errorf("stored hash %q, want the file's SHA-256", got.SHA256)
+		}
+		keys = append(keys, latestVersionKey(t, cfg, video.ID))
+	}
+	if keys[0] != keys[1] {
+		t.Fatalf("identical uploads stored at %s and %s, want one shared key", keys[0], keys[1])
+	}
+	puts := 0
+	for _, req := range fake.requestLog() {
+		if req == "PUT tubely/"+keys[0] {
+			puts++
+		}
+	}
+	if puts != 1 {
+		t.Errorf("object was put %d times, want once", puts)
+	}
+
+	other := createTestUser(t, cfg)
+	video := createTestVideo(t, cfg, other, visibilityPublic)
+	if rec := uploadTestVideo(t, cfg, video.ID, other, body); rec.Code != http.StatusOK {
+		t.Fatalf("other user's upload: got status %d: %s", rec.Code, rec.Body)
+	}
+	if key := latestVersionKey(t, cfg, video.ID); key == keys[0] {
+		t.Error("another user's identical upload reused the first user's object")
+	}
+}
+
+func TestUploadVerifiesClientChecksum(t *testing.T) {
+	cfg := newTestConfig(t)
+	installFakeMedia(t, &fakeMedia{Width: 1920, Height: 1080})
+	userID := createTestUser(t, cfg)
+	body := testMP4(1024, 0)
+	sum := sha256.Sum256(body)
+	wrong := sha256.Sum256([]byte("something else"))
+
+	tests := []struct {
+		name   string
+		header string
+		want   int
+	}{
+		{"mismatch", hex.EncodeToString(wrong[:]), http.StatusBadRequest},
+		{"malformed", "abc", http.StatusBadRequest},
+		{"match", base64.StdEncoding.EncodeToString(sum[:]), http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			video := createTestVideo(t, cfg, userID, visibilityPublic)
+			req := uploadRequest(t, video.ID, userID, body, "video/mp4")
+			req.Header.Set(checksumHeader, tt.header)
+			rec := httptest.NewRecorder()
+			cfg.handlerUploadVideo(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("got status %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+			if tt.want == http.StatusOK {
+				return
+			}
+			versions, err := cfg.db.GetVideoVersions(video.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(versions) != 0 {
+				t.Errorf("rejected upload stored %d versions", len(versions))
+			}
+		})
+	}
+}
+
+func TestLocalPutRejectsChecksumMismatch(t *testing.T) {
+	cfg := newTestConfig(t)
+	ctx := context.Background()
+	wrong := sha256.Sum256([]byte("something else"))
+	if err := cfg.storage.Put(ctx, "landscape/a.mp4", bytes.NewReader([]byte("video")), "video/mp4", hex.EncodeToString(wrong[:])); err == nil {
+		t.Fatal("Put with the wrong checksum succeeded")
+	}
+	if ok, _ := cfg.objectExists(ctx, "landscape/a.mp4"); ok {
+		t.Error("object was kept despite the checksum mismatch")
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var errUnsupportedContentEncoding = errors.New("unsupported content encoding")
+
+var contentDecoders = map[string]func(io.Reader) (io.ReadCloser, error){
+	"gzip": func(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) },
+	"deflate": func(r io.Reader) (io.ReadCloser, error) {
+		return zlib.NewReader(r)
+	},
+}
+
+func parseContentEncodings(header string) []string {
+	var encodings []string
+	for _, enc := range strings.Split(header, ",") {
+		enc = strings.ToLower(strings.TrimSpace(enc))
+		if enc == "" || enc == "identity" {
+			continue
+		}
+		if enc == "x-gzip" {
+			enc = "gzip"
+		}
+		encodings = append(encodings, enc)
+	}
+	return encodings
+}
+
+// decodeContentEncoding undoes a Content-Encoding header value on body.
+// Encodings are listed in the order they were applied, so they are removed
+// last to first. Anything not in both the decoder table and the configured
+// allowlist fails with errUnsupportedContentEncoding.
+func (cfg *apiConfig) decodeContentEncoding(body io.Reader, header string) (io.Reader, error) {
+	encodings := parseContentEncodings(header)
+	for i := len(encodings) - 1; i >= 0; i-- {
+		enc := encodings[i]
+		decoder, ok := contentDecoders[enc]
+		if !ok || !cfg.uploadEncodings[enc] {
+			return nil, fmt.Errorf("%w: %s", errUnsupportedContentEncoding, enc)
+		}
+		decoded, err := decoder(body)
+		if err != nil {
+			return nil, fmt.Errorf("could not decode %s body: %w", enc, err)
+		}
+		body = decoded
+	}
+	return body, nil
+}
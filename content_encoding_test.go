@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestUploadDecodesContentEncoding(t *testing.T) {
+	cfg := newTestConfig(t)
+	installFakeMedia(t, &fakeMedia{Width: 1920, Height: 1080})
+	userID := createTestUser(t, cfg)
+	video := createTestVideo(t, cfg, userID, visibilityPublic)
+
+	body := testMP4(2048, 0)
+	req := uploadRequest(t, video.ID, userID, body, "video/mp4")
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	if _, err := io.Copy(zw, req.Body); err != nil {
+		t.Fatal(err)
+	}
+	zw.Close()
+	req.Body = io.NopCloser(&compressed)
+	req.ContentLength = int64(compressed.Len())
+	req.Header.Set("Content-Encoding", "gzip")
+
+	rec := httptest.NewRecorder()
+	cfg.handlerUploadVideo(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body)
+	}
+	if stored := getTestObject(t, cfg, latestVersionKey(t, cfg, video.ID)); !bytes.Equal(stored, body) {
+		t.Error("stored object isn't the decompressed upload")
+	}
+}
+
+func TestUploadRejectsUnsupportedContentEncoding(t *testing.T) {
+	cfg := newTestConfig(t)
+	userID := createTestUser(t, cfg)
+	video := createTestVideo(t, cfg, userID, visibilityPublic)
+
+	for _, encoding := range []string{"br", "gzip, zstd"} {
+		req := uploadRequest(t, video.ID, userID, testMP4(256, 0), "video/mp4")
+		req.Header.Set("Content-Encoding", encoding)
+		rec := httptest.NewRecorder()
+		cfg.handlerUploadVideo(rec, req)
+		if rec.Code != http.StatusUnsupportedMediaType {
+			t.Errorf("Content-Encoding %q: got status %d, want 415", encoding, rec.Code)
+		}
+	}
+
+	cfg.uploadEncodings = map[string]bool{}
+	req := uploadRequest(t, video.ID, userID, testMP4(256, 0), "video/mp4")
+	req.Header.Set("Content-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	cfg.handlerUploadVideo(rec, req)
+	if rec.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("gzip outside the allowlist: got status %d, want 415", rec.Code)
+	}
+}
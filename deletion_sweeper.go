@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+const (
+	defaultDeleteGracePeriod   = 24 * time.Hour
+	defaultDeleteSweepInterval = time.Minute
+)
+
+// hardDeleteVideo removes a video's stored objects and then its rows. The
+// rows go last so a failed object delete is retried on the next sweep.
+func (cfg *apiConfig) hardDeleteVideo(ctx context.Context, video database.Video) error {
+	versions, err := cfg.db.GetVideoVersions(video.ID)
+	if err != nil {
+		return err
+	}
+	for _, version := range versions {
+		if err := cfg.deleteUnsharedObject(ctx, version.Key, video.ID); err != nil {
+			return err
+		}
+	}
+	captions, err := cfg.db.GetVideoCaptions(video.ID)
+	if err != nil {
+		return err
+	}
+	for _, caption := range captions {
+		if err := cfg.deleteObject(ctx, caption.Key); err != nil {
+			return err
+		}
+	}
+	if err := cfg.deleteObject(ctx, cfg.thumbnailKey(video.ID)); err != nil {
+		return err
+	}
+	if err := cfg.deleteObjectPrefix(ctx, cfg.uploadedThumbnailPrefix(video.ID)); err != nil {
+		return err
+	}
+	if err := cfg.deleteObjectPrefix(ctx, cfg.hlsPrefix(video.ID)); err != nil {
+		return err
+	}
+	if video.ThumbnailURL != nil {
+		if path, err := cfg.thumbnailDiskPath(*video.ThumbnailURL); err == nil {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to delete thumbnail: %v", err)
+			}
+		}
+	}
+	return cfg.db.DeleteVideo(video.ID)
+}
+
+// sweepDeletedVideos hard-deletes every video whose grace period has run
+// out.
+func (cfg *apiConfig) sweepDeletedVideos(ctx context.Context) {
+	videos, err := cfg.db.GetVideosDeletedBefore(cfg.now().UTC().Add(-cfg.deleteGracePeriod))
+	if err != nil {
+		log.Printf("Couldn't list deleted videos: %v", err)
+		return
+	}
+	for _, video := range videos {
+		if err := cfg.hardDeleteVideo(ctx, video); err != nil {
+			log.Printf("Couldn't hard-delete video %s: %v", video.ID, err)
+		}
+	}
+}
+
+func (cfg *apiConfig) runDeletionSweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			cfg.sweepDeletedVideos(ctx)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func videoActionRequest(t *testing.T, method, suffix string, videoID, userID uuid.UUID) *http.Request {
+	t.Helper()
+	req := newAuthedRequest(t, method, "/api/videos/"+videoID.String()+suffix, nil, userID)
+	req.SetPathValue("videoID", videoID.String())
+	return req
+}
+
+func TestSoftDeleteAndUndelete(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.deleteGracePeriod = time.Hour
+	now := time.Date(2026, 5, 1, 9, 0, 0, 0, time.UTC)
+	setTestClock(cfg, func() time.Time { return now })
+	userID := createTestUser(t, cfg)
+	video := createTestVideo(t, cfg, userID, visibilityPublic)
+	key := storeTestVersion(t, cfg, video.ID, testMP4(64, 0))
+
+	rec := httptest.NewRecorder()
+	cfg.handlerVideoMetaDelete(rec, videoActionRequest(t, http.MethodDelete, "", video.ID, userID))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("delete: got status %d: %s", rec.Code, rec.Body)
+	}
+	if got := decodeJSON[page[database.Video]](t, listVideos(t, cfg, userID, "")); got.Total != 0 {
+		t.Errorf("listing after delete has %d videos, want 0", got.Total)
+	}
+	rec = httptest.NewRecorder()
+	cfg.handlerVideoGet(rec, videoActionRequest(t, http.MethodGet, "", video.ID, userID))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("get after delete: got status %d, want 404", rec.Code)
+	}
+	if _, err := cfg.storage.Stat(context.Background(), key); err != nil {
+		t.Errorf("object gone straight after a soft delete: %v", err)
+	}
+
+	now = now.Add(30 * time.Minute)
+	rec = httptest.NewRecorder()
+	cfg.handlerVideoUndelete(rec, videoActionRequest(t, http.MethodPost, "/undelete", video.ID, userID))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("undelete within the window: got status %d: %s", rec.Code, rec.Body)
+	}
+	if got := decodeJSON[page[database.Video]](t, listVideos(t, cfg, userID, "")); got.Total != 1 {
+		t.Errorf("listing after undelete has %d videos, want 1", got.Total)
+	}
+
+	rec = httptest.NewRecorder()
+	cfg.handlerVideoMetaDelete(rec, videoActionRequest(t, http.MethodDelete, "", video.ID, userID))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("second delete: got status %d: %s", rec.Code, rec.Body)
+	}
+	now = now.Add(2 * time.Hour)
+	rec = httptest.NewRecorder()
+	cfg.handlerVideoUndelete(rec, videoActionRequest(t, http.MethodPost, "/undelete", video.ID, userID))
+	if rec.Code != http.StatusGone {
+		t.Errorf("undelete after the window: got status %d, want 410", rec.Code)
+	}
+}
+
+func TestDeletionSweeperHardDeletesAfterWindow(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.deleteGracePeriod = time.Hour
+	now := time.Date(2026, 5, 1, 9, 0, 0, 0, time.UTC)
+	setTestClock(cfg, func() time.Time { return now })
+	userID := createTestUser(t, cfg)
+	video := createTestVideo(t, cfg, userID, visibilityPublic)
+	key := storeTestVersion(t, cfg, video.ID, testMP4(64, 0))
+	if err := cfg.db.SoftDeleteVideo(video.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	now = now.Add(59 * time.Minute)
+	cfg.sweepDeletedVideos(context.Background())
+	if got, err := cfg.db.GetVideoIncludingDeleted(video.ID); err != nil || got.ID == uuid.Nil {
+		t.Fatalf("video swept inside the grace period (err %v)", err)
+	}
+
+	now = now.Add(2 * time.Minute)
+	cfg.sweepDeletedVideos(context.Background())
+	if got, err := cfg.db.GetVideoIncludingDeleted(video.ID); err != nil || got.ID != uuid.Nil {
+		t.Errorf("video row still there after the grace period (err %v)", err)
+	}
+	if _, err := cfg.storage.Stat(context.Background(), key); !errors.Is(err, errObjectNotFound) {
+		t.Errorf("Stat of swept object = %v, want errObjectNotFound", err)
+	}
+}
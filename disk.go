@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"syscall"
+)
+
+// freeDiskPercent reports how much of the volume holding dir is available
+// to unprivileged writers, as a percentage of its total size.
+func freeDiskPercent(dir string) (float64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return 0, fmt.Errorf("failed to stat %s: %v", dir, err)
+	}
+	if st.Blocks == 0 {
+		return 0, fmt.Errorf("%s reports a zero-sized volume", dir)
+	}
+	return float64(st.Bavail) / float64(st.Blocks) * 100, nil
+}
+
+// rejectLowDisk responds 503 when the temp volume uploads are spooled to
+// has less free space than cfg.minFreeDiskPercent. A threshold of 0
+// disables the check.
+func (cfg *apiConfig) rejectLowDisk(w http.ResponseWriter) bool {
+	if cfg.minFreeDiskPercent <= 0 {
+		return false
+	}
+	free, err := freeDiskPercent(os.TempDir())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check free disk space", err)
+		return true
+	}
+	if free < cfg.minFreeDiskPercent {
+		msg := fmt.Sprintf("Server is low on disk space (%.1f%% free, %.1f%% required); try again later", free, cfg.minFreeDiskPercent)
+		respondWithError(w, http.StatusServiceUnavailable, msg, nil)
+		return true
+	}
+	return false
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestUploadRejectedOnLowDisk(t *testing.T) {
+	free, err := freeDiskPercent(os.TempDir())
+	if err != nil {
+		t.Fatalf("freeDiskPercent: %v", err)
+	}
+	cfg := newTestConfig(t)
+	installFakeMedia(t, &fakeMedia{Width: 1920, Height: 1080})
+	userID := createTestUser(t, cfg)
+	video := createTestVideo(t, cfg, userID, visibilityPublic)
+
+	// Require a little more than the temp volume has, whatever that is.
+	cfg.minFreeDiskPercent = free + 1
+	rec := uploadTestVideo(t, cfg, video.ID, userID, testMP4(256, 0))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("got status %d, want 503: %s", rec.Code, rec.Body)
+	}
+	if !strings.Contains(rec.Body.String(), "low on disk space") {
+		t.Errorf("body %q doesn't explain the rejection", rec.Body)
+	}
+
+	if free > 0 {
+		cfg.minFreeDiskPercent = free / 2
+		if rec := uploadTestVideo(t, cfg, video.ID, userID, testMP4(256, 1)); rec.Code != http.StatusOK {
+			t.Errorf("with enough headroom: got status %d: %s", rec.Code, rec.Body)
+		}
+	}
+}
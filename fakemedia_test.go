@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// fakeMedia stands in for ffprobe and ffmpeg so the upload pipeline can run
+// without them. ffprobe reports the fields below; ffmpeg copies its input
+// to its output, writes a Thumb-sized JPEG for .jpg outputs and logs every
+// run. Fields are read when install or update is called.
+type fakeMedia struct {
+	Width          int
+	Height         int
+	Duration       float64
+	StreamDuration float64
+	FormatName     string
+	MajorBrand     string
+	PixFmt         string
+	AudioLanguages []string
+	// Packets is the pts_time,flags listing returned for keyframe scans.
+	Packets string
+	// FailCopy makes stream-copy remuxes fail, as for incompatible codecs.
+	FailCopy bool
+	// Thumb is the size of the JPEG written for thumbnail runs.
+	Thumb image.Point
+	// Rotated gives the source 90 degree rotation metadata: thumbnail runs
+	// with -autorotate write Thumb with its sides swapped, as the player
+	// would display it.
+	Rotated bool
+	// ReencodeSize, when set, truncates the output of bitrate-targeted
+	// (-b:v) runs to that many bytes, as a shrinking re-encode would.
+	ReencodeSize int
+
+	dir string
+}
+
+const fakeFFmpegScript = `#!/bin/sh
+dir=$(dirname "$0")
+printf '%s\t' "$@" >> "$dir/ffmpeg.log"
+echo >> "$dir/ffmpeg.log"
+in=""
+prev=""
+out=""
+for a in "$@"; do
+	if [ "$prev" = "-i" ] && [ -z "$in" ]; then in="$a"; fi
+	prev="$a"
+	out="$a"
+done
+if [ -f "$dir/fail-copy" ]; then
+	case " $* " in *" -c copy "*) exit 1;; esac
+fi
+if [ -f "$dir/reencode-size" ]; then
+	case " $* " in *" -b:v "*) head -c "$(cat "$dir/reencode-size")" "$in" > "$out"; exit 0;; esac
+fi
+case "$out" in
+*.jpg|*.jpeg)
+	case " $* " in
+	*" -autorotate "*) cp "$dir/thumb-display.jpg" "$out" ;;
+	*) cp "$dir/thumb.jpg" "$out" ;;
+	esac ;;
+*) cp "$in" "$out" ;;
+esac
+`
+
+const fakeFFprobeScript = `#!/bin/sh
+dir=$(dirname "$0")
+case " $* " in
+*" packet=pts_time,flags "*) cat "$dir/packets.csv" ;;
+*) cat "$dir/probe.json" ;;
+esac
+`
+
+// installFakeMedia puts fake ffmpeg and ffprobe first on PATH for the rest
+// of the test.
+func installFakeMedia(t *testing.T, m *fakeMedia) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake media tools are shell scripts")
+	}
+	m.dir = t.TempDir()
+	for name, script := range map[string]string{"ffmpeg": fakeFFmpegScript, "ffprobe": fakeFFprobeScript} {
+		if err := os.WriteFile(filepath.Join(m.dir, name), []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", m.dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	m.update(t)
+}
+
+// update rewrites what the fake tools report from m's fields.
+func (m *fakeMedia) update(t *testing.T) {
+	t.Helper()
+	if m.FormatName == "" {
+		m.FormatName = "mov,mp4,m4a,3gp,3g2,mj2"
+	}
+	if m.MajorBrand == "" {
+		m.MajorBrand = "mp42"
+	}
+	if m.PixFmt == "" {
+		m.PixFmt = "yuv420p"
+	}
+	if m.Duration == 0 {
+		m.Duration = 10
+	}
+	if m.StreamDuration == 0 {
+		m.StreamDuration = m.Duration
+	}
+	if m.Thumb == (image.Point{}) {
+		m.Thumb = image.Pt(64, 36)
+	}
+
+	streams := []map[string]any{{
+		"codec_type":     "video",
+		"codec_name":     "h264",
+		"pix_fmt":        m.PixFmt,
+		"width":          m.Width,
+		"height":         m.Height,
+		"duration":       fmt.Sprintf("%.3f", m.StreamDuration),
+		"avg_frame_rate": "30/1",
+		"r_frame_rate":   "30/1",
+	}}
+	for _, lang := range m.AudioLanguages {
+		streams = append(streams, map[string]any{
+			"codec_type": "audio",
+			"codec_name": "aac",
+			"tags":       map[string]string{"language": lang},
+		})
+	}
+	probe, err := json.Marshal(map[string]any{
+		"streams": streams,
+		"format": map[string]any{
+			"duration":    fmt.Sprintf("%.3f", m.Duration),
+			"bit_rate":    "1000000",
+			"format_name": m.FormatName,
+			"tags":        map[string]string{"major_brand": m.MajorBrand},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	display := m.Thumb
+	if m.Rotated {
+		display = image.Pt(m.Thumb.Y, m.Thumb.X)
+	}
+	files := map[string][]byte{
+		"probe.json":        probe,
+		"packets.csv":       []byte(m.Packets),
+		"thumb.jpg":         encodeTestJPEG(t, m.Thumb),
+		"thumb-display.jpg": encodeTestJPEG(t, display),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(m.dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	reencodeSize := filepath.Join(m.dir, "reencode-size")
+	if m.ReencodeSize > 0 {
+		err = os.WriteFile(reencodeSize, []byte(strconv.Itoa(m.ReencodeSize)), 0644)
+	} else {
+		err = os.Remove(reencodeSize)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	failCopy := filepath.Join(m.dir, "fail-copy")
+	if m.FailCopy {
+		err = os.WriteFile(failCopy, nil, 0644)
+	} else {
+		err = os.Remove(failCopy)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+}
+
+func encodeTestJPEG(t *testing.T, size image.Point) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	if err := jpeg.Encode(&b, image.NewRGBA(image.Rectangle{Max: size}), nil); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+// ffmpegRuns returns the arguments of every ffmpeg run so far.
+func (m *fakeMedia) ffmpegRuns(t *testing.T) [][]string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(m.dir, "ffmpeg.log"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	var runs [][]string
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		runs = append(runs, strings.Split(strings.TrimSuffix(line, "\t"), "\t"))
+	}
+	return runs
+}
+
+// testMP4 builds a structurally valid MP4: ftyp, an empty moov and an mdat
+// of payloadSize bytes. Distinct seeds give distinct content.
+func testMP4(payloadSize int, seed byte) []byte {
+	var b bytes.Buffer
+	b.Write(mp4Header)
+	box := func(kind string, payload []byte) {
+		binary.Write(&b, binary.BigEndian, uint32(8+len(payload)))
+		b.WriteString(kind)
+		b.Write(payload)
+	}
+	box("moov", nil)
+	payload := make([]byte, payloadSize)
+	for i := range payload {
+		payload[i] = seed + byte(i)
+	}
+	box("mdat", payload)
+	return b.Bytes()
+}
+
+// uploadRequest builds a multipart video upload for handlerUploadVideo.
+func uploadRequest(t *testing.T, videoID, userID uuid.UUID, video []byte, contentType string) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", `form-data; name="video"; filename="clip.mp4"`)
+	header.Set("Content-Type", contentType)
+	part, err := mw.CreatePart(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(video)
+	mw.Close()
+
+	req := newAuthedRequest(t, http.MethodPost, "/api/video_upload/"+videoID.String(), &body, userID)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.SetPathValue("videoID", videoID.String())
+	return req
+}
+
+// uploadTestVideo uploads video through handlerUploadVideo and returns the
+// response.
+func uploadTestVideo(t *testing.T, cfg *apiConfig, videoID, userID uuid.UUID, video []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	cfg.handlerUploadVideo(rec, uploadRequest(t, videoID, userID, video, "video/mp4"))
+	return rec
+}
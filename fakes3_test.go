@@ -0,0 +1,369 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 is an in-memory, path-style S3 endpoint covering the calls
+// s3Storage makes. Objects are keyed by "bucket/key".
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string]fakeS3Object
+	// location is what GetBucketLocation reports for every bucket.
+	location string
+	// requests records "METHOD bucket/key" for every request, with COPY
+	// for server-side copies.
+	requests []string
+	// uploads holds the parts of in-progress multipart uploads by ID.
+	uploads map[string]*fakeS3Upload
+	// tamper, when set, rewrites the body of every single-part PUT before
+	// it's stored, standing in for a store that doesn't check the checksum
+	// it was sent.
+	tamper func(name string, data []byte) []byte
+}
+
+type fakeS3Upload struct {
+	name        string
+	obj         fakeS3Object
+	parts       map[int][]byte
+	checksummed bool
+}
+
+// fakeS3Checksum is the base64 SHA-256 S3 records for data.
+func fakeS3Checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+type fakeS3Object struct {
+	data        []byte
+	contentType string
+	tagging     string
+	modified    time.Time
+	// checksum is the SHA-256 recorded for uploads sent with one; for
+	// multipart uploads it's the checksum of the part checksums with a
+	// "-N" suffix, as on S3.
+	checksum string
+}
+
+// newFakeS3 starts a fake S3 server for the rest of the test and returns
+// it with its endpoint URL.
+func newFakeS3(t *testing.T) (*fakeS3, string) {
+	t.Helper()
+	f := &fakeS3{objects: map[string]fakeS3Object{}, uploads: map[string]*fakeS3Upload{}}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return f, srv.URL
+}
+
+// newTestS3Config returns a test config whose storage is an s3Storage for
+// bucket (with an optional staging bucket) on a fake S3 server.
+func newTestS3Config(t *testing.T, bucket, stagingBucket string) (*apiConfig, *fakeS3) {
+	t.Helper()
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+	fake, endpoint := newFakeS3(t)
+	client, err := newS3Client(context.Background(), "us-east-1", bucket, endpoint, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uploader, err := newUploader(client, defaultS3PartSize, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := newTestConfig(t)
+	cfg.storageBackend = storageBackendS3
+	cfg.s3Client = client
+	cfg.s3Bucket = bucket
+	cfg.s3Region = "us-east-1"
+	cfg.stagingBucket = stagingBucket
+	cfg.s3CfDistribution = "https://cdn.example.com"
+	cfg.storage = &s3Storage{
+		client:        client,
+		uploader:      uploader,
+		bucket:        bucket,
+		stagingBucket: stagingBucket,
+		distribution:  cfg.s3CfDistribution,
+		tagging:       cfg.objectTagging,
+	}
+	return cfg, fake
+}
+
+// object returns the object stored under bucket/key.
+func (f *fakeS3) object(bucket, key string) (fakeS3Object, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	obj, ok := f.objects[bucket+"/"+key]
+	return obj, ok
+}
+
+// keys returns the stored keys in bucket, sorted.
+func (f *fakeS3) keys(bucket string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var keys []string
+	for name := range f.objects {
+		if key, ok := strings.CutPrefix(name, bucket+"/"); ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// requestLog returns the requests served so far.
+func (f *fakeS3) requestLog() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.requests...)
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	name := bucket + "/" + key
+	query := r.URL.Query()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, r.Method+" "+name)
+
+	switch {
+	case key == "" && query.Has("location"):
+		fmt.Fprintf(w, `<LocationConstraint xmlns="http://s3.amazonaws.com/doc/2006-03-01/">%s</LocationConstraint>`, f.location)
+
+	case key == "" && r.Method == http.MethodGet:
+		prefix := query.Get("prefix")
+		var b strings.Builder
+		b.WriteString(`<ListBucketResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/"><IsTruncated>false</IsTruncated>`)
+		for objName, obj := range f.objects {
+			k, ok := strings.CutPrefix(objName, bucket+"/")
+			if !ok || !strings.HasPrefix(k, prefix) {
+				continue
+			}
+			fmt.Fprintf(&b, "<Contents><Key>%s</Key><LastModified>%s</LastModified><Size>%d</Size></Contents>", k, obj.modified.Format(time.RFC3339), len(obj.data))
+		}
+		b.WriteString("</ListBucketResult>")
+		io.WriteString(w, b.String())
+
+	case key == "" && r.Method == http.MethodPost && query.Has("delete"):
+		var req struct {
+			Objects []struct {
+				Key string `xml:"Key"`
+			} `xml:"Object"`
+		}
+		if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for _, obj := range req.Objects {
+			delete(f.objects, bucket+"/"+obj.Key)
+		}
+		io.WriteString(w, `<DeleteResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/"></DeleteResult>`)
+
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		src, err := url.PathUnescape(r.Header.Get("X-Amz-Copy-Source"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.requests[len(f.requests)-1] = "COPY " + name
+		obj, ok := f.objects[strings.TrimPrefix(src, "/")]
+		if !ok {
+			f.noSuchKey(w)
+			return
+		}
+		if r.Header.Get("X-Amz-Tagging-Directive") == "REPLACE" {
+			obj.tagging = r.Header.Get("X-Amz-Tagging")
+		}
+		obj.modified = time.Now()
+		f.objects[name] = obj
+		fmt.Fprintf(w, `<CopyObjectResult><ETag>"%x"</ETag></CopyObjectResult>`, len(obj.data))
+
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		id := strconv.Itoa(len(f.uploads) + 1)
+		f.uploads[id] = &fakeS3Upload{
+			name: name,
+			obj: fakeS3Object{
+				contentType: r.Header.Get("Content-Type"),
+				tagging:     r.Header.Get("X-Amz-Tagging"),
+			},
+			parts: map[int][]byte{},
+		}
+		fmt.Fprintf(w, `<InitiateMultipartUploadResult><Bucket>%s</Bucket><Key>%s</Key><UploadId>%s</UploadId></InitiateMultipartUploadResult>`, bucket, key, id)
+
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		upload, ok := f.uploads[query.Get("uploadId")]
+		if !ok {
+			http.Error(w, "no such upload", http.StatusNotFound)
+			return
+		}
+		part, err := strconv.Atoi(query.Get("partNumber"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		data, err := readFakeS3Body(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		upload.parts[part] = data
+		upload.checksummed = upload.checksummed || fakeS3SentChecksum(r)
+		w.Header().Set("ETag", fmt.Sprintf(`"part%d"`, part))
+
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		id := query.Get("uploadId")
+		upload, ok := f.uploads[id]
+		if !ok {
+			http.Error(w, "no such upload", http.StatusNotFound)
+			return
+		}
+		numbers := make([]int, 0, len(upload.parts))
+		for n := range upload.parts {
+			numbers = append(numbers, n)
+		}
+		sort.Ints(numbers)
+		var partSums []byte
+		for _, n := range numbers {
+			upload.obj.data = append(upload.obj.data, upload.parts[n]...)
+			sum := sha256.Sum256(upload.parts[n])
+			partSums = append(partSums, sum[:]...)
+		}
+		if upload.checksummed {
+			upload.obj.checksum = fmt.Sprintf("%s-%d", fakeS3Checksum(partSums), len(numbers))
+		}
+		upload.obj.modified = time.Now()
+		f.objects[upload.name] = upload.obj
+		delete(f.uploads, id)
+		fmt.Fprintf(w, `<CompleteMultipartUploadResult><Bucket>%s</Bucket><Key>%s</Key><ETag>"%x"</ETag></CompleteMultipartUploadResult>`, bucket, key, len(upload.obj.data))
+
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		delete(f.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+
+	case r.Method == http.MethodPut:
+		data, err := readFakeS3Body(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if f.tamper != nil {
+			data = f.tamper(name, data)
+		}
+		obj := fakeS3Object{
+			data:        data,
+			contentType: r.Header.Get("Content-Type"),
+			tagging:     r.Header.Get("X-Amz-Tagging"),
+			modified:    time.Now(),
+		}
+		if fakeS3SentChecksum(r) {
+			obj.checksum = fakeS3Checksum(data)
+		}
+		f.objects[name] = obj
+		w.Header().Set("ETag", fmt.Sprintf(`"%x"`, len(data)))
+
+	case r.Method == http.MethodHead || r.Method == http.MethodGet:
+		obj, ok := f.objects[name]
+		if !ok {
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			f.noSuchKey(w)
+			return
+		}
+		etag := fmt.Sprintf(`"%x"`, len(obj.data))
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Last-Modified", obj.modified.UTC().Format(http.TimeFormat))
+		if fakeS3NotModified(r, etag, obj.modified) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", obj.contentType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(obj.data)))
+		if obj.checksum != "" && strings.EqualFold(r.Header.Get("X-Amz-Checksum-Mode"), "ENABLED") {
+			w.Header().Set("X-Amz-Checksum-Sha256", obj.checksum)
+		}
+		if r.Method == http.MethodGet {
+			w.Write(obj.data)
+		}
+
+	case r.Method == http.MethodDelete:
+		delete(f.objects, name)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "not implemented", http.StatusNotImplemented)
+	}
+}
+
+// fakeS3NotModified evaluates a GET's conditional headers the way S3 does,
+// with If-None-Match taking precedence.
+func fakeS3NotModified(r *http.Request, etag string, modified time.Time) bool {
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		return match == etag
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	return err == nil && !modified.Truncate(time.Second).After(since)
+}
+
+func (f *fakeS3) noSuchKey(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusNotFound)
+	io.WriteString(w, `<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>`)
+}
+
+// fakeS3SentChecksum reports whether a PUT came with a SHA-256, as a
+// header or announced as an aws-chunked trailer.
+func fakeS3SentChecksum(r *http.Request) bool {
+	return r.Header.Get("X-Amz-Checksum-Sha256") != "" ||
+		strings.EqualFold(r.Header.Get("X-Amz-Trailer"), "x-amz-checksum-sha256") ||
+		strings.EqualFold(r.Header.Get("X-Amz-Sdk-Checksum-Algorithm"), "SHA256")
+}
+
+// readFakeS3Body reads a PUT body, undoing aws-chunked framing.
+func readFakeS3Body(r *http.Request) ([]byte, error) {
+	if !strings.Contains(r.Header.Get("Content-Encoding"), "aws-chunked") {
+		return io.ReadAll(r.Body)
+	}
+	var data bytes.Buffer
+	br := bufio.NewReader(r.Body)
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		sizeHex, _, _ := strings.Cut(strings.TrimSpace(line), ";")
+		size, err := strconv.ParseInt(sizeHex, 16, 64)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return data.Bytes(), nil
+		}
+		if _, err := io.CopyN(&data, br, size); err != nil {
+			return nil, err
+		}
+		if _, err := br.ReadString('\n'); err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+const defaultCommandTimeout = 2 * time.Minute
+
+// ffmpegLimits configures how ffmpeg is constrained so a single pathological
+// input can't starve the machine. Zero values leave that limit off.
+type ffmpegLimits struct {
+	Niceness       int
+	MaxMemoryBytes int64
+	MaxCPUSeconds  int64
+}
+
+// resolveFFmpegWrapper turns limits into a command prefix using nice(1) and
+// prlimit(1). Tools that aren't installed are skipped with a warning rather
+// than failing, so the same config works on machines without them.
+func resolveFFmpegWrapper(limits ffmpegLimits) []string {
+	var wrapper []string
+	if limits.MaxMemoryBytes > 0 || limits.MaxCPUSeconds > 0 {
+		if path, err := exec.LookPath("prlimit"); err == nil {
+			wrapper = append(wrapper, path)
+			if limits.MaxMemoryBytes > 0 {
+				wrapper = append(wrapper, "--as="+strconv.FormatInt(limits.MaxMemoryBytes, 10))
+			}
+			if limits.MaxCPUSeconds > 0 {
+				wrapper = append(wrapper, "--cpu="+strconv.FormatInt(limits.MaxCPUSeconds, 10))
+			}
+			wrapper = append(wrapper, "--")
+		} else {
+			log.Printf("prlimit not found, running ffmpeg without memory/CPU limits")
+		}
+	}
+	if limits.Niceness != 0 {
+		if path, err := exec.LookPath("nice"); err == nil {
+			wrapper = append(wrapper, path, "-n", strconv.Itoa(limits.Niceness))
+		} else {
+			log.Printf("nice not found, running ffmpeg at normal priority")
+		}
+	}
+	return wrapper
+}
+
+// ffmpegCommand builds an ffmpeg invocation with the configured global
+// arguments (e.g. -nostdin -loglevel error) ahead of the per-call ones,
+// wrapped in any configured priority and resource limits.
+// The process is killed if ctx is cancelled.
+func (cfg *apiConfig) ffmpegCommand(ctx context.Context, args ...string) *exec.Cmd {
+	fullArgs := make([]string, 0, len(cfg.ffmpegWrapper)+1+len(cfg.ffmpegGlobalArgs)+len(args))
+	fullArgs = append(fullArgs, cfg.ffmpegWrapper...)
+	fullArgs = append(fullArgs, "ffmpeg")
+	fullArgs = append(fullArgs, cfg.ffmpegGlobalArgs...)
+	fullArgs = append(fullArgs, args...)
+	return exec.CommandContext(ctx, fullArgs[0], fullArgs[1:]...)
+}
+
+// withCommandTimeout bounds a single ffmpeg/ffprobe run by
+// cfg.commandTimeout, on top of whatever deadline ctx already has. A
+// timeout of 0 leaves only ctx's own cancellation.
+func (cfg *apiConfig) withCommandTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if cfg.commandTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, cfg.commandTimeout)
+}
+
+// commandFailed describes a failed command run. When ctx was cancelled or
+// timed out, that is reported (and wrapped) instead of stderr, since the
+// process was killed rather than rejecting the input.
+func commandFailed(ctx context.Context, what, stderr string, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return fmt.Errorf("%s: %w", what, ctxErr)
+	}
+	return fmt.Errorf("%s: %s, %v", what, stderr, err)
+}
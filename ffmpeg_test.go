@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// niceFFmpegScript stands in for ffmpeg and prints its own niceness, field
+// 19 of /proc/<pid>/stat.
+const niceFFmpegScript = `#!/bin/sh
+read -r stat < /proc/$$/stat
+set -- $stat
+echo "${19}"
+`
+
+// hangingScript stands in for an ffmpeg or ffprobe stuck on a bad input.
+// exec replaces the shell so killing the process leaves nothing holding
+// its output pipes open.
+const hangingScript = `#!/bin/sh
+exec sleep 30
+`
+
+// installHangingMedia puts never-finishing ffmpeg and ffprobe first on PATH.
+func installHangingMedia(t *testing.T) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake media tools are shell scripts")
+	}
+	dir := t.TempDir()
+	for _, name := range []string{"ffmpeg", "ffprobe"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(hangingScript), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestMediaCommandsHonourCancelledContext(t *testing.T) {
+	installHangingMedia(t)
+	cfg := newTestConfig(t)
+	input := writeTestFile(t, testMP4(256, 0))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	runs := map[string]func() error{
+		"probeVideo": func() error {
+			_, err := cfg.probeVideo(ctx, input)
+			return err
+		},
+		"processVideoForFastStart": func() error {
+			out, err := cfg.processVideoForFastStart(ctx, input, "yuv420p", "yuv420p")
+			if err == nil {
+				os.Remove(out)
+			}
+			return err
+		},
+		"extractThumbnail": func() error {
+			out, err := cfg.extractThumbnail(ctx, input, time.Second)
+			if err == nil {
+				os.Remove(out)
+			}
+			return err
+		},
+	}
+	for name, run := range runs {
+		start := time.Now()
+		err := run()
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("%s error = %v, want context.Canceled", name, err)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("%s took %s with a cancelled context", name, elapsed)
+		}
+	}
+}
+
+func TestUploadTimesOutStuckCommand(t *testing.T) {
+	installHangingMedia(t)
+	cfg := newTestConfig(t)
+	cfg.commandTimeout = 100 * time.Millisecond
+	userID := createTestUser(t, cfg)
+	video := createTestVideo(t, cfg, userID, visibilityPublic)
+
+	start := time.Now()
+	rec := uploadTestVideo(t, cfg, video.ID, userID, testMP4(256, 0))
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Errorf("got status %d, want 504: %s", rec.Code, rec.Body)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("upload took %s despite a %s command timeout", elapsed, cfg.commandTimeout)
+	}
+}
+
+func TestFFmpegRunsWithConfiguredNiceness(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("reads niceness from /proc")
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "ffmpeg"), []byte(niceFFmpegScript), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	cfg := newTestConfig(t)
+
+	niceness := func() int {
+		t.Helper()
+		out, err := cfg.ffmpegCommand(context.Background(), "-version").Output()
+		if err != nil {
+			t.Fatalf("running ffmpeg: %v", err)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(string(out)))
+		if err != nil {
+			t.Fatalf("parsing niceness %q: %v", out, err)
+		}
+		return n
+	}
+
+	base := niceness()
+	cfg.ffmpegWrapper = resolveFFmpegWrapper(ffmpegLimits{Niceness: 7})
+	if len(cfg.ffmpegWrapper) == 0 {
+		t.Skip("nice not installed")
+	}
+	if got, want := niceness(), min(base+7, 19); got != want {
+		t.Errorf("ffmpeg ran at niceness %d, want %d", got, want)
+	}
+}
+
+func TestResolveFFmpegWrapperSkipsWhenUnset(t *testing.T) {
+	if wrapper := resolveFFmpegWrapper(ffmpegLimits{}); len(wrapper) != 0 {
+		t.Errorf("wrapper with no limits = %q, want none", wrapper)
+	}
+}
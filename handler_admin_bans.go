@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func validBanKind(kind string) bool {
+	return kind == database.BanKindUser || kind == database.BanKindVideo
+}
+
+func (cfg *apiConfig) handlerAdminBansList(w http.ResponseWriter, r *http.Request) {
+	if _, ok := cfg.requireAdmin(w, r); !ok {
+		return
+	}
+
+	bans, err := cfg.db.GetBans()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get bans", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, bans)
+}
+
+func (cfg *apiConfig) handlerAdminBanCreate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Kind     string    `json:"kind"`
+		TargetID uuid.UUID `json:"target_id"`
+		Reason   string    `json:"reason"`
+	}
+
+	if _, ok := cfg.requireAdmin(w, r); !ok {
+		return
+	}
+
+	params := parameters{}
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if !validBanKind(params.Kind) {
+		respondWithError(w, http.StatusBadRequest, "Kind must be \"user\" or \"video\"", nil)
+		return
+	}
+	if params.TargetID == uuid.Nil {
+		respondWithError(w, http.StatusBadRequest, "Target ID is required", nil)
+		return
+	}
+
+	ban, err := cfg.db.CreateBan(params.Kind, params.TargetID, params.Reason)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create ban", err)
+		return
+	}
+	cfg.banCache.Delete(banCacheKey(ban.Kind, ban.TargetID))
+
+	respondWithJSON(w, http.StatusCreated, ban)
+}
+
+func (cfg *apiConfig) handlerAdminBanDelete(w http.ResponseWriter, r *http.Request) {
+	kind := r.PathValue("kind")
+	if !validBanKind(kind) {
+		respondWithError(w, http.StatusBadRequest, "Kind must be \"user\" or \"video\"", nil)
+		return
+	}
+	targetID, err := uuid.Parse(r.PathValue("targetID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid target ID", err)
+		return
+	}
+
+	if _, ok := cfg.requireAdmin(w, r); !ok {
+		return
+	}
+
+	if err := cfg.db.DeleteBan(kind, targetID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete ban", err)
+		return
+	}
+	cfg.banCache.Delete(banCacheKey(kind, targetID))
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func banTarget(t *testing.T, cfg *apiConfig, adminID uuid.UUID, kind string, targetID uuid.UUID) {
+	t.Helper()
+	body := `{"kind":"` + kind + `","target_id":"` + targetID.String() + `","reason":"test"}`
+	rec := httptest.NewRecorder()
+	cfg.handlerAdminBanCreate(rec, newAuthedRequest(t, http.MethodPost, "/admin/bans", strings.NewReader(body), adminID))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("ban %s %s: got status %d: %s", kind, targetID, rec.Code, rec.Body)
+	}
+}
+
+func unbanTarget(t *testing.T, cfg *apiConfig, adminID uuid.UUID, kind string, targetID uuid.UUID) {
+	t.Helper()
+	req := newAuthedRequest(t, http.MethodDelete, "/admin/bans/"+kind+"/"+targetID.String(), nil, adminID)
+	req.SetPathValue("kind", kind)
+	req.SetPathValue("targetID", targetID.String())
+	rec := httptest.NewRecorder()
+	cfg.handlerAdminBanDelete(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("unban %s %s: got status %d: %s", kind, targetID, rec.Code, rec.Body)
+	}
+}
+
+func TestBannedVideoIsUnavailable(t *testing.T) {
+	cfg := newTestConfig(t)
+	adminID := createTestUser(t, cfg)
+	cfg.adminUserIDs = map[uuid.UUID]bool{adminID: true}
+	userID := createTestUser(t, cfg)
+	video := createTestVideo(t, cfg, userID, visibilityPublic)
+	storeTestVersion(t, cfg, video.ID, testMP4(256, 0))
+
+	stream := func() int {
+		rec := httptest.NewRecorder()
+		cfg.handlerVideoStream(rec, streamRequest(t, video.ID, userID))
+		return rec.Code
+	}
+	get := func() int {
+		req := newAuthedRequest(t, http.MethodGet, "/api/videos/"+video.ID.String(), nil, userID)
+		req.SetPathValue("videoID", video.ID.String())
+		rec := httptest.NewRecorder()
+		cfg.handlerVideoGet(rec, req)
+		return rec.Code
+	}
+
+	// Prime the ban cache so the ban has to invalidate it.
+	if code := stream(); code != http.StatusOK {
+		t.Fatalf("stream before the ban: got status %d", code)
+	}
+	banTarget(t, cfg, adminID, database.BanKindVideo, video.ID)
+	if code := stream(); code != http.StatusUnavailableForLegalReasons {
+		t.Errorf("stream of a banned video: got status %d, want 451", code)
+	}
+	if code := get(); code != http.StatusUnavailableForLegalReasons {
+		t.Errorf("get of a banned video: got status %d, want 451", code)
+	}
+
+	unbanTarget(t, cfg, adminID, database.BanKindVideo, video.ID)
+	if code := stream(); code != http.StatusOK {
+		t.Errorf("stream after unbanning: got status %d, want 200", code)
+	}
+	if code := get(); code != http.StatusOK {
+		t.Errorf("get after unbanning: got status %d, want 200", code)
+	}
+}
+
+func TestBannedUserCannotUpload(t *testing.T) {
+	cfg := newTestConfig(t)
+	installFakeMedia(t, &fakeMedia{Width: 1920, Height: 1080})
+	adminID := createTestUser(t, cfg)
+	cfg.adminUserIDs = map[uuid.UUID]bool{adminID: true}
+	userID := createTestUser(t, cfg)
+	video := createTestVideo(t, cfg, userID, visibilityPublic)
+
+	banTarget(t, cfg, adminID, database.BanKindUser, userID)
+	if rec := uploadTestVideo(t, cfg, video.ID, userID, testMP4(256, 0)); rec.Code != http.StatusForbidden {
+		t.Errorf("upload by a banned user: got status %d, want 403", rec.Code)
+	}
+
+	unbanTarget(t, cfg, adminID, database.BanKindUser, userID)
+	if rec := uploadTestVideo(t, cfg, video.ID, userID, testMP4(256, 1)); rec.Code != http.StatusOK {
+		t.Errorf("upload after unbanning: got status %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestBanRequiresAdmin(t *testing.T) {
+	cfg := newTestConfig(t)
+	userID := createTestUser(t, cfg)
+	body := `{"kind":"user","target_id":"` + uuid.NewString() + `"}`
+	rec := httptest.NewRecorder()
+	cfg.handlerAdminBanCreate(rec, newAuthedRequest(t, http.MethodPost, "/admin/bans", strings.NewReader(body), userID))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("ban by a non-admin: got status %d, want 403", rec.Code)
+	}
+}
+
+func TestBannedVideoHiddenFromVideoEndpoints(t *testing.T) {
+	cfg := newTestConfig(t)
+	adminID := createTestUser(t, cfg)
+	cfg.adminUserIDs = map[uuid.UUID]bool{adminID: true}
+	userID := createTestUser(t, cfg)
+	video := createTestVideo(t, cfg, userID, visibilityPublic)
+	storeTestVersion(t, cfg, video.ID, testMP4(256, 0))
+	banTarget(t, cfg, adminID, database.BanKindVideo, video.ID)
+
+	handlers := []struct {
+		suffix  string
+		handler http.HandlerFunc
+	}{
+		{"/status", cfg.handlerVideoState},
+		{"/metadata", cfg.handlerVideoMetadata},
+		{"/versions", cfg.handlerVideoVersionsList},
+		{"/timings", cfg.handlerVideoTimings},
+	}
+	for _, h := range handlers {
+		rec := httptest.NewRecorder()
+		h.handler(rec, videoActionRequest(t, http.MethodGet, h.suffix, video.ID, userID))
+		if rec.Code != http.StatusUnavailableForLegalReasons {
+			t.Errorf("GET %s of a banned video: got status %d, want 451", h.suffix, rec.Code)
+		}
+	}
+}
+
+func TestBannedVideoNotSignedInBatches(t *testing.T) {
+	cfg := newTestConfig(t)
+	adminID := createTestUser(t, cfg)
+	cfg.adminUserIDs = map[uuid.UUID]bool{adminID: true}
+	userID := createTestUser(t, cfg)
+	banned := createTestVideo(t, cfg, userID, visibilityPublic)
+	clean := createTestVideo(t, cfg, userID, visibilityPublic)
+	for i, video := range []database.Video{banned, clean} {
+		videoURL := cfg.videoURLRef(storeTestVersion(t, cfg, video.ID, testMP4(256, byte(i))))
+		video.VideoURL = &videoURL
+		if err := cfg.db.UpdateVideo(video); err != nil {
+			t.Fatal(err)
+		}
+	}
+	banTarget(t, cfg, adminID, database.BanKindVideo, banned.ID)
+
+	body := `{"video_ids":["` + banned.ID.String() + `","` + clean.ID.String() + `"]}`
+	rec := httptest.NewRecorder()
+	cfg.handlerVideosSign(rec, newAuthedRequest(t, http.MethodPost, "/api/videos/sign", strings.NewReader(body), userID))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("sign: got status %d: %s", rec.Code, rec.Body)
+	}
+	signed := decodeJSON[map[uuid.UUID]any](t, rec)
+	if _, ok := signed[banned.ID]; ok {
+		t.Errorf("banned video was signed")
+	}
+	if _, ok := signed[clean.ID]; !ok {
+		t.Errorf("unbanned video wasn't signed")
+	}
+
+	rec = listVideos(t, cfg, userID, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("list: got status %d: %s", rec.Code, rec.Body)
+	}
+	list := decodeJSON[page[database.Video]](t, rec)
+	if list.Total != 2 || len(list.Items) != 2 {
+		t.Fatalf("list has %d of %d videos, want both", len(list.Items), list.Total)
+	}
+	for _, video := range list.Items {
+		switch video.ID {
+		case banned.ID:
+			if !video.Banned || video.VideoURL != nil {
+				t.Errorf("banned video listed as banned=%v with URL %v, want marked and unsigned", video.Banned, video.VideoURL)
+			}
+		case clean.ID:
+			if video.Banned || video.VideoURL == nil {
+				t.Errorf("unbanned video listed as banned=%v with URL %v", video.Banned, video.VideoURL)
+			}
+		}
+	}
+}
+
+func TestBannedUserCannotReprocessOrRegenerateThumbnails(t *testing.T) {
+	cfg := newTestConfig(t)
+	adminID := createTestUser(t, cfg)
+	cfg.adminUserIDs = map[uuid.UUID]bool{adminID: true}
+	userID := createTestUser(t, cfg)
+	video := createTestVideo(t, cfg, userID, visibilityPublic)
+	storeTestVersion(t, cfg, video.ID, testMP4(256, 0))
+	banTarget(t, cfg, adminID, database.BanKindUser, userID)
+
+	rec := httptest.NewRecorder()
+	cfg.handlerVideoReprocess(rec, reprocessRequest(t, video.ID, userID))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("reprocess by a banned user: got status %d, want 403", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	cfg.handlerVideoThumbnailAuto(rec, videoActionRequest(t, http.MethodPost, "/thumbnail/auto", video.ID, userID))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("auto thumbnail by a banned user: got status %d, want 403", rec.Code)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// handlerAdminErrors lists recent processing failures across all videos,
+// newest first. ?stage= filters to one pipeline stage and ?since= takes an
+// RFC 3339 timestamp or a duration such as "1h" meaning that long ago.
+func (cfg *apiConfig) handlerAdminErrors(w http.ResponseWriter, r *http.Request) {
+	if _, ok := cfg.requireAdmin(w, r); !ok {
+		return
+	}
+
+	filter := database.ProcessingErrorFilter{
+		Stage: r.URL.Query().Get("stage"),
+		Limit: defaultPageLimit,
+	}
+	if limitString := r.URL.Query().Get("limit"); limitString != "" {
+		limit, err := strconv.Atoi(limitString)
+		if err != nil || limit < 1 || limit > maxStoredProcessingErrors {
+			respondWithError(w, http.StatusBadRequest, "Invalid limit", err)
+			return
+		}
+		filter.Limit = limit
+	}
+	if since := r.URL.Query().Get("since"); since != "" {
+		if d, err := time.ParseDuration(since); err == nil {
+			filter.Since = cfg.now().Add(-d)
+		} else if t, err := time.Parse(time.RFC3339, since); err == nil {
+			filter.Since = t
+		} else {
+			respondWithError(w, http.StatusBadRequest, "since must be an RFC 3339 timestamp or a duration", err)
+			return
+		}
+	}
+
+	errs, err := cfg.db.GetProcessingErrors(filter)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get processing errors", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, errs)
+}
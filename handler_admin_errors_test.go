@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestAdminErrorsListsProcessingFailures(t *testing.T) {
+	cfg := newTestConfig(t)
+	now := time.Date(2026, 6, 1, 8, 0, 0, 0, time.UTC)
+	setTestClock(cfg, func() time.Time { return now })
+	installFakeMedia(t, &fakeMedia{Width: 1920, Height: 1080, Duration: 10, StreamDuration: 2})
+	cfg.strictDuration = true
+	adminID := createTestUser(t, cfg)
+	cfg.adminUserIDs = map[uuid.UUID]bool{adminID: true}
+	userID := createTestUser(t, cfg)
+
+	old := createTestVideo(t, cfg, userID, visibilityPublic)
+	cfg.recordProcessingError(old, processingStageTranscode, errors.New("encoder crashed"))
+	now = now.Add(2 * time.Hour)
+	failed := createTestVideo(t, cfg, userID, visibilityPublic)
+	if rec := uploadTestVideo(t, cfg, failed.ID, userID, testMP4(256, 0)); rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("upload: got status %d, want 422", rec.Code)
+	}
+
+	list := func(query string) []database.ProcessingError {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		cfg.handlerAdminErrors(rec, newAuthedRequest(t, http.MethodGet, "/api/admin/errors"+query, nil, adminID))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("list %q: got status %d: %s", query, rec.Code, rec.Body)
+		}
+		return decodeJSON[[]database.ProcessingError](t, rec)
+	}
+
+	all := list("")
+	if len(all) != 2 {
+		t.Fatalf("got %d errors, want 2: %+v", len(all), all)
+	}
+	if got := all[0]; got.VideoID != failed.ID || got.UserID != userID || got.Stage != processingStageValidate || got.Error == "" {
+		t.Errorf("newest error = %+v, want the failed upload's validate error", got)
+	}
+
+	if got := list("?stage=" + processingStageTranscode); len(got) != 1 || got[0].VideoID != old.ID {
+		t.Errorf("stage filter returned %+v, want only the transcode error", got)
+	}
+	if got := list("?since=1h"); len(got) != 1 || got[0].VideoID != failed.ID {
+		t.Errorf("since filter returned %+v, want only the recent error", got)
+	}
+	if got := list("?stage=nope"); len(got) != 0 {
+		t.Errorf("unknown stage returned %+v, want none", got)
+	}
+
+	rec := httptest.NewRecorder()
+	cfg.handlerAdminErrors(rec, newAuthedRequest(t, http.MethodGet, "/api/admin/errors", nil, userID))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("non-admin: got status %d, want 403", rec.Code)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// createTestAPIKey creates a key with scopes for userID through the API and
+// returns its secret.
+func createTestAPIKey(t *testing.T, cfg *apiConfig, userID uuid.UUID, scopes ...string) string {
+	t.Helper()
+	body := `{"name":"integration","scopes":["` + strings.Join(scopes, `","`) + `"]}`
+	rec := httptest.NewRecorder()
+	cfg.handlerAPIKeyCreate(rec, newAuthedRequest(t, http.MethodPost, "/api/api_keys", strings.NewReader(body), userID))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("creating API key: got status %d: %s", rec.Code, rec.Body)
+	}
+	return decodeJSON[struct {
+		Key string `json:"key"`
+	}](t, rec).Key
+}
+
+// withAPIKey swaps req's credentials for key.
+func withAPIKey(req *http.Request, key string) *http.Request {
+	req.Header.Set("Authorization", "ApiKey "+key)
+	return req
+}
+
+func TestAPIKeyScopesEnforced(t *testing.T) {
+	cfg := newTestConfig(t)
+	installFakeMedia(t, &fakeMedia{Width: 1920, Height: 1080})
+	userID := createTestUser(t, cfg)
+	video := createTestVideo(t, cfg, userID, visibilityPublic)
+	readKey := createTestAPIKey(t, cfg, userID, scopeRead)
+	uploadKey := createTestAPIKey(t, cfg, userID, scopeUpload)
+
+	upload := func(key string, seed byte) int {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		cfg.handlerUploadVideo(rec, withAPIKey(uploadRequest(t, video.ID, uuid.Nil, testMP4(256, seed), "video/mp4"), key))
+		return rec.Code
+	}
+	remove := func(key string) int {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		cfg.handlerVideoMetaDelete(rec, withAPIKey(videoActionRequest(t, http.MethodDelete, "", video.ID, uuid.Nil), key))
+		return rec.Code
+	}
+
+	if code := upload(readKey, 0); code != http.StatusForbidden {
+		t.Errorf("upload with a read-only key: got status %d, want 403", code)
+	}
+	if code := upload(uploadKey, 1); code != http.StatusOK {
+		t.Errorf("upload with an upload key: got status %d, want 200", code)
+	}
+	if code := remove(uploadKey); code != http.StatusForbidden {
+		t.Errorf("delete with an upload-only key: got status %d, want 403", code)
+	}
+	if code := remove("tubely_not-a-key"); code != http.StatusUnauthorized {
+		t.Errorf("delete with an unknown key: got status %d, want 401", code)
+	}
+	if stored, err := cfg.db.GetVideo(video.ID); err != nil || stored.ID == uuid.Nil {
+		t.Errorf("video is gone after only rejected deletes: %v", err)
+	}
+}
+
+func TestAPIKeyCreateRejectsUnknownScope(t *testing.T) {
+	cfg := newTestConfig(t)
+	userID := createTestUser(t, cfg)
+	rec := httptest.NewRecorder()
+	body := strings.NewReader(`{"name":"bad","scopes":["admin"]}`)
+	cfg.handlerAPIKeyCreate(rec, newAuthedRequest(t, http.MethodPost, "/api/api_keys", body, userID))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("got status %d, want 400", rec.Code)
+	}
+}
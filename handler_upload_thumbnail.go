@@ -3,11 +3,12 @@ package main
 import (
 	"fmt"
 	"io"
+	"log"
 	"mime"
 	"net/http"
 	"os"
 
-	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
 	"github.com/google/uuid"
 )
 
@@ -19,21 +20,17 @@ func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+	userID, ok := cfg.authenticate(w, r, scopeUpload)
+	if !ok {
 		return
 	}
 
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+	if cfg.rejectBannedUser(w, userID) {
 		return
 	}
 
 	fmt.Println("uploading thumbnail for video", videoID, "by user", userID)
 
-	// TODO: implement the upload here
 	const maxMemory = 10 << 20
 	r.ParseMultipartForm(maxMemory)
 
@@ -56,43 +53,101 @@ func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Requ
 		respondWithError(w, http.StatusBadRequest, "Invalid file type", err)
 		return
 	}
+	ext, err := mediaTypeToExt(mediaType)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid file type", err)
+		return
+	}
 
-	//assetPath := getAssetPath(videoID, mediaType)
-	assetPath := getAssetPath(mediaType)
-	assetDiskPath := cfg.getAssetDiskPath(assetPath)
-
-	dst, err := os.Create(assetDiskPath)
+	video, err := cfg.db.GetVideo(videoID)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Unable to create file", nil)
+		respondWithError(w, http.StatusBadRequest, "Unable to get video", err)
 		return
 	}
-	defer dst.Close()
-	_, err = io.Copy(dst, file)
+	if video.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return
+	}
+	allowed, err := cfg.canAccessVideo(video, userID, database.GrantPermissionEdit)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Unable to write file", nil)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check video access", err)
+		return
+	}
+	if !allowed {
+		respondWithError(w, http.StatusUnauthorized, "Not authorized to update this video", nil)
 		return
 	}
 
-	video, err := cfg.db.GetVideo(videoID)
+	// The image is reshaped on disk before it goes to the store, so it's
+	// staged in a temp file carrying its extension.
+	tmp, err := os.CreateTemp("", "tubely-thumbnail-*"+ext)
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Unable to get video", err)
+		respondWithError(w, http.StatusInternalServerError, "Unable to create file", err)
 		return
 	}
-	if video.UserID != userID {
-		respondWithError(w, http.StatusUnauthorized, "Not authorized to update this video", nil)
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	if _, err := io.Copy(tmp, file); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to write file", err)
 		return
 	}
+	tmp.Close()
 
-	thumbnailURL := cfg.getAssetURL(assetPath)
-	video.ThumbnailURL = &thumbnailURL // Assign pointer to string
+	if err := cfg.matchThumbnailAspect(tmp.Name(), video.Width, video.Height); err != nil {
+		log.Printf("Couldn't match thumbnail aspect for video %s: %v", videoID, err)
+	}
+	if cfg.progressiveThumbnails && mediaType == "image/jpeg" {
+		if err := makeProgressiveJPEG(tmp.Name()); err != nil {
+			log.Printf("Keeping baseline thumbnail for video %s: %v", videoID, err)
+		}
+	}
+	if cfg.blurhash {
+		hash, err := computeBlurhash(tmp.Name())
+		if err != nil {
+			log.Printf("Couldn't compute blurhash for video %s: %v", videoID, err)
+		} else {
+			video.Blurhash = &hash
+		}
+	}
+
+	thumb, err := os.Open(tmp.Name())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to read file", err)
+		return
+	}
+	defer thumb.Close()
+
+	// A new upload replaces any earlier one, which may have had the other
+	// extension.
+	prefix := cfg.uploadedThumbnailPrefix(videoID)
+	if err := cfg.deleteObjectPrefix(r.Context(), prefix); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't replace thumbnail", err)
+		return
+	}
+	key := prefix + "uploaded" + ext
+	if err := cfg.putVideoObject(r.Context(), key, thumb, mediaType); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't store thumbnail", err)
+		return
+	}
+	thumbnailURL := cfg.getVersionedObjectURL(r.Context(), key)
+	video.ThumbnailURL = &thumbnailURL
 
 	err = cfg.db.UpdateVideo(video)
 	if err != nil {
-		//delete(videoThumbnails, videoID)
 		respondWithError(w, http.StatusInternalServerError, "Failed to update video", err)
 		return
 	}
 
+	signedThumbnail, err := cfg.signedThumbnailURL(video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't generate presigned url", err)
+		return
+	}
+	video, err = cfg.dbVideoToSignedVideo(video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't generate presigned url", err)
+		return
+	}
+	video.ThumbnailURL = signedThumbnail
 	respondWithJSON(w, http.StatusOK, video)
-	//respondWithJSON(w, http.StatusOK, struct{}{})
 }
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func uploadTestThumbnail(t *testing.T, cfg *apiConfig, videoID, userID uuid.UUID, img []byte, contentType string) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", `form-data; name="thumbnail"; filename="thumb"`)
+	header.Set("Content-Type", contentType)
+	part, err := mw.CreatePart(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(img)
+	mw.Close()
+
+	req := newAuthedRequest(t, http.MethodPost, "/api/thumbnail_upload/"+videoID.String(), &body, userID)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.SetPathValue("videoID", videoID.String())
+	rec := httptest.NewRecorder()
+	cfg.handlerUploadThumbnail(rec, req)
+	return rec
+}
+
+func TestUploadThumbnailGoesToObjectStore(t *testing.T) {
+	cfg, fake := newTestS3Config(t, "tubely", "")
+	userID := createTestUser(t, cfg)
+	video := createTestVideo(t, cfg, userID, visibilityPrivate)
+
+	rec := uploadTestThumbnail(t, cfg, video.ID, userID, encodeTestJPEG(t, image.Pt(64, 36)), "image/jpeg")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body)
+	}
+
+	key := cfg.uploadedThumbnailPrefix(video.ID) + "uploaded.jpg"
+	obj, ok := fake.object("tubely", key)
+	if !ok {
+		t.Fatalf("thumbnail not stored under %s; bucket has %v", key, fake.keys("tubely"))
+	}
+	if obj.contentType != "image/jpeg" {
+		t.Errorf("content type = %q, want image/jpeg", obj.contentType)
+	}
+	if entries, err := os.ReadDir(cfg.assetsRoot); err == nil && len(entries) > 0 {
+		t.Errorf("assets root has %d entries, want none", len(entries))
+	}
+
+	stored, err := cfg.db.GetVideo(video.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.ThumbnailURL == nil || unversionedURL(*stored.ThumbnailURL) != cfg.getObjectURL(key) {
+		t.Errorf("stored thumbnail URL = %v, want the object URL of %s", stored.ThumbnailURL, key)
+	}
+	got := decodeJSON[database.Video](t, rec)
+	if got.ThumbnailURL == nil || !strings.Contains(*got.ThumbnailURL, "X-Amz-Signature") {
+		t.Errorf("response thumbnail URL = %v, want a presigned URL", *got.ThumbnailURL)
+	}
+
+	// Replacing it with a PNG leaves only the new object behind.
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 64, 36))); err != nil {
+		t.Fatal(err)
+	}
+	if rec := uploadTestThumbnail(t, cfg, video.ID, userID, buf.Bytes(), "image/png"); rec.Code != http.StatusOK {
+		t.Fatalf("replacing thumbnail: got status %d: %s", rec.Code, rec.Body)
+	}
+	if _, ok := fake.object("tubely", key); ok {
+		t.Errorf("old thumbnail %s was left behind", key)
+	}
+	if _, ok := fake.object("tubely", cfg.uploadedThumbnailPrefix(video.ID)+"uploaded.png"); !ok {
+		t.Errorf("new thumbnail not stored; bucket has %v", fake.keys("tubely"))
+	}
+}
+
+func TestUploadThumbnailRequiresEditAccess(t *testing.T) {
+	cfg, fake := newTestS3Config(t, "tubely", "")
+	ownerID := createTestUser(t, cfg)
+	otherID := createTestUser(t, cfg)
+	video := createTestVideo(t, cfg, ownerID, visibilityPublic)
+
+	rec := uploadTestThumbnail(t, cfg, video.ID, otherID, encodeTestJPEG(t, image.Pt(64, 36)), "image/jpeg")
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("got status %d, want 401", rec.Code)
+	}
+	if keys := fake.keys("tubely"); len(keys) != 0 {
+		t.Errorf("bucket has %v after a rejected upload, want nothing", keys)
+	}
+}
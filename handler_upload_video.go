@@ -1,35 +1,33 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"log"
 	"math"
 	"mime"
 	"net/http"
 	"os"
 	"os/exec"
-	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
-	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
 	"github.com/google/uuid"
 )
 
-func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request) {
-	const maxUploadSize = 1 << 30
-
-	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
-	err := r.ParseMultipartForm(maxUploadSize)
-	if err != nil {
-		http.Error(w, "File is too large. Maximum size is 1 GB.", http.StatusRequestEntityTooLarge)
-		return
-	}
+// maxUploadSize caps a video upload, however it's sent.
+const maxUploadSize = 1 << 30
 
+func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request) {
 	videoIDString := r.PathValue("videoID")
 	videoID, err := uuid.Parse(videoIDString)
 	if err != nil {
@@ -37,15 +35,19 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+	userID, ok := cfg.authenticate(w, r, scopeUpload)
+	if !ok {
 		return
 	}
-
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if cfg.rejectBannedUser(w, userID) {
+		return
+	}
+	if cfg.rejectLowDisk(w) {
+		return
+	}
+	opts, err := cfg.parseUploadOptions(r)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
 		return
 	}
 	video, err := cfg.db.GetVideo(videoID)
@@ -53,163 +55,760 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 		respondWithError(w, http.StatusBadRequest, "Unable to get video", err)
 		return
 	}
-	if video.UserID != userID {
-		respondWithError(w, http.StatusUnauthorized, "Not authorized to update this video", err)
+	allowed, err := cfg.canAccessVideo(video, userID, database.GrantPermissionEdit)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check video access", err)
+		return
+	}
+	if !allowed {
+		respondWithError(w, http.StatusUnauthorized, "Not authorized to update this video", nil)
 		return
 	}
+	release, ok := cfg.lockVideoProcessing(w, videoID)
+	if !ok {
+		return
+	}
+	// Once processing is queued the job owns the lock and the temp files,
+	// so the deferred cleanup only runs if the handler finishes first.
+	queued := false
+	defer func() {
+		if !queued {
+			release()
+		}
+	}()
+
+	reservation, ok := cfg.reserveUploadQuota(w, userID, r.ContentLength)
+	if !ok {
+		return
+	}
+	defer func() {
+		if !queued {
+			reservation.release()
+		}
+	}()
+	expectedSum, err := parseExpectedChecksum(r.Header.Get(checksumHeader))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid "+checksumHeader+" header", err)
+		return
+	}
+
+	uploadBody := cfg.trackUploadProgress(videoID, newStallDeadlineReader(w, r.Body, cfg.bodyReadTimeout), r.ContentLength)
+	defer cfg.uploadProgress.Clear(videoID)
+	r.Body = http.MaxBytesReader(w, uploadBody, maxUploadSize)
+	respondEncodingError := func(err error) {
+		if errors.Is(err, errUnsupportedContentEncoding) {
+			respondWithError(w, http.StatusUnsupportedMediaType, "Unsupported Content-Encoding", err)
+			return
+		}
+		respondUploadReadError(w, "Unable to decode upload", err)
+	}
+	if encoding := r.Header.Get("Content-Encoding"); encoding != "" {
+		decoded, err := cfg.decodeContentEncoding(r.Body, encoding)
+		if err != nil {
+			respondEncodingError(err)
+			return
+		}
+		// Cap the decompressed size too so a small compressed body can't
+		// expand past the upload limit.
+		r.Body = http.MaxBytesReader(w, io.NopCloser(decoded), maxUploadSize)
+		r.Header.Del("Content-Encoding")
+	}
 
-	file, header, err := r.FormFile("video")
+	mr, err := r.MultipartReader()
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Unable to parse from file", err)
+		respondWithError(w, http.StatusBadRequest, "Expected a multipart form", err)
+		return
+	}
+	parts := newPartReader(mr, cfg.maxMultipartParts)
+	file, err := parts.nextField("video")
+	if err != nil {
+		respondUploadReadError(w, "Unable to parse from file", err)
 		return
 	}
 	defer file.Close()
 
 	fmt.Println("uploading video", videoID, "by user", userID)
 
-	mediaType, _, err := mime.ParseMediaType(header.Header.Get("Content-Type"))
+	mediaType := ""
+	if contentType := file.Header.Get("Content-Type"); contentType != "" {
+		mediaType, _, err = mime.ParseMediaType(contentType)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid Content-Type", err)
+			return
+		}
+	}
+	var partBody io.Reader = file
+	if encoding := file.Header.Get("Content-Encoding"); encoding != "" {
+		partBody, err = cfg.decodeContentEncoding(file, encoding)
+		if err != nil {
+			respondEncodingError(err)
+			return
+		}
+		partBody = http.MaxBytesReader(w, io.NopCloser(partBody), maxUploadSize)
+	}
+	body := bufio.NewReaderSize(partBody, sniffLen)
+	head, err := body.Peek(sniffLen)
+	if err != nil && err != io.EOF {
+		respondUploadReadError(w, "Unable to read file", err)
+		return
+	}
+	mediaType, err = cfg.resolveVideoMediaType(mediaType, head)
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid Content-Type", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid file type", err)
 		return
 	}
-	if mediaType != "video/mp4" {
+	// The random part goes before the extension so tools that look at the
+	// file name still see the real container.
+	ext, err := mediaTypeToExt(mediaType)
+	if err != nil {
 		respondWithError(w, http.StatusBadRequest, "Invalid file type", err)
 		return
 	}
-	tmp, err := os.CreateTemp("", "tubely-upload.mp4")
+	tmp, err := os.CreateTemp("", "tubely-upload-*"+ext)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Unable to create file", err)
 		return
 	}
-	defer os.Remove(tmp.Name())
+	defer func() {
+		if !queued {
+			os.Remove(tmp.Name())
+		}
+	}()
 	defer tmp.Close()
-	_, err = io.Copy(tmp, file)
+
+	var src io.Reader = body
+	// Only MP4 can be stored as-is; anything else has to be transcoded
+	// from a complete file on disk. A client checksum has to be checked
+	// before anything is stored, so it rules out streaming too.
+	streamable := mediaType == "video/mp4" && !cfg.needsUploadOnDisk(opts) && expectedSum == ""
+	if streamable && (cfg.streamUploads || cfg.streamFastStart) {
+		probeStart := time.Now()
+		header, probe, ok, err := cfg.bufferStreamHeader(r.Context(), body, ext, cfg.streamProbeBytes)
+		probeTime := time.Since(probeStart)
+		if err != nil {
+			clearBodyDeadline(w)
+			respondUploadReadError(w, "Unable to read file", err)
+			return
+		}
+		defer os.Remove(header.Name())
+		defer header.Close()
+		if ok && !cfg.streamUploads {
+			// Without STREAM_UPLOADS only files that need no processing
+			// skip the disk copy.
+			ok, err = moovBeforeMdat(header.Name())
+			if err != nil {
+				log.Printf("Couldn't check fast-start layout of upload for video %s: %v", videoID, err)
+			}
+			ok = ok && cfg.reencodeOverBytes == 0
+		}
+		if ok {
+			cfg.finishStreamedUpload(r.Context(), w, video, mediaType, header.Name(), probe, probeTime, io.MultiReader(header, body), reservation)
+			return
+		}
+		// The header alone wasn't enough to probe (e.g. the moov atom is at
+		// the end), so spool the whole file to disk as usual.
+		src = io.MultiReader(header, body)
+	}
+	hash := sha256.New()
+	uploadedBytes, err := io.Copy(io.MultiWriter(tmp, hash), src)
+	if err != nil {
+		clearBodyDeadline(w)
+		respondUploadReadError(w, "Unable to write file", err)
+		return
+	}
+	if expectedSum != "" && hex.EncodeToString(hash.Sum(nil)) != expectedSum {
+		clearBodyDeadline(w)
+		respondWithError(w, http.StatusBadRequest, "Upload doesn't match "+checksumHeader, errChecksumMismatch)
+		return
+	}
+
+	// Extra audio tracks (audio_<lang> fields) must follow the video part.
+	audioTracks, err := readAudioTracks(parts)
+	defer func() {
+		if !queued {
+			removeAudioTracks(audioTracks)
+		}
+	}()
+	clearBodyDeadline(w)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Unable to write file", err)
+		respondUploadReadError(w, "Unable to read audio tracks", err)
+		return
+	}
+	for _, track := range audioTracks {
+		info, err := os.Stat(track.Path)
+		if err == nil {
+			uploadedBytes += info.Size()
+		}
+	}
+	if !reservation.resize(w, uploadedBytes) {
+		return
+	}
+
+	// The row records the upload before any processing starts, so an
+	// async reader sees "uploaded" rather than the previous state.
+	if !cfg.claimVideoUpload(w, &video) {
 		return
 	}
 
-	tmp.Seek(0, io.SeekStart)
+	tmp.Close()
+	upload := uploadedFile{
+		Path:        tmp.Name(),
+		MediaType:   mediaType,
+		Size:        uploadedBytes,
+		AudioTracks: audioTracks,
+		Reservation: reservation,
+	}
+	queued = cfg.dispatchUploadProcessing(w, r, video, userID, opts, upload, func() {
+		os.Remove(upload.Path)
+		removeAudioTracks(upload.AudioTracks)
+		release()
+	})
+}
+
+// needsUploadOnDisk reports whether a step configured for this upload reads
+// the whole file, which rules out streaming it straight to storage.
+func (cfg *apiConfig) needsUploadOnDisk(opts uploadOptions) bool {
+	return opts.AutoCaption || cfg.maxKeyframeInterval > 0 || len(cfg.inspectors) > 0 || cfg.hlsEnabled
+}
+
+// uploadedFile is a video upload spooled to disk and ready for processing.
+// Size is every byte received for it, extra audio tracks included, which
+// is what's counted against the upload quota. Processing commits or
+// releases Reservation.
+type uploadedFile struct {
+	Path        string
+	MediaType   string
+	Size        int64
+	AudioTracks []audioTrack
+	Reservation *uploadReservation
+}
+
+// processUploadedVideo runs the processing pipeline on a claimed, spooled
+// upload, stores the result as the video's next version and responds with
+// the updated video.
+func (cfg *apiConfig) processUploadedVideo(ctx context.Context, w http.ResponseWriter, video database.Video, userID uuid.UUID, opts uploadOptions, upload uploadedFile) {
+	videoID := video.ID
+	mediaType := upload.MediaType
+	defer upload.Reservation.release()
+
+	failProcessing := func(stage string, code int, msg string, err error) {
+		cfg.failVideoProcessing(w, &video, stage, code, msg, err)
+	}
 
-	//get aspect ratio
-	aspectRatio, err := getVideoAspectRatio(tmp.Name())
+	cfg.setProcessingStatus(&video, processingStatusProcessing, 10, nil)
+
+	pixFmt := cfg.defaultPixFmt
+	if opts.PixFmt != "" {
+		pixFmt = opts.PixFmt
+	}
+
+	timings := database.VideoTimings{VideoID: videoID}
+
+	// Inspectors see the file exactly as uploaded, before any conversion.
+	inspection, err := cfg.runInspectors(ctx, upload.Path)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Unable to find aspect", err)
+		failProcessing(processingStageValidate, http.StatusInternalServerError, "Unable to inspect video", err)
+		return
+	}
+	if inspection.Blocked != "" {
+		failProcessing(processingStageValidate, http.StatusUnprocessableEntity, "Upload rejected by "+inspection.Blocked, nil)
 		return
 	}
+	if len(inspection.Warnings) > 0 {
+		log.Printf("Inspection warnings for video %s: %s", videoID, strings.Join(inspection.Warnings, "; "))
+		w.Header().Set("X-Inspection-Warnings", strings.Join(inspection.Warnings, "; "))
+		// Queued jobs have no client to send the header to, so the
+		// warnings are kept for the status endpoint too.
+		if err := cfg.db.UpdateVideoProcessingWarnings(videoID, inspection.Warnings); err != nil {
+			log.Printf("Couldn't record inspection warnings for video %s: %v", videoID, err)
+		}
+		video.ProcessingWarnings = inspection.Warnings
+	}
 
-	aspect := ""
-	switch aspectRatio {
-	case "16:9":
-		aspect = "landscape"
-	case "9:16":
-		aspect = "portrait"
-	default:
-		aspect = "other"
+	// The declared type is only a hint; the container ffprobe finds decides
+	// whether the upload is accepted and whether it needs converting.
+	probeStart := time.Now()
+	probe, err := cfg.probeVideo(ctx, upload.Path)
+	timings.ProbeMS = time.Since(probeStart).Milliseconds()
+	if err != nil {
+		failProcessing(processingStageProbe, http.StatusUnprocessableEntity, "Unable to read video", err)
+		return
+	}
+	if !cfg.allowedVideoTypes[probe.Container] {
+		msg := "Unsupported video container"
+		if probe.Container != "" {
+			msg += " " + probe.Container
+		}
+		failProcessing(processingStageValidate, http.StatusUnsupportedMediaType, msg, nil)
+		return
+	}
+	if probe.Container != mediaType {
+		log.Printf("Upload for video %s declared %s but contains %s", videoID, mediaType, probe.Container)
+		mediaType = probe.Container
+	}
+
+	// Non-MP4 containers are converted up front so probing and every later
+	// step see the file that actually gets stored.
+	inputPath := upload.Path
+	if mediaType != "video/mp4" {
+		transcodeStart := time.Now()
+		transcodedPath, err := cfg.transcodeToMP4(ctx, inputPath, pixFmt)
+		timings.TranscodeMS = time.Since(transcodeStart).Milliseconds()
+		if err != nil {
+			failProcessing(processingStageTranscode, http.StatusUnprocessableEntity, "Unable to convert video to mp4", err)
+			return
+		}
+		defer os.Remove(transcodedPath)
+		os.Remove(upload.Path)
+		inputPath = transcodedPath
+		mediaType = "video/mp4"
+
+		probeStart := time.Now()
+		probe, err = cfg.probeVideo(ctx, inputPath)
+		timings.ProbeMS += time.Since(probeStart).Milliseconds()
+		if err != nil {
+			failProcessing(processingStageProbe, http.StatusInternalServerError, "Unable to find aspect", err)
+			return
+		}
 	}
-	key := getAssetPath(mediaType)
-	key = filepath.Join(aspect, key)
+	cfg.setProcessingStatus(&video, processingStatusProcessing, 30, nil)
 
-	processedFilePath, err := processVideoForFastStart(tmp.Name())
+	if cfg.strictDuration {
+		if err := checkDurationConsistency(probe); err != nil {
+			failProcessing(processingStageValidate, http.StatusUnprocessableEntity, "Declared duration doesn't match the video stream", err)
+			return
+		}
+	}
+
+	if cfg.requireThumbnail && video.ThumbnailURL == nil {
+		failProcessing(processingStageValidate, http.StatusUnprocessableEntity, "A thumbnail is required: upload one before uploading the video", nil)
+		return
+	}
+
+	if cfg.maxKeyframeInterval > 0 {
+		interval, err := cfg.probeKeyframeInterval(ctx, inputPath)
+		if err != nil {
+			failProcessing(processingStageProbe, http.StatusInternalServerError, "Unable to check keyframe interval", err)
+			return
+		}
+		if interval > cfg.maxKeyframeInterval {
+			if cfg.keyframeMode == keyframeModeReject {
+				msg := fmt.Sprintf("Keyframes are %s apart; at most %s is allowed", interval.Round(time.Millisecond), cfg.maxKeyframeInterval)
+				failProcessing(processingStageValidate, http.StatusUnprocessableEntity, msg, nil)
+				return
+			}
+			reencodedPath, err := cfg.reencodeWithKeyframes(ctx, inputPath, cfg.maxKeyframeInterval, pixFmt)
+			if err != nil {
+				failProcessing(processingStageTranscode, http.StatusInternalServerError, "Unable to re-encode keyframes", err)
+				return
+			}
+			defer os.Remove(reencodedPath)
+			inputPath = reencodedPath
+		}
+	}
+
+	aspect := aspectPrefix(probe.AspectRatio)
+	objectName, err := cfg.videoObjectName(video.Title, mediaType)
+	if err != nil {
+		failProcessing(processingStageStore, http.StatusInternalServerError, "Couldn't name video object", err)
+		return
+	}
+	key := cfg.videoKey(videoID, aspect, objectName)
+
+	latestVersion, err := cfg.db.GetLatestVideoVersionNumber(videoID)
+	if err != nil {
+		failProcessing(processingStageStore, http.StatusInternalServerError, "Couldn't look up video versions", err)
+		return
+	}
+	version := latestVersion + 1
+	key = versionedKey(key, version)
+
+	if cfg.verifyMoov && mediaType == "video/mp4" {
+		if err := verifyMP4Structure(inputPath); err != nil {
+			failProcessing(processingStageValidate, http.StatusUnprocessableEntity, "Incomplete or truncated MP4 file", err)
+			return
+		}
+	}
+
+	sourcePath := inputPath
+	audioLanguages := []string{}
+	if probe.HasAudio {
+		audioLanguages = append(audioLanguages, cfg.resolveAudioLanguage(ctx, inputPath, probe))
+	}
+	transcodeStart := time.Now()
+	if len(upload.AudioTracks) > 0 {
+		muxedPath, err := cfg.muxAudioTracks(ctx, sourcePath, audioLanguageOrUnd(audioLanguages), probe.HasAudio, upload.AudioTracks)
+		if err != nil {
+			failProcessing(processingStageMux, http.StatusUnprocessableEntity, "Unable to add audio tracks", err)
+			return
+		}
+		defer os.Remove(muxedPath)
+		sourcePath = muxedPath
+		for _, track := range upload.AudioTracks {
+			audioLanguages = append(audioLanguages, track.Language)
+		}
+	}
+
+	processedFilePath, err := cfg.processVideoForFastStart(ctx, sourcePath, probe.PixFmt, pixFmt)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Unable fast process", err)
+		failProcessing(processingStageTranscode, http.StatusInternalServerError, "Unable fast process", err)
 		return
 	}
 	defer os.Remove(processedFilePath)
+	cfg.setProcessingStatus(&video, processingStatusProcessing, 60, nil)
+
+	// ffmpeg needs the upload on disk, but once the processed copy exists
+	// the original is only read again for captions. Dropping it now keeps
+	// a single full-size copy on disk while the upload to S3 runs.
+	if !opts.AutoCaption {
+		os.Remove(upload.Path)
+		os.Remove(inputPath)
+		if sourcePath != inputPath {
+			os.Remove(sourcePath)
+		}
+	}
 
-	processedFile, err := os.Open(processedFilePath)
+	processedInfo, err := os.Stat(processedFilePath)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Unable to open processed file", err)
+		failProcessing(processingStageTranscode, http.StatusInternalServerError, "Unable to stat processed file", err)
 		return
 	}
-	defer processedFile.Close()
+	finalSize := processedInfo.Size()
+	if cfg.reencodeOverBytes > 0 && finalSize > cfg.reencodeOverBytes {
+		reencodedPath, ok, err := cfg.reencodeToTarget(ctx, processedFilePath, probe, cfg.reencodeTargetBytes, pixFmt)
+		if err != nil {
+			failProcessing(processingStageTranscode, http.StatusInternalServerError, "Unable to re-encode oversized video", err)
+			return
+		}
+		if ok {
+			defer os.Remove(reencodedPath)
+			processedFilePath = reencodedPath
+			if info, err := os.Stat(reencodedPath); err == nil {
+				finalSize = info.Size()
+			}
+		}
+		cfg.setProcessingStatus(&video, processingStatusProcessing, 80, nil)
+	}
 
-	_, err = cfg.s3Client.PutObject(context.TODO(), &s3.PutObjectInput{
-		Bucket: aws.String(cfg.s3Bucket),
-		Key:    aws.String(key),
-		//Body:        processedFile,
-		Body:        tmp,
-		ContentType: aws.String(mediaType),
-	})
+	timings.TranscodeMS += time.Since(transcodeStart).Milliseconds()
+
+	processedSum, err := fileSHA256(processedFilePath)
+	if err != nil {
+		failProcessing(processingStageUpload, http.StatusInternalServerError, "Unable to hash processed file", err)
+		return
+	}
+	existingKey, err := cfg.existingObjectFor(ctx, video.UserID, processedSum, key)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to upload", err)
+		failProcessing(processingStageStore, http.StatusInternalServerError, "Couldn't look up duplicate uploads", err)
 		return
 	}
+	if existingKey != "" {
+		log.Printf("Video %s version %d is identical to %s; reusing it", videoID, version, existingKey)
+		key = existingKey
+	} else {
+		processedFile, err := os.Open(processedFilePath)
+		if err != nil {
+			failProcessing(processingStageUpload, http.StatusInternalServerError, "Unable to open processed file", err)
+			return
+		}
+		defer processedFile.Close()
+
+		uploadStart := time.Now()
+		err = cfg.putVideoObjectChecksum(ctx, key, processedFile, mediaType, processedSum)
+		timings.UploadMS = time.Since(uploadStart).Milliseconds()
+		if err != nil {
+			failProcessing(processingStageUpload, http.StatusInternalServerError, "Failed to upload", err)
+			return
+		}
+	}
 
-	videoURL := cfg.getObjectURL(key)
+	_, err = cfg.db.CreateVideoVersion(videoID, version, key, finalSize, processedSum)
+	if err != nil {
+		failProcessing(processingStageStore, http.StatusInternalServerError, "Failed to record video version", err)
+		return
+	}
+
+	// A missing poster shouldn't fail the upload, so errors are only logged.
+	if video.ThumbnailURL == nil {
+		thumbnailURL, err := cfg.storeGeneratedThumbnail(ctx, videoID, processedFilePath, cfg.thumbnailAt, probe.Width, probe.Height)
+		if err != nil {
+			log.Printf("Couldn't generate thumbnail for video %s: %v", videoID, err)
+		} else {
+			video.ThumbnailURL = &thumbnailURL
+		}
+	}
+
+	if cfg.hlsEnabled {
+		cfg.setProcessingStatus(&video, processingStatusProcessing, 90, nil)
+	}
+	video.HLSURL = cfg.storeHLS(ctx, videoID, processedFilePath, probe.Width, probe.Height)
+
+	videoURL := cfg.videoURLRef(key)
 	video.VideoURL = &videoURL
-	err = cfg.db.UpdateVideo(video)
+	applyProbeMetadata(&video, probe)
+	video.Aspect = aspect
+	video.Bitrate = overallBitrate(finalSize, probe.DurationSec)
+	video.AudioLanguage = audioLanguageOrUnd(audioLanguages)
+	video.AudioLanguages = audioLanguages
+	video.OriginalSizeBytes = upload.Size
+	video.FinalSizeBytes = finalSize
+	video.SHA256 = processedSum
+	video.Status = processingStatusReady
+	video.Progress = 100
+	video.ProcessingError = nil
+	err = cfg.db.UpdateVideoProcessed(video)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to update video", err)
+		failProcessing(processingStageStore, http.StatusInternalServerError, "Failed to update video", err)
 		return
 	}
+	// The job may have sat in the queue while the owner edited the video,
+	// so respond with the row as it is now.
+	if current, err := cfg.db.GetVideo(videoID); err != nil {
+		log.Printf("Couldn't reload video %s after processing: %v", videoID, err)
+	} else if current.ID != uuid.Nil {
+		video = current
+	}
+
+	upload.Reservation.commit(upload.Size)
 
-	// video, err = cfg.dbVideoToSignedVideo(video)
-	// if err != nil {
-	// 	respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
-	// 	return
-	// }
+	cfg.saveVideoTimings(timings)
+	if opts.AutoCaption {
+		cfg.startAutoCaption(ctx, video, sourcePath, probe.HasAudio || len(upload.AudioTracks) > 0)
+	}
+	cfg.notifyProcessing(video, processingStatusReady, nil)
 
-	respondWithJSON(w, http.StatusOK, video)
+	cfg.respondWithSignedVideo(w, video)
 }
 
-func getVideoAspectRatio(filePath string) (string, error) {
+func respondUploadReadError(w http.ResponseWriter, msg string, err error) {
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case isTimeout(err):
+		respondWithError(w, http.StatusRequestTimeout, "Timed out waiting for upload data", err)
+	case errors.As(err, &maxBytesErr):
+		respondWithError(w, http.StatusRequestEntityTooLarge, "File is too large. Maximum size is 1 GB.", err)
+	default:
+		respondWithError(w, http.StatusBadRequest, msg, err)
+	}
+}
+
+// failVideoProcessing marks the video as failed, logs the failure for
+// admins, notifies the owner and responds with the error. An ffmpeg or
+// ffprobe run that hit its timeout is reported as 504.
+func (cfg *apiConfig) failVideoProcessing(w http.ResponseWriter, video *database.Video, stage string, code int, msg string, err error) {
+	procErr := errors.New(msg)
+	if err != nil {
+		procErr = fmt.Errorf("%s: %w", msg, err)
+	}
+	cfg.setProcessingStatus(video, processingStatusFailed, video.Progress, procErr)
+	cfg.recordProcessingError(*video, stage, procErr)
+	cfg.notifyProcessing(*video, processingStatusFailed, procErr)
+	if errors.Is(err, context.DeadlineExceeded) {
+		code = http.StatusGatewayTimeout
+	}
+	respondWithError(w, code, msg, err)
+}
+
+type videoProbe struct {
+	Width             int
+	Height            int
+	DurationSec       float64
+	StreamDurationSec float64
+	AspectRatio       string
+	VideoCodec        string
+	Bitrate           int64
+	FrameRate         float64
+	Container         string
+	HasAudio          bool
+	AudioLanguage     string
+	PixFmt            string
+}
+
+func (cfg *apiConfig) probeVideo(ctx context.Context, filePath string) (videoProbe, error) {
 	type VideoStream struct {
-		CodecName string `json:"codec_name"`
-		Width     int    `json:"width"`
-		Height    int    `json:"height"`
-		Duration  string `json:"duration"`
+		CodecType    string `json:"codec_type"`
+		CodecName    string `json:"codec_name"`
+		PixFmt       string `json:"pix_fmt"`
+		Width        int    `json:"width"`
+		Height       int    `json:"height"`
+		Duration     string `json:"duration"`
+		AvgFrameRate string `json:"avg_frame_rate"`
+		RFrameRate   string `json:"r_frame_rate"`
+		Tags         struct {
+			Language string `json:"language"`
+		} `json:"tags"`
+	}
+	type FFprobeFormat struct {
+		Duration   string `json:"duration"`
+		BitRate    string `json:"bit_rate"`
+		FormatName string `json:"format_name"`
+		Tags       struct {
+			MajorBrand string `json:"major_brand"`
+		} `json:"tags"`
 	}
 	type FFprobeResult struct {
 		Streams []VideoStream `json:"streams"`
+		Format  FFprobeFormat `json:"format"`
 	}
 
-	cmd := exec.Command("ffprobe", "-v", "error", "-print_format", "json", "-show_streams", filePath)
+	ctx, cancel := cfg.withCommandTimeout(ctx)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "ffprobe", "-v", "error", "-print_format", "json", "-show_streams", "-show_format", filePath)
 	var out bytes.Buffer
 	cmd.Stdout = &out
 
 	if err := cmd.Run(); err != nil {
-		return "", err
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return videoProbe{}, fmt.Errorf("ffprobe: %w", ctxErr)
+		}
+		return videoProbe{}, err
 	}
 
 	var result FFprobeResult
 	if err := json.Unmarshal(out.Bytes(), &result); err != nil {
-		return "", fmt.Errorf("could not parse ffprobe: %v", err)
+		return videoProbe{}, fmt.Errorf("could not parse ffprobe: %v", err)
+	}
+
+	var stream, audio *VideoStream
+	for i := range result.Streams {
+		switch result.Streams[i].CodecType {
+		case "video":
+			if stream == nil {
+				stream = &result.Streams[i]
+			}
+		case "audio":
+			if audio == nil {
+				audio = &result.Streams[i]
+			}
+		}
+	}
+	if stream == nil {
+		return videoProbe{}, errors.New("no video streams found")
+	}
+
+	streamDuration, _ := strconv.ParseFloat(stream.Duration, 64)
+	duration, err := strconv.ParseFloat(result.Format.Duration, 64)
+	if err != nil {
+		duration = streamDuration
+	}
+
+	probe := videoProbe{
+		Width:             stream.Width,
+		Height:            stream.Height,
+		DurationSec:       duration,
+		StreamDurationSec: streamDuration,
+		AspectRatio:       classifyAspectRatio(stream.Width, stream.Height),
+		VideoCodec:        stream.CodecName,
+		FrameRate:         parseFrameRate(stream.AvgFrameRate, stream.RFrameRate),
+		Container:         containerMediaType(result.Format.FormatName, result.Format.Tags.MajorBrand, readFileHead(filePath, sniffLen)),
+		PixFmt:            stream.PixFmt,
+	}
+	probe.Bitrate, _ = strconv.ParseInt(result.Format.BitRate, 10, 64)
+	if audio != nil {
+		probe.HasAudio = true
+		probe.AudioLanguage = normalizeLanguageTag(audio.Tags.Language)
 	}
+	return probe, nil
+}
 
-	if len(result.Streams) == 0 {
-		return "", errors.New("no video streams found")
+// aspectPrefix maps an aspect ratio to the folder its objects are stored
+// under and the value filtered on by the list endpoint.
+func aspectPrefix(aspectRatio string) string {
+	switch aspectRatio {
+	case "16:9":
+		return "landscape"
+	case "9:16":
+		return "portrait"
+	case "4:3":
+		return "standard"
+	case "1:1":
+		return "square"
+	default:
+		return "other"
 	}
+}
 
-	stream := result.Streams[0]
-	aspectRatio := float64(stream.Height) / float64(stream.Width)
+// classifyAspectRatio labels a frame size as "16:9", "9:16", "4:3", "1:1"
+// or "other". The ratio is always width/height, so landscape shapes are
+// above 1 and portrait shapes below it.
+func classifyAspectRatio(width, height int) string {
+	if width <= 0 || height <= 0 {
+		return "other"
+	}
+	aspectRatio := float64(width) / float64(height)
 	const tolerance = 0.01
 	switch {
+	case almostEqual(aspectRatio, 16.0/9.0, tolerance):
+		return "16:9"
 	case almostEqual(aspectRatio, 9.0/16.0, tolerance):
-		return "16:9", nil
+		return "9:16"
 	case almostEqual(aspectRatio, 4.0/3.0, tolerance):
-		return "4:3", nil
-	case almostEqual(aspectRatio, 16.0/9.0, tolerance):
-		return "9:16", nil
+		return "4:3"
 	case almostEqual(aspectRatio, 1.0, tolerance):
-		return "1:1", nil
+		return "1:1"
 	default:
-		return "Other", nil
+		return "other"
+	}
+}
+
+// checkDurationConsistency reports an error when the container and video
+// stream disagree about the duration by more than a small margin. Files
+// without both values pass, since there's nothing to compare.
+func checkDurationConsistency(probe videoProbe) error {
+	if probe.DurationSec <= 0 || probe.StreamDurationSec <= 0 {
+		return nil
+	}
+	tolerance := math.Max(2.0, probe.DurationSec*0.05)
+	if math.Abs(probe.DurationSec-probe.StreamDurationSec) > tolerance {
+		return fmt.Errorf("container duration %.2fs differs from stream duration %.2fs", probe.DurationSec, probe.StreamDurationSec)
 	}
+	return nil
 }
 
 func almostEqual(a, b, tolerance float64) bool {
 	return math.Abs(a-b) < tolerance
 }
 
-func processVideoForFastStart(filePath string) (string, error) {
+// fastStartArgs remuxes with the moov atom up front. The copy variant is
+// fast but only works when the streams are already MP4-compatible; the
+// re-encode variant converts to H.264/AAC.
+func fastStartArgs(input, output string, reencode bool, pixFmt string) []string {
+	args := []string{"-i", input}
+	if reencode {
+		args = append(args, "-c:v", "libx264", "-preset", "veryfast", "-crf", "23", "-pix_fmt", pixFmt, "-c:a", "aac", "-b:a", "128k")
+	} else {
+		args = append(args, "-c", "copy")
+	}
+	return append(args, "-movflags", "faststart", "-f", "mp4", "-y", output)
+}
+
+// processVideoForFastStart remuxes filePath for progressive playback.
+// pixFmt is only applied if the stream copy fails and the video has to be
+// re-encoded; on the copy path a mismatching source format is just logged.
+func (cfg *apiConfig) processVideoForFastStart(ctx context.Context, filePath, sourcePixFmt, pixFmt string) (string, error) {
+	ctx, cancel := cfg.withCommandTimeout(ctx)
+	defer cancel()
 	processedFilePath := fmt.Sprintf("%s.processing", filePath)
-	cmd := exec.Command("ffmpeg", "-i", filePath, "-c", "copy", "-movflags", "faststart", "-f", "mp4", processedFilePath)
+	cmd := cfg.ffmpegCommand(ctx, fastStartArgs(filePath, processedFilePath, false, pixFmt)...)
 	var stderr bytes.Buffer
 	cmd.Stderr = &stderr
 
 	if err := cmd.Run(); err != nil {
-		return "", fmt.Errorf("error processing video: %s, %v", stderr.String(), err)
+		if !cfg.reencodeFallback || ctx.Err() != nil {
+			os.Remove(processedFilePath)
+			return "", commandFailed(ctx, "error processing video", stderr.String(), err)
+		}
+		log.Printf("Stream copy failed for %s, falling back to a full re-encode: %v", filePath, err)
+		copyErr := stderr.String()
+		stderr.Reset()
+		cmd = cfg.ffmpegCommand(ctx, fastStartArgs(filePath, processedFilePath, true, pixFmt)...)
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			os.Remove(processedFilePath)
+			return "", commandFailed(ctx, fmt.Sprintf("error processing video: copy failed (%s) and re-encode failed", copyErr), stderr.String(), err)
+		}
+	} else if sourcePixFmt != "" && sourcePixFmt != pixFmt {
+		log.Printf("Copied %s with pixel format %s rather than %s; some devices may not play it", filePath, sourcePixFmt, pixFmt)
 	}
 
 	fileInfo, err := os.Stat(processedFilePath)
@@ -223,34 +822,3 @@ func processVideoForFastStart(filePath string) (string, error) {
 	return processedFilePath, nil
 
 }
-
-// func (cfg *apiConfig) dbVideoToSignedVideo(video database.Video) (database.Video, error) {
-// 	if video.VideoURL == nil {
-// 		return video, nil
-// 	}
-// 	data := strings.Split(*video.VideoURL, ",")
-// 	if len(data) < 2 {
-// 		return video, nil
-// 	}
-// 	presignURL, err := generatePresignedURL(cfg.s3Client, data[0], data[1], 5*time.Minute)
-// 	if err != nil {
-// 		return video, err
-// 	}
-
-// 	video.VideoURL = &presignURL
-// 	return video, nil
-
-// }
-// func generatePresignedURL(s3Client *s3.Client, bucket, key string, expireTime time.Duration) (string, error) {
-// 	s3PresignClient := s3.NewPresignClient(s3Client)
-
-// 	req, err := s3PresignClient.PresignGetObject(context.TODO(), &s3.GetObjectInput{
-// 		Bucket: aws.String(bucket),
-// 		Key:    aws.String(key),
-// 	}, s3.WithPresignExpires(expireTime))
-// 	if err != nil {
-// 		return "", fmt.Errorf("failed to generate presigned url %v", err)
-// 	}
-
-// 	return req.URL, nil
-// }
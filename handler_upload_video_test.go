@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func TestUploadVideoReportsDimensions(t *testing.T) {
+	cfg := newTestConfig(t)
+	installFakeMedia(t, &fakeMedia{Width: 1280, Height: 720})
+	userID := createTestUser(t, cfg)
+	video := createTestVideo(t, cfg, userID, visibilityPublic)
+
+	rec := uploadTestVideo(t, cfg, video.ID, userID, testMP4(1024, 0))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body)
+	}
+	got := decodeJSON[database.Video](t, rec)
+	if got.Width != 1280 || got.Height != 720 || got.Aspect != "landscape" {
+		t.Errorf("got %dx%d %q, want 1280x720 landscape", got.Width, got.Height, got.Aspect)
+	}
+}
+
+func TestUploadTempFileKeepsExtension(t *testing.T) {
+	tests := []struct {
+		mediaType string
+		ext       string
+	}{
+		{"video/mp4", ".mp4"},
+		{"video/webm", ".webm"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mediaType, func(t *testing.T) {
+			cfg := newTestConfig(t)
+			cfg.allowedVideoTypes[tt.mediaType] = true
+			installFakeMedia(t, &fakeMedia{Width: 1920, Height: 1080})
+			inspector := &fakeInspector{name: "recorder", verdict: Verdict{Action: verdictPass}}
+			cfg.inspectors = []Inspector{inspector}
+			userID := createTestUser(t, cfg)
+			video := createTestVideo(t, cfg, userID, visibilityPublic)
+
+			rec := httptest.NewRecorder()
+			cfg.handlerUploadVideo(rec, uploadRequest(t, video.ID, userID, testMP4(1024, 0), tt.mediaType))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("got status %d: %s", rec.Code, rec.Body)
+			}
+			paths := inspector.calls()
+			if len(paths) != 1 {
+				t.Fatalf("inspector saw %d files, want 1", len(paths))
+			}
+			if base := filepath.Base(paths[0]); !strings.HasPrefix(base, "tubely-upload-") || filepath.Ext(base) != tt.ext {
+				t.Errorf("temp file %q doesn't end in %s", base, tt.ext)
+			}
+		})
+	}
+}
+
+func TestUploadRequiresThumbnailUnderPolicy(t *testing.T) {
+	cfg := newTestConfig(t)
+	installFakeMedia(t, &fakeMedia{Width: 1920, Height: 1080})
+	userID := createTestUser(t, cfg)
+
+	cfg.requireThumbnail = true
+	bare := createTestVideo(t, cfg, userID, visibilityPublic)
+	if rec := uploadTestVideo(t, cfg, bare.ID, userID, testMP4(256, 0)); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("thumbnail-less upload under the policy: got status %d, want 422", rec.Code)
+	}
+
+	withThumb := createTestVideo(t, cfg, userID, visibilityPublic)
+	thumbnailURL := "http://localhost:8091/assets/thumb.jpg"
+	withThumb.ThumbnailURL = &thumbnailURL
+	if err := cfg.db.UpdateVideo(withThumb); err != nil {
+		t.Fatal(err)
+	}
+	if rec := uploadTestVideo(t, cfg, withThumb.ID, userID, testMP4(256, 1)); rec.Code != http.StatusOK {
+		t.Errorf("upload with a thumbnail under the policy: got status %d: %s", rec.Code, rec.Body)
+	}
+
+	cfg.requireThumbnail = false
+	other := createTestVideo(t, cfg, userID, visibilityPublic)
+	if rec := uploadTestVideo(t, cfg, other.ID, userID, testMP4(256, 2)); rec.Code != http.StatusOK {
+		t.Errorf("thumbnail-less upload without the policy: got status %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestUploadStrictDuration(t *testing.T) {
+	tests := []struct {
+		name           string
+		streamDuration float64
+		wantCode       int
+	}{
+		{"consistent", 10.2, http.StatusOK},
+		{"discrepant", 3, http.StatusUnprocessableEntity},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestConfig(t)
+			cfg.strictDuration = true
+			installFakeMedia(t, &fakeMedia{Width: 1920, Height: 1080, Duration: 10, StreamDuration: tt.streamDuration})
+			userID := createTestUser(t, cfg)
+			video := createTestVideo(t, cfg, userID, visibilityPublic)
+
+			rec := uploadTestVideo(t, cfg, video.ID, userID, testMP4(256, byte(i)))
+			if rec.Code != tt.wantCode {
+				t.Fatalf("got status %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			if got := decodeJSON[database.Video](t, rec); got.DurationSec != 10 {
+				t.Errorf("stored duration %v, want the container's 10", got.DurationSec)
+			}
+		})
+	}
+}
+
+func TestUploadReencodesOverSizeThreshold(t *testing.T) {
+	tests := []struct {
+		name         string
+		payload      int
+		wantReencode bool
+	}{
+		{"over threshold", 4096, true},
+		{"under threshold", 512, false},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestConfig(t)
+			cfg.reencodeOverBytes = 2048
+			cfg.reencodeTargetBytes = 1024
+			media := &fakeMedia{Width: 1920, Height: 1080, ReencodeSize: 1024}
+			installFakeMedia(t, media)
+			userID := createTestUser(t, cfg)
+			video := createTestVideo(t, cfg, userID, visibilityPublic)
+
+			body := testMP4(tt.payload, byte(i))
+			rec := uploadTestVideo(t, cfg, video.ID, userID, body)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("got status %d: %s", rec.Code, rec.Body)
+			}
+			got := decodeJSON[database.Video](t, rec)
+
+			reencoded := false
+			for _, args := range media.ffmpegRuns(t) {
+				reencoded = reencoded || slices.Contains(args, "-b:v")
+			}
+			if reencoded != tt.wantReencode {
+				t.Errorf("re-encoded = %v, want %v", reencoded, tt.wantReencode)
+			}
+			if got.OriginalSizeBytes != int64(len(body)) {
+				t.Errorf("original size %d, want %d", got.OriginalSizeBytes, len(body))
+			}
+			wantFinal := int64(len(body))
+			if tt.wantReencode {
+				wantFinal = 1024
+			}
+			if got.FinalSizeBytes != wantFinal {
+				t.Errorf("final size %d, want %d", got.FinalSizeBytes, wantFinal)
+			}
+		})
+	}
+}
+
+func TestFastStartReencodeFallback(t *testing.T) {
+	tests := []struct {
+		name     string
+		failCopy bool
+		fallback bool
+		wantRuns int
+		wantErr  bool
+	}{
+		{"copy succeeds", false, true, 1, false},
+		{"copy fails, re-encode succeeds", true, true, 2, false},
+		{"copy fails without fallback", true, false, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestConfig(t)
+			cfg.reencodeFallback = tt.fallback
+			media := &fakeMedia{FailCopy: tt.failCopy}
+			installFakeMedia(t, media)
+			input := writeTestFile(t, testMP4(256, 0))
+
+			out, err := cfg.processVideoForFastStart(context.Background(), input, "yuv420p", "yuv420p")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("processVideoForFastStart error = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil {
+				defer os.Remove(out)
+			}
+			runs := media.ffmpegRuns(t)
+			if len(runs) != tt.wantRuns {
+				t.Fatalf("ffmpeg ran %d times, want %d: %q", len(runs), tt.wantRuns, runs)
+			}
+			if !slices.Contains(runs[0], "copy") {
+				t.Errorf("first run %q isn't a stream copy", runs[0])
+			}
+			if tt.wantRuns == 2 && !slices.Contains(runs[1], "libx264") {
+				t.Errorf("fallback run %q isn't a re-encode", runs[1])
+			}
+		})
+	}
+}
+
+func TestUploadAppliesPixelFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		failCopy bool
+		want     string // -pix_fmt on the remux, "" for none
+	}{
+		{"copy path", "", false, ""},
+		{"re-encode with the default", "", true, "yuv420p"},
+		{"re-encode with pixfmt", "pixfmt=yuv444p", true, "yuv444p"},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestConfig(t)
+			cfg.reencodeFallback = true
+			media := &fakeMedia{Width: 1920, Height: 1080, PixFmt: "yuv422p", FailCopy: tt.failCopy}
+			installFakeMedia(t, media)
+			userID := createTestUser(t, cfg)
+			video := createTestVideo(t, cfg, userID, visibilityPublic)
+
+			req := uploadRequest(t, video.ID, userID, testMP4(256, byte(i)), "video/mp4")
+			req.URL.RawQuery = tt.query
+			rec := httptest.NewRecorder()
+			cfg.handlerUploadVideo(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("got status %d: %s", rec.Code, rec.Body)
+			}
+
+			got := ""
+			for _, args := range media.ffmpegRuns(t) {
+				if i := slices.Index(args, "-pix_fmt"); i >= 0 {
+					got = args[i+1]
+				}
+			}
+			if got != tt.want {
+				t.Errorf("-pix_fmt = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClassifyAspectRatio(t *testing.T) {
+	tests := []struct {
+		width, height int
+		want          string
+		prefix        string
+	}{
+		{1920, 1080, "16:9", "landscape"},
+		{1080, 1920, "9:16", "portrait"},
+		{640, 480, "4:3", "standard"},
+		{512, 512, "1:1", "square"},
+		{1000, 1333, "other", "other"},
+		{0, 1080, "other", "other"},
+	}
+	for _, tt := range tests {
+		got := classifyAspectRatio(tt.width, tt.height)
+		if got != tt.want {
+			t.Errorf("classifyAspectRatio(%d, %d) = %q, want %q", tt.width, tt.height, got, tt.want)
+		}
+		if prefix := aspectPrefix(got); prefix != tt.prefix {
+			t.Errorf("aspectPrefix(%q) = %q, want %q", got, prefix, tt.prefix)
+		}
+	}
+}
@@ -44,3 +44,59 @@ func (cfg *apiConfig) handlerUsersCreate(w http.ResponseWriter, r *http.Request)
 
 	respondWithJSON(w, http.StatusCreated, user)
 }
+
+func (cfg *apiConfig) handlerUserPreferencesUpdate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		DefaultVisibility *string `json:"default_visibility"`
+	}
+
+	userID, ok := cfg.authenticate(w, r, scopeWrite)
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	// A null default_visibility clears the preference so the global
+	// default applies again.
+	if params.DefaultVisibility != nil {
+		if err := validateVisibility(*params.DefaultVisibility); err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error(), err)
+			return
+		}
+	}
+
+	err = cfg.db.SetUserDefaultVisibility(userID, params.DefaultVisibility)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update preferences", err)
+		return
+	}
+
+	user, err := cfg.db.GetUser(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, user)
+}
+
+func (cfg *apiConfig) handlerUserStats(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticate(w, r, scopeRead)
+	if !ok {
+		return
+	}
+
+	stats, err := cfg.db.UserStats(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user stats", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, stats)
+}
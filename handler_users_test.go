@@ -0,0 +1,104 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func createVideoAs(t *testing.T, cfg *apiConfig, userID uuid.UUID, body string) database.Video {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	cfg.handlerVideoMetaCreate(rec, newAuthedRequest(t, http.MethodPost, "/api/videos", strings.NewReader(body), userID))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create video: got status %d: %s", rec.Code, rec.Body)
+	}
+	return decodeJSON[database.Video](t, rec)
+}
+
+func TestNewVideoInheritsDefaultVisibility(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.defaultVisibility = visibilityPublic
+	userID := createTestUser(t, cfg)
+
+	if got := createVideoAs(t, cfg, userID, `{"title":"Before"}`); got.Visibility != visibilityPublic {
+		t.Errorf("without a preference: got %q, want the global default %q", got.Visibility, visibilityPublic)
+	}
+
+	rec := httptest.NewRecorder()
+	body := strings.NewReader(`{"default_visibility":"private"}`)
+	cfg.handlerUserPreferencesUpdate(rec, newAuthedRequest(t, http.MethodPut, "/api/users/me/preferences", body, userID))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("update preferences: got status %d: %s", rec.Code, rec.Body)
+	}
+
+	if got := createVideoAs(t, cfg, userID, `{"title":"After"}`); got.Visibility != visibilityPrivate {
+		t.Errorf("with a private preference: got %q, want private", got.Visibility)
+	}
+	if got := createVideoAs(t, cfg, userID, `{"title":"Explicit","visibility":"public"}`); got.Visibility != visibilityPublic {
+		t.Errorf("explicit visibility: got %q, want public", got.Visibility)
+	}
+	if other := createVideoAs(t, cfg, createTestUser(t, cfg), `{"title":"Other"}`); other.Visibility != visibilityPublic {
+		t.Errorf("another user's video: got %q, want the global default", other.Visibility)
+	}
+}
+
+func TestUserStatsAggregates(t *testing.T) {
+	cfg := newTestConfig(t)
+	userID := createTestUser(t, cfg)
+	for _, v := range []struct {
+		aspect   string
+		duration float64
+		size     int64
+	}{
+		{"landscape", 60, 1000},
+		{"landscape", 120.5, 2000},
+		{"portrait", 30, 500},
+		{"", 0, 0},
+	} {
+		video := createTestVideo(t, cfg, userID, visibilityPublic)
+		video.Aspect = v.aspect
+		video.DurationSec = v.duration
+		video.FinalSizeBytes = v.size
+		if err := cfg.db.UpdateVideo(video); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deleted := createTestVideo(t, cfg, userID, visibilityPublic)
+	deleted.Aspect = "portrait"
+	deleted.DurationSec = 999
+	if err := cfg.db.UpdateVideo(deleted); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.db.SoftDeleteVideo(deleted.ID); err != nil {
+		t.Fatal(err)
+	}
+	createTestVideo(t, cfg, createTestUser(t, cfg), visibilityPublic)
+
+	rec := httptest.NewRecorder()
+	cfg.handlerUserStats(rec, newAuthedRequest(t, http.MethodGet, "/api/users/me/stats", nil, userID))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body)
+	}
+	got := decodeJSON[database.UserStats](t, rec)
+	if got.VideoCount != 4 || got.TotalDurationSec != 210.5 || got.TotalBytes != 3500 {
+		t.Errorf("totals = %d videos, %vs, %d bytes, want 4, 210.5s, 3500", got.VideoCount, got.TotalDurationSec, got.TotalBytes)
+	}
+	want := map[string]database.AspectStats{
+		"landscape": {Count: 2, TotalDurationSec: 180.5, TotalBytes: 3000},
+		"portrait":  {Count: 1, TotalDurationSec: 30, TotalBytes: 500},
+		"unknown":   {Count: 1},
+	}
+	if len(got.ByAspect) != len(want) {
+		t.Errorf("by_aspect = %+v, want %+v", got.ByAspect, want)
+	}
+	for aspect, w := range want {
+		if got.ByAspect[aspect] != w {
+			t.Errorf("by_aspect[%s] = %+v, want %+v", aspect, got.ByAspect[aspect], w)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"log"
+	"mime"
+	"net/http"
+	"path"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// handlerVideoClone copies a public or shared video into the caller's
+// account. The stored object is copied server-side, so nothing is
+// re-downloaded or re-processed, but the copy still counts against the
+// caller's upload quota.
+func (cfg *apiConfig) handlerVideoClone(w http.ResponseWriter, r *http.Request) {
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+
+	userID, ok := cfg.authenticate(w, r, scopeUpload)
+	if !ok {
+		return
+	}
+	if cfg.rejectBannedUser(w, userID) || cfg.rejectBannedVideo(w, videoID) {
+		return
+	}
+
+	source, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if source.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", nil)
+		return
+	}
+	allowed := source.Visibility == visibilityPublic
+	if !allowed {
+		allowed, err = cfg.canAccessVideo(source, userID, database.GrantPermissionView)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't check video access", err)
+			return
+		}
+	}
+	if !allowed {
+		respondWithError(w, http.StatusForbidden, "You can't clone this video", nil)
+		return
+	}
+
+	latest, err := cfg.db.GetLatestVideoVersionNumber(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't look up video versions", err)
+		return
+	}
+	if latest == 0 {
+		respondWithError(w, http.StatusConflict, "Video hasn't been uploaded yet", nil)
+		return
+	}
+	version, err := cfg.db.GetVideoVersion(videoID, latest)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video version", err)
+		return
+	}
+
+	reservation, ok := cfg.reserveUploadQuota(w, userID, source.FinalSizeBytes)
+	if !ok {
+		return
+	}
+	defer reservation.release()
+
+	visibility, err := cfg.defaultVisibilityFor(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get default visibility", err)
+		return
+	}
+	clone, err := cfg.db.CreateVideo(database.CreateVideoParams{
+		Title:       source.Title,
+		Description: source.Description,
+		UserID:      userID,
+		Visibility:  visibility,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create video", err)
+		return
+	}
+	// Drop the half-made clone if any later step fails.
+	failClone := func(msg string, err error) {
+		cfg.deleteObject(r.Context(), cfg.thumbnailKey(clone.ID))
+		if delErr := cfg.db.DeleteVideo(clone.ID); delErr != nil {
+			log.Printf("Couldn't remove failed clone %s: %v", clone.ID, delErr)
+		}
+		respondWithError(w, http.StatusInternalServerError, msg, err)
+	}
+
+	mediaType := mime.TypeByExtension(path.Ext(version.Key))
+	if mediaType == "" {
+		mediaType = "video/mp4"
+	}
+	objectName, err := cfg.videoObjectName(source.Title, mediaType)
+	if err != nil {
+		failClone("Couldn't name video object", err)
+		return
+	}
+	key := versionedKey(cfg.videoKey(clone.ID, source.Aspect, objectName), 1)
+	if err := cfg.copyObject(r.Context(), version.Key, key); err != nil {
+		failClone("Couldn't copy video", err)
+		return
+	}
+	if _, err := cfg.db.CreateVideoVersion(clone.ID, 1, key, version.SizeBytes, version.SHA256); err != nil {
+		cfg.deleteObject(r.Context(), key)
+		failClone("Failed to record video version", err)
+		return
+	}
+
+	// Only generated posters are copied; an uploaded thumbnail belongs to
+	// the source and is removed along with it.
+	if source.ThumbnailURL != nil && unversionedURL(*source.ThumbnailURL) == cfg.getObjectURL(cfg.thumbnailKey(source.ID)) {
+		if err := cfg.copyObject(r.Context(), cfg.thumbnailKey(source.ID), cfg.thumbnailKey(clone.ID)); err != nil {
+			log.Printf("Couldn't copy thumbnail for clone %s: %v", clone.ID, err)
+		} else {
+			thumbnailURL := cfg.getVersionedObjectURL(r.Context(), cfg.thumbnailKey(clone.ID))
+			clone.ThumbnailURL = &thumbnailURL
+		}
+	}
+
+	videoURL := cfg.videoURLRef(key)
+	clone.VideoURL = &videoURL
+	clone.Width = source.Width
+	clone.Height = source.Height
+	clone.Aspect = source.Aspect
+	clone.DurationSec = source.DurationSec
+	clone.VideoCodec = source.VideoCodec
+	clone.Bitrate = source.Bitrate
+	clone.FrameRate = source.FrameRate
+	clone.AudioLanguage = source.AudioLanguage
+	clone.AudioLanguages = source.AudioLanguages
+	clone.Blurhash = source.Blurhash
+	clone.OriginalSizeBytes = source.OriginalSizeBytes
+	clone.FinalSizeBytes = source.FinalSizeBytes
+	clone.SHA256 = source.SHA256
+	clone.Status = processingStatusReady
+	clone.Progress = 100
+	if err := cfg.db.UpdateVideo(clone); err != nil {
+		cfg.deleteObject(r.Context(), key)
+		failClone("Failed to update video", err)
+		return
+	}
+
+	reservation.commit(source.FinalSizeBytes)
+
+	clone, err = cfg.dbVideoToSignedVideo(clone)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't generate presigned url", err)
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, clone)
+}
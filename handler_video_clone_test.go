@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func cloneVideo(t *testing.T, cfg *apiConfig, videoID, userID uuid.UUID) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	cfg.handlerVideoClone(rec, videoActionRequest(t, http.MethodPost, "/clone", videoID, userID))
+	return rec
+}
+
+func createUploadedVideo(t *testing.T, cfg *apiConfig, userID uuid.UUID, visibility string, body []byte) database.Video {
+	t.Helper()
+	video := createTestVideo(t, cfg, userID, visibility)
+	key := storeTestVersion(t, cfg, video.ID, body)
+	videoURL := cfg.videoURLRef(key)
+	video.VideoURL = &videoURL
+	video.Aspect = "landscape"
+	video.FinalSizeBytes = int64(len(body))
+	if err := cfg.db.UpdateVideo(video); err != nil {
+		t.Fatal(err)
+	}
+	return video
+}
+
+func TestCloneVideo(t *testing.T) {
+	cfg := newTestConfig(t)
+	ownerID := createTestUser(t, cfg)
+	callerID := createTestUser(t, cfg)
+	body := testMP4(512, 0)
+	source := createUploadedVideo(t, cfg, ownerID, visibilityPublic, body)
+
+	rec := cloneVideo(t, cfg, source.ID, callerID)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body)
+	}
+	clone := decodeJSON[database.Video](t, rec)
+	if clone.ID == source.ID || clone.UserID != callerID {
+		t.Fatalf("clone %s is owned by %s, want a new video owned by %s", clone.ID, clone.UserID, callerID)
+	}
+	if clone.Title != source.Title || clone.Aspect != source.Aspect || clone.Status != processingStatusReady {
+		t.Errorf("clone %+v doesn't carry over the source's metadata", clone)
+	}
+
+	key := latestVersionKey(t, cfg, clone.ID)
+	if key == latestVersionKey(t, cfg, source.ID) {
+		t.Errorf("clone shares the source's key %s", key)
+	}
+	if got := getTestObject(t, cfg, key); !bytes.Equal(got, body) {
+		t.Errorf("cloned object has %d bytes, want a copy of the source's %d", len(got), len(body))
+	}
+}
+
+func TestClonePrivateVideoRejected(t *testing.T) {
+	cfg := newTestConfig(t)
+	ownerID := createTestUser(t, cfg)
+	callerID := createTestUser(t, cfg)
+	source := createUploadedVideo(t, cfg, ownerID, visibilityPrivate, testMP4(512, 0))
+
+	if rec := cloneVideo(t, cfg, source.ID, callerID); rec.Code != http.StatusForbidden {
+		t.Fatalf("got status %d, want 403: %s", rec.Code, rec.Body)
+	}
+	videos, err := cfg.db.GetVideos(callerID, database.VideoSortNewest, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(videos) != 0 {
+		t.Errorf("rejected clone left %d videos in the caller's account", len(videos))
+	}
+}
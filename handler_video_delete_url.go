@@ -0,0 +1,126 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const defaultDeleteURLExpiry = 5 * time.Minute
+
+// ownedUploadedVideo loads a video for the delete-url endpoints, which only
+// the owner may use and only on S3, where the client can reach the bucket.
+// It responds and returns false on any failure.
+func (cfg *apiConfig) ownedUploadedVideo(w http.ResponseWriter, r *http.Request) (database.Video, database.VideoVersion, bool) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return database.Video{}, database.VideoVersion{}, false
+	}
+
+	userID, ok := cfg.authenticate(w, r, scopeDelete)
+	if !ok {
+		return database.Video{}, database.VideoVersion{}, false
+	}
+
+	if _, ok := cfg.storage.(deletePresigner); !ok {
+		respondWithError(w, http.StatusNotImplemented, "Presigned delete URLs aren't supported by this storage backend", nil)
+		return database.Video{}, database.VideoVersion{}, false
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return database.Video{}, database.VideoVersion{}, false
+	}
+	if video.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return database.Video{}, database.VideoVersion{}, false
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "You can't delete this video", nil)
+		return database.Video{}, database.VideoVersion{}, false
+	}
+
+	latest, err := cfg.db.GetLatestVideoVersionNumber(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't look up video versions", err)
+		return database.Video{}, database.VideoVersion{}, false
+	}
+	if latest == 0 {
+		respondWithError(w, http.StatusConflict, "Video hasn't been uploaded yet", nil)
+		return database.Video{}, database.VideoVersion{}, false
+	}
+	version, err := cfg.db.GetVideoVersion(videoID, latest)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video version", err)
+		return database.Video{}, database.VideoVersion{}, false
+	}
+	return video, version, true
+}
+
+// handlerVideoDeleteURL hands the owner a short-lived presigned DELETE for
+// the current version's object. Once it has been used, the client calls
+// handlerVideoDeleteURLComplete so the server drops the rest.
+func (cfg *apiConfig) handlerVideoDeleteURL(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		URL       string    `json:"url"`
+		Method    string    `json:"method"`
+		Key       string    `json:"key"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+
+	video, version, ok := cfg.ownedUploadedVideo(w, r)
+	if !ok {
+		return
+	}
+	refs, err := cfg.db.CountKeyReferences(version.Key, video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check video object", err)
+		return
+	}
+	if refs > 0 {
+		respondWithError(w, http.StatusConflict, "Video object is shared with a duplicate upload; delete the video instead", nil)
+		return
+	}
+
+	url, err := cfg.storage.(deletePresigner).PresignDeleteURL(version.Key, cfg.deleteURLExpiry)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't generate presigned delete url", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, response{
+		URL:       url,
+		Method:    http.MethodDelete,
+		Key:       version.Key,
+		ExpiresAt: cfg.now().Add(cfg.deleteURLExpiry).UTC(),
+	})
+}
+
+// handlerVideoDeleteURLComplete reconciles the database after a client-side
+// delete. The object must really be gone; older versions, the generated
+// thumbnail and the row are then removed server-side.
+func (cfg *apiConfig) handlerVideoDeleteURLComplete(w http.ResponseWriter, r *http.Request) {
+	video, version, ok := cfg.ownedUploadedVideo(w, r)
+	if !ok {
+		return
+	}
+
+	exists, err := cfg.objectExists(r.Context(), version.Key)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check video object", err)
+		return
+	}
+	if exists {
+		respondWithError(w, http.StatusConflict, "Video object still exists; delete it with the presigned URL first", nil)
+		return
+	}
+
+	if err := cfg.hardDeleteVideo(r.Context(), video); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete video", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
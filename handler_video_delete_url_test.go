@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestVideoDeleteURL(t *testing.T) {
+	cfg, fake := newTestS3Config(t, "tubely", "")
+	ownerID := createTestUser(t, cfg)
+	video := createTestVideo(t, cfg, ownerID, visibilityPublic)
+	key := storeTestVersion(t, cfg, video.ID, testMP4(256, 0))
+
+	call := func(handler http.HandlerFunc, suffix string, userID uuid.UUID) *httptest.ResponseRecorder {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handler(rec, videoActionRequest(t, http.MethodPost, suffix, video.ID, userID))
+		return rec
+	}
+
+	if rec := call(cfg.handlerVideoDeleteURL, "/delete-url", createTestUser(t, cfg)); rec.Code != http.StatusForbidden {
+		t.Errorf("another user: got status %d, want 403", rec.Code)
+	}
+	if rec := call(cfg.handlerVideoDeleteURLComplete, "/delete-url/complete", ownerID); rec.Code != http.StatusConflict {
+		t.Errorf("complete before deleting: got status %d, want 409", rec.Code)
+	}
+
+	rec := call(cfg.handlerVideoDeleteURL, "/delete-url", ownerID)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body)
+	}
+	got := decodeJSON[struct {
+		URL       string    `json:"url"`
+		Method    string    `json:"method"`
+		Key       string    `json:"key"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}](t, rec)
+	if got.Key != key || got.Method != http.MethodDelete {
+		t.Errorf("got %s %s, want DELETE %s", got.Method, got.Key, key)
+	}
+	u, err := url.Parse(got.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Path != "/tubely/"+key {
+		t.Errorf("URL path %s, want /tubely/%s", u.Path, key)
+	}
+	query := u.Query()
+	if query.Get("X-Amz-Signature") == "" || query.Get("X-Amz-Expires") != "300" {
+		t.Errorf("URL %s isn't presigned for %s", got.URL, defaultDeleteURLExpiry)
+	}
+
+	req, err := http.NewRequest(http.MethodDelete, got.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if _, ok := fake.object("tubely", key); ok {
+		t.Fatal("object survived the presigned DELETE")
+	}
+
+	if rec := call(cfg.handlerVideoDeleteURLComplete, "/delete-url/complete", ownerID); rec.Code != http.StatusNoContent {
+		t.Fatalf("complete: got status %d: %s", rec.Code, rec.Body)
+	}
+	if stored, err := cfg.db.GetVideo(video.ID); err != nil || stored.ID != uuid.Nil {
+		t.Errorf("video row survived the completed delete (err %v)", err)
+	}
+	if keys := fake.keys("tubely"); len(keys) != 0 {
+		t.Errorf("objects left behind: %q", keys)
+	}
+}
+
+func TestVideoDeleteURLNeedsS3(t *testing.T) {
+	cfg := newTestConfig(t)
+	userID := createTestUser(t, cfg)
+	video := createTestVideo(t, cfg, userID, visibilityPublic)
+	storeTestVersion(t, cfg, video.ID, testMP4(256, 0))
+
+	rec := httptest.NewRecorder()
+	cfg.handlerVideoDeleteURL(rec, videoActionRequest(t, http.MethodPost, "/delete-url", video.ID, userID))
+	if rec.Code != http.StatusNotImplemented {
+		t.Errorf("local backend: got status %d, want 501", rec.Code)
+	}
+}
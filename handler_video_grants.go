@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// videoOwnerFromRequest authenticates the caller and loads the video in the
+// path, checking the caller owns it. It writes the error response itself.
+func (cfg *apiConfig) videoOwnerFromRequest(w http.ResponseWriter, r *http.Request) (database.Video, bool) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return database.Video{}, false
+	}
+
+	userID, ok := cfg.authenticate(w, r, scopeWrite)
+	if !ok {
+		return database.Video{}, false
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return database.Video{}, false
+	}
+	if video.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return database.Video{}, false
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "Only the owner can manage access to this video", nil)
+		return database.Video{}, false
+	}
+	return video, true
+}
+
+func (cfg *apiConfig) handlerVideoGrantsList(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.videoOwnerFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	grants, err := cfg.db.GetVideoGrants(video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get grants", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, grants)
+}
+
+func (cfg *apiConfig) handlerVideoGrantCreate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		GranteeUserID uuid.UUID `json:"grantee_user_id"`
+		Permission    string    `json:"permission"`
+	}
+
+	video, ok := cfg.videoOwnerFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	params := parameters{}
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if params.Permission == "" {
+		params.Permission = database.GrantPermissionView
+	}
+	if params.Permission != database.GrantPermissionView && params.Permission != database.GrantPermissionEdit {
+		respondWithError(w, http.StatusBadRequest, "Permission must be \"view\" or \"edit\"", nil)
+		return
+	}
+	if params.GranteeUserID == uuid.Nil || params.GranteeUserID == video.UserID {
+		respondWithError(w, http.StatusBadRequest, "A grantee other than the owner is required", nil)
+		return
+	}
+	grantee, err := cfg.db.GetUser(params.GranteeUserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get grantee", err)
+		return
+	}
+	if grantee == nil {
+		respondWithError(w, http.StatusNotFound, "Grantee not found", nil)
+		return
+	}
+
+	grant, err := cfg.db.UpsertVideoGrant(video.ID, params.GranteeUserID, params.Permission)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create grant", err)
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, grant)
+}
+
+func (cfg *apiConfig) handlerVideoGrantDelete(w http.ResponseWriter, r *http.Request) {
+	granteeUserID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID", err)
+		return
+	}
+
+	video, ok := cfg.videoOwnerFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if err := cfg.db.DeleteVideoGrant(video.ID, granteeUserID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke grant", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
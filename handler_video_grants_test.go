@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestVideoGrantAllowsStreamingUntilRevoked(t *testing.T) {
+	cfg := newTestConfig(t)
+	ownerID := createTestUser(t, cfg)
+	granteeID := createTestUser(t, cfg)
+	video := createTestVideo(t, cfg, ownerID, visibilityPrivate)
+	storeTestVersion(t, cfg, video.ID, testMP4(128, 0))
+
+	stream := func() int {
+		rec := httptest.NewRecorder()
+		cfg.handlerVideoStream(rec, streamRequest(t, video.ID, granteeID))
+		return rec.Code
+	}
+
+	if code := stream(); code != http.StatusForbidden {
+		t.Errorf("stream before the grant: got status %d, want 403", code)
+	}
+
+	body := `{"grantee_user_id":"` + granteeID.String() + `","permission":"view"}`
+	req := newAuthedRequest(t, http.MethodPost, "/api/videos/"+video.ID.String()+"/grants", strings.NewReader(body), ownerID)
+	req.SetPathValue("videoID", video.ID.String())
+	rec := httptest.NewRecorder()
+	cfg.handlerVideoGrantCreate(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("grant: got status %d: %s", rec.Code, rec.Body)
+	}
+
+	if code := stream(); code != http.StatusOK {
+		t.Errorf("stream by the grantee: got status %d, want 200", code)
+	}
+	rec = httptest.NewRecorder()
+	cfg.handlerVideoMetaDelete(rec, videoActionRequest(t, http.MethodDelete, "", video.ID, granteeID))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("delete by the grantee: got status %d, want 403", rec.Code)
+	}
+	if got, err := cfg.db.GetVideo(video.ID); err != nil || got.ID != video.ID {
+		t.Fatalf("video gone after the grantee's delete (err %v)", err)
+	}
+
+	req = newAuthedRequest(t, http.MethodDelete, "/api/videos/"+video.ID.String()+"/grants/"+granteeID.String(), nil, ownerID)
+	req.SetPathValue("videoID", video.ID.String())
+	req.SetPathValue("userID", granteeID.String())
+	rec = httptest.NewRecorder()
+	cfg.handlerVideoGrantDelete(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("revoke: got status %d: %s", rec.Code, rec.Body)
+	}
+
+	if code := stream(); code != http.StatusForbidden {
+		t.Errorf("stream after revoking: got status %d, want 403", code)
+	}
+}
+
+func TestVideoGrantOnlyByOwner(t *testing.T) {
+	cfg := newTestConfig(t)
+	ownerID := createTestUser(t, cfg)
+	otherID := createTestUser(t, cfg)
+	video := createTestVideo(t, cfg, ownerID, visibilityPrivate)
+
+	body := `{"grantee_user_id":"` + otherID.String() + `"}`
+	req := newAuthedRequest(t, http.MethodPost, "/api/videos/"+video.ID.String()+"/grants", strings.NewReader(body), otherID)
+	req.SetPathValue("videoID", video.ID.String())
+	rec := httptest.NewRecorder()
+	cfg.handlerVideoGrantCreate(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("self-grant by a non-owner: got status %d, want 403", rec.Code)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// handlerVideoHLSPlaylist serves a stored HLS playlist with its segment
+// URIs replaced by freshly presigned URLs. GET .../hls/master.m3u8 is the
+// usual entry point; variant playlists are fetched through the same route
+// via the relative URIs the master playlist keeps.
+func (cfg *apiConfig) handlerVideoHLSPlaylist(w http.ResponseWriter, r *http.Request) {
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+
+	if cfg.rejectBannedVideo(w, videoID) {
+		return
+	}
+
+	name := r.PathValue("playlist")
+	if !strings.HasSuffix(name, ".m3u8") || path.Clean("/"+name) != "/"+name {
+		respondWithError(w, http.StatusBadRequest, "Invalid playlist path", nil)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", nil)
+		return
+	}
+	if !cfg.authorizeVideoView(w, r, video) {
+		return
+	}
+
+	key := cfg.hlsPrefix(videoID) + name
+	playlist, err := cfg.readObject(r.Context(), key, maxHLSPlaylistBytes)
+	if errors.Is(err, errObjectNotFound) {
+		respondWithError(w, http.StatusNotFound, "Playlist not found", nil)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't read playlist", err)
+		return
+	}
+
+	expiry := cfg.presignExpiryFor(video)
+	signed, err := rewriteHLSPlaylist(playlist, key, func(segmentKey string) (string, error) {
+		return cfg.presignGetURL(segmentKey, expiry)
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't sign playlist", err)
+		return
+	}
+
+	// The signed URLs expire, so a cached copy would go stale.
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", hlsPlaylistContentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(signed)
+}
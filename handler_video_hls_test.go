@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func getHLSPlaylist(t *testing.T, cfg *apiConfig, videoID, userID uuid.UUID, name string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := newAuthedRequest(t, http.MethodGet, "/api/videos/"+videoID.String()+"/hls/"+name, nil, userID)
+	req.SetPathValue("videoID", videoID.String())
+	req.SetPathValue("playlist", name)
+	rec := httptest.NewRecorder()
+	cfg.handlerVideoHLSPlaylist(rec, req)
+	return rec
+}
+
+func TestHLSPlaylistSignsSegments(t *testing.T) {
+	cfg := newTestConfig(t)
+	userID := createTestUser(t, cfg)
+	video := createTestVideo(t, cfg, userID, visibilityPublic)
+	prefix := cfg.hlsPrefix(video.ID)
+	putTestObject(t, cfg, prefix+"master.m3u8", []byte("#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=2800000\n720p/index.m3u8\n"))
+	putTestObject(t, cfg, prefix+"720p/index.m3u8", []byte(
+		"#EXTM3U\n#EXT-X-MAP:URI=\"init.mp4\"\n#EXTINF:4.0,\nseg0.ts\n#EXTINF:4.0,\nseg1.ts\n#EXT-X-ENDLIST\n"))
+
+	rec := getHLSPlaylist(t, cfg, video.ID, userID, "master.m3u8")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("master playlist: got status %d: %s", rec.Code, rec.Body)
+	}
+	if !strings.Contains(rec.Body.String(), "\n720p/index.m3u8\n") {
+		t.Errorf("master playlist should keep its relative variant URI, got:\n%s", rec.Body)
+	}
+
+	rec = getHLSPlaylist(t, cfg, video.ID, userID, "720p/index.m3u8")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("variant playlist: got status %d: %s", rec.Code, rec.Body)
+	}
+	if got := rec.Header().Get("Cache-Control"); got != "no-store" {
+		t.Errorf("Cache-Control = %q, want no-store", got)
+	}
+	body := rec.Body.String()
+	segments := []string{"seg0.ts", "seg1.ts"}
+	var uris []string
+	for _, line := range strings.Split(body, "\n") {
+		if line != "" && !strings.HasPrefix(line, "#") {
+			uris = append(uris, line)
+		}
+	}
+	if len(uris) != len(segments) {
+		t.Fatalf("got segment URIs %q, want %d", uris, len(segments))
+	}
+	for i, uri := range uris {
+		signedQuery(t, cfg, uri, prefix+"720p/"+segments[i])
+	}
+	start := strings.Index(body, `URI="`)
+	if start < 0 {
+		t.Fatalf("EXT-X-MAP lost its URI:\n%s", body)
+	}
+	mapURI := body[start+len(`URI="`):]
+	mapURI = mapURI[:strings.Index(mapURI, `"`)]
+	signedQuery(t, cfg, mapURI, prefix+"720p/init.mp4")
+}
+
+func TestHLSPlaylistRejectsBadPaths(t *testing.T) {
+	cfg := newTestConfig(t)
+	userID := createTestUser(t, cfg)
+	video := createTestVideo(t, cfg, userID, visibilityPublic)
+
+	for _, name := range []string{"../other/master.m3u8", "720p/seg0.ts"} {
+		if rec := getHLSPlaylist(t, cfg, video.ID, userID, name); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: got status %d, want 400", name, rec.Code)
+		}
+	}
+	if rec := getHLSPlaylist(t, cfg, video.ID, userID, "master.m3u8"); rec.Code != http.StatusNotFound {
+		t.Errorf("missing playlist: got status %d, want 404", rec.Code)
+	}
+}
@@ -1,39 +1,59 @@
 package main
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
 
-	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
 	"github.com/google/uuid"
 )
 
+var validAspects = map[string]bool{
+	"landscape": true,
+	"portrait":  true,
+	"standard":  true,
+	"square":    true,
+	"other":     true,
+}
+
 func (cfg *apiConfig) handlerVideoMetaCreate(w http.ResponseWriter, r *http.Request) {
 	type parameters struct {
 		database.CreateVideoParams
 	}
 
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
-		return
-	}
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+	userID, ok := cfg.authenticate(w, r, scopeWrite)
+	if !ok {
 		return
 	}
 
 	decoder := json.NewDecoder(r.Body)
 	params := parameters{}
-	err = decoder.Decode(&params)
+	err := decoder.Decode(&params)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters", err)
 		return
 	}
 	params.UserID = userID
 
+	if params.Visibility == "" {
+		params.Visibility, err = cfg.defaultVisibilityFor(userID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get default visibility", err)
+			return
+		}
+	}
+	if err := validateVisibility(params.Visibility); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	if err := cfg.validateURLTTL(params.URLTTLSeconds); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
 	video, err := cfg.db.CreateVideo(params.CreateVideoParams)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't create video", err)
@@ -51,14 +71,8 @@ func (cfg *apiConfig) handlerVideoMetaDelete(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
-		return
-	}
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+	userID, ok := cfg.authenticate(w, r, scopeDelete)
+	if !ok {
 		return
 	}
 
@@ -72,7 +86,11 @@ func (cfg *apiConfig) handlerVideoMetaDelete(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	err = cfg.db.DeleteVideo(videoID)
+	if cfg.deleteGracePeriod <= 0 {
+		err = cfg.hardDeleteVideo(r.Context(), video)
+	} else {
+		err = cfg.db.SoftDeleteVideo(videoID)
+	}
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't delete video", err)
 		return
@@ -81,6 +99,50 @@ func (cfg *apiConfig) handlerVideoMetaDelete(w http.ResponseWriter, r *http.Requ
 	w.WriteHeader(http.StatusNoContent)
 }
 
+func (cfg *apiConfig) handlerVideoUndelete(w http.ResponseWriter, r *http.Request) {
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	userID, ok := cfg.authenticate(w, r, scopeDelete)
+	if !ok {
+		return
+	}
+
+	video, err := cfg.db.GetVideoIncludingDeleted(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "You can't restore this video", nil)
+		return
+	}
+	if video.DeletedAt == nil {
+		respondWithError(w, http.StatusConflict, "Video isn't deleted", nil)
+		return
+	}
+	if cfg.now().Sub(*video.DeletedAt) >= cfg.deleteGracePeriod {
+		respondWithError(w, http.StatusGone, "The undo window for this video has passed", nil)
+		return
+	}
+
+	if err := cfg.db.UndeleteVideo(videoID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't restore video", err)
+		return
+	}
+	video.DeletedAt = nil
+
+	cfg.respondWithSignedVideo(w, video)
+}
+
 func (cfg *apiConfig) handlerVideoGet(w http.ResponseWriter, r *http.Request) {
 	videoIDString := r.PathValue("videoID")
 	videoID, err := uuid.Parse(videoIDString)
@@ -89,47 +151,112 @@ func (cfg *apiConfig) handlerVideoGet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if cfg.rejectBannedVideo(w, videoID) {
+		return
+	}
+
 	video, err := cfg.db.GetVideo(videoID)
 	if err != nil {
 		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
 		return
 	}
+	if video.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return
+	}
+	if !cfg.authorizeVideoView(w, r, video) {
+		return
+	}
+
+	video.Versions, err = cfg.db.GetVideoVersions(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video versions", err)
+		return
+	}
+	video.Captions, err = cfg.db.GetVideoCaptions(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video captions", err)
+		return
+	}
 
-	// video, err = cfg.dbVideoToSignedVideo(video)
-	// if err != nil {
-	// 	respondWithError(w, http.StatusInternalServerError, "Couldn't generate presigned url", err)
-	// 	return
-	// }
+	if versionString := r.URL.Query().Get("version"); versionString != "" {
+		version, err := strconv.Atoi(versionString)
+		if err != nil || version < 1 {
+			respondWithError(w, http.StatusBadRequest, "Invalid version", err)
+			return
+		}
+		v, err := cfg.db.GetVideoVersion(videoID, version)
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusNotFound, "Version not found", err)
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get video version", err)
+			return
+		}
+		videoURL := cfg.videoURLRef(v.Key)
+		video.VideoURL = &videoURL
+	}
 
-	respondWithJSON(w, http.StatusOK, video)
+	cfg.respondWithSignedVideo(w, video)
 }
 
 func (cfg *apiConfig) handlerVideosRetrieve(w http.ResponseWriter, r *http.Request) {
-	token, err := auth.GetBearerToken(r.Header)
+	userID, ok := cfg.authenticate(w, r, scopeRead)
+	if !ok {
+		return
+	}
+
+	limit, offset, err := parsePagination(r)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
 		return
 	}
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	sort, err := parseVideoSort(r, cfg.defaultVideoSort)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
 		return
 	}
 
-	videos, err := cfg.db.GetVideos(userID)
+	var videos []database.Video
+	var total int
+	if aspect := r.URL.Query().Get("aspect"); aspect != "" {
+		if !validAspects[aspect] {
+			respondWithError(w, http.StatusBadRequest, "aspect must be one of landscape, portrait, standard, square or other", nil)
+			return
+		}
+		videos, err = cfg.db.GetVideosByAspect(userID, aspect, sort, limit, offset)
+		if err == nil {
+			total, err = cfg.db.CountVideosByAspect(userID, aspect)
+		}
+	} else {
+		videos, err = cfg.db.GetVideos(userID, sort, limit, offset)
+		if err == nil {
+			total, err = cfg.db.CountVideos(userID)
+		}
+	}
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve videos", err)
 		return
 	}
 
-	// for i, video := range videos {
-	// 	video, err := cfg.dbVideoToSignedVideo(video)
-	// 	if err != nil {
-	// 		respondWithError(w, http.StatusInternalServerError, "Couldn't generate presign url", err)
-	// 		return
-	// 	}
-	// 	videos[i] = video
-	// }
+	for i, video := range videos {
+		banned, err := cfg.markBannedVideo(&video)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't check moderation status", err)
+			return
+		}
+		if banned {
+			videos[i] = video
+			continue
+		}
+		video, err = cfg.dbVideoToSignedVideo(video)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't generate presigned url", err)
+			return
+		}
+		videos[i] = video
+	}
 
-	respondWithJSON(w, http.StatusOK, videos)
+	respondWithJSON(w, http.StatusOK, newPage(r, videos, total, limit, offset))
 }
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func listVideos(t *testing.T, cfg *apiConfig, userID uuid.UUID, query string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	cfg.handlerVideosRetrieve(rec, newAuthedRequest(t, http.MethodGet, "/api/videos"+query, nil, userID))
+	return rec
+}
+
+func TestVideosRetrieveFiltersByAspect(t *testing.T) {
+	cfg := newTestConfig(t)
+	userID := createTestUser(t, cfg)
+	aspects := []string{"landscape", "portrait", "standard", "square", "other"}
+	ids := map[string]uuid.UUID{}
+	for _, aspect := range aspects {
+		video := createTestVideo(t, cfg, userID, visibilityPublic)
+		video.Aspect = aspect
+		if err := cfg.db.UpdateVideo(video); err != nil {
+			t.Fatal(err)
+		}
+		ids[aspect] = video.ID
+	}
+
+	for _, aspect := range aspects {
+		t.Run(aspect, func(t *testing.T) {
+			rec := listVideos(t, cfg, userID, "?aspect="+aspect)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("got status %d: %s", rec.Code, rec.Body)
+			}
+			got := decodeJSON[page[database.Video]](t, rec)
+			if len(got.Items) != 1 || got.Items[0].ID != ids[aspect] || got.Total != 1 {
+				t.Errorf("got %d videos (total %d), want only %s", len(got.Items), got.Total, ids[aspect])
+			}
+		})
+	}
+
+	if rec := listVideos(t, cfg, userID, "?aspect=wide"); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid aspect: got status %d, want 400", rec.Code)
+	}
+}
+
+func TestVideosRetrieveLinksNextPage(t *testing.T) {
+	cfg := newTestConfig(t)
+	userID := createTestUser(t, cfg)
+	for range defaultPageLimit + 1 {
+		createTestVideo(t, cfg, userID, visibilityPublic)
+	}
+
+	got := decodeJSON[page[database.Video]](t, listVideos(t, cfg, userID, ""))
+	if len(got.Items) != defaultPageLimit || !got.HasMore {
+		t.Fatalf("got %d videos with has_more %v, want %d and true", len(got.Items), got.HasMore, defaultPageLimit)
+	}
+	if want := "/api/videos?limit=50&offset=50"; got.Next != want {
+		t.Fatalf("got next %q, want %q", got.Next, want)
+	}
+
+	rest := decodeJSON[page[database.Video]](t, listVideos(t, cfg, userID, "?limit=50&offset=50"))
+	if len(rest.Items) != 1 || rest.HasMore || rest.Next != "" {
+		t.Errorf("last page: got %d videos, has_more %v, next %q; want 1, false and none", len(rest.Items), rest.HasMore, rest.Next)
+	}
+}
+
+func TestVideoMetaCreateUsesInjectedGenerators(t *testing.T) {
+	cfg := newTestConfig(t)
+	userID := createTestUser(t, cfg)
+	fixedID := uuid.MustParse("00000000-0000-4000-8000-000000000001")
+	fixedNow := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	cfg.uuidgen = func() uuid.UUID { return fixedID }
+	setTestClock(cfg, func() time.Time { return fixedNow })
+
+	body := strings.NewReader(`{"title":"Fixed","description":"Deterministic"}`)
+	rec := httptest.NewRecorder()
+	cfg.handlerVideoMetaCreate(rec, newAuthedRequest(t, http.MethodPost, "/api/videos", body, userID))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body)
+	}
+	got := decodeJSON[database.Video](t, rec)
+	if got.ID != fixedID {
+		t.Errorf("got ID %s, want %s", got.ID, fixedID)
+	}
+	if !got.CreatedAt.Equal(fixedNow) || !got.UpdatedAt.Equal(fixedNow) {
+		t.Errorf("got timestamps %s / %s, want %s", got.CreatedAt, got.UpdatedAt, fixedNow)
+	}
+}
+
+func TestVideosRetrieveSort(t *testing.T) {
+	cfg := newTestConfig(t)
+	clock := time.Date(2026, 5, 1, 9, 0, 0, 0, time.UTC)
+	setTestClock(cfg, func() time.Time {
+		clock = clock.Add(time.Minute)
+		return clock
+	})
+	userID := createTestUser(t, cfg)
+
+	// Created in this order, so oldest first is a, b, c.
+	fixtures := []struct {
+		title    string
+		duration float64
+		size     int64
+	}{
+		{"banana", 30, 100},
+		{"Apple", 10, 300},
+		{"cherry", 20, 200},
+	}
+	var ids []uuid.UUID
+	for _, f := range fixtures {
+		video := createTestVideo(t, cfg, userID, visibilityPublic)
+		video.Title = f.title
+		video.DurationSec = f.duration
+		video.FinalSizeBytes = f.size
+		if err := cfg.db.UpdateVideo(video); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, video.ID)
+	}
+	a, b, c := ids[0], ids[1], ids[2]
+
+	order := func(query string) []uuid.UUID {
+		t.Helper()
+		rec := listVideos(t, cfg, userID, query)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: got status %d: %s", query, rec.Code, rec.Body)
+		}
+		var got []uuid.UUID
+		for _, video := range decodeJSON[page[database.Video]](t, rec).Items {
+			got = append(got, video.ID)
+		}
+		return got
+	}
+
+	tests := []struct {
+		sort database.VideoSort
+		want []uuid.UUID
+	}{
+		{database.VideoSortNewest, []uuid.UUID{c, b, a}},
+		{database.VideoSortOldest, []uuid.UUID{a, b, c}},
+		{database.VideoSortTitle, []uuid.UUID{b, a, c}},
+		{database.VideoSortDuration, []uuid.UUID{a, c, b}},
+		{database.VideoSortSize, []uuid.UUID{b, c, a}},
+	}
+	if len(tests) != len(database.VideoSorts) {
+		t.Errorf("table covers %d sorts, database.VideoSorts has %d", len(tests), len(database.VideoSorts))
+	}
+	for _, tt := range tests {
+		if got := order("?sort=" + string(tt.sort)); !slices.Equal(got, tt.want) {
+			t.Errorf("sort=%s: got %v, want %v", tt.sort, got, tt.want)
+		}
+	}
+
+	cfg.defaultVideoSort = database.VideoSortOldest
+	if got := order(""); !slices.Equal(got, []uuid.UUID{a, b, c}) {
+		t.Errorf("configured default: got %v, want oldest first", got)
+	}
+	for _, sort := range []string{"random", "created_at; DROP TABLE videos"} {
+		if rec := listVideos(t, cfg, userID, "?sort="+url.QueryEscape(sort)); rec.Code != http.StatusBadRequest {
+			t.Errorf("sort=%q: got status %d, want 400", sort, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// parseFrameRate reads ffprobe's "num/den" frame rates, preferring the
+// average over the stream's base rate. It returns 0 when neither is usable,
+// as ffprobe reports "0/0" for streams without timing.
+func parseFrameRate(rates ...string) float64 {
+	for _, rate := range rates {
+		num, den, ok := strings.Cut(rate, "/")
+		if !ok {
+			continue
+		}
+		n, err1 := strconv.ParseFloat(num, 64)
+		d, err2 := strconv.ParseFloat(den, 64)
+		if err1 != nil || err2 != nil || n <= 0 || d <= 0 {
+			continue
+		}
+		return n / d
+	}
+	return 0
+}
+
+// overallBitrate is a stored file's average bitrate in bits per second,
+// which is what ffprobe reports as the format bit_rate.
+func overallBitrate(sizeBytes int64, durationSec float64) int64 {
+	if durationSec <= 0 {
+		return 0
+	}
+	return int64(float64(sizeBytes*8) / durationSec)
+}
+
+// applyProbeMetadata copies the stream details shown to clients from a
+// probe onto the video. Bitrate is left to the caller, since the probed
+// file isn't always the one that gets stored.
+func applyProbeMetadata(video *database.Video, probe videoProbe) {
+	video.Width = probe.Width
+	video.Height = probe.Height
+	video.DurationSec = probe.DurationSec
+	video.VideoCodec = probe.VideoCodec
+	video.FrameRate = probe.FrameRate
+}
+
+// handlerVideoMetadata re-probes the current version of a video, saves
+// what it finds and returns it.
+func (cfg *apiConfig) handlerVideoMetadata(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		VideoID     uuid.UUID `json:"video_id"`
+		Version     int       `json:"version"`
+		DurationSec float64   `json:"duration_sec"`
+		Width       int       `json:"width"`
+		Height      int       `json:"height"`
+		Aspect      string    `json:"aspect"`
+		VideoCodec  string    `json:"video_codec"`
+		Bitrate     int64     `json:"bitrate"`
+		FrameRate   float64   `json:"frame_rate"`
+		SizeBytes   int64     `json:"size_bytes"`
+		HasAudio    bool      `json:"has_audio"`
+	}
+
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	userID, ok := cfg.authenticate(w, r, scopeRead)
+	if !ok {
+		return
+	}
+
+	if cfg.rejectBannedVideo(w, videoID) {
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		return
+	}
+	allowed, err := cfg.canAccessVideo(video, userID, database.GrantPermissionView)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check video access", err)
+		return
+	}
+	if !allowed {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", nil)
+		return
+	}
+	release, ok := cfg.lockVideoProcessing(w, videoID)
+	if !ok {
+		return
+	}
+	defer release()
+
+	latest, err := cfg.db.GetLatestVideoVersionNumber(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't look up video versions", err)
+		return
+	}
+	if latest == 0 {
+		respondWithError(w, http.StatusConflict, "Video hasn't been uploaded yet", nil)
+		return
+	}
+	version, err := cfg.db.GetVideoVersion(videoID, latest)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video version", err)
+		return
+	}
+
+	localPath, err := cfg.downloadObjectToTemp(r.Context(), version.Key, "tubely-metadata-*"+filepath.Ext(version.Key))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't download video", err)
+		return
+	}
+	defer os.Remove(localPath)
+
+	probe, err := cfg.probeVideo(r.Context(), localPath)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't probe video", err)
+		return
+	}
+	info, err := os.Stat(localPath)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't stat video", err)
+		return
+	}
+
+	applyProbeMetadata(&video, probe)
+	video.Bitrate = probe.Bitrate
+	if video.Bitrate == 0 {
+		video.Bitrate = overallBitrate(info.Size(), probe.DurationSec)
+	}
+	video.FinalSizeBytes = info.Size()
+	err = cfg.db.UpdateVideo(video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update video", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		VideoID:     video.ID,
+		Version:     version.Version,
+		DurationSec: video.DurationSec,
+		Width:       video.Width,
+		Height:      video.Height,
+		Aspect:      video.Aspect,
+		VideoCodec:  video.VideoCodec,
+		Bitrate:     video.Bitrate,
+		FrameRate:   video.FrameRate,
+		SizeBytes:   video.FinalSizeBytes,
+		HasAudio:    probe.HasAudio,
+	})
+}
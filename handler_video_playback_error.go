@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	maxStoredPlaybackErrors  = 50
+	maxPlaybackErrorCodeLen  = 64
+	maxPlaybackErrorTextLen  = 1024
+	maxPlaybackErrorBodySize = 8 << 10
+)
+
+func (cfg *apiConfig) handlerVideoPlaybackErrorReport(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Code      string `json:"code"`
+		Message   string `json:"message"`
+		UserAgent string `json:"userAgent"`
+	}
+
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+
+	if !cfg.playbackErrorLimiter.Allow(clientIP(r) + "/" + videoID.String()) {
+		respondWithError(w, http.StatusTooManyRequests, "Too many playback error reports", nil)
+		return
+	}
+
+	params := parameters{}
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPlaybackErrorBodySize))
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	params.Code = strings.TrimSpace(params.Code)
+	if params.Code == "" {
+		respondWithError(w, http.StatusBadRequest, "Error code is required", nil)
+		return
+	}
+	if len(params.Code) > maxPlaybackErrorCodeLen {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Error code must be at most %d characters", maxPlaybackErrorCodeLen), nil)
+		return
+	}
+	if params.UserAgent == "" {
+		params.UserAgent = r.UserAgent()
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return
+	}
+
+	err = cfg.db.RecordPlaybackError(database.CreatePlaybackErrorParams{
+		VideoID:   videoID,
+		Code:      params.Code,
+		Message:   truncate(params.Message, maxPlaybackErrorTextLen),
+		UserAgent: truncate(params.UserAgent, maxPlaybackErrorTextLen),
+	}, maxStoredPlaybackErrors)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't record playback error", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerAdminPlaybackErrors(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		VideoID uuid.UUID                `json:"video_id"`
+		Count   int                      `json:"count"`
+		Recent  []database.PlaybackError `json:"recent"`
+	}
+
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+
+	if _, ok := cfg.requireAdmin(w, r); !ok {
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return
+	}
+
+	recent, err := cfg.db.GetPlaybackErrors(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get playback errors", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		VideoID: videoID,
+		Count:   video.PlaybackErrorCount,
+		Recent:  recent,
+	})
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
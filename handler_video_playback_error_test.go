@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func reportPlaybackError(t *testing.T, cfg *apiConfig, videoID uuid.UUID, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/videos/"+videoID.String()+"/playback-error", strings.NewReader(body))
+	req.SetPathValue("videoID", videoID.String())
+	rec := httptest.NewRecorder()
+	cfg.handlerVideoPlaybackErrorReport(rec, req)
+	return rec
+}
+
+func TestPlaybackErrorIsRecorded(t *testing.T) {
+	cfg := newTestConfig(t)
+	adminID := createTestUser(t, cfg)
+	cfg.adminUserIDs = map[uuid.UUID]bool{adminID: true}
+	video := createTestVideo(t, cfg, createTestUser(t, cfg), visibilityPublic)
+
+	for _, code := range []string{"MEDIA_ERR_DECODE", "MEDIA_ERR_NETWORK"} {
+		rec := reportPlaybackError(t, cfg, video.ID, `{"code":"`+code+`","message":"failed","userAgent":"test-agent"}`)
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("report %s: got status %d: %s", code, rec.Code, rec.Body)
+		}
+	}
+
+	req := newAuthedRequest(t, http.MethodGet, "/admin/videos/"+video.ID.String()+"/playback-errors", nil, adminID)
+	req.SetPathValue("videoID", video.ID.String())
+	rec := httptest.NewRecorder()
+	cfg.handlerAdminPlaybackErrors(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("admin list: got status %d: %s", rec.Code, rec.Body)
+	}
+	got := decodeJSON[struct {
+		Count  int                      `json:"count"`
+		Recent []database.PlaybackError `json:"recent"`
+	}](t, rec)
+	if got.Count != 2 {
+		t.Errorf("count = %d, want 2", got.Count)
+	}
+	if len(got.Recent) != 2 || got.Recent[0].Code != "MEDIA_ERR_NETWORK" || got.Recent[0].UserAgent != "test-agent" {
+		t.Errorf("recent = %+v, want both reports newest first", got.Recent)
+	}
+}
+
+func TestPlaybackErrorRateLimited(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.playbackErrorLimiter = newRateLimiter(1, time.Minute, cfg.now)
+	video := createTestVideo(t, cfg, createTestUser(t, cfg), visibilityPublic)
+
+	if rec := reportPlaybackError(t, cfg, video.ID, `{"code":"E1"}`); rec.Code != http.StatusNoContent {
+		t.Fatalf("first report: got status %d: %s", rec.Code, rec.Body)
+	}
+	if rec := reportPlaybackError(t, cfg, video.ID, `{"code":"E2"}`); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("second report: got status %d, want 429", rec.Code)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func (cfg *apiConfig) handlerVideoRenditionGet(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Quality   string    `json:"quality"`
+		URL       string    `json:"url"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+
+	if cfg.rejectBannedVideo(w, videoID) {
+		return
+	}
+
+	quality := r.PathValue("quality")
+	if _, ok := findRendition(quality); !ok {
+		respondWithError(w, http.StatusBadRequest, "Unknown quality", nil)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", nil)
+		return
+	}
+	if !cfg.authorizeVideoView(w, r, video) {
+		return
+	}
+
+	key := cfg.renditionKey(videoID, quality)
+	exists, err := cfg.objectExists(r.Context(), key)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't look up rendition", err)
+		return
+	}
+	if !exists {
+		respondWithError(w, http.StatusNotFound, "Rendition not found", nil)
+		return
+	}
+
+	// This is a direct link to the stored variant playlist. Its segment
+	// URIs are relative and unsigned; players that need every segment
+	// signed use the HLS route instead. The URL isn't taken from the
+	// presign cache so expires_at is exact.
+	expiry := cfg.presignExpiryFor(video)
+	url, err := cfg.signGetURL(key, expiry)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't generate presigned url", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, response{
+		Quality:   quality,
+		URL:       url,
+		ExpiresAt: cfg.now().Add(expiry).UTC(),
+	})
+}
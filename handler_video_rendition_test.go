@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func getRendition(t *testing.T, cfg *apiConfig, videoID, userID uuid.UUID, quality string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := newAuthedRequest(t, http.MethodGet, "/api/videos/"+videoID.String()+"/rendition/"+quality, nil, userID)
+	req.SetPathValue("videoID", videoID.String())
+	req.SetPathValue("quality", quality)
+	rec := httptest.NewRecorder()
+	cfg.handlerVideoRenditionGet(rec, req)
+	return rec
+}
+
+func TestVideoRenditionGet(t *testing.T) {
+	cfg := newTestConfig(t)
+	now := time.Date(2026, 5, 1, 9, 0, 0, 0, time.UTC)
+	setTestClock(cfg, func() time.Time { return now })
+	userID := createTestUser(t, cfg)
+	video := createTestVideo(t, cfg, userID, visibilityPrivate)
+	key := cfg.renditionKey(video.ID, "720p")
+	putTestObject(t, cfg, key, []byte("#EXTM3U\n"))
+
+	rec := getRendition(t, cfg, video.ID, userID, "720p")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("existing rendition: got status %d: %s", rec.Code, rec.Body)
+	}
+	got := decodeJSON[struct {
+		Quality   string    `json:"quality"`
+		URL       string    `json:"url"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}](t, rec)
+	if got.Quality != "720p" {
+		t.Errorf("quality = %q, want 720p", got.Quality)
+	}
+	query := signedQuery(t, cfg, got.URL, key)
+	wantExpiry := now.Add(cfg.presignExpiry)
+	if !got.ExpiresAt.Equal(wantExpiry) {
+		t.Errorf("expires_at = %v, want %v", got.ExpiresAt, wantExpiry)
+	}
+	if query.Get("expires") != strconv.FormatInt(wantExpiry.Unix(), 10) {
+		t.Errorf("URL expires at %s, want %d to match expires_at", query.Get("expires"), wantExpiry.Unix())
+	}
+
+	if rec := getRendition(t, cfg, video.ID, userID, "1080p"); rec.Code != http.StatusNotFound {
+		t.Errorf("rendition that wasn't produced: got status %d, want 404", rec.Code)
+	}
+	if rec := getRendition(t, cfg, video.ID, userID, "4k"); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown quality: got status %d, want 400", rec.Code)
+	}
+	if rec := getRendition(t, cfg, video.ID, uuid.Nil, "720p"); rec.Code == http.StatusOK {
+		t.Error("private video's rendition was returned without credentials")
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// handlerVideoReprocess re-probes the stored object for a video and refreshes
+// its metadata. If the aspect classification changed, the object is moved to
+// the matching prefix so its key stays consistent with the stored aspect.
+func (cfg *apiConfig) handlerVideoReprocess(w http.ResponseWriter, r *http.Request) {
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	userID, ok := cfg.authenticate(w, r, scopeUpload)
+	if !ok {
+		return
+	}
+
+	if cfg.rejectBannedUser(w, userID) {
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		return
+	}
+	allowed, err := cfg.canAccessVideo(video, userID, database.GrantPermissionEdit)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check video access", err)
+		return
+	}
+	if !allowed {
+		respondWithError(w, http.StatusForbidden, "You can't reprocess this video", nil)
+		return
+	}
+	release, ok := cfg.lockVideoProcessing(w, videoID)
+	if !ok {
+		return
+	}
+	defer release()
+
+	latest, err := cfg.db.GetLatestVideoVersionNumber(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't look up video versions", err)
+		return
+	}
+	if latest == 0 {
+		respondWithError(w, http.StatusConflict, "Video hasn't been uploaded yet", nil)
+		return
+	}
+	version, err := cfg.db.GetVideoVersion(videoID, latest)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video version", err)
+		return
+	}
+
+	localPath, err := cfg.downloadObjectToTemp(r.Context(), version.Key, "tubely-reprocess-*"+filepath.Ext(version.Key))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't download video", err)
+		return
+	}
+	defer os.Remove(localPath)
+
+	probe, err := cfg.probeVideo(r.Context(), localPath)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to find aspect", err)
+		return
+	}
+
+	aspect := aspectPrefix(probe.AspectRatio)
+	applyProbeMetadata(&video, probe)
+	video.Aspect = aspect
+	video.Bitrate = probe.Bitrate
+
+	// Regenerated posters reuse their key; the versioned URL changes with
+	// the new content so cached copies are bypassed. Uploaded thumbnails
+	// are left alone.
+	if video.ThumbnailURL == nil || unversionedURL(*video.ThumbnailURL) == cfg.getObjectURL(cfg.thumbnailKey(video.ID)) {
+		thumbnailURL, err := cfg.storeGeneratedThumbnail(r.Context(), video.ID, localPath, cfg.thumbnailAt, video.Width, video.Height)
+		if err != nil {
+			log.Printf("Couldn't regenerate thumbnail for video %s: %v", video.ID, err)
+		} else {
+			video.ThumbnailURL = &thumbnailURL
+		}
+	}
+
+	oldAspect, name := splitVideoKey(version.Key)
+	if !cfg.moveOnAspectChange || oldAspect == aspect {
+		err = cfg.db.UpdateVideo(video)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to update video", err)
+			return
+		}
+		cfg.respondWithSignedVideo(w, video)
+		return
+	}
+
+	// Copy first and only delete the old object once the row points at the
+	// new key, so the video stays playable if any step fails.
+	newKey := cfg.videoKey(video.ID, aspect, name)
+	err = cfg.copyObject(r.Context(), version.Key, newKey)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't move video", err)
+		return
+	}
+
+	videoURL := cfg.videoURLRef(newKey)
+	video.VideoURL = &videoURL
+	err = cfg.db.RelocateVideoVersion(video, version.Version, newKey)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to update video", err)
+		return
+	}
+
+	err = cfg.deleteUnsharedObject(r.Context(), version.Key, uuid.Nil)
+	if err != nil {
+		log.Printf("Couldn't remove old object after aspect change for video %s: %v", videoID, err)
+	}
+
+	cfg.respondWithSignedVideo(w, video)
+}
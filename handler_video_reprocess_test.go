@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"image"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func reprocessRequest(t *testing.T, videoID, userID uuid.UUID) *http.Request {
+	t.Helper()
+	req := newAuthedRequest(t, http.MethodPost, "/api/videos/"+videoID.String()+"/reprocess", nil, userID)
+	req.SetPathValue("videoID", videoID.String())
+	return req
+}
+
+func latestVersionKey(t *testing.T, cfg *apiConfig, videoID uuid.UUID) string {
+	t.Helper()
+	latest, err := cfg.db.GetLatestVideoVersionNumber(videoID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	version, err := cfg.db.GetVideoVersion(videoID, latest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return version.Key
+}
+
+func TestReprocessMovesObjectOnAspectChange(t *testing.T) {
+	cfg := newTestConfig(t)
+	media := &fakeMedia{Width: 1920, Height: 1080}
+	installFakeMedia(t, media)
+	userID := createTestUser(t, cfg)
+	video := createTestVideo(t, cfg, userID, visibilityPublic)
+	if rec := uploadTestVideo(t, cfg, video.ID, userID, testMP4(256, 0)); rec.Code != http.StatusOK {
+		t.Fatalf("upload: got status %d: %s", rec.Code, rec.Body)
+	}
+	oldKey := latestVersionKey(t, cfg, video.ID)
+	if !strings.HasPrefix(oldKey, "landscape/") {
+		t.Fatalf("uploaded under %s, want landscape/", oldKey)
+	}
+
+	media.Width, media.Height = 1080, 1920
+	media.update(t)
+	rec := httptest.NewRecorder()
+	cfg.handlerVideoReprocess(rec, reprocessRequest(t, video.ID, userID))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("reprocess: got status %d: %s", rec.Code, rec.Body)
+	}
+
+	newKey := latestVersionKey(t, cfg, video.ID)
+	_, name := splitVideoKey(oldKey)
+	if newKey != "portrait/"+name {
+		t.Errorf("moved to %s, want portrait/%s", newKey, name)
+	}
+	ctx := context.Background()
+	if ok, _ := cfg.objectExists(ctx, newKey); !ok {
+		t.Errorf("nothing stored at the new key %s", newKey)
+	}
+	if ok, _ := cfg.objectExists(ctx, oldKey); ok {
+		t.Errorf("old object %s wasn't removed", oldKey)
+	}
+	stored, err := cfg.db.GetVideo(video.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Aspect != "portrait" || stored.VideoURL == nil || *stored.VideoURL != cfg.videoURLRef(newKey) {
+		t.Errorf("stored aspect %q and URL %v, want portrait at %s", stored.Aspect, stored.VideoURL, newKey)
+	}
+}
+
+func TestReprocessKeepsKeyWhenMovingIsOff(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.moveOnAspectChange = false
+	media := &fakeMedia{Width: 1920, Height: 1080}
+	installFakeMedia(t, media)
+	userID := createTestUser(t, cfg)
+	video := createTestVideo(t, cfg, userID, visibilityPublic)
+	if rec := uploadTestVideo(t, cfg, video.ID, userID, testMP4(256, 0)); rec.Code != http.StatusOK {
+		t.Fatalf("upload: got status %d: %s", rec.Code, rec.Body)
+	}
+	oldKey := latestVersionKey(t, cfg, video.ID)
+
+	media.Width, media.Height = 1080, 1920
+	media.update(t)
+	rec := httptest.NewRecorder()
+	cfg.handlerVideoReprocess(rec, reprocessRequest(t, video.ID, userID))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("reprocess: got status %d: %s", rec.Code, rec.Body)
+	}
+	if key := latestVersionKey(t, cfg, video.ID); key != oldKey {
+		t.Errorf("key changed from %s to %s with moving off", oldKey, key)
+	}
+}
+
+func TestReprocessChangesThumbnailVersion(t *testing.T) {
+	cfg := newTestConfig(t)
+	media := &fakeMedia{Width: 1920, Height: 1080, Thumb: image.Pt(64, 36)}
+	installFakeMedia(t, media)
+	userID := createTestUser(t, cfg)
+	video := createTestVideo(t, cfg, userID, visibilityPublic)
+	if rec := uploadTestVideo(t, cfg, video.ID, userID, testMP4(256, 0)); rec.Code != http.StatusOK {
+		t.Fatalf("upload: got status %d: %s", rec.Code, rec.Body)
+	}
+
+	ctx := context.Background()
+	key := cfg.thumbnailKey(video.ID)
+	thumbnailURL := func() *url.URL {
+		t.Helper()
+		stored, err := cfg.db.GetVideo(video.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored.ThumbnailURL == nil {
+			t.Fatal("video has no thumbnail")
+		}
+		u, err := url.Parse(*stored.ThumbnailURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		etag, err := cfg.objectETag(ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := u.Query().Get("v"); got != etag {
+			t.Errorf("thumbnail URL version %q, want the current ETag %q", got, etag)
+		}
+		return u
+	}
+	before := thumbnailURL()
+
+	media.Thumb = image.Pt(128, 72)
+	media.update(t)
+	rec := httptest.NewRecorder()
+	cfg.handlerVideoReprocess(rec, reprocessRequest(t, video.ID, userID))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("reprocess: got status %d: %s", rec.Code, rec.Body)
+	}
+	after := thumbnailURL()
+
+	if after.Query().Get("v") == before.Query().Get("v") {
+		t.Errorf("thumbnail URL %s didn't change after reprocessing", after)
+	}
+	if unversionedURL(after.String()) != unversionedURL(before.String()) {
+		t.Errorf("thumbnail moved from %s to %s; the key should stay put", before, after)
+	}
+}
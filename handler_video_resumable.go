@@ -0,0 +1,413 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	// resumableUploadPrefix is where parts are assembled before the
+	// finished upload is processed like a direct one. A lifecycle rule
+	// aborting incomplete multipart uploads under it cleans up abandoned
+	// sessions.
+	resumableUploadPrefix = "resumable/"
+
+	// S3 allows part numbers 1-10000 and parts of at least 5 MB except the
+	// last. Parts are spooled to disk before being sent on, so they're
+	// capped well below S3's 5 GB.
+	maxResumablePartNumber = 10000
+	maxResumablePartSize   = 100 << 20
+)
+
+// resumableUploadKey is the staging key an upload session's parts are
+// assembled under.
+func resumableUploadKey(videoID, sessionID uuid.UUID) string {
+	return fmt.Sprintf("%s%s/%s", resumableUploadPrefix, videoID, sessionID)
+}
+
+// handlerResumableUploadCreate starts a multipart upload for a video. The
+// client then PUTs numbered parts and completes the session; if the
+// connection drops, GET on the session lists the parts already stored.
+func (cfg *apiConfig) handlerResumableUploadCreate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		ContentType string `json:"content_type"`
+	}
+
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+
+	userID, ok := cfg.authenticate(w, r, scopeUpload)
+	if !ok {
+		return
+	}
+	if cfg.rejectBannedUser(w, userID) {
+		return
+	}
+	multipart, ok := cfg.storage.(multipartStorage)
+	if !ok {
+		respondWithError(w, http.StatusNotImplemented, "Resumable uploads aren't supported by this storage backend", nil)
+		return
+	}
+
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	// Generic types are resolved by sniffing the assembled file on
+	// completion.
+	if !cfg.allowedVideoTypes[params.ContentType] && !(cfg.mimeCorrection && isGenericMediaType(params.ContentType)) {
+		respondWithError(w, http.StatusBadRequest, "Invalid file type", nil)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return
+	}
+	allowed, err := cfg.canAccessVideo(video, userID, database.GrantPermissionEdit)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check video access", err)
+		return
+	}
+	if !allowed {
+		respondWithError(w, http.StatusForbidden, "Not authorized to update this video", nil)
+		return
+	}
+
+	// Parts go straight to S3, so this is the last point the quotas can be
+	// checked before any data arrives.
+	if _, ok := cfg.checkUploadQuotas(w, userID, -1); !ok {
+		return
+	}
+
+	key := resumableUploadKey(videoID, cfg.uuidgen())
+	multipartID, err := multipart.CreateMultipart(r.Context(), key, params.ContentType)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't start upload", err)
+		return
+	}
+
+	upload, err := cfg.db.CreateResumableUpload(database.CreateResumableUploadParams{
+		VideoID:     videoID,
+		UserID:      userID,
+		S3UploadID:  multipartID,
+		Key:         key,
+		ContentType: params.ContentType,
+	})
+	if err != nil {
+		abortMultipartUpload(multipart, key, multipartID)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't record upload", err)
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, upload)
+}
+
+// resumableUpload loads the session named in the path for its owner,
+// along with the backend that holds its parts. It responds and returns
+// false on any failure.
+func (cfg *apiConfig) resumableUpload(w http.ResponseWriter, r *http.Request) (database.ResumableUpload, multipartStorage, bool) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return database.ResumableUpload{}, nil, false
+	}
+	uploadID, err := uuid.Parse(r.PathValue("uploadID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid upload ID", err)
+		return database.ResumableUpload{}, nil, false
+	}
+
+	userID, ok := cfg.authenticate(w, r, scopeUpload)
+	if !ok {
+		return database.ResumableUpload{}, nil, false
+	}
+	multipart, ok := cfg.storage.(multipartStorage)
+	if !ok {
+		respondWithError(w, http.StatusNotImplemented, "Resumable uploads aren't supported by this storage backend", nil)
+		return database.ResumableUpload{}, nil, false
+	}
+
+	upload, err := cfg.db.GetResumableUpload(uploadID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get upload", err)
+		return database.ResumableUpload{}, nil, false
+	}
+	if upload.ID == uuid.Nil || upload.VideoID != videoID {
+		respondWithError(w, http.StatusNotFound, "Upload not found", nil)
+		return database.ResumableUpload{}, nil, false
+	}
+	if upload.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "This upload belongs to another user", nil)
+		return database.ResumableUpload{}, nil, false
+	}
+	return upload, multipart, true
+}
+
+// handlerResumableUploadGet reports the parts stored so far, so a client
+// that lost its connection knows which ones to send again.
+func (cfg *apiConfig) handlerResumableUploadGet(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		database.ResumableUpload
+		Parts         []database.ResumableUploadPart `json:"parts"`
+		ReceivedBytes int64                          `json:"received_bytes"`
+	}
+
+	upload, _, ok := cfg.resumableUpload(w, r)
+	if !ok {
+		return
+	}
+	parts, err := cfg.db.GetResumableUploadParts(upload.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get upload parts", err)
+		return
+	}
+	resp := response{ResumableUpload: upload, Parts: parts}
+	for _, part := range parts {
+		resp.ReceivedBytes += part.SizeBytes
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// handlerResumableUploadPart stores one part. Re-sending a part number
+// replaces the earlier copy.
+func (cfg *apiConfig) handlerResumableUploadPart(w http.ResponseWriter, r *http.Request) {
+	upload, multipart, ok := cfg.resumableUpload(w, r)
+	if !ok {
+		return
+	}
+	partNumber, err := strconv.Atoi(r.PathValue("partNumber"))
+	if err != nil || partNumber < 1 || partNumber > maxResumablePartNumber {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Part number must be between 1 and %d", maxResumablePartNumber), err)
+		return
+	}
+	if cfg.rejectLowDisk(w) {
+		return
+	}
+
+	// S3 needs the part's length up front, so it's spooled to disk first;
+	// that also means a dropped connection never leaves a partial part.
+	body := http.MaxBytesReader(w, newStallDeadlineReader(w, r.Body, cfg.bodyReadTimeout), maxResumablePartSize)
+	tmp, err := os.CreateTemp("", "tubely-part-*")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to create file", err)
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	size, err := io.Copy(tmp, body)
+	clearBodyDeadline(w)
+	if err != nil {
+		respondUploadReadError(w, "Unable to read part", err)
+		return
+	}
+	if size == 0 {
+		respondWithError(w, http.StatusBadRequest, "Part is empty", nil)
+		return
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to read part", err)
+		return
+	}
+
+	etag, err := multipart.UploadPart(r.Context(), upload.Key, upload.S3UploadID, partNumber, tmp, size)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't store part", err)
+		return
+	}
+
+	part := database.ResumableUploadPart{
+		PartNumber: partNumber,
+		ETag:       etag,
+		SizeBytes:  size,
+	}
+	if err := cfg.db.SaveResumableUploadPart(upload.ID, part); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't record part", err)
+		return
+	}
+	part.CreatedAt = cfg.now().UTC()
+	respondWithJSON(w, http.StatusOK, part)
+}
+
+// handlerResumableUploadComplete assembles the stored parts and runs the
+// result through the same processing as a direct upload.
+func (cfg *apiConfig) handlerResumableUploadComplete(w http.ResponseWriter, r *http.Request) {
+	upload, multipart, ok := cfg.resumableUpload(w, r)
+	if !ok {
+		return
+	}
+	if cfg.rejectBannedUser(w, upload.UserID) {
+		return
+	}
+	if cfg.rejectLowDisk(w) {
+		return
+	}
+	opts, err := cfg.parseUploadOptions(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(upload.VideoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return
+	}
+	allowed, err := cfg.canAccessVideo(video, upload.UserID, database.GrantPermissionEdit)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check video access", err)
+		return
+	}
+	if !allowed {
+		respondWithError(w, http.StatusForbidden, "Not authorized to update this video", nil)
+		return
+	}
+	release, ok := cfg.lockVideoProcessing(w, video.ID)
+	if !ok {
+		return
+	}
+	queued := false
+	defer func() {
+		if !queued {
+			release()
+		}
+	}()
+
+	parts, err := cfg.db.GetResumableUploadParts(upload.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get upload parts", err)
+		return
+	}
+	if len(parts) == 0 {
+		respondWithError(w, http.StatusConflict, "No parts have been uploaded", nil)
+		return
+	}
+	var size int64
+	for _, part := range parts {
+		size += part.SizeBytes
+	}
+	if size > maxUploadSize {
+		respondWithError(w, http.StatusRequestEntityTooLarge, "File is too large. Maximum size is 1 GB.", nil)
+		return
+	}
+	// The hourly limit was checked when the session was created, so only
+	// the bytes are reserved here.
+	reservation, ok := cfg.reserveUploadBytes(w, upload.UserID, size)
+	if !ok {
+		return
+	}
+	defer func() {
+		if !queued {
+			reservation.release()
+		}
+	}()
+
+	err = multipart.CompleteMultipart(r.Context(), upload.Key, upload.S3UploadID, parts)
+	if err != nil {
+		// Usually a part under S3's minimum size; the session stays open so
+		// the client can replace it.
+		respondWithError(w, http.StatusBadRequest, "Couldn't assemble upload parts", err)
+		return
+	}
+	// The multipart upload is gone once completed, so the session can't be
+	// resumed whatever happens next.
+	if err := cfg.db.DeleteResumableUpload(upload.ID); err != nil {
+		log.Printf("Couldn't remove finished upload session %s: %v", upload.ID, err)
+	}
+
+	localPath, err := cfg.downloadObjectToTemp(r.Context(), upload.Key, "tubely-resumable-*")
+	if delErr := cfg.deleteObject(context.Background(), upload.Key); delErr != nil {
+		log.Printf("Couldn't remove assembled upload %s: %v", upload.Key, delErr)
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't download assembled upload", err)
+		return
+	}
+	defer func() {
+		if !queued {
+			os.Remove(localPath)
+		}
+	}()
+
+	mediaType, err := cfg.resolveVideoMediaType(upload.ContentType, readFileHead(localPath, sniffLen))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid file type", err)
+		return
+	}
+
+	if !cfg.claimVideoUpload(w, &video) {
+		return
+	}
+	processed := uploadedFile{
+		Path:        localPath,
+		MediaType:   mediaType,
+		Size:        size,
+		Reservation: reservation,
+	}
+	queued = cfg.dispatchUploadProcessing(w, r, video, upload.UserID, opts, processed, func() {
+		os.Remove(localPath)
+		release()
+	})
+}
+
+// handlerResumableUploadAbort discards a session and the parts stored for
+// it.
+func (cfg *apiConfig) handlerResumableUploadAbort(w http.ResponseWriter, r *http.Request) {
+	upload, multipart, ok := cfg.resumableUpload(w, r)
+	if !ok {
+		return
+	}
+	err := multipart.AbortMultipart(r.Context(), upload.Key, upload.S3UploadID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't abort upload", err)
+		return
+	}
+	if err := cfg.db.DeleteResumableUpload(upload.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't remove upload", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// abortMultipartUpload is best-effort cleanup; the lifecycle rule on
+// resumableUploadPrefix catches anything it misses.
+func abortMultipartUpload(multipart multipartStorage, key, uploadID string) {
+	err := multipart.AbortMultipart(context.Background(), key, uploadID)
+	if err != nil {
+		log.Printf("Couldn't abort multipart upload %s: %v", key, err)
+	}
+}
+
+// readFileHead returns up to n bytes from the start of a file, or nil if it
+// can't be read.
+func readFileHead(path string, n int) []byte {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	head := make([]byte, n)
+	read, _ := io.ReadFull(f, head)
+	return head[:read]
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const maxSignBatchSize = 100
+
+func (cfg *apiConfig) handlerVideosSign(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		VideoIDs []uuid.UUID `json:"video_ids"`
+	}
+	type signedURLs struct {
+		VideoURL     *string `json:"video_url"`
+		ThumbnailURL *string `json:"thumbnail_url"`
+	}
+
+	userID, ok := cfg.authenticate(w, r, scopeRead)
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if len(params.VideoIDs) > maxSignBatchSize {
+		respondWithError(w, http.StatusBadRequest, "Too many videos in one batch (max 100)", nil)
+		return
+	}
+
+	signed := map[uuid.UUID]signedURLs{}
+	for _, videoID := range params.VideoIDs {
+		if _, done := signed[videoID]; done {
+			continue
+		}
+		video, err := cfg.db.GetVideo(videoID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+			return
+		}
+		// Grantees sign videos one at a time through the fetch endpoints;
+		// the batch is only for the owner's own grid.
+		if video.ID == uuid.Nil || video.UserID != userID {
+			continue
+		}
+		banned, err := cfg.isBanned(database.BanKindVideo, videoID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't check moderation status", err)
+			return
+		}
+		if banned {
+			continue
+		}
+
+		thumbnailURL, err := cfg.signedThumbnailURL(video)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't generate presigned url", err)
+			return
+		}
+		urls := signedURLs{ThumbnailURL: thumbnailURL}
+		videoURL, ok, err := cfg.signedVideoURL(video)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't generate presigned url", err)
+			return
+		}
+		if ok {
+			urls.VideoURL = &videoURL
+		}
+		signed[videoID] = urls
+	}
+
+	respondWithJSON(w, http.StatusOK, signed)
+}
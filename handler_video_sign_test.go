@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestVideosSignOnlySignsOwnedVideos(t *testing.T) {
+	cfg := newTestConfig(t)
+	userID := createTestUser(t, cfg)
+	otherID := createTestUser(t, cfg)
+
+	owned := createTestVideo(t, cfg, userID, visibilityPrivate)
+	key := versionedKey(cfg.videoKey(owned.ID, "landscape", "video.mp4"), 1)
+	putTestObject(t, cfg, key, testMP4(64, 0))
+	if _, err := cfg.db.CreateVideoVersion(owned.ID, 1, key, 64, ""); err != nil {
+		t.Fatal(err)
+	}
+	putTestObject(t, cfg, cfg.thumbnailKey(owned.ID), []byte("jpeg"))
+	thumbnailURL := cfg.getObjectURL(cfg.thumbnailKey(owned.ID))
+	owned.ThumbnailURL = &thumbnailURL
+	if err := cfg.db.UpdateVideo(owned); err != nil {
+		t.Fatal(err)
+	}
+	foreign := createTestVideo(t, cfg, otherID, visibilityPublic)
+
+	body := fmt.Sprintf(`{"video_ids":[%q,%q,%q]}`, owned.ID, foreign.ID, uuid.New())
+	rec := httptest.NewRecorder()
+	cfg.handlerVideosSign(rec, newAuthedRequest(t, http.MethodPost, "/api/videos/sign", strings.NewReader(body), userID))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body)
+	}
+	got := decodeJSON[map[uuid.UUID]struct {
+		VideoURL     *string `json:"video_url"`
+		ThumbnailURL *string `json:"thumbnail_url"`
+	}](t, rec)
+	if len(got) != 1 {
+		t.Fatalf("got %d signed videos, want only the owned one: %v", len(got), got)
+	}
+	urls, ok := got[owned.ID]
+	if !ok || urls.VideoURL == nil || urls.ThumbnailURL == nil {
+		t.Fatalf("owned video missing signed URLs: %+v", urls)
+	}
+
+	videoQuery := signedQuery(t, cfg, *urls.VideoURL, key)
+	thumbQuery := signedQuery(t, cfg, *urls.ThumbnailURL, cfg.thumbnailKey(owned.ID))
+	if videoQuery.Get("expires") != thumbQuery.Get("expires") {
+		t.Errorf("thumbnail expires at %s, video at %s", thumbQuery.Get("expires"), videoQuery.Get("expires"))
+	}
+}
+
+// signedQuery checks that rawURL is a valid local presigned URL for key
+// and returns its query.
+func signedQuery(t *testing.T, cfg *apiConfig, rawURL, key string) url.Values {
+	t.Helper()
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(u.Path, "/"+key) {
+		t.Errorf("URL %s isn't for %s", rawURL, key)
+	}
+	if !cfg.localSigner.verify(key, u.Query()) {
+		t.Errorf("URL %s isn't validly signed", rawURL)
+	}
+	return u.Query()
+}
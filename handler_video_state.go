@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func (cfg *apiConfig) handlerVideoState(w http.ResponseWriter, r *http.Request) {
+	type playbackURLs struct {
+		VideoURL     *string `json:"video_url"`
+		ThumbnailURL *string `json:"thumbnail_url"`
+	}
+	type response struct {
+		Status   string          `json:"status"`
+		Progress int             `json:"progress"`
+		Error    *string         `json:"error"`
+		Warnings []string        `json:"warnings,omitempty"`
+		URLs     *playbackURLs   `json:"urls"`
+		Upload   *uploadProgress `json:"upload,omitempty"`
+		JobID    *uuid.UUID      `json:"job_id,omitempty"`
+	}
+
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+
+	userID, ok := cfg.authenticate(w, r, scopeRead)
+	if !ok {
+		return
+	}
+
+	if cfg.rejectBannedVideo(w, videoID) {
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		return
+	}
+	allowed, err := cfg.canAccessVideo(video, userID, database.GrantPermissionView)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check video access", err)
+		return
+	}
+	if !allowed {
+		respondWithError(w, http.StatusForbidden, "You can't view this video's state", nil)
+		return
+	}
+
+	resp := response{
+		Status:   video.Status,
+		Progress: video.Progress,
+		Error:    video.ProcessingError,
+		Warnings: video.ProcessingWarnings,
+	}
+	if progress, ok := cfg.uploadProgress.Get(videoID); ok {
+		resp.Upload = &progress
+	}
+	if cfg.processingQueue != nil {
+		if jobID, ok := cfg.processingQueue.JobID(videoID); ok {
+			resp.JobID = &jobID
+		}
+	}
+	if video.Status == processingStatusReady {
+		urls := &playbackURLs{
+			VideoURL:     video.VideoURL,
+			ThumbnailURL: video.ThumbnailURL,
+		}
+		signed, ok, err := cfg.signedVideoURL(video)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't generate presigned url", err)
+			return
+		}
+		if ok {
+			urls.VideoURL = &signed
+		}
+		resp.URLs = urls
+	}
+
+	respondWithJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type videoStateResponse struct {
+	Status   string `json:"status"`
+	Progress int    `json:"progress"`
+	URLs     *struct {
+		VideoURL     *string `json:"video_url"`
+		ThumbnailURL *string `json:"thumbnail_url"`
+	} `json:"urls"`
+}
+
+func TestVideoStateURLsOnlyWhenReady(t *testing.T) {
+	cfg := newTestConfig(t)
+	userID := createTestUser(t, cfg)
+	video := createTestVideo(t, cfg, userID, visibilityPrivate)
+	key := storeTestVersion(t, cfg, video.ID, testMP4(64, 0))
+
+	getState := func() videoStateResponse {
+		t.Helper()
+		req := newAuthedRequest(t, http.MethodGet, "/api/videos/"+video.ID.String()+"/state", nil, userID)
+		req.SetPathValue("videoID", video.ID.String())
+		rec := httptest.NewRecorder()
+		cfg.handlerVideoState(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("got status %d: %s", rec.Code, rec.Body)
+		}
+		return decodeJSON[videoStateResponse](t, rec)
+	}
+
+	cfg.setProcessingStatus(&video, processingStatusProcessing, 30, nil)
+	if got := getState(); got.Status != processingStatusProcessing || got.Progress != 30 || got.URLs != nil {
+		t.Errorf("processing video: got %+v, want processing at 30%% with no urls", got)
+	}
+
+	videoURL := cfg.videoURLRef(key)
+	video.VideoURL = &videoURL
+	video.Status = processingStatusReady
+	video.Progress = 100
+	if err := cfg.db.UpdateVideo(video); err != nil {
+		t.Fatal(err)
+	}
+	got := getState()
+	if got.Status != processingStatusReady || got.URLs == nil || got.URLs.VideoURL == nil {
+		t.Fatalf("ready video: got %+v, want urls", got)
+	}
+	signedQuery(t, cfg, *got.URLs.VideoURL, key)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func streamRequest(t *testing.T, videoID, userID uuid.UUID) *http.Request {
+	t.Helper()
+	req := newAuthedRequest(t, http.MethodGet, "/api/videos/"+videoID.String()+"/stream", nil, userID)
+	req.SetPathValue("videoID", videoID.String())
+	return req
+}
+
+func TestVideoStreamRangeFromLocalBackend(t *testing.T) {
+	cfg := newTestConfig(t)
+	userID := createTestUser(t, cfg)
+	video := createTestVideo(t, cfg, userID, visibilityPublic)
+	body := testMP4(1000, 0)
+	storeTestVersion(t, cfg, video.ID, body)
+
+	req := streamRequest(t, video.ID, userID)
+	req.Header.Set("Range", "bytes=100-199")
+	rec := httptest.NewRecorder()
+	cfg.handlerVideoStream(rec, req)
+
+	if rec.Code != http.StatusPartialContent {
+		t.Fatalf("got status %d, want 206", rec.Code)
+	}
+	if want := fmt.Sprintf("bytes 100-199/%d", len(body)); rec.Header().Get("Content-Range") != want {
+		t.Errorf("got Content-Range %q, want %q", rec.Header().Get("Content-Range"), want)
+	}
+	if !bytes.Equal(rec.Body.Bytes(), body[100:200]) {
+		t.Error("ranged body doesn't match the stored bytes")
+	}
+}
+
+func TestVideoStreamConditionalRequests(t *testing.T) {
+	backends := map[string]func(t *testing.T) *apiConfig{
+		"local": newTestConfig,
+		"s3": func(t *testing.T) *apiConfig {
+			cfg, _ := newTestS3Config(t, "tubely", "")
+			return cfg
+		},
+	}
+	for name, newConfig := range backends {
+		t.Run(name, func(t *testing.T) {
+			cfg := newConfig(t)
+			userID := createTestUser(t, cfg)
+			video := createTestVideo(t, cfg, userID, visibilityPublic)
+			storeTestVersion(t, cfg, video.ID, testMP4(1000, 0))
+
+			stream := func(header, value string) *httptest.ResponseRecorder {
+				t.Helper()
+				req := streamRequest(t, video.ID, userID)
+				if header != "" {
+					req.Header.Set(header, value)
+				}
+				rec := httptest.NewRecorder()
+				cfg.handlerVideoStream(rec, req)
+				return rec
+			}
+
+			rec := stream("", "")
+			if rec.Code != http.StatusOK {
+				t.Fatalf("unconditional request: got status %d", rec.Code)
+			}
+			lastModified, err := http.ParseTime(rec.Header().Get("Last-Modified"))
+			if err != nil {
+				t.Fatalf("Last-Modified %q: %v", rec.Header().Get("Last-Modified"), err)
+			}
+			etag := rec.Header().Get("ETag")
+			if etag == "" {
+				t.Fatal("response has no ETag")
+			}
+
+			if rec := stream("If-Modified-Since", lastModified.Format(http.TimeFormat)); rec.Code != http.StatusNotModified {
+				t.Errorf("unchanged since Last-Modified: got status %d, want 304", rec.Code)
+			} else if rec.Body.Len() != 0 {
+				t.Errorf("304 carried a %d byte body", rec.Body.Len())
+			}
+			if rec := stream("If-None-Match", etag); rec.Code != http.StatusNotModified {
+				t.Errorf("matching ETag: got status %d, want 304", rec.Code)
+			}
+			earlier := lastModified.Add(-time.Hour).Format(http.TimeFormat)
+			if rec := stream("If-Modified-Since", earlier); rec.Code != http.StatusOK {
+				t.Errorf("modified since the cached copy: got status %d, want 200", rec.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// handlerVideoThumbnailAuto replaces a video's thumbnail with a frame
+// extracted from its current version. ?at= picks the offset as a duration
+// ("2.5s") or seconds; it defaults to THUMBNAIL_AT.
+func (cfg *apiConfig) handlerVideoThumbnailAuto(w http.ResponseWriter, r *http.Request) {
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	at := cfg.thumbnailAt
+	if value := r.URL.Query().Get("at"); value != "" {
+		at, err = parseThumbnailOffset(value)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid at", err)
+			return
+		}
+	}
+
+	userID, ok := cfg.authenticate(w, r, scopeUpload)
+	if !ok {
+		return
+	}
+
+	if cfg.rejectBannedUser(w, userID) {
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		return
+	}
+	allowed, err := cfg.canAccessVideo(video, userID, database.GrantPermissionEdit)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check video access", err)
+		return
+	}
+	if !allowed {
+		respondWithError(w, http.StatusForbidden, "You can't change this video's thumbnail", nil)
+		return
+	}
+	if video.DurationSec > 0 && at.Seconds() >= video.DurationSec {
+		respondWithError(w, http.StatusBadRequest, "Offset is past the end of the video", nil)
+		return
+	}
+	release, ok := cfg.lockVideoProcessing(w, videoID)
+	if !ok {
+		return
+	}
+	defer release()
+
+	latest, err := cfg.db.GetLatestVideoVersionNumber(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't look up video versions", err)
+		return
+	}
+	if latest == 0 {
+		respondWithError(w, http.StatusConflict, "Video hasn't been uploaded yet", nil)
+		return
+	}
+	version, err := cfg.db.GetVideoVersion(videoID, latest)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video version", err)
+		return
+	}
+
+	localPath, err := cfg.downloadObjectToTemp(r.Context(), version.Key, "tubely-thumbnail-src-*"+filepath.Ext(version.Key))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't download video", err)
+		return
+	}
+	defer os.Remove(localPath)
+
+	thumbnailURL, err := cfg.storeGeneratedThumbnail(r.Context(), video.ID, localPath, at, video.Width, video.Height)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't generate thumbnail", err)
+		return
+	}
+	video.ThumbnailURL = &thumbnailURL
+
+	err = cfg.db.UpdateVideo(video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update video", err)
+		return
+	}
+
+	cfg.respondWithSignedVideo(w, video)
+}
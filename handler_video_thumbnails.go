@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/jpeg"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const maxSpriteBatchSize = 50
+
+type thumbnailSprite struct {
+	Image  *image.RGBA
+	Width  int
+	Height int
+	Cells  map[uuid.UUID]spriteCell
+}
+
+// buildThumbnailSprite authenticates the request, loads the thumbnails of
+// the requested videos the caller owns and composes them into one sprite.
+// Videos that don't exist, aren't owned or have no thumbnail are left out of
+// the cell map. It writes the error response itself when it fails.
+func (cfg *apiConfig) buildThumbnailSprite(w http.ResponseWriter, r *http.Request) (thumbnailSprite, bool) {
+	userID, ok := cfg.authenticate(w, r, scopeRead)
+	if !ok {
+		return thumbnailSprite{}, false
+	}
+
+	var videoIDs []uuid.UUID
+	seen := map[uuid.UUID]bool{}
+	for _, idString := range strings.Split(r.URL.Query().Get("ids"), ",") {
+		idString = strings.TrimSpace(idString)
+		if idString == "" {
+			continue
+		}
+		id, err := uuid.Parse(idString)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+			return thumbnailSprite{}, false
+		}
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		videoIDs = append(videoIDs, id)
+	}
+	if len(videoIDs) == 0 {
+		respondWithError(w, http.StatusBadRequest, "ids is required", nil)
+		return thumbnailSprite{}, false
+	}
+	if len(videoIDs) > maxSpriteBatchSize {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Too many videos in one batch (max %d)", maxSpriteBatchSize), nil)
+		return thumbnailSprite{}, false
+	}
+
+	var imgs []image.Image
+	var ids []uuid.UUID
+	for _, videoID := range videoIDs {
+		video, err := cfg.db.GetVideo(videoID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+			return thumbnailSprite{}, false
+		}
+		allowed, err := cfg.canAccessVideo(video, userID, database.GrantPermissionView)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't check video access", err)
+			return thumbnailSprite{}, false
+		}
+		if !allowed || video.ThumbnailURL == nil {
+			continue
+		}
+		banned, err := cfg.isBanned(database.BanKindVideo, videoID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't check moderation status", err)
+			return thumbnailSprite{}, false
+		}
+		if banned {
+			continue
+		}
+		img, err := cfg.loadThumbnailImage(r.Context(), *video.ThumbnailURL)
+		if err != nil {
+			log.Printf("Skipping thumbnail for video %s: %v", videoID, err)
+			continue
+		}
+		imgs = append(imgs, img)
+		ids = append(ids, videoID)
+	}
+
+	img, cells := composeSprite(imgs, spriteCellWidth, spriteCellHeight, spriteColumns)
+	sprite := thumbnailSprite{
+		Image:  img,
+		Width:  img.Bounds().Dx(),
+		Height: img.Bounds().Dy(),
+		Cells:  make(map[uuid.UUID]spriteCell, len(cells)),
+	}
+	for i, cell := range cells {
+		sprite.Cells[ids[i]] = cell
+	}
+	return sprite, true
+}
+
+// handlerVideoThumbnailsMap returns where each video's thumbnail sits in the
+// sprite served by handlerVideoThumbnailsSprite for the same ids.
+func (cfg *apiConfig) handlerVideoThumbnailsMap(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		SpriteURL string                   `json:"sprite_url"`
+		Width     int                      `json:"width"`
+		Height    int                      `json:"height"`
+		Cells     map[uuid.UUID]spriteCell `json:"cells"`
+	}
+
+	sprite, ok := cfg.buildThumbnailSprite(w, r)
+	if !ok {
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		SpriteURL: "/api/videos/thumbnails/sprite?" + r.URL.RawQuery,
+		Width:     sprite.Width,
+		Height:    sprite.Height,
+		Cells:     sprite.Cells,
+	})
+}
+
+func (cfg *apiConfig) handlerVideoThumbnailsSprite(w http.ResponseWriter, r *http.Request) {
+	sprite, ok := cfg.buildThumbnailSprite(w, r)
+	if !ok {
+		return
+	}
+	if len(sprite.Cells) == 0 {
+		respondWithError(w, http.StatusNotFound, "No thumbnails found", nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.WriteHeader(http.StatusOK)
+	if err := jpeg.Encode(w, sprite.Image, &jpeg.Options{Quality: 85}); err != nil {
+		log.Printf("Error encoding thumbnail sprite: %v", err)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestVideoTimingsRecorded(t *testing.T) {
+	cfg := newTestConfig(t)
+	installFakeMedia(t, &fakeMedia{Width: 1920, Height: 1080})
+	ownerID := createTestUser(t, cfg)
+	adminID := createTestUser(t, cfg)
+	otherID := createTestUser(t, cfg)
+	cfg.adminUserIDs = map[uuid.UUID]bool{adminID: true}
+	video := createTestVideo(t, cfg, ownerID, visibilityPublic)
+
+	timings := func(userID uuid.UUID) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		cfg.handlerVideoTimings(rec, videoActionRequest(t, http.MethodGet, "/timings", video.ID, userID))
+		return rec
+	}
+
+	if rec := timings(ownerID); rec.Code != http.StatusNotFound {
+		t.Errorf("before processing: got status %d, want 404", rec.Code)
+	}
+	if rec := uploadTestVideo(t, cfg, video.ID, ownerID, testMP4(512, 0)); rec.Code != http.StatusOK {
+		t.Fatalf("upload: got status %d: %s", rec.Code, rec.Body)
+	}
+
+	for _, userID := range []uuid.UUID{ownerID, adminID} {
+		rec := timings(userID)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("got status %d: %s", rec.Code, rec.Body)
+		}
+		got := decodeJSON[database.VideoTimings](t, rec)
+		if got.VideoID != video.ID || got.RecordedAt.IsZero() {
+			t.Errorf("timings = %+v, want a recorded entry for the video", got)
+		}
+		if got.ProbeMS < 0 || got.TranscodeMS < 0 || got.UploadMS < 0 {
+			t.Errorf("timings = %+v, want non-negative durations", got)
+		}
+		// The fake tools are separate processes, so processing can't be
+		// instant.
+		if got.ProbeMS+got.TranscodeMS+got.UploadMS == 0 {
+			t.Errorf("timings = %+v, want some time spent", got)
+		}
+	}
+
+	if rec := timings(otherID); rec.Code != http.StatusForbidden {
+		t.Errorf("another user's request: got status %d, want 403", rec.Code)
+	}
+}
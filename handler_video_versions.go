@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+type videoVersionResponse struct {
+	database.VideoVersion
+	Current bool `json:"current"`
+}
+
+// handlerVideoVersionsList pages through a video's stored versions, newest
+// first. The highest version is the one the video currently plays.
+func (cfg *apiConfig) handlerVideoVersionsList(w http.ResponseWriter, r *http.Request) {
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+
+	userID, ok := cfg.authenticate(w, r, scopeRead)
+	if !ok {
+		return
+	}
+
+	if cfg.rejectBannedVideo(w, videoID) {
+		return
+	}
+
+	limit, offset, err := parsePagination(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "You can't view this video's versions", nil)
+		return
+	}
+
+	latest, err := cfg.db.GetLatestVideoVersionNumber(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't look up video versions", err)
+		return
+	}
+	versions, err := cfg.db.GetVideoVersionsPage(videoID, limit, offset)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video versions", err)
+		return
+	}
+	total, err := cfg.db.CountVideoVersions(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't count video versions", err)
+		return
+	}
+
+	items := make([]videoVersionResponse, 0, len(versions))
+	for _, version := range versions {
+		items = append(items, videoVersionResponse{
+			VideoVersion: version,
+			Current:      version.Version == latest,
+		})
+	}
+	respondWithJSON(w, http.StatusOK, newPage(r, items, total, limit, offset))
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func listVersions(t *testing.T, cfg *apiConfig, videoID, userID uuid.UUID, query string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := newAuthedRequest(t, http.MethodGet, "/api/videos/"+videoID.String()+"/versions"+query, nil, userID)
+	req.SetPathValue("videoID", videoID.String())
+	rec := httptest.NewRecorder()
+	cfg.handlerVideoVersionsList(rec, req)
+	return rec
+}
+
+func TestVideoVersionsListNewestFirst(t *testing.T) {
+	cfg := newTestConfig(t)
+	userID := createTestUser(t, cfg)
+	video := createTestVideo(t, cfg, userID, visibilityPublic)
+	keys := map[int]string{}
+	for v := 1; v <= 3; v++ {
+		keys[v] = storeTestVersion(t, cfg, video.ID, testMP4(100*v, byte(v)))
+	}
+
+	rec := listVersions(t, cfg, video.ID, userID, "?limit=2")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body)
+	}
+	first := decodeJSON[page[videoVersionResponse]](t, rec)
+	if first.Total != 3 || !first.HasMore || first.Next == "" {
+		t.Errorf("first page total %d, has_more %v, next %q; want 3 with a next page", first.Total, first.HasMore, first.Next)
+	}
+	if len(first.Items) != 2 || first.Items[0].Version != 3 || first.Items[1].Version != 2 {
+		t.Fatalf("first page %+v, want versions 3 and 2", first.Items)
+	}
+	if !first.Items[0].Current || first.Items[1].Current {
+		t.Errorf("current flags %v, %v; want only version 3 current", first.Items[0].Current, first.Items[1].Current)
+	}
+	if first.Items[0].Key != keys[3] || first.Items[0].SizeBytes != int64(len(testMP4(300, 3))) {
+		t.Errorf("version 3 is %s (%d bytes), want %s", first.Items[0].Key, first.Items[0].SizeBytes, keys[3])
+	}
+
+	rec = listVersions(t, cfg, video.ID, userID, "?limit=2&offset=2")
+	second := decodeJSON[page[videoVersionResponse]](t, rec)
+	if len(second.Items) != 1 || second.Items[0].Version != 1 || second.Items[0].Current || second.HasMore {
+		t.Errorf("second page %+v, want just version 1, not current, and no more", second)
+	}
+}
+
+func TestVideoVersionsListOwnerOnly(t *testing.T) {
+	cfg := newTestConfig(t)
+	ownerID := createTestUser(t, cfg)
+	video := createTestVideo(t, cfg, ownerID, visibilityPublic)
+	storeTestVersion(t, cfg, video.ID, testMP4(100, 0))
+
+	if rec := listVersions(t, cfg, video.ID, createTestUser(t, cfg), ""); rec.Code != http.StatusForbidden {
+		t.Errorf("another user: got status %d, want 403", rec.Code)
+	}
+	if rec := listVersions(t, cfg, uuid.New(), ownerID, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown video: got status %d, want 404", rec.Code)
+	}
+}
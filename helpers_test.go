@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const testJWTSecret = "test-secret"
+
+// mp4Header is the start of an MP4 file: an ftyp box with the mp42 brand,
+// which is enough for content sniffing.
+var mp4Header = []byte{
+	0x00, 0x00, 0x00, 0x18, 'f', 't', 'y', 'p',
+	'm', 'p', '4', '2', 0x00, 0x00, 0x00, 0x00,
+	'm', 'p', '4', '2', 'i', 's', 'o', 'm',
+}
+
+// newTestConfig returns a config backed by a fresh SQLite database and the
+// local storage backend, both under a temp directory, with the defaults
+// main uses for everything else.
+func newTestConfig(t *testing.T) *apiConfig {
+	t.Helper()
+	dir := t.TempDir()
+	db, err := database.NewClient(filepath.Join(dir, "tubely.db"))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	cfg := &apiConfig{
+		db:                 db,
+		jwtSecret:          testJWTSecret,
+		platform:           "dev",
+		assetsRoot:         filepath.Join(dir, "assets"),
+		port:               "8091",
+		mimeCorrection:     true,
+		allowedVideoTypes:  map[string]bool{"video/mp4": true},
+		uploadEncodings:    map[string]bool{"gzip": true, "deflate": true},
+		bodyReadTimeout:    30 * time.Second,
+		progressInterval:   time.Second,
+		uuidgen:            uuid.New,
+		now:                time.Now,
+		presignExpiry:      defaultPresignExpiry,
+		maxPresignExpiry:   defaultMaxPresignExpiry,
+		maxMultipartParts:  defaultMaxMultipartParts,
+		moveOnAspectChange: true,
+		storageBackend:     storageBackendLocal,
+		localStorageRoot:   filepath.Join(dir, "objects"),
+		defaultVisibility:  visibilityPublic,
+		thumbnailAt:        time.Second,
+		uploadClaimTimeout: defaultUploadClaimTimeout,
+		commandTimeout:     defaultCommandTimeout,
+		quarantineTag:      defaultQuarantineTag,
+		defaultPixFmt:      "yuv420p",
+		keyframeMode:       keyframeModeReject,
+		defaultVideoSort:   database.VideoSortNewest,
+		deleteURLExpiry:    defaultDeleteURLExpiry,
+		streamProbeBytes:   defaultStreamProbeBytes,
+		ffmpegGlobalArgs:   []string{"-nostdin"},
+	}
+	cfg.presignCache = newPresignCache(cfg.presignExpiry, cfg.now)
+	cfg.localSigner = &urlSigner{secret: []byte(testJWTSecret), now: cfg.now}
+	cfg.storage = &localStorage{
+		root:      cfg.localStorageRoot,
+		urlPrefix: "http://localhost:" + cfg.port + "/objects/",
+		signer:    cfg.localSigner,
+	}
+	cfg.processingLocks = newProcessingLocks()
+	cfg.quotaMu = &sync.Mutex{}
+	cfg.uploadProgress = newUploadProgressTracker()
+	cfg.banCache = newCache[string, bool](banCacheSize, banCacheTTL, cfg.now)
+	cfg.playbackErrorLimiter = newRateLimiter(10, time.Minute, cfg.now)
+	return cfg
+}
+
+// setTestClock points every time source the config hands out at now.
+func setTestClock(cfg *apiConfig, now func() time.Time) {
+	cfg.now = now
+	cfg.localSigner.now = now
+	cfg.db.SetGenerators(cfg.uuidgen, now)
+}
+
+func createTestUser(t *testing.T, cfg *apiConfig) uuid.UUID {
+	t.Helper()
+	user, err := cfg.db.CreateUser(database.CreateUserParams{
+		Email:    uuid.NewString() + "@example.com",
+		Password: "unused",
+	})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	return user.ID
+}
+
+func createTestVideo(t *testing.T, cfg *apiConfig, userID uuid.UUID, visibility string) database.Video {
+	t.Helper()
+	video, err := cfg.db.CreateVideo(database.CreateVideoParams{
+		Title:       "Test video",
+		Description: "A video for tests",
+		UserID:      userID,
+		Visibility:  visibility,
+	})
+	if err != nil {
+		t.Fatalf("CreateVideo: %v", err)
+	}
+	return video
+}
+
+// putTestObject stores body under key in the config's storage.
+func putTestObject(t *testing.T, cfg *apiConfig, key string, body []byte) {
+	t.Helper()
+	if err := cfg.storage.Put(context.Background(), key, bytes.NewReader(body), "application/octet-stream", ""); err != nil {
+		t.Fatalf("Put %s: %v", key, err)
+	}
+}
+
+// getTestObject returns the object stored under key.
+func getTestObject(t *testing.T, cfg *apiConfig, key string) []byte {
+	t.Helper()
+	obj, err := cfg.storage.Get(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Get %s: %v", key, err)
+	}
+	defer obj.Close()
+	data, err := io.ReadAll(obj)
+	if err != nil {
+		t.Fatalf("reading %s: %v", key, err)
+	}
+	return data
+}
+
+// newAuthedRequest builds a request with a JWT for userID, or without any
+// credentials when userID is uuid.Nil.
+func newAuthedRequest(t *testing.T, method, target string, body io.Reader, userID uuid.UUID) *http.Request {
+	t.Helper()
+	req := httptest.NewRequest(method, target, body)
+	if userID != uuid.Nil {
+		token, err := auth.MakeJWT(userID, testJWTSecret, time.Hour)
+		if err != nil {
+			t.Fatalf("MakeJWT: %v", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req
+}
+
+func decodeJSON[T any](t *testing.T, rec *httptest.ResponseRecorder) T {
+	t.Helper()
+	var v T
+	if err := json.NewDecoder(rec.Body).Decode(&v); err != nil {
+		t.Fatalf("decoding response %q: %v", rec.Body.String(), err)
+	}
+	return v
+}
+
+// storeTestVersion stores body as the video's next version and returns its
+// key.
+func storeTestVersion(t *testing.T, cfg *apiConfig, videoID uuid.UUID, body []byte) string {
+	t.Helper()
+	latest, err := cfg.db.GetLatestVideoVersionNumber(videoID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := versionedKey(cfg.videoKey(videoID, "landscape", "video.mp4"), latest+1)
+	putTestObject(t, cfg, key, body)
+	if _, err := cfg.db.CreateVideoVersion(videoID, latest+1, key, int64(len(body)), ""); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
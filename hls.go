@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+const (
+	hlsMasterPlaylist      = "master.m3u8"
+	hlsSegmentSeconds      = 6
+	hlsSegmentContentType  = "video/mp2t"
+	hlsKeyframeIntervalSec = 2
+)
+
+// hlsRenditions picks the ladder rungs worth producing for a source of the
+// given height: every rung up to the source, so nothing is upscaled, and
+// always at least the lowest one.
+func hlsRenditions(sourceHeight int) []rendition {
+	var out []rendition
+	for _, r := range renditionLadder {
+		if r.Height <= sourceHeight {
+			out = append(out, r)
+		}
+	}
+	if len(out) == 0 {
+		out = append(out, renditionLadder[0])
+	}
+	return out
+}
+
+// hlsRenditionArgs builds the ffmpeg arguments for one variant. Keyframes
+// are forced on a fixed interval so every variant's segments start at the
+// same timestamps and players can switch between them cleanly. The scale
+// never goes above the source height for sources below the lowest rung.
+func hlsRenditionArgs(input, dir string, r rendition) []string {
+	scale := fmt.Sprintf("scale=-2:trunc(min(%d\\,ih)/2)*2", r.Height)
+	return []string{
+		"-i", input,
+		"-map", "0:v:0",
+		"-map", "0:a:0?",
+		"-vf", scale,
+		"-c:v", "libx264",
+		"-preset", "veryfast",
+		"-b:v", r.VideoBitrate,
+		"-maxrate", r.VideoBitrate,
+		"-bufsize", r.VideoBitrate,
+		"-force_key_frames", fmt.Sprintf("expr:gte(t,n_forced*%d)", hlsKeyframeIntervalSec),
+		"-sc_threshold", "0",
+		"-c:a", "aac",
+		"-b:a", r.AudioBitrate,
+		"-ac", "2",
+		"-f", "hls",
+		"-hls_time", strconv.Itoa(hlsSegmentSeconds),
+		"-hls_playlist_type", "vod",
+		"-hls_segment_filename", filepath.Join(dir, r.Name, "seg_%03d.ts"),
+		"-y", filepath.Join(dir, r.Name, "index.m3u8"),
+	}
+}
+
+// bitrateBits converts an ffmpeg bitrate such as "1400k" to bits per
+// second.
+func bitrateBits(bitrate string) int {
+	multiplier := 1
+	switch {
+	case strings.HasSuffix(bitrate, "k"):
+		multiplier = 1000
+	case strings.HasSuffix(bitrate, "M"):
+		multiplier = 1000 * 1000
+	}
+	n, err := strconv.Atoi(strings.TrimRight(bitrate, "kM"))
+	if err != nil {
+		return 0
+	}
+	return n * multiplier
+}
+
+// hlsMasterPlaylistFor lists the variants with their bandwidth and, when
+// the source dimensions are known, their resolution.
+func hlsMasterPlaylistFor(renditions []rendition, width, height int) []byte {
+	var b bytes.Buffer
+	b.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n")
+	for _, r := range renditions {
+		fmt.Fprintf(&b, "#EXT-X-STREAM-INF:BANDWIDTH=%d", bitrateBits(r.VideoBitrate)+bitrateBits(r.AudioBitrate))
+		if width > 0 && height > 0 {
+			h := min(r.Height, height) / 2 * 2
+			w := (width*h/height + 1) / 2 * 2
+			fmt.Fprintf(&b, ",RESOLUTION=%dx%d", w, h)
+		}
+		fmt.Fprintf(&b, "\n%s/index.m3u8\n", r.Name)
+	}
+	return b.Bytes()
+}
+
+// hlsPlaybackURL is the API route that serves the master playlist with
+// signed segment URLs; the stored tree isn't playable from a private
+// bucket on its own.
+func hlsPlaybackURL(videoID uuid.UUID) string {
+	return fmt.Sprintf("/api/videos/%s/hls/%s", videoID, hlsMasterPlaylist)
+}
+
+// transcodeHLS encodes filePath into the HLS ladder, replaces the video's
+// segment tree under hls/{videoID}/ and returns the playback URL. The
+// master playlist is uploaded last so players never see a variant that
+// isn't there yet.
+func (cfg *apiConfig) transcodeHLS(ctx context.Context, videoID uuid.UUID, filePath string, width, height int) (string, error) {
+	dir, err := os.MkdirTemp("", "tubely-hls-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+
+	renditions := hlsRenditions(height)
+	for _, r := range renditions {
+		if err := os.Mkdir(filepath.Join(dir, r.Name), 0755); err != nil {
+			return "", err
+		}
+		if err := cfg.runHLSRendition(ctx, filePath, dir, r); err != nil {
+			return "", fmt.Errorf("%s: %w", r.Name, err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, hlsMasterPlaylist), hlsMasterPlaylistFor(renditions, width, height), 0644); err != nil {
+		return "", err
+	}
+
+	// Clear out the previous version's tree so a shorter re-upload doesn't
+	// leave stale segments behind.
+	prefix := cfg.hlsPrefix(videoID)
+	if err := cfg.deleteObjectPrefix(ctx, prefix); err != nil {
+		return "", err
+	}
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || d.Name() == hlsMasterPlaylist {
+			return err
+		}
+		return cfg.putHLSFile(ctx, dir, path, prefix)
+	})
+	if err != nil {
+		return "", err
+	}
+	if err := cfg.putHLSFile(ctx, dir, filepath.Join(dir, hlsMasterPlaylist), prefix); err != nil {
+		return "", err
+	}
+	return hlsPlaybackURL(videoID), nil
+}
+
+func (cfg *apiConfig) runHLSRendition(ctx context.Context, input, dir string, r rendition) error {
+	ctx, cancel := cfg.withCommandTimeout(ctx)
+	defer cancel()
+	cmd := cfg.ffmpegCommand(ctx, hlsRenditionArgs(input, dir, r)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return commandFailed(ctx, "error transcoding HLS rendition", stderr.String(), err)
+	}
+	return nil
+}
+
+func (cfg *apiConfig) putHLSFile(ctx context.Context, dir, path, prefix string) error {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return err
+	}
+	contentType := hlsSegmentContentType
+	if strings.HasSuffix(path, ".m3u8") {
+		contentType = hlsPlaylistContentType
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return cfg.putVideoObject(ctx, prefix+filepath.ToSlash(rel), f, contentType)
+}
+
+// storeHLS runs transcodeHLS when HLS output is enabled and returns the
+// URL to store on the video. The progressive mp4 is still there if it
+// fails, so errors are only logged and the video is left without a
+// playlist rather than one for an older version.
+func (cfg *apiConfig) storeHLS(ctx context.Context, videoID uuid.UUID, filePath string, width, height int) *string {
+	if !cfg.hlsEnabled {
+		return nil
+	}
+	url, err := cfg.transcodeHLS(ctx, videoID, filePath, width, height)
+	if err != nil {
+		log.Printf("Couldn't transcode HLS for video %s: %v", videoID, err)
+		return nil
+	}
+	return &url
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+const (
+	hlsPlaylistContentType = "application/vnd.apple.mpegurl"
+	maxHLSPlaylistBytes    = 1 << 20
+)
+
+// hlsURIAttr matches the URI="..." attribute carried by tags such as
+// EXT-X-KEY, EXT-X-MAP, EXT-X-MEDIA and EXT-X-I-FRAME-STREAM-INF.
+var hlsURIAttr = regexp.MustCompile(`URI="([^"]*)"`)
+
+// rewriteHLSPlaylist rewrites every URI in a stored playlist so a player
+// can fetch it from a private bucket. playlistKey is the object key the
+// playlist was read from; relative URIs are resolved against its
+// directory. Nested playlists keep their relative URI so the player
+// requests them back through this API and gets them rewritten too, while
+// everything else (segments, keys, init sections) goes through sign.
+// Absolute URIs already point somewhere else and are left alone.
+func rewriteHLSPlaylist(playlist []byte, playlistKey string, sign func(key string) (string, error)) ([]byte, error) {
+	dir := path.Dir(playlistKey)
+	rewrite := func(uri string) (string, error) {
+		u, err := url.Parse(uri)
+		if err != nil || u.IsAbs() || u.Host != "" || strings.HasPrefix(u.Path, "/") || u.Path == "" {
+			return uri, nil
+		}
+		if strings.HasSuffix(u.Path, ".m3u8") {
+			return uri, nil
+		}
+		return sign(path.Join(dir, u.Path))
+	}
+
+	var out bytes.Buffer
+	var rewriteErr error
+	scanner := bufio.NewScanner(bytes.NewReader(playlist))
+	scanner.Buffer(make([]byte, 0, 64*1024), maxHLSPlaylistBytes)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+		case strings.HasPrefix(trimmed, "#"):
+			line = hlsURIAttr.ReplaceAllStringFunc(line, func(attr string) string {
+				uri := hlsURIAttr.FindStringSubmatch(attr)[1]
+				signed, err := rewrite(uri)
+				if err != nil {
+					rewriteErr = err
+					return attr
+				}
+				return `URI="` + signed + `"`
+			})
+		default:
+			signed, err := rewrite(trimmed)
+			if err != nil {
+				return nil, err
+			}
+			line = signed
+		}
+		if rewriteErr != nil {
+			return nil, rewriteErr
+		}
+		out.WriteString(line)
+		out.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"slices"
+	"strings"
+)
+
+const (
+	verdictPass  = "pass"
+	verdictWarn  = "warn"
+	verdictBlock = "block"
+)
+
+// Verdict is one inspector's opinion of an upload. Reason is shown to the
+// client for warnings and blocks.
+type Verdict struct {
+	Action string
+	Reason string
+}
+
+// Inspector checks an uploaded file before it's processed. Inspectors run
+// in the order configured in INSPECTORS; the first block stops the chain.
+type Inspector interface {
+	Name() string
+	Inspect(ctx context.Context, filePath string) (Verdict, error)
+}
+
+// inspectionResult aggregates a chain run: every warning in order, and the
+// block that ended it, if any.
+type inspectionResult struct {
+	Warnings []string
+	Blocked  string
+}
+
+func (cfg *apiConfig) runInspectors(ctx context.Context, filePath string) (inspectionResult, error) {
+	result := inspectionResult{}
+	for _, inspector := range cfg.inspectors {
+		verdict, err := inspector.Inspect(ctx, filePath)
+		if err != nil {
+			return inspectionResult{}, fmt.Errorf("inspector %s: %w", inspector.Name(), err)
+		}
+		switch verdict.Action {
+		case verdictPass:
+		case verdictWarn:
+			result.Warnings = append(result.Warnings, inspector.Name()+": "+verdict.Reason)
+		case verdictBlock:
+			result.Blocked = inspector.Name() + ": " + verdict.Reason
+			return result, nil
+		default:
+			return inspectionResult{}, fmt.Errorf("inspector %s returned unknown verdict %q", inspector.Name(), verdict.Action)
+		}
+	}
+	return result, nil
+}
+
+// buildInspectors turns the comma-separated INSPECTORS list into the chain,
+// reading each inspector's own settings.
+func (cfg *apiConfig) buildInspectors(names string, getenv func(string) string) ([]Inspector, error) {
+	var inspectors []Inspector
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		switch name {
+		case "":
+			continue
+		case codecInspectorName:
+			codecs := strings.Fields(strings.ReplaceAll(getenv("INSPECT_ALLOWED_CODECS"), ",", " "))
+			if len(codecs) == 0 {
+				return nil, errors.New("INSPECT_ALLOWED_CODECS must list at least one codec")
+			}
+			inspectors = append(inspectors, &codecInspector{allowed: codecs, probe: cfg.probeVideo})
+		case commandInspectorName:
+			argv := strings.Fields(getenv("INSPECT_COMMAND"))
+			if len(argv) == 0 {
+				return nil, errors.New("INSPECT_COMMAND must be set")
+			}
+			inspectors = append(inspectors, &commandInspector{cfg: cfg, argv: argv})
+		default:
+			return nil, fmt.Errorf("unknown inspector %q", name)
+		}
+	}
+	return inspectors, nil
+}
+
+const codecInspectorName = "codec"
+
+// codecInspector blocks video streams whose codec isn't allowlisted.
+type codecInspector struct {
+	allowed []string
+	probe   func(ctx context.Context, filePath string) (videoProbe, error)
+}
+
+func (i *codecInspector) Name() string { return codecInspectorName }
+
+func (i *codecInspector) Inspect(ctx context.Context, filePath string) (Verdict, error) {
+	probe, err := i.probe(ctx, filePath)
+	if err != nil {
+		return Verdict{}, err
+	}
+	if !slices.Contains(i.allowed, probe.VideoCodec) {
+		return Verdict{Action: verdictBlock, Reason: fmt.Sprintf("video codec %q isn't allowed", probe.VideoCodec)}, nil
+	}
+	return Verdict{Action: verdictPass}, nil
+}
+
+const commandInspectorName = "command"
+
+// commandInspector runs an external checker (a virus scanner, a content
+// classifier) with the file path as its last argument. Exit 0 passes, or
+// warns with stdout as the reason if it printed anything; exit 1 blocks.
+// Any other failure is an error, so a broken scanner doesn't let uploads
+// through.
+type commandInspector struct {
+	cfg  *apiConfig
+	argv []string
+}
+
+func (i *commandInspector) Name() string { return i.argv[0] }
+
+func (i *commandInspector) Inspect(ctx context.Context, filePath string) (Verdict, error) {
+	ctx, cancel := i.cfg.withCommandTimeout(ctx)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, i.argv[0], append(slices.Clone(i.argv[1:]), filePath)...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	reason := strings.TrimSpace(stdout.String())
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil && reason == "":
+		return Verdict{Action: verdictPass}, nil
+	case err == nil:
+		return Verdict{Action: verdictWarn, Reason: reason}, nil
+	case errors.As(err, &exitErr) && exitErr.ExitCode() == 1 && ctx.Err() == nil:
+		if reason == "" {
+			reason = "rejected by content inspection"
+		}
+		return Verdict{Action: verdictBlock, Reason: reason}, nil
+	default:
+		return Verdict{}, commandFailed(ctx, "error running inspector", stderr.String(), err)
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeInspector returns a fixed verdict and records the files it saw.
+type fakeInspector struct {
+	name    string
+	verdict Verdict
+	err     error
+
+	mu    sync.Mutex
+	paths []string
+}
+
+func (i *fakeInspector) Name() string { return i.name }
+
+func (i *fakeInspector) Inspect(ctx context.Context, filePath string) (Verdict, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.paths = append(i.paths, filePath)
+	return i.verdict, i.err
+}
+
+func (i *fakeInspector) calls() []string {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return append([]string(nil), i.paths...)
+}
+
+func TestRunInspectors(t *testing.T) {
+	pass := Verdict{Action: verdictPass}
+	warn := func(reason string) Verdict { return Verdict{Action: verdictWarn, Reason: reason} }
+	block := Verdict{Action: verdictBlock, Reason: "infected"}
+
+	tests := []struct {
+		name         string
+		verdicts     []Verdict
+		errAt        int // index of the inspector that errors, -1 for none
+		wantWarnings []string
+		wantBlocked  string
+		wantRan      int
+		wantErr      bool
+	}{
+		{"all pass", []Verdict{pass, pass}, -1, nil, "", 2, false},
+		{"warnings aggregate in order", []Verdict{warn("a"), pass, warn("b")}, -1, []string{"i0: a", "i2: b"}, "", 3, false},
+		{"block short-circuits", []Verdict{warn("a"), block, pass}, -1, []string{"i0: a"}, "i1: infected", 2, false},
+		{"error stops the chain", []Verdict{pass, pass, pass}, 1, nil, "", 2, true},
+		{"unknown verdict", []Verdict{{Action: "maybe"}, pass}, -1, nil, "", 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestConfig(t)
+			var inspectors []*fakeInspector
+			for i, verdict := range tt.verdicts {
+				inspector := &fakeInspector{name: fmt.Sprintf("i%d", i), verdict: verdict}
+				if i == tt.errAt {
+					inspector.err = errors.New("scanner unavailable")
+				}
+				inspectors = append(inspectors, inspector)
+				cfg.inspectors = append(cfg.inspectors, inspector)
+			}
+
+			result, err := cfg.runInspectors(context.Background(), "/tmp/clip.mp4")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error %v", err, tt.wantErr)
+			}
+			if !slices.Equal(result.Warnings, tt.wantWarnings) || result.Blocked != tt.wantBlocked {
+				t.Errorf("got warnings %q, blocked %q; want %q, %q", result.Warnings, result.Blocked, tt.wantWarnings, tt.wantBlocked)
+			}
+			ran := 0
+			for _, inspector := range inspectors {
+				if len(inspector.calls()) > 0 {
+					ran++
+				}
+			}
+			if ran != tt.wantRan {
+				t.Errorf("%d inspectors ran, want %d", ran, tt.wantRan)
+			}
+		})
+	}
+}
+
+func TestUploadRunsInspectors(t *testing.T) {
+	tests := []struct {
+		name        string
+		verdicts    []Verdict
+		wantCode    int
+		wantWarning string
+	}{
+		{"pass", []Verdict{{Action: verdictPass}}, http.StatusOK, ""},
+		{"warn", []Verdict{{Action: verdictWarn, Reason: "low bitrate"}, {Action: verdictPass}}, http.StatusOK, "i0: low bitrate"},
+		{"block", []Verdict{{Action: verdictPass}, {Action: verdictBlock, Reason: "infected"}}, http.StatusUnprocessableEntity, ""},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestConfig(t)
+			installFakeMedia(t, &fakeMedia{Width: 1920, Height: 1080})
+			for j, verdict := range tt.verdicts {
+				cfg.inspectors = append(cfg.inspectors, &fakeInspector{name: fmt.Sprintf("i%d", j), verdict: verdict})
+			}
+			userID := createTestUser(t, cfg)
+			video := createTestVideo(t, cfg, userID, visibilityPublic)
+
+			rec := uploadTestVideo(t, cfg, video.ID, userID, testMP4(256, byte(i)))
+			if rec.Code != tt.wantCode {
+				t.Fatalf("got status %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			if got := rec.Header().Get("X-Inspection-Warnings"); got != tt.wantWarning {
+				t.Errorf("X-Inspection-Warnings = %q, want %q", got, tt.wantWarning)
+			}
+			if tt.wantCode != http.StatusOK && !strings.Contains(rec.Body.String(), "infected") {
+				t.Errorf("rejection %q doesn't give the inspector's reason", rec.Body)
+			}
+		})
+	}
+}
+
+func TestBuildInspectors(t *testing.T) {
+	cfg := newTestConfig(t)
+	env := map[string]string{"INSPECT_ALLOWED_CODECS": "h264,vp9", "INSPECT_COMMAND": "clamscan --no-summary"}
+	inspectors, err := cfg.buildInspectors("codec, command", func(key string) string { return env[key] })
+	if err != nil {
+		t.Fatalf("buildInspectors: %v", err)
+	}
+	var names []string
+	for _, inspector := range inspectors {
+		names = append(names, inspector.Name())
+	}
+	if want := []string{"codec", "clamscan"}; !slices.Equal(names, want) {
+		t.Errorf("got chain %q, want %q", names, want)
+	}
+
+	if _, err := cfg.buildInspectors("codec,antivirus", func(key string) string { return env[key] }); err == nil {
+		t.Error("unknown inspector was accepted")
+	}
+	if _, err := cfg.buildInspectors("codec", func(string) string { return "" }); err == nil {
+		t.Error("codec inspector without an allowlist was accepted")
+	}
+}
+
+func TestQueuedUploadReportsWarningsOnStatus(t *testing.T) {
+	cfg := newTestConfig(t)
+	installFakeMedia(t, &fakeMedia{Width: 1920, Height: 1080})
+	inspector := &fakeInspector{name: "loudness", verdict: Verdict{Action: verdictWarn, Reason: "quiet, mono"}}
+	cfg.inspectors = []Inspector{inspector}
+	cfg.processingQueue = newProcessingQueue(2)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cfg.runProcessingWorkers(ctx, 1)
+	userID := createTestUser(t, cfg)
+	video := createTestVideo(t, cfg, userID, visibilityPublic)
+
+	type status struct {
+		Status   string   `json:"status"`
+		Warnings []string `json:"warnings"`
+	}
+	waitReady := func() status {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			rec := httptest.NewRecorder()
+			cfg.handlerVideoState(rec, videoActionRequest(t, http.MethodGet, "/status", video.ID, userID))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status: got %d: %s", rec.Code, rec.Body)
+			}
+			got := decodeJSON[status](t, rec)
+			if got.Status == processingStatusReady {
+				return got
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("video is still %q", got.Status)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	if rec := uploadTestVideo(t, cfg, video.ID, userID, testMP4(256, 0)); rec.Code != http.StatusAccepted {
+		t.Fatalf("upload: got status %d: %s", rec.Code, rec.Body)
+	}
+	if got := waitReady(); !slices.Equal(got.Warnings, []string{"loudness: quiet, mono"}) {
+		t.Errorf("warnings = %q, want the inspector's", got.Warnings)
+	}
+
+	// A clean re-upload clears them.
+	inspector.mu.Lock()
+	inspector.verdict = Verdict{Action: verdictPass}
+	inspector.mu.Unlock()
+	if rec := uploadTestVideo(t, cfg, video.ID, userID, testMP4(256, 1)); rec.Code != http.StatusAccepted {
+		t.Fatalf("re-upload: got status %d: %s", rec.Code, rec.Body)
+	}
+	if got := waitReady(); len(got.Warnings) != 0 {
+		t.Errorf("warnings after a clean upload = %q, want none", got.Warnings)
+	}
+}
@@ -0,0 +1,100 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type APIKey struct {
+	ID        uuid.UUID  `json:"id"`
+	UserID    uuid.UUID  `json:"user_id"`
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+}
+
+type CreateAPIKeyParams struct {
+	UserID uuid.UUID
+	Name   string
+	// KeyHash is the SHA-256 of the key; the key itself is never stored.
+	KeyHash string
+	Scopes  []string
+}
+
+const apiKeyColumns = `id, user_id, name, scopes, created_at, revoked_at`
+
+func (c Client) CreateAPIKey(params CreateAPIKeyParams) (APIKey, error) {
+	key := APIKey{
+		ID:        c.newID(),
+		UserID:    params.UserID,
+		Name:      params.Name,
+		Scopes:    params.Scopes,
+		CreatedAt: c.timestamp(),
+	}
+	query := `
+	INSERT INTO api_keys (id, user_id, name, key_hash, scopes, created_at)
+	VALUES (?, ?, ?, ?, ?, ?)
+	`
+	_, err := c.db.Exec(query, key.ID, key.UserID, key.Name, params.KeyHash, strings.Join(key.Scopes, ","), key.CreatedAt)
+	if err != nil {
+		return APIKey{}, err
+	}
+	return key, nil
+}
+
+// GetAPIKeyByHash looks up an unrevoked key. It returns a zero APIKey when
+// there is no match.
+func (c Client) GetAPIKeyByHash(keyHash string) (APIKey, error) {
+	row := c.db.QueryRow("SELECT "+apiKeyColumns+" FROM api_keys WHERE key_hash = ? AND revoked_at IS NULL", keyHash)
+	key, err := scanAPIKey(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return APIKey{}, nil
+	}
+	return key, err
+}
+
+func (c Client) GetAPIKeys(userID uuid.UUID) ([]APIKey, error) {
+	rows, err := c.db.Query("SELECT "+apiKeyColumns+" FROM api_keys WHERE user_id = ? ORDER BY created_at", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	keys := []APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// RevokeAPIKey revokes one of userID's keys and reports whether it found
+// an active key to revoke.
+func (c Client) RevokeAPIKey(id, userID uuid.UUID) (bool, error) {
+	result, err := c.db.Exec("UPDATE api_keys SET revoked_at = ? WHERE id = ? AND user_id = ? AND revoked_at IS NULL", c.timestamp(), id, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
+
+func scanAPIKey(row rowScanner) (APIKey, error) {
+	var key APIKey
+	var scopes string
+	if err := row.Scan(&key.ID, &key.UserID, &key.Name, &scopes, &key.CreatedAt, &key.RevokedAt); err != nil {
+		return APIKey{}, err
+	}
+	key.Scopes = []string{}
+	if scopes != "" {
+		key.Scopes = strings.Split(scopes, ",")
+	}
+	return key, nil
+}
@@ -0,0 +1,75 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	BanKindUser  = "user"
+	BanKindVideo = "video"
+)
+
+type Ban struct {
+	Kind      string    `json:"kind"`
+	TargetID  uuid.UUID `json:"target_id"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (c Client) CreateBan(kind string, targetID uuid.UUID, reason string) (Ban, error) {
+	ban := Ban{
+		Kind:      kind,
+		TargetID:  targetID,
+		Reason:    reason,
+		CreatedAt: c.timestamp(),
+	}
+	query := `
+	INSERT INTO bans (kind, target_id, reason, created_at)
+	VALUES (?, ?, ?, ?)
+	ON CONFLICT(kind, target_id) DO UPDATE SET reason = excluded.reason
+	`
+	_, err := c.db.Exec(query, ban.Kind, ban.TargetID, ban.Reason, ban.CreatedAt)
+	if err != nil {
+		return Ban{}, err
+	}
+	return ban, nil
+}
+
+func (c Client) DeleteBan(kind string, targetID uuid.UUID) error {
+	_, err := c.db.Exec("DELETE FROM bans WHERE kind = ? AND target_id = ?", kind, targetID)
+	return err
+}
+
+func (c Client) IsBanned(kind string, targetID uuid.UUID) (bool, error) {
+	var found int
+	err := c.db.QueryRow("SELECT 1 FROM bans WHERE kind = ? AND target_id = ?", kind, targetID).Scan(&found)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (c Client) GetBans() ([]Ban, error) {
+	rows, err := c.db.Query("SELECT kind, target_id, reason, created_at FROM bans ORDER BY created_at DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bans := []Ban{}
+	for rows.Next() {
+		var ban Ban
+		if err := rows.Scan(&ban.Kind, &ban.TargetID, &ban.Reason, &ban.CreatedAt); err != nil {
+			return nil, err
+		}
+		bans = append(bans, ban)
+	}
+	return bans, rows.Err()
+}
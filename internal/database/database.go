@@ -3,12 +3,17 @@ package database
 import (
 	"database/sql"
 	"fmt"
+	"strings"
+	"time"
 
+	"github.com/google/uuid"
 	_ "github.com/mattn/go-sqlite3"
 )
 
 type Client struct {
-	db *sql.DB
+	db    *sql.DB
+	newID func() uuid.UUID
+	now   func() time.Time
 }
 
 func NewClient(pathToDB string) (Client, error) {
@@ -16,7 +21,7 @@ func NewClient(pathToDB string) (Client, error) {
 	if err != nil {
 		return Client{}, err
 	}
-	c := Client{db}
+	c := Client{db: db, newID: uuid.New, now: time.Now}
 	err = c.autoMigrate()
 	if err != nil {
 		return Client{}, err
@@ -72,18 +77,315 @@ func (c *Client) autoMigrate() error {
 	if err != nil {
 		return err
 	}
+	videoColumns := []struct{ name, definition string }{
+		{"width", "INTEGER NOT NULL DEFAULT 0"},
+		{"height", "INTEGER NOT NULL DEFAULT 0"},
+		{"aspect", "TEXT NOT NULL DEFAULT ''"},
+		{"duration_sec", "REAL NOT NULL DEFAULT 0"},
+		{"audio_language", "TEXT NOT NULL DEFAULT 'und'"},
+		{"blurhash", "TEXT"},
+		{"visibility", "TEXT NOT NULL DEFAULT 'public'"},
+		{"status", "TEXT NOT NULL DEFAULT 'pending'"},
+		{"progress", "INTEGER NOT NULL DEFAULT 0"},
+		{"processing_error", "TEXT"},
+		{"audio_languages", "TEXT NOT NULL DEFAULT ''"},
+		{"playback_error_count", "INTEGER NOT NULL DEFAULT 0"},
+		{"original_size_bytes", "INTEGER NOT NULL DEFAULT 0"},
+		{"final_size_bytes", "INTEGER NOT NULL DEFAULT 0"},
+		{"url_ttl_seconds", "INTEGER"},
+		{"deleted_at", "TIMESTAMP"},
+		{"hls_url", "TEXT"},
+		{"video_codec", "TEXT NOT NULL DEFAULT ''"},
+		{"bitrate", "INTEGER NOT NULL DEFAULT 0"},
+		{"frame_rate", "REAL NOT NULL DEFAULT 0"},
+		{"sha256", "TEXT NOT NULL DEFAULT ''"},
+		{"processing_warnings", "TEXT NOT NULL DEFAULT ''"},
+	}
+	for _, col := range videoColumns {
+		if err := c.addColumn("videos", col.name, col.definition); err != nil {
+			return err
+		}
+	}
+	if err := c.addColumn("users", "default_visibility", "TEXT"); err != nil {
+		return err
+	}
+
+	videoVersionTable := `
+	CREATE TABLE IF NOT EXISTS video_versions (
+		video_id TEXT NOT NULL,
+		version INTEGER NOT NULL,
+		key TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY(video_id, version),
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	`
+	_, err = c.db.Exec(videoVersionTable)
+	if err != nil {
+		return err
+	}
+	if err := c.addColumn("video_versions", "size_bytes", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := c.addColumn("video_versions", "sha256", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+
+	uploadUsageTable := `
+	CREATE TABLE IF NOT EXISTS upload_usage (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id TEXT NOT NULL,
+		bytes INTEGER NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		FOREIGN KEY(user_id) REFERENCES users(id)
+	);
+	`
+	_, err = c.db.Exec(uploadUsageTable)
+	if err != nil {
+		return err
+	}
+	if err := c.addColumn("upload_usage", "pending", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+
+	playbackErrorTable := `
+	CREATE TABLE IF NOT EXISTS playback_errors (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		video_id TEXT NOT NULL,
+		code TEXT NOT NULL,
+		message TEXT NOT NULL,
+		user_agent TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	`
+	_, err = c.db.Exec(playbackErrorTable)
+	if err != nil {
+		return err
+	}
+
+	banTable := `
+	CREATE TABLE IF NOT EXISTS bans (
+		kind TEXT NOT NULL,
+		target_id TEXT NOT NULL,
+		reason TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP NOT NULL,
+		PRIMARY KEY(kind, target_id)
+	);
+	`
+	_, err = c.db.Exec(banTable)
+	if err != nil {
+		return err
+	}
+
+	processingErrorTable := `
+	CREATE TABLE IF NOT EXISTS processing_errors (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		video_id TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		stage TEXT NOT NULL,
+		error TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL
+	);
+	`
+	_, err = c.db.Exec(processingErrorTable)
+	if err != nil {
+		return err
+	}
+
+	videoGrantTable := `
+	CREATE TABLE IF NOT EXISTS video_grants (
+		video_id TEXT NOT NULL,
+		grantee_user_id TEXT NOT NULL,
+		permission TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		PRIMARY KEY(video_id, grantee_user_id),
+		FOREIGN KEY(video_id) REFERENCES videos(id),
+		FOREIGN KEY(grantee_user_id) REFERENCES users(id)
+	);
+	`
+	_, err = c.db.Exec(videoGrantTable)
+	if err != nil {
+		return err
+	}
+
+	videoTimingsTable := `
+	CREATE TABLE IF NOT EXISTS video_timings (
+		video_id TEXT PRIMARY KEY,
+		probe_ms INTEGER NOT NULL,
+		transcode_ms INTEGER NOT NULL,
+		upload_ms INTEGER NOT NULL,
+		recorded_at TIMESTAMP NOT NULL,
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	`
+	_, err = c.db.Exec(videoTimingsTable)
+	if err != nil {
+		return err
+	}
+
+	videoCaptionTable := `
+	CREATE TABLE IF NOT EXISTS video_captions (
+		video_id TEXT NOT NULL,
+		language TEXT NOT NULL,
+		key TEXT NOT NULL,
+		url TEXT NOT NULL,
+		generated BOOLEAN NOT NULL DEFAULT FALSE,
+		created_at TIMESTAMP NOT NULL,
+		PRIMARY KEY(video_id, language),
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	`
+	_, err = c.db.Exec(videoCaptionTable)
+	if err != nil {
+		return err
+	}
+
+	apiKeyTable := `
+	CREATE TABLE IF NOT EXISTS api_keys (
+		id TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		name TEXT NOT NULL,
+		key_hash TEXT NOT NULL UNIQUE,
+		scopes TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		revoked_at TIMESTAMP,
+		FOREIGN KEY(user_id) REFERENCES users(id)
+	);
+	`
+	_, err = c.db.Exec(apiKeyTable)
+	if err != nil {
+		return err
+	}
+
+	resumableUploadTable := `
+	CREATE TABLE IF NOT EXISTS resumable_uploads (
+		id TEXT PRIMARY KEY,
+		video_id TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		s3_upload_id TEXT NOT NULL,
+		key TEXT NOT NULL,
+		content_type TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		FOREIGN KEY(video_id) REFERENCES videos(id),
+		FOREIGN KEY(user_id) REFERENCES users(id)
+	);
+	`
+	_, err = c.db.Exec(resumableUploadTable)
+	if err != nil {
+		return err
+	}
+
+	resumableUploadPartTable := `
+	CREATE TABLE IF NOT EXISTS resumable_upload_parts (
+		upload_id TEXT NOT NULL,
+		part_number INTEGER NOT NULL,
+		etag TEXT NOT NULL,
+		size_bytes INTEGER NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		PRIMARY KEY(upload_id, part_number),
+		FOREIGN KEY(upload_id) REFERENCES resumable_uploads(id)
+	);
+	`
+	_, err = c.db.Exec(resumableUploadPartTable)
+	if err != nil {
+		return err
+	}
 	return nil
 }
 
+// SetGenerators replaces how the client mints IDs and creation timestamps,
+// which lets tests make both deterministic.
+func (c *Client) SetGenerators(newID func() uuid.UUID, now func() time.Time) {
+	c.newID = newID
+	c.now = now
+}
+
+func (c Client) timestamp() time.Time {
+	return c.now().UTC()
+}
+
+// addColumn adds a column to an existing table unless it's already there, so
+// databases created before the column existed are upgraded in place.
+func (c *Client) addColumn(table, column, definition string) error {
+	rows, err := c.db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			colType    string
+			notNull    int
+			defaultVal sql.NullString
+			primaryKey int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultVal, &primaryKey); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	_, err = c.db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
 func (c Client) Reset() error {
 	if _, err := c.db.Exec("DELETE FROM refresh_tokens"); err != nil {
 		return fmt.Errorf("failed to reset table refresh_tokens: %w", err)
 	}
+	if _, err := c.db.Exec("DELETE FROM resumable_upload_parts"); err != nil {
+		return fmt.Errorf("failed to reset table resumable_upload_parts: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM resumable_uploads"); err != nil {
+		return fmt.Errorf("failed to reset table resumable_uploads: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM api_keys"); err != nil {
+		return fmt.Errorf("failed to reset table api_keys: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM upload_usage"); err != nil {
+		return fmt.Errorf("failed to reset table upload_usage: %w", err)
+	}
 	if _, err := c.db.Exec("DELETE FROM users"); err != nil {
 		return fmt.Errorf("failed to reset table users: %w", err)
 	}
+	if _, err := c.db.Exec("DELETE FROM video_captions"); err != nil {
+		return fmt.Errorf("failed to reset table video_captions: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM video_timings"); err != nil {
+		return fmt.Errorf("failed to reset table video_timings: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM video_grants"); err != nil {
+		return fmt.Errorf("failed to reset table video_grants: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM processing_errors"); err != nil {
+		return fmt.Errorf("failed to reset table processing_errors: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM bans"); err != nil {
+		return fmt.Errorf("failed to reset table bans: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM playback_errors"); err != nil {
+		return fmt.Errorf("failed to reset table playback_errors: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM video_versions"); err != nil {
+		return fmt.Errorf("failed to reset table video_versions: %w", err)
+	}
 	if _, err := c.db.Exec("DELETE FROM videos"); err != nil {
 		return fmt.Errorf("failed to reset table videos: %w", err)
 	}
 	return nil
 }
+
+// placeholders returns n comma-separated "?" for an IN (...) list.
+func placeholders(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return strings.Repeat("?, ", n-1) + "?"
+}
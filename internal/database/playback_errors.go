@@ -0,0 +1,89 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type PlaybackError struct {
+	ID        int64     `json:"id"`
+	VideoID   uuid.UUID `json:"video_id"`
+	Code      string    `json:"code"`
+	Message   string    `json:"message"`
+	UserAgent string    `json:"user_agent"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type CreatePlaybackErrorParams struct {
+	VideoID   uuid.UUID
+	Code      string
+	Message   string
+	UserAgent string
+}
+
+// RecordPlaybackError stores a client playback failure, bumps the video's
+// counter and trims the stored reports to the newest keep entries.
+func (c Client) RecordPlaybackError(params CreatePlaybackErrorParams, keep int) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+	INSERT INTO playback_errors (
+		video_id,
+		code,
+		message,
+		user_agent,
+		created_at
+	) VALUES (?, ?, ?, ?, ?)
+	`, params.VideoID, params.Code, params.Message, params.UserAgent, c.timestamp())
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE videos SET playback_error_count = playback_error_count + 1 WHERE id = ?", params.VideoID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+	DELETE FROM playback_errors
+	WHERE video_id = ? AND id NOT IN (
+		SELECT id FROM playback_errors
+		WHERE video_id = ?
+		ORDER BY id DESC
+		LIMIT ?
+	)
+	`, params.VideoID, params.VideoID, keep)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (c Client) GetPlaybackErrors(videoID uuid.UUID) ([]PlaybackError, error) {
+	query := `
+	SELECT id, video_id, code, message, user_agent, created_at
+	FROM playback_errors
+	WHERE video_id = ?
+	ORDER BY id DESC
+	`
+	rows, err := c.db.Query(query, videoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	errs := []PlaybackError{}
+	for rows.Next() {
+		var e PlaybackError
+		if err := rows.Scan(&e.ID, &e.VideoID, &e.Code, &e.Message, &e.UserAgent, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		errs = append(errs, e)
+	}
+	return errs, rows.Err()
+}
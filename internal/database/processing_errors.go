@@ -0,0 +1,102 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type ProcessingError struct {
+	ID        int64     `json:"id"`
+	VideoID   uuid.UUID `json:"video_id"`
+	UserID    uuid.UUID `json:"user_id"`
+	Stage     string    `json:"stage"`
+	Error     string    `json:"error"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type CreateProcessingErrorParams struct {
+	VideoID uuid.UUID
+	UserID  uuid.UUID
+	Stage   string
+	Error   string
+}
+
+type ProcessingErrorFilter struct {
+	// Stage limits results to one pipeline stage when non-empty.
+	Stage string
+	// Since drops failures older than this when non-zero.
+	Since time.Time
+	Limit int
+}
+
+// RecordProcessingError appends to the processing error log, keeping only
+// the newest keep entries across all videos.
+func (c Client) RecordProcessingError(params CreateProcessingErrorParams, keep int) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+	INSERT INTO processing_errors (
+		video_id,
+		user_id,
+		stage,
+		error,
+		created_at
+	) VALUES (?, ?, ?, ?, ?)
+	`, params.VideoID, params.UserID, params.Stage, params.Error, c.timestamp())
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+	DELETE FROM processing_errors
+	WHERE id NOT IN (
+		SELECT id FROM processing_errors
+		ORDER BY id DESC
+		LIMIT ?
+	)
+	`, keep)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (c Client) GetProcessingErrors(filter ProcessingErrorFilter) ([]ProcessingError, error) {
+	query := `
+	SELECT id, video_id, user_id, stage, error, created_at
+	FROM processing_errors
+	WHERE 1 = 1
+	`
+	var args []any
+	if filter.Stage != "" {
+		query += " AND stage = ?"
+		args = append(args, filter.Stage)
+	}
+	if !filter.Since.IsZero() {
+		query += " AND created_at >= ?"
+		args = append(args, filter.Since.UTC())
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, filter.Limit)
+
+	rows, err := c.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	errs := []ProcessingError{}
+	for rows.Next() {
+		var e ProcessingError
+		if err := rows.Scan(&e.ID, &e.VideoID, &e.UserID, &e.Stage, &e.Error, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		errs = append(errs, e)
+	}
+	return errs, rows.Err()
+}
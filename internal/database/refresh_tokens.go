@@ -28,9 +28,10 @@ func (c Client) CreateRefreshToken(params CreateRefreshTokenParams) (RefreshToke
 			updated_at,
 			user_id,
 			expires_at
-		) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?)
+		) VALUES (?, ?, ?, ?, ?)
 	`
-	_, err := c.db.Exec(query, params.Token, params.UserID.String(), params.ExpiresAt)
+	now := c.timestamp()
+	_, err := c.db.Exec(query, params.Token, now, now, params.UserID.String(), params.ExpiresAt)
 	if err != nil {
 		return RefreshToken{}, err
 	}
@@ -41,10 +42,10 @@ func (c Client) CreateRefreshToken(params CreateRefreshTokenParams) (RefreshToke
 func (c Client) RevokeRefreshToken(token string) error {
 	query := `
 		UPDATE refresh_tokens
-		SET revoked_at = CURRENT_TIMESTAMP
+		SET revoked_at = ?
 		WHERE token = ?
 	`
-	_, err := c.db.Exec(query, token)
+	_, err := c.db.Exec(query, c.timestamp(), token)
 	return err
 }
 
@@ -0,0 +1,129 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ResumableUpload tracks an S3 multipart upload a client sends in parts,
+// so it can pick up where it left off after a dropped connection.
+type ResumableUpload struct {
+	ID          uuid.UUID `json:"id"`
+	VideoID     uuid.UUID `json:"video_id"`
+	UserID      uuid.UUID `json:"user_id"`
+	S3UploadID  string    `json:"-"`
+	Key         string    `json:"-"`
+	ContentType string    `json:"content_type"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type ResumableUploadPart struct {
+	PartNumber int       `json:"part_number"`
+	ETag       string    `json:"etag"`
+	SizeBytes  int64     `json:"size_bytes"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type CreateResumableUploadParams struct {
+	VideoID     uuid.UUID
+	UserID      uuid.UUID
+	S3UploadID  string
+	Key         string
+	ContentType string
+}
+
+const resumableUploadColumns = `id, video_id, user_id, s3_upload_id, key, content_type, created_at`
+
+func (c Client) CreateResumableUpload(params CreateResumableUploadParams) (ResumableUpload, error) {
+	upload := ResumableUpload{
+		ID:          c.newID(),
+		VideoID:     params.VideoID,
+		UserID:      params.UserID,
+		S3UploadID:  params.S3UploadID,
+		Key:         params.Key,
+		ContentType: params.ContentType,
+		CreatedAt:   c.timestamp(),
+	}
+	query := `
+	INSERT INTO resumable_uploads (` + resumableUploadColumns + `)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err := c.db.Exec(query, upload.ID, upload.VideoID, upload.UserID, upload.S3UploadID, upload.Key, upload.ContentType, upload.CreatedAt)
+	if err != nil {
+		return ResumableUpload{}, err
+	}
+	return upload, nil
+}
+
+// GetResumableUpload returns a zero ResumableUpload when there is no match.
+func (c Client) GetResumableUpload(id uuid.UUID) (ResumableUpload, error) {
+	row := c.db.QueryRow("SELECT "+resumableUploadColumns+" FROM resumable_uploads WHERE id = ?", id)
+	var upload ResumableUpload
+	err := row.Scan(&upload.ID, &upload.VideoID, &upload.UserID, &upload.S3UploadID, &upload.Key, &upload.ContentType, &upload.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ResumableUpload{}, nil
+	}
+	if err != nil {
+		return ResumableUpload{}, err
+	}
+	return upload, nil
+}
+
+// SaveResumableUploadPart records a stored part. Sending a part number
+// again replaces it, matching S3's behaviour.
+func (c Client) SaveResumableUploadPart(uploadID uuid.UUID, part ResumableUploadPart) error {
+	query := `
+	INSERT INTO resumable_upload_parts (upload_id, part_number, etag, size_bytes, created_at)
+	VALUES (?, ?, ?, ?, ?)
+	ON CONFLICT(upload_id, part_number) DO UPDATE SET
+		etag = excluded.etag,
+		size_bytes = excluded.size_bytes,
+		created_at = excluded.created_at
+	`
+	_, err := c.db.Exec(query, uploadID, part.PartNumber, part.ETag, part.SizeBytes, c.timestamp())
+	return err
+}
+
+// GetResumableUploadParts returns the stored parts in part order.
+func (c Client) GetResumableUploadParts(uploadID uuid.UUID) ([]ResumableUploadPart, error) {
+	query := `
+	SELECT part_number, etag, size_bytes, created_at
+	FROM resumable_upload_parts
+	WHERE upload_id = ?
+	ORDER BY part_number
+	`
+	rows, err := c.db.Query(query, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	parts := []ResumableUploadPart{}
+	for rows.Next() {
+		var part ResumableUploadPart
+		if err := rows.Scan(&part.PartNumber, &part.ETag, &part.SizeBytes, &part.CreatedAt); err != nil {
+			return nil, err
+		}
+		parts = append(parts, part)
+	}
+	return parts, rows.Err()
+}
+
+func (c Client) DeleteResumableUpload(id uuid.UUID) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM resumable_upload_parts WHERE upload_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM resumable_uploads WHERE id = ?", id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,107 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func (c Client) RecordUpload(userID uuid.UUID, bytes int64, at time.Time) error {
+	query := `
+	INSERT INTO upload_usage (
+		user_id,
+		bytes,
+		created_at
+	) VALUES (?, ?, ?)
+	`
+	_, err := c.db.Exec(query, userID, bytes, at.UTC())
+	return err
+}
+
+// ReserveUpload records an upload that's still in flight. The row counts
+// toward the user's usage straight away, so concurrent uploads see each
+// other, and is later committed with the real size or released.
+func (c Client) ReserveUpload(userID uuid.UUID, bytes int64, at time.Time) (int64, error) {
+	query := `
+	INSERT INTO upload_usage (
+		user_id,
+		bytes,
+		created_at,
+		pending
+	) VALUES (?, ?, ?, 1)
+	`
+	res, err := c.db.Exec(query, userID, bytes, at.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// ResizeUploadReservation changes how many bytes a pending upload holds.
+func (c Client) ResizeUploadReservation(id, bytes int64) error {
+	_, err := c.db.Exec("UPDATE upload_usage SET bytes = ? WHERE id = ? AND pending = 1", bytes, id)
+	return err
+}
+
+// CommitUploadReservation turns a pending upload into a finished one of
+// the given size. It reports false when the reservation is gone, having
+// been released as stale.
+func (c Client) CommitUploadReservation(id, bytes int64) (bool, error) {
+	res, err := c.db.Exec("UPDATE upload_usage SET bytes = ?, pending = 0 WHERE id = ?", bytes, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// ReleaseUploadReservation drops a pending upload that failed.
+func (c Client) ReleaseUploadReservation(id int64) error {
+	_, err := c.db.Exec("DELETE FROM upload_usage WHERE id = ? AND pending = 1", id)
+	return err
+}
+
+// GetUploadedBytesSince sums the bytes a user has uploaded at or after the
+// given time, pending uploads included.
+func (c Client) GetUploadedBytesSince(userID uuid.UUID, since time.Time) (int64, error) {
+	query := `
+	SELECT COALESCE(SUM(bytes), 0)
+	FROM upload_usage
+	WHERE user_id = ? AND created_at >= ?
+	`
+	var total int64
+	err := c.db.QueryRow(query, userID, since.UTC()).Scan(&total)
+	return total, err
+}
+
+// CountUploadsSince counts the uploads a user has recorded at or after the
+// given time, pending uploads included.
+func (c Client) CountUploadsSince(userID uuid.UUID, since time.Time) (int64, error) {
+	query := `
+	SELECT COUNT(*)
+	FROM upload_usage
+	WHERE user_id = ? AND created_at >= ?
+	`
+	var count int64
+	err := c.db.QueryRow(query, userID, since.UTC()).Scan(&count)
+	return count, err
+}
+
+// GetPendingUploadBytes sums the bytes held by a user's in-flight uploads.
+func (c Client) GetPendingUploadBytes(userID uuid.UUID) (int64, error) {
+	query := `
+	SELECT COALESCE(SUM(bytes), 0)
+	FROM upload_usage
+	WHERE user_id = ? AND pending = 1
+	`
+	var total int64
+	err := c.db.QueryRow(query, userID).Scan(&total)
+	return total, err
+}
+
+// ReleaseStaleUploadReservations drops pending uploads reserved before the
+// given time, which never finished, such as ones cut off by a restart.
+func (c Client) ReleaseStaleUploadReservations(before time.Time) error {
+	_, err := c.db.Exec("DELETE FROM upload_usage WHERE pending = 1 AND created_at < ?", before.UTC())
+	return err
+}
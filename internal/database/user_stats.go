@@ -0,0 +1,51 @@
+package database
+
+import "github.com/google/uuid"
+
+type AspectStats struct {
+	Count            int     `json:"count"`
+	TotalDurationSec float64 `json:"total_duration_sec"`
+	TotalBytes       int64   `json:"total_bytes"`
+}
+
+type UserStats struct {
+	VideoCount       int                    `json:"video_count"`
+	TotalDurationSec float64                `json:"total_duration_sec"`
+	TotalBytes       int64                  `json:"total_bytes"`
+	ByAspect         map[string]AspectStats `json:"by_aspect"`
+}
+
+// UserStats aggregates a user's videos in a single grouped query; the
+// overall totals are the sum of the per-aspect rows. Videos that haven't
+// been processed yet are grouped under "unknown".
+func (c Client) UserStats(userID uuid.UUID) (UserStats, error) {
+	query := `
+	SELECT
+		COALESCE(NULLIF(aspect, ''), 'unknown'),
+		COUNT(*),
+		COALESCE(SUM(duration_sec), 0),
+		COALESCE(SUM(final_size_bytes), 0)
+	FROM videos
+	WHERE user_id = ? AND deleted_at IS NULL
+	GROUP BY 1
+	`
+	rows, err := c.db.Query(query, userID)
+	if err != nil {
+		return UserStats{}, err
+	}
+	defer rows.Close()
+
+	stats := UserStats{ByAspect: map[string]AspectStats{}}
+	for rows.Next() {
+		var aspect string
+		var s AspectStats
+		if err := rows.Scan(&aspect, &s.Count, &s.TotalDurationSec, &s.TotalBytes); err != nil {
+			return UserStats{}, err
+		}
+		stats.ByAspect[aspect] = s
+		stats.VideoCount += s.Count
+		stats.TotalDurationSec += s.TotalDurationSec
+		stats.TotalBytes += s.TotalBytes
+	}
+	return stats, rows.Err()
+}
@@ -0,0 +1,55 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type VideoCaption struct {
+	VideoID   uuid.UUID `json:"video_id"`
+	Language  string    `json:"language"`
+	Key       string    `json:"key"`
+	URL       string    `json:"url"`
+	Generated bool      `json:"generated"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// UpsertVideoCaption records a subtitle track, replacing any existing one
+// for the same language.
+func (c Client) UpsertVideoCaption(caption VideoCaption) error {
+	query := `
+	INSERT INTO video_captions (video_id, language, key, url, generated, created_at)
+	VALUES (?, ?, ?, ?, ?, ?)
+	ON CONFLICT(video_id, language) DO UPDATE SET
+		key = excluded.key,
+		url = excluded.url,
+		generated = excluded.generated,
+		created_at = excluded.created_at
+	`
+	_, err := c.db.Exec(query, caption.VideoID, caption.Language, caption.Key, caption.URL, caption.Generated, c.timestamp())
+	return err
+}
+
+func (c Client) GetVideoCaptions(videoID uuid.UUID) ([]VideoCaption, error) {
+	rows, err := c.db.Query(`
+	SELECT video_id, language, key, url, generated, created_at
+	FROM video_captions
+	WHERE video_id = ?
+	ORDER BY language
+	`, videoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	captions := []VideoCaption{}
+	for rows.Next() {
+		var caption VideoCaption
+		if err := rows.Scan(&caption.VideoID, &caption.Language, &caption.Key, &caption.URL, &caption.Generated, &caption.CreatedAt); err != nil {
+			return nil, err
+		}
+		captions = append(captions, caption)
+	}
+	return captions, rows.Err()
+}
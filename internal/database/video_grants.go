@@ -0,0 +1,84 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	GrantPermissionView = "view"
+	GrantPermissionEdit = "edit"
+)
+
+type VideoGrant struct {
+	VideoID       uuid.UUID `json:"video_id"`
+	GranteeUserID uuid.UUID `json:"grantee_user_id"`
+	Permission    string    `json:"permission"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// UpsertVideoGrant gives a user access to a video, replacing any
+// permission they already had on it.
+func (c Client) UpsertVideoGrant(videoID, granteeUserID uuid.UUID, permission string) (VideoGrant, error) {
+	grant := VideoGrant{
+		VideoID:       videoID,
+		GranteeUserID: granteeUserID,
+		Permission:    permission,
+		CreatedAt:     c.timestamp(),
+	}
+	query := `
+	INSERT INTO video_grants (video_id, grantee_user_id, permission, created_at)
+	VALUES (?, ?, ?, ?)
+	ON CONFLICT(video_id, grantee_user_id) DO UPDATE SET permission = excluded.permission
+	`
+	_, err := c.db.Exec(query, grant.VideoID, grant.GranteeUserID, grant.Permission, grant.CreatedAt)
+	if err != nil {
+		return VideoGrant{}, err
+	}
+	return grant, nil
+}
+
+func (c Client) DeleteVideoGrant(videoID, granteeUserID uuid.UUID) error {
+	_, err := c.db.Exec("DELETE FROM video_grants WHERE video_id = ? AND grantee_user_id = ?", videoID, granteeUserID)
+	return err
+}
+
+// GetVideoGrantPermission returns the permission a user has been granted on
+// a video, or "" if they have none.
+func (c Client) GetVideoGrantPermission(videoID, granteeUserID uuid.UUID) (string, error) {
+	var permission string
+	err := c.db.QueryRow(
+		"SELECT permission FROM video_grants WHERE video_id = ? AND grantee_user_id = ?",
+		videoID, granteeUserID,
+	).Scan(&permission)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return permission, err
+}
+
+func (c Client) GetVideoGrants(videoID uuid.UUID) ([]VideoGrant, error) {
+	rows, err := c.db.Query(`
+	SELECT video_id, grantee_user_id, permission, created_at
+	FROM video_grants
+	WHERE video_id = ?
+	ORDER BY created_at
+	`, videoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	grants := []VideoGrant{}
+	for rows.Next() {
+		var grant VideoGrant
+		if err := rows.Scan(&grant.VideoID, &grant.GranteeUserID, &grant.Permission, &grant.CreatedAt); err != nil {
+			return nil, err
+		}
+		grants = append(grants, grant)
+	}
+	return grants, rows.Err()
+}
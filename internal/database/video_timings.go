@@ -0,0 +1,48 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// VideoTimings is how long each processing stage took for the most recent
+// upload of a video, in milliseconds.
+type VideoTimings struct {
+	VideoID     uuid.UUID `json:"video_id"`
+	ProbeMS     int64     `json:"probe_ms"`
+	TranscodeMS int64     `json:"transcode_ms"`
+	UploadMS    int64     `json:"upload_ms"`
+	RecordedAt  time.Time `json:"recorded_at"`
+}
+
+func (c Client) SaveVideoTimings(timings VideoTimings) error {
+	query := `
+	INSERT INTO video_timings (video_id, probe_ms, transcode_ms, upload_ms, recorded_at)
+	VALUES (?, ?, ?, ?, ?)
+	ON CONFLICT(video_id) DO UPDATE SET
+		probe_ms = excluded.probe_ms,
+		transcode_ms = excluded.transcode_ms,
+		upload_ms = excluded.upload_ms,
+		recorded_at = excluded.recorded_at
+	`
+	_, err := c.db.Exec(query, timings.VideoID, timings.ProbeMS, timings.TranscodeMS, timings.UploadMS, c.timestamp())
+	return err
+}
+
+// GetVideoTimings returns sql.ErrNoRows if the video has never been
+// processed.
+func (c Client) GetVideoTimings(videoID uuid.UUID) (VideoTimings, error) {
+	var timings VideoTimings
+	err := c.db.QueryRow(`
+	SELECT video_id, probe_ms, transcode_ms, upload_ms, recorded_at
+	FROM video_timings
+	WHERE video_id = ?
+	`, videoID).Scan(&timings.VideoID, &timings.ProbeMS, &timings.TranscodeMS, &timings.UploadMS, &timings.RecordedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return VideoTimings{}, sql.ErrNoRows
+	}
+	return timings, err
+}
@@ -0,0 +1,223 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type VideoVersion struct {
+	VideoID   uuid.UUID `json:"video_id"`
+	Version   int       `json:"version"`
+	Key       string    `json:"key"`
+	SizeBytes int64     `json:"size_bytes"`
+	SHA256    string    `json:"sha256"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CreateVideoVersion records a stored version. sha256 is the hex digest of
+// the object, or empty when it wasn't computed.
+func (c Client) CreateVideoVersion(videoID uuid.UUID, version int, key string, sizeBytes int64, sha256 string) (VideoVersion, error) {
+	query := `
+	INSERT INTO video_versions (
+		video_id,
+		version,
+		key,
+		size_bytes,
+		sha256,
+		created_at
+	) VALUES (?, ?, ?, ?, ?, ?)
+	`
+	_, err := c.db.Exec(query, videoID, version, key, sizeBytes, sha256, c.timestamp())
+	if err != nil {
+		return VideoVersion{}, err
+	}
+	return c.GetVideoVersion(videoID, version)
+}
+
+// GetLatestVideoVersionNumber returns the highest version stored for a
+// video, or 0 when it has never been uploaded.
+func (c Client) GetLatestVideoVersionNumber(videoID uuid.UUID) (int, error) {
+	query := `
+	SELECT COALESCE(MAX(version), 0)
+	FROM video_versions
+	WHERE video_id = ?
+	`
+	var version int
+	err := c.db.QueryRow(query, videoID).Scan(&version)
+	return version, err
+}
+
+func (c Client) GetVideoVersion(videoID uuid.UUID, version int) (VideoVersion, error) {
+	query := `
+	SELECT video_id, version, key, size_bytes, sha256, created_at
+	FROM video_versions
+	WHERE video_id = ? AND version = ?
+	`
+	v, err := scanVideoVersion(c.db.QueryRow(query, videoID, version))
+	if err != nil {
+		return VideoVersion{}, err
+	}
+	return v, nil
+}
+
+func (c Client) GetVideoVersions(videoID uuid.UUID) ([]VideoVersion, error) {
+	query := `
+	SELECT video_id, version, key, size_bytes, sha256, created_at
+	FROM video_versions
+	WHERE video_id = ?
+	ORDER BY version DESC
+	`
+	rows, err := c.db.Query(query, videoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanVideoVersions(rows)
+}
+
+// GetVideoVersionsPage returns one page of a video's versions, newest first.
+func (c Client) GetVideoVersionsPage(videoID uuid.UUID, limit, offset int) ([]VideoVersion, error) {
+	query := `
+	SELECT video_id, version, key, size_bytes, sha256, created_at
+	FROM video_versions
+	WHERE video_id = ?
+	ORDER BY version DESC
+	LIMIT ? OFFSET ?
+	`
+	rows, err := c.db.Query(query, videoID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanVideoVersions(rows)
+}
+
+func (c Client) CountVideoVersions(videoID uuid.UUID) (int, error) {
+	var count int
+	err := c.db.QueryRow("SELECT COUNT(*) FROM video_versions WHERE video_id = ?", videoID).Scan(&count)
+	return count, err
+}
+
+func scanVideoVersion(row rowScanner) (VideoVersion, error) {
+	var v VideoVersion
+	err := row.Scan(&v.VideoID, &v.Version, &v.Key, &v.SizeBytes, &v.SHA256, &v.CreatedAt)
+	return v, err
+}
+
+func scanVideoVersions(rows *sql.Rows) ([]VideoVersion, error) {
+	versions := []VideoVersion{}
+	for rows.Next() {
+		v, err := scanVideoVersion(rows)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
+// RelocateVideoVersion points a stored version at a new key and saves the
+// video in the same transaction, so the row never references an object
+// that has already moved.
+func (c Client) RelocateVideoVersion(video Video, version int, key string) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE video_versions SET key = ? WHERE video_id = ? AND version = ?", key, video.ID, version)
+	if err != nil {
+		return err
+	}
+	if err := updateVideo(tx, video); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetReferencedObjectKeys returns every object key a row points at:
+// stored video versions and caption tracks, soft-deleted videos included.
+func (c Client) GetReferencedObjectKeys() ([]string, error) {
+	rows, err := c.db.Query(`
+	SELECT key FROM video_versions
+	UNION
+	SELECT key FROM video_captions
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []string{}
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// GetStoredBytes sums every stored version of a user's videos. Soft-deleted
+// videos count until they're purged, since their objects are still there,
+// and versions sharing a deduplicated object only count it once.
+func (c Client) GetStoredBytes(userID uuid.UUID) (int64, error) {
+	query := `
+	SELECT COALESCE(SUM(size_bytes), 0)
+	FROM (
+		SELECT DISTINCT vv.key, vv.size_bytes
+		FROM video_versions vv
+		JOIN videos v ON v.id = vv.video_id
+		WHERE v.user_id = ?
+	)
+	`
+	var total int64
+	err := c.db.QueryRow(query, userID).Scan(&total)
+	return total, err
+}
+
+// GetVersionKeyBySHA256 returns the key of a stored version of one of the
+// user's live videos with the given digest, or "" when there's none. The
+// newest match wins.
+func (c Client) GetVersionKeyBySHA256(userID uuid.UUID, sha256 string) (string, error) {
+	query := `
+	SELECT vv.key
+	FROM video_versions vv
+	JOIN videos v ON v.id = vv.video_id
+	WHERE v.user_id = ? AND v.deleted_at IS NULL AND vv.sha256 = ?
+	ORDER BY vv.created_at DESC
+	LIMIT 1
+	`
+	var key string
+	err := c.db.QueryRow(query, userID, sha256).Scan(&key)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return key, err
+}
+
+// CountKeyReferences counts the versions pointing at key outside
+// excludeVideoID, so an object shared by deduplicated uploads is only
+// deleted with its last reference. Pass uuid.Nil to count them all.
+func (c Client) CountKeyReferences(key string, excludeVideoID uuid.UUID) (int, error) {
+	var count int
+	err := c.db.QueryRow("SELECT COUNT(*) FROM video_versions WHERE key = ? AND video_id != ?", key, excludeVideoID).Scan(&count)
+	return count, err
+}
+
+// GetVideoIDByVersionKey returns the video a stored version key belongs
+// to, or uuid.Nil when no version uses it. Deduplicated keys shared by
+// several videos resolve to the oldest one.
+func (c Client) GetVideoIDByVersionKey(key string) (uuid.UUID, error) {
+	var id uuid.UUID
+	err := c.db.QueryRow("SELECT video_id FROM video_versions WHERE key = ? ORDER BY created_at LIMIT 1", key).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return uuid.Nil, nil
+	}
+	return id, err
+}
@@ -2,18 +2,46 @@ package database
 
 import (
 	"database/sql"
+	"database/sql/driver"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 type Video struct {
-	ID           uuid.UUID `json:"id"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
-	ThumbnailURL *string   `json:"thumbnail_url"`
-	VideoURL     *string   `json:"video_url"`
+	ID                 uuid.UUID      `json:"id"`
+	CreatedAt          time.Time      `json:"created_at"`
+	UpdatedAt          time.Time      `json:"updated_at"`
+	ThumbnailURL       *string        `json:"thumbnail_url"`
+	VideoURL           *string        `json:"video_url"`
+	Width              int            `json:"width"`
+	Height             int            `json:"height"`
+	Aspect             string         `json:"aspect"`
+	DurationSec        float64        `json:"duration_sec"`
+	VideoCodec         string         `json:"video_codec"`
+	Bitrate            int64          `json:"bitrate"`
+	FrameRate          float64        `json:"frame_rate"`
+	SHA256             string         `json:"sha256"`
+	AudioLanguage      string         `json:"audio_language"`
+	AudioLanguages     LanguageList   `json:"audio_languages"`
+	Blurhash           *string        `json:"blurhash"`
+	Status             string         `json:"status"`
+	Progress           int            `json:"progress"`
+	ProcessingError    *string        `json:"processing_error"`
+	ProcessingWarnings WarningList    `json:"processing_warnings"`
+	OriginalSizeBytes  int64          `json:"original_size_bytes"`
+	FinalSizeBytes     int64          `json:"final_size_bytes"`
+	PlaybackErrorCount int            `json:"playback_error_count"`
+	DeletedAt          *time.Time     `json:"deleted_at,omitempty"`
+	HLSURL             *string        `json:"hls_url"`
+	Versions           []VideoVersion `json:"versions,omitempty"`
+	Captions           []VideoCaption `json:"captions,omitempty"`
+	// Banned isn't stored with the video; listings set it from the
+	// moderation table.
+	Banned bool `json:"banned,omitempty"`
 	CreateVideoParams
 }
 
@@ -21,11 +49,69 @@ type CreateVideoParams struct {
 	Title       string    `json:"title"`
 	Description string    `json:"description"`
 	UserID      uuid.UUID `json:"user_id"`
+	Visibility  string    `json:"visibility"`
+	// URLTTLSeconds overrides the default lifetime of this video's signed
+	// URLs when set.
+	URLTTLSeconds *int `json:"url_ttl_seconds"`
 }
 
-func (c Client) GetVideos(userID uuid.UUID) ([]Video, error) {
-	query := `
-	SELECT
+// LanguageList is stored as a comma-separated column.
+type LanguageList []string
+
+func (l LanguageList) Value() (driver.Value, error) {
+	return strings.Join(l, ","), nil
+}
+
+func (l *LanguageList) Scan(src any) error {
+	var raw string
+	switch v := src.(type) {
+	case nil:
+	case string:
+		raw = v
+	case []byte:
+		raw = string(v)
+	default:
+		return fmt.Errorf("unsupported type for LanguageList: %T", src)
+	}
+	*l = LanguageList{}
+	if raw != "" {
+		*l = strings.Split(raw, ",")
+	}
+	return nil
+}
+
+// WarningList is stored one warning per line, since warnings are free
+// text that may well contain commas. Line breaks inside a warning are
+// flattened to spaces.
+type WarningList []string
+
+func (l WarningList) Value() (driver.Value, error) {
+	lines := make([]string, len(l))
+	for i, warning := range l {
+		lines[i] = strings.ReplaceAll(warning, "\n", " ")
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+func (l *WarningList) Scan(src any) error {
+	var raw string
+	switch v := src.(type) {
+	case nil:
+	case string:
+		raw = v
+	case []byte:
+		raw = string(v)
+	default:
+		return fmt.Errorf("unsupported type for WarningList: %T", src)
+	}
+	*l = WarningList{}
+	if raw != "" {
+		*l = strings.Split(raw, "\n")
+	}
+	return nil
+}
+
+const videoColumns = `
 		id,
 		created_at,
 		updated_at,
@@ -33,41 +119,177 @@ func (c Client) GetVideos(userID uuid.UUID) ([]Video, error) {
 		description,
 		thumbnail_url,
 		video_url,
-		user_id
+		user_id,
+		width,
+		height,
+		aspect,
+		duration_sec,
+		audio_language,
+		blurhash,
+		visibility,
+		status,
+		progress,
+		processing_error,
+		audio_languages,
+		playback_error_count,
+		original_size_bytes,
+		final_size_bytes,
+		url_ttl_seconds,
+		deleted_at,
+		hls_url,
+		video_codec,
+		bitrate,
+		frame_rate,
+		sha256,
+		processing_warnings`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanVideo(row rowScanner) (Video, error) {
+	var video Video
+	err := row.Scan(
+		&video.ID,
+		&video.CreatedAt,
+		&video.UpdatedAt,
+		&video.Title,
+		&video.Description,
+		&video.ThumbnailURL,
+		&video.VideoURL,
+		&video.UserID,
+		&video.Width,
+		&video.Height,
+		&video.Aspect,
+		&video.DurationSec,
+		&video.AudioLanguage,
+		&video.Blurhash,
+		&video.Visibility,
+		&video.Status,
+		&video.Progress,
+		&video.ProcessingError,
+		&video.AudioLanguages,
+		&video.PlaybackErrorCount,
+		&video.OriginalSizeBytes,
+		&video.FinalSizeBytes,
+		&video.URLTTLSeconds,
+		&video.DeletedAt,
+		&video.HLSURL,
+		&video.VideoCodec,
+		&video.Bitrate,
+		&video.FrameRate,
+		&video.SHA256,
+		&video.ProcessingWarnings,
+	)
+	return video, err
+}
+
+// VideoSort names an ordering for video lists. Only the values in
+// videoSortClauses are accepted, so the ORDER BY never comes from input.
+type VideoSort string
+
+const (
+	VideoSortNewest   VideoSort = "newest"
+	VideoSortOldest   VideoSort = "oldest"
+	VideoSortTitle    VideoSort = "title"
+	VideoSortDuration VideoSort = "duration"
+	VideoSortSize     VideoSort = "size"
+)
+
+// VideoSorts lists the accepted orderings.
+var VideoSorts = []VideoSort{VideoSortNewest, VideoSortOldest, VideoSortTitle, VideoSortDuration, VideoSortSize}
+
+// Ties fall back to newest first so pages stay stable.
+var videoSortClauses = map[VideoSort]string{
+	VideoSortNewest:   "created_at DESC, id",
+	VideoSortOldest:   "created_at ASC, id",
+	VideoSortTitle:    "title COLLATE NOCASE ASC, created_at DESC, id",
+	VideoSortDuration: "duration_sec DESC, created_at DESC, id",
+	VideoSortSize:     "final_size_bytes DESC, created_at DESC, id",
+}
+
+func (s VideoSort) Valid() bool {
+	_, ok := videoSortClauses[s]
+	return ok
+}
+
+func orderByClause(sort VideoSort) (string, error) {
+	clause, ok := videoSortClauses[sort]
+	if !ok {
+		return "", fmt.Errorf("unknown sort %q", sort)
+	}
+	return clause, nil
+}
+
+func (c Client) GetVideos(userID uuid.UUID, sort VideoSort, limit, offset int) ([]Video, error) {
+	orderBy, err := orderByClause(sort)
+	if err != nil {
+		return nil, err
+	}
+	query := `
+	SELECT` + videoColumns + `
+	FROM videos
+	WHERE user_id = ? AND deleted_at IS NULL
+	ORDER BY ` + orderBy + `
+	LIMIT ? OFFSET ?
+	`
+
+	rows, err := c.db.Query(query, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanVideos(rows)
+}
+
+func (c Client) GetVideosByAspect(userID uuid.UUID, aspect string, sort VideoSort, limit, offset int) ([]Video, error) {
+	orderBy, err := orderByClause(sort)
+	if err != nil {
+		return nil, err
+	}
+	query := `
+	SELECT` + videoColumns + `
 	FROM videos
-	WHERE user_id = ?
-	ORDER BY created_at DESC
+	WHERE user_id = ? AND aspect = ? AND deleted_at IS NULL
+	ORDER BY ` + orderBy + `
+	LIMIT ? OFFSET ?
 	`
 
-	rows, err := c.db.Query(query, userID)
+	rows, err := c.db.Query(query, userID, aspect, limit, offset)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
+	return scanVideos(rows)
+}
+
+func (c Client) CountVideos(userID uuid.UUID) (int, error) {
+	var count int
+	err := c.db.QueryRow("SELECT COUNT(*) FROM videos WHERE user_id = ? AND deleted_at IS NULL", userID).Scan(&count)
+	return count, err
+}
+
+func (c Client) CountVideosByAspect(userID uuid.UUID, aspect string) (int, error) {
+	var count int
+	err := c.db.QueryRow("SELECT COUNT(*) FROM videos WHERE user_id = ? AND aspect = ? AND deleted_at IS NULL", userID, aspect).Scan(&count)
+	return count, err
+}
 
+func scanVideos(rows *sql.Rows) ([]Video, error) {
 	videos := []Video{}
 	for rows.Next() {
-		var video Video
-		if err := rows.Scan(
-			&video.ID,
-			&video.CreatedAt,
-			&video.UpdatedAt,
-			&video.Title,
-			&video.Description,
-			&video.ThumbnailURL,
-			&video.VideoURL,
-			&video.UserID,
-		); err != nil {
+		video, err := scanVideo(rows)
+		if err != nil {
 			return nil, err
 		}
 		videos = append(videos, video)
 	}
-
-	return videos, nil
+	return videos, rows.Err()
 }
 
 func (c Client) CreateVideo(params CreateVideoParams) (Video, error) {
-	id := uuid.New()
+	id := c.newID()
+	now := c.timestamp()
 	query := `
 	INSERT INTO videos (
 		id,
@@ -75,10 +297,12 @@ func (c Client) CreateVideo(params CreateVideoParams) (Video, error) {
 		updated_at,
 		title,
 		description,
-		user_id
-	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?)
+		user_id,
+		visibility,
+		url_ttl_seconds
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
 	`
-	_, err := c.db.Exec(query, id, params.Title, params.Description, params.UserID)
+	_, err := c.db.Exec(query, id, now, now, params.Title, params.Description, params.UserID, params.Visibility, params.URLTTLSeconds)
 	if err != nil {
 		return Video{}, err
 	}
@@ -86,31 +310,29 @@ func (c Client) CreateVideo(params CreateVideoParams) (Video, error) {
 	return c.GetVideo(id)
 }
 
+// GetVideo returns the video with the given ID, or an empty Video if it
+// doesn't exist or has been soft-deleted.
 func (c Client) GetVideo(id uuid.UUID) (Video, error) {
+	return c.getVideo(id, false)
+}
+
+// GetVideoIncludingDeleted is like GetVideo but also returns soft-deleted
+// videos that are still within their grace period.
+func (c Client) GetVideoIncludingDeleted(id uuid.UUID) (Video, error) {
+	return c.getVideo(id, true)
+}
+
+func (c Client) getVideo(id uuid.UUID, includeDeleted bool) (Video, error) {
 	query := `
-	SELECT
-		id,
-		created_at,
-		updated_at,
-		title,
-		description,
-		thumbnail_url,
-		video_url,
-		user_id
+	SELECT` + videoColumns + `
 	FROM videos
 	WHERE id = ?
 	`
+	if !includeDeleted {
+		query += " AND deleted_at IS NULL"
+	}
 
-	var video Video
-	err := c.db.QueryRow(query, id).Scan(
-		&video.ID,
-		&video.CreatedAt,
-		&video.UpdatedAt,
-		&video.Title,
-		&video.Description,
-		&video.ThumbnailURL,
-		&video.VideoURL,
-		&video.UserID)
+	video, err := scanVideo(c.db.QueryRow(query, id))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return Video{}, nil
@@ -121,7 +343,15 @@ func (c Client) GetVideo(id uuid.UUID) (Video, error) {
 	return video, nil
 }
 
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
 func (c Client) UpdateVideo(video Video) error {
+	return updateVideo(c.db, video)
+}
+
+func updateVideo(db execer, video Video) error {
 	query := `
 	UPDATE videos
 	SET
@@ -129,27 +359,245 @@ func (c Client) UpdateVideo(video Video) error {
 		description = ?,
 		thumbnail_url = ?,
 		video_url = ?,
-		user_id = ?
+		user_id = ?,
+		width = ?,
+		height = ?,
+		aspect = ?,
+		duration_sec = ?,
+		audio_language = ?,
+		blurhash = ?,
+		visibility = ?,
+		status = ?,
+		progress = ?,
+		processing_error = ?,
+		audio_languages = ?,
+		original_size_bytes = ?,
+		final_size_bytes = ?,
+		url_ttl_seconds = ?,
+		hls_url = ?,
+		video_codec = ?,
+		bitrate = ?,
+		frame_rate = ?,
+		sha256 = ?
 	WHERE id = ?
 	`
 
-	_, err := c.db.Exec(
+	_, err := db.Exec(
 		query,
 		video.Title,
 		video.Description,
 		&video.ThumbnailURL,
 		&video.VideoURL,
 		video.UserID,
+		video.Width,
+		video.Height,
+		video.Aspect,
+		video.DurationSec,
+		video.AudioLanguage,
+		video.Blurhash,
+		video.Visibility,
+		video.Status,
+		video.Progress,
+		video.ProcessingError,
+		video.AudioLanguages,
+		video.OriginalSizeBytes,
+		video.FinalSizeBytes,
+		video.URLTTLSeconds,
+		video.HLSURL,
+		video.VideoCodec,
+		video.Bitrate,
+		video.FrameRate,
+		video.SHA256,
+		video.ID,
+	)
+	return err
+}
+
+// UpdateVideoProcessed stores the result of processing an upload: the new
+// video URL, what was probed from the file and the final status. Only the
+// columns processing owns are written, so edits made while the job ran
+// (title, visibility, an uploaded thumbnail, ...) survive. The thumbnail is
+// only filled in when the row still has none.
+func (c Client) UpdateVideoProcessed(video Video) error {
+	query := `
+	UPDATE videos
+	SET
+		thumbnail_url = COALESCE(thumbnail_url, ?),
+		video_url = ?,
+		width = ?,
+		height = ?,
+		aspect = ?,
+		duration_sec = ?,
+		audio_language = ?,
+		audio_languages = ?,
+		status = ?,
+		progress = ?,
+		processing_error = ?,
+		original_size_bytes = ?,
+		final_size_bytes = ?,
+		hls_url = ?,
+		video_codec = ?,
+		bitrate = ?,
+		frame_rate = ?,
+		sha256 = ?,
+		updated_at = ?
+	WHERE id = ?
+	`
+	_, err := c.db.Exec(
+		query,
+		video.ThumbnailURL,
+		video.VideoURL,
+		video.Width,
+		video.Height,
+		video.Aspect,
+		video.DurationSec,
+		video.AudioLanguage,
+		video.AudioLanguages,
+		video.Status,
+		video.Progress,
+		video.ProcessingError,
+		video.OriginalSizeBytes,
+		video.FinalSizeBytes,
+		video.HLSURL,
+		video.VideoCodec,
+		video.Bitrate,
+		video.FrameRate,
+		video.SHA256,
+		c.timestamp(),
 		video.ID,
 	)
 	return err
 }
 
+// UpdateVideoProcessing records how far processing has got without
+// touching the rest of the row.
+func (c Client) UpdateVideoProcessing(id uuid.UUID, status string, progress int, processingError *string) error {
+	query := `
+	UPDATE videos
+	SET
+		status = ?,
+		progress = ?,
+		processing_error = ?,
+		updated_at = ?
+	WHERE id = ?
+	`
+	_, err := c.db.Exec(query, status, progress, processingError, c.timestamp(), id)
+	return err
+}
+
+// UpdateVideoProcessingWarnings records what the upload inspectors flagged
+// without blocking the upload.
+func (c Client) UpdateVideoProcessingWarnings(id uuid.UUID, warnings []string) error {
+	_, err := c.db.Exec("UPDATE videos SET processing_warnings = ? WHERE id = ?", WarningList(warnings), id)
+	return err
+}
+
+// ClaimVideoProcessing moves a video to status unless it is already in one
+// of the busy statuses, so two uploads to the same video can't run the
+// pipeline at once. A busy row that hasn't been touched since staleBefore
+// is assumed abandoned (e.g. the server restarted mid-upload) and can be
+// claimed again. It reports whether the claim succeeded.
+func (c Client) ClaimVideoProcessing(id uuid.UUID, status string, progress int, busy []string, staleBefore time.Time) (bool, error) {
+	query := `
+	UPDATE videos
+	SET
+		status = ?,
+		progress = ?,
+		processing_error = NULL,
+		processing_warnings = '',
+		updated_at = ?
+	WHERE id = ? AND (status NOT IN (` + placeholders(len(busy)) + `) OR updated_at < ?)
+	`
+	args := []any{status, progress, c.timestamp(), id}
+	for _, s := range busy {
+		args = append(args, s)
+	}
+	args = append(args, staleBefore.UTC())
+	result, err := c.db.Exec(query, args...)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// SoftDeleteVideo hides a video from reads and listings until it is either
+// restored with UndeleteVideo or hard-deleted with DeleteVideo.
+func (c Client) SoftDeleteVideo(id uuid.UUID) error {
+	_, err := c.db.Exec("UPDATE videos SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL", c.timestamp(), id)
+	return err
+}
+
+func (c Client) UndeleteVideo(id uuid.UUID) error {
+	_, err := c.db.Exec("UPDATE videos SET deleted_at = NULL WHERE id = ?", id)
+	return err
+}
+
+// GetVideosDeletedBefore lists soft-deleted videos whose deletion is older
+// than cutoff.
+func (c Client) GetVideosDeletedBefore(cutoff time.Time) ([]Video, error) {
+	query := `
+	SELECT` + videoColumns + `
+	FROM videos
+	WHERE deleted_at IS NOT NULL AND deleted_at < ?
+	ORDER BY deleted_at
+	`
+	rows, err := c.db.Query(query, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanVideos(rows)
+}
+
 func (c Client) DeleteVideo(id uuid.UUID) error {
+	_, err := c.db.Exec("DELETE FROM video_versions WHERE video_id = ?", id)
+	if err != nil {
+		return err
+	}
+	_, err = c.db.Exec("DELETE FROM playback_errors WHERE video_id = ?", id)
+	if err != nil {
+		return err
+	}
+	_, err = c.db.Exec("DELETE FROM video_grants WHERE video_id = ?", id)
+	if err != nil {
+		return err
+	}
+	_, err = c.db.Exec("DELETE FROM video_timings WHERE video_id = ?", id)
+	if err != nil {
+		return err
+	}
+	_, err = c.db.Exec("DELETE FROM video_captions WHERE video_id = ?", id)
+	if err != nil {
+		return err
+	}
 	query := `
 	DELETE FROM videos
 	WHERE id = ?
 	`
-	_, err := c.db.Exec(query, id)
+	_, err = c.db.Exec(query, id)
 	return err
 }
+
+// GetAllVideoIDs returns the ID of every video row, soft-deleted ones
+// included.
+func (c Client) GetAllVideoIDs() ([]uuid.UUID, error) {
+	rows, err := c.db.Query("SELECT id FROM videos")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []uuid.UUID{}
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
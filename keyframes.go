@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	keyframeModeReject   = "reject"
+	keyframeModeReencode = "reencode"
+
+	// keyframeSampleSeconds bounds how much of the video is scanned for
+	// keyframes; packet listing reads the whole range it's given.
+	keyframeSampleSeconds = 60
+)
+
+// probeKeyframeInterval returns the largest gap between keyframes in the
+// first keyframeSampleSeconds of the video stream.
+func (cfg *apiConfig) probeKeyframeInterval(ctx context.Context, filePath string) (time.Duration, error) {
+	ctx, cancel := cfg.withCommandTimeout(ctx)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "ffprobe", "-v", "error",
+		"-select_streams", "v:0",
+		"-read_intervals", fmt.Sprintf("%%+%d", keyframeSampleSeconds),
+		"-show_entries", "packet=pts_time,flags",
+		"-of", "csv=p=0",
+		filePath,
+	)
+	var out, stderr bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return 0, commandFailed(ctx, "error listing packets", stderr.String(), err)
+	}
+	return maxKeyframeGap(out.String())
+}
+
+// maxKeyframeGap parses ffprobe's "pts_time,flags" packet lines. The time
+// from the last keyframe to the last packet counts too, since the next
+// keyframe is at least that far away.
+func maxKeyframeGap(packets string) (time.Duration, error) {
+	var gap float64
+	lastKey, lastPTS := -1.0, -1.0
+	scanner := bufio.NewScanner(strings.NewReader(packets))
+	for scanner.Scan() {
+		ptsString, flags, ok := strings.Cut(strings.TrimSpace(scanner.Text()), ",")
+		if !ok || ptsString == "N/A" {
+			continue
+		}
+		pts, err := strconv.ParseFloat(ptsString, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid packet time %q", ptsString)
+		}
+		lastPTS = max(lastPTS, pts)
+		if !strings.Contains(flags, "K") {
+			continue
+		}
+		if lastKey >= 0 {
+			gap = max(gap, pts-lastKey)
+		}
+		lastKey = pts
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	if lastKey < 0 {
+		return 0, fmt.Errorf("no keyframes found")
+	}
+	gap = max(gap, lastPTS-lastKey)
+	return time.Duration(gap * float64(time.Second)), nil
+}
+
+// reencodeWithKeyframes re-encodes the video forcing a keyframe at least
+// every interval so players can seek without decoding long runs of frames.
+func (cfg *apiConfig) reencodeWithKeyframes(ctx context.Context, filePath string, interval time.Duration, pixFmt string) (string, error) {
+	ctx, cancel := cfg.withCommandTimeout(ctx)
+	defer cancel()
+
+	outputPath := fmt.Sprintf("%s.keyframes.mp4", filePath)
+	cmd := cfg.ffmpegCommand(ctx,
+		"-i", filePath,
+		"-map", "0:v:0", "-map", "0:a?",
+		"-c:v", "libx264", "-preset", "veryfast", "-crf", "23", "-pix_fmt", pixFmt,
+		"-force_key_frames", fmt.Sprintf("expr:gte(t,n_forced*%g)", interval.Seconds()),
+		"-c:a", "copy",
+		"-f", "mp4", "-y", outputPath,
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		os.Remove(outputPath)
+		return "", commandFailed(ctx, "error re-encoding keyframes", stderr.String(), err)
+	}
+	return outputPath, nil
+}
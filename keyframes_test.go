@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestMaxKeyframeGap(t *testing.T) {
+	tests := []struct {
+		name    string
+		packets string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"regular", "0.000,K_\n1.000,__\n2.000,K_\n3.000,__\n4.000,K_\n", 2 * time.Second, false},
+		{"trailing run", "0.000,K_\n1.000,K_\n6.500,__\n", 5500 * time.Millisecond, false},
+		{"unknown times skipped", "N/A,K_\n0.000,K_\n0.500,K_\n", 500 * time.Millisecond, false},
+		{"no keyframes", "0.000,__\n1.000,__\n", 0, true},
+		{"bad time", "zero,K_\n", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := maxKeyframeGap(tt.packets)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUploadKeyframeInterval(t *testing.T) {
+	const (
+		smallGOP = "0.000,K_\n1.000,K_\n2.000,K_\n"
+		largeGOP = "0.000,K_\n4.000,__\n8.000,K_\n"
+	)
+	tests := []struct {
+		name         string
+		packets      string
+		mode         string
+		wantCode     int
+		wantReencode bool
+	}{
+		{"small GOP", smallGOP, keyframeModeReject, http.StatusOK, false},
+		{"large GOP rejected", largeGOP, keyframeModeReject, http.StatusUnprocessableEntity, false},
+		{"large GOP re-encoded", largeGOP, keyframeModeReencode, http.StatusOK, true},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestConfig(t)
+			cfg.maxKeyframeInterval = 2 * time.Second
+			cfg.keyframeMode = tt.mode
+			media := &fakeMedia{Width: 1920, Height: 1080, Packets: tt.packets}
+			installFakeMedia(t, media)
+			userID := createTestUser(t, cfg)
+			video := createTestVideo(t, cfg, userID, visibilityPublic)
+
+			rec := uploadTestVideo(t, cfg, video.ID, userID, testMP4(256, byte(i)))
+			if rec.Code != tt.wantCode {
+				t.Fatalf("got status %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			reencoded := false
+			for _, args := range media.ffmpegRuns(t) {
+				if i := slices.Index(args, "-force_key_frames"); i >= 0 {
+					reencoded = true
+					if want := "expr:gte(t,n_forced*2)"; args[i+1] != want {
+						t.Errorf("-force_key_frames %q, want %q", args[i+1], want)
+					}
+				}
+			}
+			if reencoded != tt.wantReencode {
+				t.Errorf("re-encoded = %v, want %v", reencoded, tt.wantReencode)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// undeterminedLanguage is the ISO 639-2 code for an unknown language.
+const undeterminedLanguage = "und"
+
+const languageSampleSeconds = "30"
+
+func normalizeLanguageTag(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if tag == "" {
+		return undeterminedLanguage
+	}
+	return tag
+}
+
+// resolveAudioLanguage returns the language to store for a video's audio.
+// The container tag wins; otherwise the configured detection tool is run on
+// a short sample when enabled. Detection failures never fail the upload.
+func (cfg *apiConfig) resolveAudioLanguage(ctx context.Context, filePath string, probe videoProbe) string {
+	if probe.AudioLanguage != "" && probe.AudioLanguage != undeterminedLanguage {
+		return probe.AudioLanguage
+	}
+	if !probe.HasAudio || !cfg.detectLanguage || cfg.languageDetectCmd == "" {
+		return undeterminedLanguage
+	}
+	language, err := cfg.detectAudioLanguage(ctx, filePath)
+	if err != nil {
+		log.Printf("Couldn't detect audio language for %s: %v", filePath, err)
+		return undeterminedLanguage
+	}
+	return language
+}
+
+// detectAudioLanguage extracts a mono 16 kHz WAV sample from the start of
+// the file and passes its path to languageDetectCmd, which must print a
+// language code on stdout.
+func (cfg *apiConfig) detectAudioLanguage(ctx context.Context, filePath string) (string, error) {
+	ctx, cancel := cfg.withCommandTimeout(ctx)
+	defer cancel()
+	sample, err := os.CreateTemp("", "tubely-language-*.wav")
+	if err != nil {
+		return "", err
+	}
+	sample.Close()
+	defer os.Remove(sample.Name())
+
+	var stderr bytes.Buffer
+	extract := cfg.ffmpegCommand(ctx, "-y", "-i", filePath, "-t", languageSampleSeconds, "-vn", "-ac", "1", "-ar", "16000", sample.Name())
+	extract.Stderr = &stderr
+	if err := extract.Run(); err != nil {
+		return "", commandFailed(ctx, "error extracting audio sample", stderr.String(), err)
+	}
+
+	var out bytes.Buffer
+	detect := exec.CommandContext(ctx, cfg.languageDetectCmd, sample.Name())
+	detect.Stdout = &out
+	if err := detect.Run(); err != nil {
+		return "", fmt.Errorf("language detection failed: %v", err)
+	}
+	return normalizeLanguageTag(out.String()), nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func TestUploadStoresAudioLanguage(t *testing.T) {
+	tests := []struct {
+		name     string
+		tag      string
+		detector string
+		want     string
+	}{
+		{"tagged", "ENG", "", "eng"},
+		{"untagged", "", "", undeterminedLanguage},
+		{"untagged with detection", "", "spa", "spa"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestConfig(t)
+			installFakeMedia(t, &fakeMedia{Width: 1920, Height: 1080, AudioLanguages: []string{tt.tag}})
+			if tt.detector != "" {
+				detector := filepath.Join(t.TempDir(), "detect")
+				if err := os.WriteFile(detector, []byte("#!/bin/sh\necho "+tt.detector+"\n"), 0755); err != nil {
+					t.Fatal(err)
+				}
+				cfg.detectLanguage = true
+				cfg.languageDetectCmd = detector
+			}
+			userID := createTestUser(t, cfg)
+			video := createTestVideo(t, cfg, userID, visibilityPublic)
+
+			rec := uploadTestVideo(t, cfg, video.ID, userID, testMP4(256, 0))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("got status %d: %s", rec.Code, rec.Body)
+			}
+			got := decodeJSON[database.Video](t, rec)
+			if got.AudioLanguage != tt.want {
+				t.Errorf("got audio language %q, want %q", got.AudioLanguage, tt.want)
+			}
+			stored, err := cfg.db.GetVideo(video.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.AudioLanguage != tt.want {
+				t.Errorf("stored audio language %q, want %q", stored.AudioLanguage, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func getLocalObject(t *testing.T, cfg *apiConfig, rawURL string, userID uuid.UUID) *httptest.ResponseRecorder {
+	t.Helper()
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := newAuthedRequest(t, http.MethodGet, u.RequestURI(), nil, userID)
+	req.SetPathValue("key", strings.TrimPrefix(u.Path, "/objects/"))
+	rec := httptest.NewRecorder()
+	cfg.handlerLocalObject(rec, req)
+	return rec
+}
+
+func TestLocalObjectSignedURL(t *testing.T) {
+	cfg := newTestConfig(t)
+	now := time.Date(2026, 5, 1, 9, 0, 0, 0, time.UTC)
+	setTestClock(cfg, func() time.Time { return now })
+	userID := createTestUser(t, cfg)
+	video := createTestVideo(t, cfg, userID, visibilityPrivate)
+	body := testMP4(256, 0)
+	key := storeTestVersion(t, cfg, video.ID, body)
+
+	signed, err := cfg.storage.PresignURL(key, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := getLocalObject(t, cfg, signed, uuid.Nil)
+	if rec.Code != http.StatusOK || !bytes.Equal(rec.Body.Bytes(), body) {
+		t.Fatalf("signed URL: got status %d with %d bytes, want the object", rec.Code, rec.Body.Len())
+	}
+
+	tampered := strings.Replace(signed, "signature=", "signature=x", 1)
+	if rec := getLocalObject(t, cfg, tampered, uuid.Nil); rec.Code != http.StatusForbidden {
+		t.Errorf("tampered signature: got status %d, want 403", rec.Code)
+	}
+	otherKey := storeTestVersion(t, cfg, video.ID, testMP4(256, 1))
+	u, _ := url.Parse(signed)
+	if rec := getLocalObject(t, cfg, cfg.getObjectURL(otherKey)+"?"+u.RawQuery, uuid.Nil); rec.Code != http.StatusForbidden {
+		t.Errorf("signature for another key: got status %d, want 403", rec.Code)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if rec := getLocalObject(t, cfg, signed, uuid.Nil); rec.Code != http.StatusForbidden {
+		t.Errorf("expired signature: got status %d, want 403", rec.Code)
+	}
+}
+
+func TestLocalObjectUnsignedAccess(t *testing.T) {
+	cfg := newTestConfig(t)
+	ownerID := createTestUser(t, cfg)
+	public := createTestVideo(t, cfg, ownerID, visibilityPublic)
+	private := createTestVideo(t, cfg, ownerID, visibilityPrivate)
+	publicThumb := cfg.thumbnailKey(public.ID)
+	privateThumb := cfg.thumbnailKey(private.ID)
+	putTestObject(t, cfg, publicThumb, []byte("public"))
+	putTestObject(t, cfg, privateThumb, []byte("private"))
+	privateVersion := storeTestVersion(t, cfg, private.ID, testMP4(256, 0))
+
+	tests := []struct {
+		name   string
+		key    string
+		userID uuid.UUID
+		want   int
+	}{
+		{"public thumbnail", publicThumb, uuid.Nil, http.StatusOK},
+		{"private thumbnail, anonymous", privateThumb, uuid.Nil, http.StatusUnauthorized},
+		{"private thumbnail, owner", privateThumb, ownerID, http.StatusOK},
+		{"private thumbnail, stranger", privateThumb, createTestUser(t, cfg), http.StatusNotFound},
+		{"private version, anonymous", privateVersion, uuid.Nil, http.StatusUnauthorized},
+		{"private version, owner", privateVersion, ownerID, http.StatusOK},
+		{"unowned key", "landscape/stray.mp4", ownerID, http.StatusNotFound},
+		{"traversal", "../tubely.db", ownerID, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := newAuthedRequest(t, http.MethodGet, "/objects/x", nil, tt.userID)
+			req.SetPathValue("key", tt.key)
+			rec := httptest.NewRecorder()
+			cfg.handlerLocalObject(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("got status %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
@@ -2,29 +2,109 @@ package main
 
 import (
 	"context"
+	"errors"
+	"image/color"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"strings"
+	"sync"
+	"time"
 
-	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
 
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 )
 
 type apiConfig struct {
-	db               database.Client
-	jwtSecret        string
-	platform         string
-	filepathRoot     string
-	assetsRoot       string
-	s3Bucket         string
-	s3Region         string
-	s3CfDistribution string
-	port             string
-	s3Client         *s3.Client
+	db                    database.Client
+	jwtSecret             string
+	platform              string
+	filepathRoot          string
+	assetsRoot            string
+	s3Bucket              string
+	s3Region              string
+	s3CfDistribution      string
+	port                  string
+	s3Client              *s3.Client
+	mimeCorrection        bool
+	notifier              Notifier
+	adminUserIDs          map[uuid.UUID]bool
+	dailyUploadBytesQuota int64
+	storageBytesQuota     int64
+	hourlyUploadLimit     int64
+	quotaExemptUserIDs    map[uuid.UUID]bool
+	s3PartSize            int64
+	s3UploadConcurrency   int
+	s3Uploader            *manager.Uploader
+	bodyReadTimeout       time.Duration
+	uuidgen               func() uuid.UUID
+	now                   func() time.Time
+	verifyMoov            bool
+	detectLanguage        bool
+	languageDetectCmd     string
+	presignExpiry         time.Duration
+	blurhash              bool
+	maxMultipartParts     int
+	moveOnAspectChange    bool
+	storageBackend        string
+	localStorageRoot      string
+	defaultVisibility     string
+	maxPresignExpiry      time.Duration
+	presignCache          *cache[string, string]
+	requireThumbnail      bool
+	ffmpegWrapper         []string
+	ffmpegGlobalArgs      []string
+	thumbnailSeekFallback bool
+	strictDuration        bool
+	playbackErrorLimiter  *rateLimiter
+	reencodeOverBytes     int64
+	reencodeTargetBytes   int64
+	streamUploads         bool
+	streamProbeBytes      int64
+	banCache              *cache[string, bool]
+	progressiveThumbnails bool
+	uploadEncodings       map[string]bool
+	deleteGracePeriod     time.Duration
+	includeTitleInKey     bool
+	shardKeys             bool
+	thumbnailAspectMode   string
+	thumbnailPadColor     color.RGBA
+	stagingBucket         string
+	captionCmd            string
+	reencodeFallback      bool
+	defaultPixFmt         string
+	strictRegion          bool
+	thumbnailAutorotate   bool
+	minFreeDiskPercent    float64
+	uploadClaimTimeout    time.Duration
+	commandTimeout        time.Duration
+	quarantineOther       bool
+	quarantineTag         string
+	processingProfiles    processingProfiles
+	processingLocks       *processingLocks
+	uploadProgressHooks   []uploadProgressFunc
+	progressInterval      time.Duration
+	uploadProgress        *uploadProgressTracker
+	maxKeyframeInterval   time.Duration
+	keyframeMode          string
+	defaultVideoSort      database.VideoSort
+	deleteURLExpiry       time.Duration
+	inspectors            []Inspector
+	processingQueue       *processingQueue
+	streamFastStart       bool
+	thumbnailAt           time.Duration
+	hlsEnabled            bool
+	allowedVideoTypes     map[string]bool
+	cloudFrontSigner      *cloudFrontSigner
+	storage               objectStorage
+	localSigner           *urlSigner
+	quotaMu               *sync.Mutex
 }
 
 // type thumbnail struct {
@@ -82,29 +162,229 @@ func main() {
 		log.Fatal("S3_CF_DISTRO environment variable is not set")
 	}
 
+	// With a key pair, signed URLs go through the distribution rather than
+	// straight to the bucket.
+	var cfSigner *cloudFrontSigner
+	if keyPairID := os.Getenv("CF_KEY_PAIR_ID"); keyPairID != "" {
+		cfSigner, err = loadCloudFrontSigner(keyPairID, os.Getenv("CF_PRIVATE_KEY_PATH"))
+		if err != nil {
+			log.Fatalf("Couldn't load CloudFront signing key: %v", err)
+		}
+	}
+
 	port := os.Getenv("PORT")
 	if port == "" {
 		log.Fatal("PORT environment variable is not set")
 	}
 
-	awsCfg, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion(s3Region))
+	mimeCorrection := getEnvBool("MIME_CORRECTION", true)
+	allowedVideoTypes, err := parseVideoTypes(getEnvString("ALLOWED_VIDEO_TYPES", defaultVideoTypes))
+	if err != nil {
+		log.Fatalf("Invalid ALLOWED_VIDEO_TYPES: %v", err)
+	}
+
+	notifier, err := newNotifier(os.Getenv("NOTIFIER"))
+	if err != nil {
+		log.Fatalf("Couldn't configure notifier: %v", err)
+	}
+
+	storageBackend := getEnvString("STORAGE_BACKEND", storageBackendS3)
+	if storageBackend != storageBackendS3 && storageBackend != storageBackendLocal {
+		log.Fatalf("STORAGE_BACKEND must be %q or %q", storageBackendS3, storageBackendLocal)
+	}
+	localStorageRoot := getEnvString("LOCAL_STORAGE_ROOT", "./objects")
+
+	defaultVisibility := getEnvString("DEFAULT_VISIBILITY", visibilityPublic)
+	if err := validateVisibility(defaultVisibility); err != nil {
+		log.Fatalf("DEFAULT_VISIBILITY is invalid: %v", err)
+	}
+
+	adminUserIDs := getEnvUserIDs("ADMIN_USER_IDS")
+	quotaExemptUserIDs := getEnvUserIDs("QUOTA_EXEMPT_USER_IDS")
+
+	dailyUploadBytesQuota := getEnvInt64("DAILY_UPLOAD_BYTES_QUOTA", 0)
+	storageBytesQuota := getEnvInt64("STORAGE_BYTES_QUOTA", 0)
+	hourlyUploadLimit := getEnvInt64("HOURLY_UPLOAD_LIMIT", 0)
+
+	defaultPixFmt := getEnvString("DEFAULT_PIX_FMT", "yuv420p")
+	if err := validatePixFmt(defaultPixFmt); err != nil {
+		log.Fatalf("DEFAULT_PIX_FMT is invalid: %v", err)
+	}
+
+	processingProfiles, err := parseProcessingProfiles(os.Getenv("PROCESSING_PROFILES"))
+	if err != nil {
+		log.Fatalf("PROCESSING_PROFILES is invalid: %v", err)
+	}
+
+	defaultVideoSort := database.VideoSort(getEnvString("DEFAULT_VIDEO_SORT", string(database.VideoSortNewest)))
+	if !defaultVideoSort.Valid() {
+		log.Fatalf("DEFAULT_VIDEO_SORT must be one of %s", videoSortNames())
+	}
+
+	keyframeMode := getEnvString("KEYFRAME_INTERVAL_MODE", keyframeModeReject)
+	if keyframeMode != keyframeModeReject && keyframeMode != keyframeModeReencode {
+		log.Fatalf("KEYFRAME_INTERVAL_MODE must be %q or %q", keyframeModeReject, keyframeModeReencode)
+	}
+
+	thumbnailAspectMode := getEnvString("THUMBNAIL_ASPECT_MODE", thumbnailAspectOff)
+	if thumbnailAspectMode != thumbnailAspectOff && thumbnailAspectMode != thumbnailAspectCrop && thumbnailAspectMode != thumbnailAspectPad {
+		log.Fatalf("THUMBNAIL_ASPECT_MODE must be empty, %q or %q", thumbnailAspectCrop, thumbnailAspectPad)
+	}
+	thumbnailPadColor, err := parseHexColor(getEnvString("THUMBNAIL_PAD_COLOR", "#000000"))
+	if err != nil {
+		log.Fatalf("THUMBNAIL_PAD_COLOR is invalid: %v", err)
+	}
+
+	quarantineTag := getEnvString("QUARANTINE_TAG", defaultQuarantineTag)
+	if _, err := url.ParseQuery(quarantineTag); err != nil {
+		log.Fatalf("QUARANTINE_TAG must be URL-encoded key=value pairs: %v", err)
+	}
+
+	uploadEncodings := map[string]bool{}
+	for _, enc := range parseContentEncodings(getEnvString("UPLOAD_CONTENT_ENCODINGS", "gzip,deflate")) {
+		if _, ok := contentDecoders[enc]; !ok {
+			log.Fatalf("UPLOAD_CONTENT_ENCODINGS contains an unsupported encoding %q", enc)
+		}
+		uploadEncodings[enc] = true
+	}
+
+	s3Endpoint := os.Getenv("S3_ENDPOINT")
+	s3Client, err := newS3Client(context.TODO(), s3Region, s3Bucket, s3Endpoint, getEnvBool("S3_USE_PATH_STYLE", s3Endpoint != ""))
 	if err != nil {
-		log.Fatal("awsconfig environment is not set")
+		log.Fatalf("Couldn't configure S3 client: %v", err)
 	}
 
-	s3Client := s3.NewFromConfig(awsCfg)
+	s3PartSize := getEnvInt64("S3_PART_SIZE", defaultS3PartSize)
+	s3UploadConcurrency := getEnvInt("S3_UPLOAD_CONCURRENCY", defaultS3UploadConcurrency)
+	s3Uploader, err := newUploader(s3Client, s3PartSize, s3UploadConcurrency)
+	if err != nil {
+		log.Fatalf("Couldn't configure S3 uploader: %v", err)
+	}
 
 	cfg := apiConfig{
-		db:               db,
-		jwtSecret:        jwtSecret,
-		platform:         platform,
-		filepathRoot:     filepathRoot,
-		assetsRoot:       assetsRoot,
-		s3Bucket:         s3Bucket,
-		s3Region:         s3Region,
-		s3CfDistribution: s3CfDistribution,
-		port:             port,
-		s3Client:         s3Client,
+		db:                    db,
+		jwtSecret:             jwtSecret,
+		platform:              platform,
+		filepathRoot:          filepathRoot,
+		assetsRoot:            assetsRoot,
+		s3Bucket:              s3Bucket,
+		s3Region:              s3Region,
+		s3CfDistribution:      s3CfDistribution,
+		port:                  port,
+		s3Client:              s3Client,
+		mimeCorrection:        mimeCorrection,
+		allowedVideoTypes:     allowedVideoTypes,
+		cloudFrontSigner:      cfSigner,
+		notifier:              notifier,
+		adminUserIDs:          adminUserIDs,
+		quotaExemptUserIDs:    quotaExemptUserIDs,
+		storageBytesQuota:     storageBytesQuota,
+		hourlyUploadLimit:     hourlyUploadLimit,
+		dailyUploadBytesQuota: dailyUploadBytesQuota,
+		uploadEncodings:       uploadEncodings,
+		thumbnailAspectMode:   thumbnailAspectMode,
+		thumbnailPadColor:     thumbnailPadColor,
+		s3PartSize:            s3PartSize,
+		s3UploadConcurrency:   s3UploadConcurrency,
+		s3Uploader:            s3Uploader,
+		bodyReadTimeout:       getEnvDuration("BODY_READ_TIMEOUT", 30*time.Second),
+		progressInterval:      getEnvDuration("UPLOAD_PROGRESS_INTERVAL", time.Second),
+		uuidgen:               uuid.New,
+		now:                   time.Now,
+		verifyMoov:            getEnvBool("VERIFY_MOOV", true),
+		detectLanguage:        getEnvBool("DETECT_LANGUAGE", false),
+		languageDetectCmd:     os.Getenv("LANGUAGE_DETECT_CMD"),
+		captionCmd:            os.Getenv("CAPTION_CMD"),
+		presignExpiry:         getEnvDuration("PRESIGN_EXPIRY", defaultPresignExpiry),
+		maxPresignExpiry:      getEnvDuration("MAX_PRESIGN_EXPIRY", defaultMaxPresignExpiry),
+		blurhash:              getEnvBool("BLURHASH", false),
+		maxMultipartParts:     getEnvInt("MAX_MULTIPART_PARTS", defaultMaxMultipartParts),
+		moveOnAspectChange:    getEnvBool("MOVE_ON_ASPECT_CHANGE", true),
+		storageBackend:        storageBackend,
+		localStorageRoot:      localStorageRoot,
+		defaultVisibility:     defaultVisibility,
+		requireThumbnail:      getEnvBool("REQUIRE_THUMBNAIL", false),
+		ffmpegGlobalArgs:      strings.Fields(getEnvString("FFMPEG_GLOBAL_ARGS", "-nostdin")),
+		ffmpegWrapper: resolveFFmpegWrapper(ffmpegLimits{
+			Niceness:       getEnvInt("FFMPEG_NICENESS", 0),
+			MaxMemoryBytes: getEnvInt64("FFMPEG_MAX_MEMORY_BYTES", 0),
+			MaxCPUSeconds:  getEnvInt64("FFMPEG_MAX_CPU_SECONDS", 0),
+		}),
+		thumbnailSeekFallback: getEnvBool("THUMBNAIL_ACCURATE_SEEK_FALLBACK", true),
+		thumbnailAutorotate:   getEnvBool("THUMBNAIL_AUTOROTATE", true),
+		thumbnailAt:           getEnvDuration("THUMBNAIL_AT", time.Second),
+		hlsEnabled:            getEnvBool("HLS_ENABLED", false),
+		minFreeDiskPercent:    getEnvFloat("MIN_FREE_DISK_PERCENT", 0),
+		uploadClaimTimeout:    getEnvDuration("UPLOAD_CLAIM_TIMEOUT", defaultUploadClaimTimeout),
+		commandTimeout:        getEnvDuration("FFMPEG_TIMEOUT", defaultCommandTimeout),
+		quarantineOther:       getEnvBool("QUARANTINE_OTHER", false),
+		quarantineTag:         quarantineTag,
+		strictDuration:        getEnvBool("STRICT_DURATION", false),
+		reencodeOverBytes:     getEnvInt64("REENCODE_OVER_BYTES", 0),
+		defaultPixFmt:         defaultPixFmt,
+		processingProfiles:    processingProfiles,
+		maxKeyframeInterval:   getEnvDuration("MAX_KEYFRAME_INTERVAL", 0),
+		keyframeMode:          keyframeMode,
+		defaultVideoSort:      defaultVideoSort,
+		deleteURLExpiry:       getEnvDuration("DELETE_URL_EXPIRY", defaultDeleteURLExpiry),
+		reencodeFallback:      getEnvBool("FASTSTART_REENCODE_FALLBACK", true),
+		streamUploads:         getEnvBool("STREAM_UPLOADS", false),
+		streamFastStart:       getEnvBool("STREAM_FASTSTART_UPLOADS", false),
+		progressiveThumbnails: getEnvBool("PROGRESSIVE_THUMBNAILS", false),
+		deleteGracePeriod:     getEnvDuration("DELETE_GRACE_PERIOD", defaultDeleteGracePeriod),
+		includeTitleInKey:     getEnvBool("INCLUDE_TITLE_IN_KEY", false),
+		shardKeys:             getEnvBool("SHARD_KEYS", false),
+		strictRegion:          getEnvBool("STRICT_REGION", false),
+		stagingBucket:         os.Getenv("S3_STAGING_BUCKET"),
+		streamProbeBytes:      getEnvInt64("STREAM_PROBE_BYTES", defaultStreamProbeBytes),
+	}
+	cfg.reencodeTargetBytes = getEnvInt64("REENCODE_TARGET_BYTES", cfg.reencodeOverBytes)
+	cfg.presignCache = newPresignCache(cfg.presignExpiry, cfg.now)
+	if storageBackend == storageBackendLocal {
+		cfg.localSigner = &urlSigner{
+			secret: []byte(getEnvString("LOCAL_URL_SECRET", jwtSecret)),
+			now:    cfg.now,
+		}
+		cfg.storage = &localStorage{
+			root:      localStorageRoot,
+			urlPrefix: "http://localhost:" + port + "/objects/",
+			signer:    cfg.localSigner,
+		}
+	} else {
+		cfg.storage = &s3Storage{
+			client:        s3Client,
+			uploader:      s3Uploader,
+			bucket:        s3Bucket,
+			stagingBucket: cfg.stagingBucket,
+			distribution:  cfg.s3CfDistribution,
+			tagging:       cfg.objectTagging,
+		}
+	}
+	cfg.processingLocks = newProcessingLocks()
+	cfg.quotaMu = &sync.Mutex{}
+	cfg.uploadProgress = newUploadProgressTracker()
+	cfg.onUploadProgress(cfg.uploadProgress.Update)
+	cfg.banCache = newCache[string, bool](banCacheSize, banCacheTTL, cfg.now)
+	cfg.playbackErrorLimiter = newRateLimiter(
+		getEnvInt("PLAYBACK_ERROR_RATE_LIMIT", 10),
+		getEnvDuration("PLAYBACK_ERROR_RATE_WINDOW", time.Minute),
+		cfg.now,
+	)
+	cfg.db.SetGenerators(cfg.uuidgen, cfg.now)
+	cfg.inspectors, err = cfg.buildInspectors(os.Getenv("INSPECTORS"), os.Getenv)
+	if err != nil {
+		log.Fatalf("INSPECTORS is invalid: %v", err)
+	}
+
+	if cfg.storageBackend == storageBackendS3 {
+		err := checkBucketRegion(context.TODO(), cfg.s3Client, cfg.s3Bucket, cfg.s3Region)
+		switch {
+		case err == nil:
+		case errors.Is(err, errBucketRegionMismatch) && cfg.strictRegion:
+			log.Fatalf("S3 region check failed: %v", err)
+		default:
+			log.Printf("Warning: %v", err)
+		}
 	}
 
 	err = cfg.ensureAssetsDir()
@@ -119,21 +399,75 @@ func main() {
 	assetsHandler := http.StripPrefix("/assets", http.FileServer(http.Dir(assetsRoot)))
 	mux.Handle("/assets/", noCacheMiddleware(assetsHandler))
 
+	if storageBackend == storageBackendLocal {
+		mux.HandleFunc("GET /objects/{key...}", cfg.handlerLocalObject)
+	}
+
 	mux.HandleFunc("POST /api/login", cfg.handlerLogin)
 	mux.HandleFunc("POST /api/refresh", cfg.handlerRefresh)
 	mux.HandleFunc("POST /api/revoke", cfg.handlerRevoke)
 
 	mux.HandleFunc("POST /api/users", cfg.handlerUsersCreate)
+	mux.HandleFunc("PUT /api/users/me/preferences", cfg.handlerUserPreferencesUpdate)
+	mux.HandleFunc("GET /api/users/me/stats", cfg.handlerUserStats)
 
+	mux.HandleFunc("POST /api/keys", cfg.handlerAPIKeyCreate)
+	mux.HandleFunc("GET /api/keys", cfg.handlerAPIKeysList)
+	mux.HandleFunc("DELETE /api/keys/{keyID}", cfg.handlerAPIKeyRevoke)
 	mux.HandleFunc("POST /api/videos", cfg.handlerVideoMetaCreate)
 	mux.HandleFunc("POST /api/thumbnail_upload/{videoID}", cfg.handlerUploadThumbnail)
+	mux.HandleFunc("POST /api/videos/{videoID}/thumbnail/auto", cfg.handlerVideoThumbnailAuto)
 	mux.HandleFunc("POST /api/video_upload/{videoID}", cfg.handlerUploadVideo)
+	mux.HandleFunc("POST /api/videos/{videoID}/uploads", cfg.handlerResumableUploadCreate)
+	mux.HandleFunc("GET /api/videos/{videoID}/uploads/{uploadID}", cfg.handlerResumableUploadGet)
+	mux.HandleFunc("PUT /api/videos/{videoID}/uploads/{uploadID}/parts/{partNumber}", cfg.handlerResumableUploadPart)
+	mux.HandleFunc("POST /api/videos/{videoID}/uploads/{uploadID}/complete", cfg.handlerResumableUploadComplete)
+	mux.HandleFunc("DELETE /api/videos/{videoID}/uploads/{uploadID}", cfg.handlerResumableUploadAbort)
+	mux.HandleFunc("POST /api/videos/{videoID}/reprocess", cfg.handlerVideoReprocess)
+	mux.HandleFunc("POST /api/videos/{videoID}/playback-error", cfg.handlerVideoPlaybackErrorReport)
+	mux.HandleFunc("POST /api/videos/{videoID}/undelete", cfg.handlerVideoUndelete)
+	mux.HandleFunc("POST /api/videos/{videoID}/clone", cfg.handlerVideoClone)
+	mux.HandleFunc("GET /api/videos/{videoID}/grants", cfg.handlerVideoGrantsList)
+	mux.HandleFunc("POST /api/videos/{videoID}/grants", cfg.handlerVideoGrantCreate)
+	mux.HandleFunc("DELETE /api/videos/{videoID}/grants/{userID}", cfg.handlerVideoGrantDelete)
+	mux.HandleFunc("POST /api/videos/sign", cfg.handlerVideosSign)
 	mux.HandleFunc("GET /api/videos", cfg.handlerVideosRetrieve)
+	mux.HandleFunc("GET /api/videos/options", cfg.handlerVideoOptions)
+	mux.HandleFunc("GET /api/videos/thumbnails", cfg.handlerVideoThumbnailsMap)
+	mux.HandleFunc("GET /api/videos/thumbnails/sprite", cfg.handlerVideoThumbnailsSprite)
 	mux.HandleFunc("GET /api/videos/{videoID}", cfg.handlerVideoGet)
+	mux.HandleFunc("GET /api/videos/{videoID}/rendition/{quality}", cfg.handlerVideoRenditionGet)
+	mux.HandleFunc("GET /api/videos/{videoID}/hls/{playlist...}", cfg.handlerVideoHLSPlaylist)
+	mux.HandleFunc("GET /api/videos/{videoID}/stream", cfg.handlerVideoStream)
+	mux.HandleFunc("GET /api/videos/{videoID}/state", cfg.handlerVideoState)
+	mux.HandleFunc("GET /api/videos/{videoID}/status", cfg.handlerVideoState)
+	mux.HandleFunc("GET /api/videos/{videoID}/timings", cfg.handlerVideoTimings)
+	mux.HandleFunc("GET /api/videos/{videoID}/versions", cfg.handlerVideoVersionsList)
+	mux.HandleFunc("GET /api/videos/{videoID}/metadata", cfg.handlerVideoMetadata)
 	// mux.HandleFunc("GET /api/thumbnails/{videoID}", cfg.handlerThumbnailGet)
 	mux.HandleFunc("DELETE /api/videos/{videoID}", cfg.handlerVideoMetaDelete)
+	mux.HandleFunc("POST /api/videos/{videoID}/delete-url", cfg.handlerVideoDeleteURL)
+	mux.HandleFunc("POST /api/videos/{videoID}/delete-url/complete", cfg.handlerVideoDeleteURLComplete)
 
 	mux.HandleFunc("POST /admin/reset", cfg.handlerReset)
+	mux.HandleFunc("GET /admin/videos/{videoID}/playback-errors", cfg.handlerAdminPlaybackErrors)
+	mux.HandleFunc("GET /api/admin/errors", cfg.handlerAdminErrors)
+	mux.HandleFunc("GET /admin/bans", cfg.handlerAdminBansList)
+	mux.HandleFunc("POST /admin/bans", cfg.handlerAdminBanCreate)
+	mux.HandleFunc("DELETE /admin/bans/{kind}/{targetID}", cfg.handlerAdminBanDelete)
+
+	if workers := getEnvInt("PROCESSING_WORKERS", defaultProcessingWorkers); workers > 0 {
+		cfg.processingQueue = newProcessingQueue(getEnvInt("PROCESSING_QUEUE_SIZE", defaultProcessingQueueSize))
+		cfg.runProcessingWorkers(context.Background(), workers)
+	}
+
+	if cfg.deleteGracePeriod > 0 {
+		go cfg.runDeletionSweeper(context.Background(), getEnvDuration("DELETE_SWEEP_INTERVAL", defaultDeleteSweepInterval))
+	}
+
+	if interval := getEnvDuration("ORPHAN_SWEEP_INTERVAL", 0); interval > 0 {
+		go cfg.runOrphanSweeper(context.Background(), interval, getEnvDuration("ORPHAN_MIN_AGE", defaultOrphanMinAge))
+	}
 
 	srv := &http.Server{
 		Addr:    ":" + port,
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// defaultVideoTypes is the ALLOWED_VIDEO_TYPES default. Anything other than
+// MP4 is transcoded to MP4 before it is stored.
+const defaultVideoTypes = "video/mp4,video/quicktime,video/webm,video/x-matroska"
+
+// parseVideoTypes reads a comma-separated allowlist of upload media types.
+func parseVideoTypes(raw string) (map[string]bool, error) {
+	types := map[string]bool{}
+	for _, mediaType := range strings.Split(raw, ",") {
+		mediaType = strings.TrimSpace(mediaType)
+		if mediaType == "" {
+			continue
+		}
+		if !strings.HasPrefix(mediaType, "video/") {
+			return nil, fmt.Errorf("%q is not a video media type", mediaType)
+		}
+		types[mediaType] = true
+	}
+	if len(types) == 0 {
+		return nil, fmt.Errorf("no video types listed")
+	}
+	return types, nil
+}
+
+// ebmlMagic starts every Matroska file, WebM included.
+var ebmlMagic = []byte{0x1a, 0x45, 0xdf, 0xa3}
+
+// isGenericMediaType reports whether a declared Content-Type carries no
+// real information about the file, which is common for browser and CLI
+// uploads of video files.
+func isGenericMediaType(mediaType string) bool {
+	return mediaType == "" || mediaType == "application/octet-stream"
+}
+
+// sniffLen is how many leading bytes http.DetectContentType looks at.
+const sniffLen = 512
+
+// sniffMediaType detects the media type from the first bytes of a file.
+// http.DetectContentType doesn't know QuickTime, so its "qt" ftyp brand is
+// checked here, and it reports every Matroska file as WebM, so the EBML
+// doctype is checked too.
+func sniffMediaType(head []byte) string {
+	if len(head) >= 12 && string(head[4:12]) == "ftypqt  " {
+		return "video/quicktime"
+	}
+	if bytes.HasPrefix(head, ebmlMagic) && bytes.Contains(head, []byte("matroska")) {
+		return "video/x-matroska"
+	}
+	mediaType := http.DetectContentType(head)
+	mediaType, _, _ = strings.Cut(mediaType, ";")
+	return strings.TrimSpace(mediaType)
+}
+
+// resolveVideoMediaType returns the media type to store an upload under.
+// A generic declared type is replaced by the sniffed one when correction is
+// enabled; anything else must already be a supported video type.
+func (cfg *apiConfig) resolveVideoMediaType(declared string, head []byte) (string, error) {
+	if isGenericMediaType(declared) && cfg.mimeCorrection {
+		sniffed := sniffMediaType(head)
+		if !cfg.allowedVideoTypes[sniffed] {
+			return "", fmt.Errorf("unsupported file type: %s", sniffed)
+		}
+		return sniffed, nil
+	}
+	if !cfg.allowedVideoTypes[declared] {
+		return "", fmt.Errorf("unsupported file type: %s", declared)
+	}
+	return declared, nil
+}
+
+// ffprobeContainers maps ffprobe's format names to media types. The MP4
+// and Matroska demuxers each cover a family of containers, so those are
+// told apart by containerMediaType instead.
+var ffprobeContainers = map[string]string{
+	"avi":    "video/x-msvideo",
+	"flv":    "video/x-flv",
+	"mpegts": "video/mp2t",
+	"ogg":    "video/ogg",
+	"asf":    "video/x-ms-asf",
+}
+
+// containerMediaType identifies the container ffprobe found from its
+// format_name, the ftyp major brand and the file's first bytes. It returns
+// "" for formats it doesn't know.
+func containerMediaType(formatName, majorBrand string, head []byte) string {
+	names := strings.Split(formatName, ",")
+	for _, name := range names {
+		switch name {
+		case "mov", "mp4":
+			if strings.TrimSpace(majorBrand) == "qt" {
+				return "video/quicktime"
+			}
+			return "video/mp4"
+		case "matroska", "webm":
+			if bytes.Contains(head, []byte("webm")) {
+				return "video/webm"
+			}
+			return "video/x-matroska"
+		}
+	}
+	for _, name := range names {
+		if mediaType, ok := ffprobeContainers[name]; ok {
+			return mediaType
+		}
+	}
+	return ""
+}
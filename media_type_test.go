@@ -0,0 +1,61 @@
+package main
+
+import "testing"
+
+func TestResolveVideoMediaTypeCorrectsOctetStream(t *testing.T) {
+	cfg := newTestConfig(t)
+
+	got, err := cfg.resolveVideoMediaType("application/octet-stream", mp4Header)
+	if err != nil {
+		t.Fatalf("octet-stream MP4: %v", err)
+	}
+	if got != "video/mp4" {
+		t.Errorf("octet-stream MP4 resolved to %q, want video/mp4", got)
+	}
+
+	if _, err := cfg.resolveVideoMediaType("application/octet-stream", []byte("just some notes\n")); err == nil {
+		t.Error("octet-stream text file was accepted")
+	}
+}
+
+func TestResolveVideoMediaTypeWithoutCorrection(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.mimeCorrection = false
+
+	if _, err := cfg.resolveVideoMediaType("application/octet-stream", mp4Header); err == nil {
+		t.Error("octet-stream MP4 was accepted with correction off")
+	}
+	if _, err := cfg.resolveVideoMediaType("video/mp4", mp4Header); err != nil {
+		t.Errorf("declared MP4 with correction off: %v", err)
+	}
+}
+
+func TestMediaTypeToExt(t *testing.T) {
+	tests := []struct {
+		mediaType string
+		want      string
+	}{
+		{"video/mp4", ".mp4"},
+		{"video/webm", ".webm"},
+		{"video/quicktime", ".mov"},
+		{"video/x-matroska", ".mkv"},
+		{"image/jpeg", ".jpg"},
+		{"image/png", ".png"},
+		{"image/webp", ".webp"},
+	}
+	for _, tt := range tests {
+		got, err := mediaTypeToExt(tt.mediaType)
+		if err != nil || got != tt.want {
+			t.Errorf("mediaTypeToExt(%q) = %q, %v; want %q", tt.mediaType, got, err, tt.want)
+		}
+	}
+	if len(tests) != len(mediaTypeExtensions) {
+		t.Errorf("table covers %d types, mediaTypeExtensions has %d", len(tests), len(mediaTypeExtensions))
+	}
+
+	for _, mediaType := range []string{"video/x-msvideo", "text/plain", ""} {
+		if ext, err := mediaTypeToExt(mediaType); err == nil {
+			t.Errorf("mediaTypeToExt(%q) = %q, want an error", mediaType, ext)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	banCacheSize = 10000
+	banCacheTTL  = 30 * time.Second
+)
+
+func banCacheKey(kind string, id uuid.UUID) string {
+	return kind + ":" + id.String()
+}
+
+// isBanned checks the moderation table, caching answers briefly so hot read
+// paths don't hit the database on every request. Ban changes made through
+// this server invalidate the cache immediately.
+func (cfg *apiConfig) isBanned(kind string, id uuid.UUID) (bool, error) {
+	key := banCacheKey(kind, id)
+	if banned, ok := cfg.banCache.Get(key); ok {
+		return banned, nil
+	}
+	banned, err := cfg.db.IsBanned(kind, id)
+	if err != nil {
+		return false, err
+	}
+	cfg.banCache.Set(key, banned)
+	return banned, nil
+}
+
+// rejectBannedVideo responds with 451 when the video has been banned and
+// reports whether the caller should stop.
+func (cfg *apiConfig) rejectBannedVideo(w http.ResponseWriter, videoID uuid.UUID) bool {
+	banned, err := cfg.isBanned(database.BanKindVideo, videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check moderation status", err)
+		return true
+	}
+	if banned {
+		respondWithError(w, http.StatusUnavailableForLegalReasons, "This video is unavailable", nil)
+		return true
+	}
+	return false
+}
+
+// markBannedVideo flags a listed video that has been banned and drops its
+// URLs so nothing gets signed for it. It reports whether the video is
+// banned.
+func (cfg *apiConfig) markBannedVideo(video *database.Video) (bool, error) {
+	banned, err := cfg.isBanned(database.BanKindVideo, video.ID)
+	if err != nil || !banned {
+		return false, err
+	}
+	video.Banned = true
+	video.VideoURL = nil
+	video.ThumbnailURL = nil
+	video.HLSURL = nil
+	return true, nil
+}
+
+// rejectBannedUser responds with 403 when the user has been banned and
+// reports whether the caller should stop.
+func (cfg *apiConfig) rejectBannedUser(w http.ResponseWriter, userID uuid.UUID) bool {
+	banned, err := cfg.isBanned(database.BanKindUser, userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check moderation status", err)
+		return true
+	}
+	if banned {
+		respondWithError(w, http.StatusForbidden, "Your account has been suspended", nil)
+		return true
+	}
+	return false
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+var (
+	errMissingMoov  = errors.New("file has no moov atom")
+	errTruncatedMP4 = errors.New("file is truncated")
+)
+
+// verifyMP4Structure walks the top-level boxes of an MP4 file and reports
+// whether the moov atom is present and every box fits within the file.
+// It only reads box headers, so it's cheap even for very large uploads.
+func verifyMP4Structure(filePath string) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	fileSize := info.Size()
+
+	foundMoov := false
+	var offset int64
+	header := make([]byte, 16)
+	for offset < fileSize {
+		if fileSize-offset < 8 {
+			return errTruncatedMP4
+		}
+		if _, err := f.ReadAt(header[:8], offset); err != nil {
+			return fmt.Errorf("could not read box header: %v", err)
+		}
+		boxSize := int64(binary.BigEndian.Uint32(header[:4]))
+		boxType := string(header[4:8])
+		headerSize := int64(8)
+
+		switch boxSize {
+		case 0:
+			// The box extends to the end of the file.
+			boxSize = fileSize - offset
+		case 1:
+			if _, err := f.ReadAt(header[8:16], offset+8); err != nil {
+				if err == io.EOF {
+					return errTruncatedMP4
+				}
+				return fmt.Errorf("could not read box size: %v", err)
+			}
+			boxSize = int64(binary.BigEndian.Uint64(header[8:16]))
+			headerSize = 16
+		}
+		if boxSize < headerSize {
+			return fmt.Errorf("invalid %q box size %d", boxType, boxSize)
+		}
+		if offset+boxSize > fileSize {
+			return errTruncatedMP4
+		}
+		if boxType == "moov" {
+			foundMoov = true
+		}
+		offset += boxSize
+	}
+
+	if !foundMoov {
+		return errMissingMoov
+	}
+	return nil
+}
+
+// moovBeforeMdat reports whether a possibly partial MP4 file has its moov
+// atom ahead of the media data, i.e. it's already laid out for fast start
+// and storing it as-is loses nothing. Running out of data before either
+// box is found counts as false.
+func moovBeforeMdat(filePath string) (bool, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+	fileSize := info.Size()
+
+	var offset int64
+	header := make([]byte, 16)
+	for fileSize-offset >= 8 {
+		if _, err := f.ReadAt(header[:8], offset); err != nil {
+			return false, fmt.Errorf("could not read box header: %v", err)
+		}
+		boxSize := int64(binary.BigEndian.Uint32(header[:4]))
+		switch string(header[4:8]) {
+		case "moov":
+			return true, nil
+		case "mdat":
+			return false, nil
+		}
+		headerSize := int64(8)
+		switch boxSize {
+		case 0:
+			return false, nil
+		case 1:
+			if _, err := f.ReadAt(header[8:16], offset+8); err != nil {
+				return false, nil
+			}
+			boxSize = int64(binary.BigEndian.Uint64(header[8:16]))
+			headerSize = 16
+		}
+		if boxSize < headerSize {
+			return false, fmt.Errorf("invalid box size %d", boxSize)
+		}
+		offset += boxSize
+	}
+	return false, nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "clip.mp4")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestVerifyMP4Structure(t *testing.T) {
+	complete := testMP4(256, 0)
+	withoutMoov := append(append([]byte{}, mp4Header...), 0, 0, 0, 8, 'm', 'd', 'a', 't')
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"complete", complete, nil},
+		{"cut off mid-box", complete[:len(complete)-100], errTruncatedMP4},
+		{"no moov", withoutMoov, errMissingMoov},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyMP4Structure(writeTestFile(t, tt.data))
+			if !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestUploadRejectsTruncatedMP4(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.verifyMoov = true
+	installFakeMedia(t, &fakeMedia{Width: 1920, Height: 1080})
+	userID := createTestUser(t, cfg)
+	video := createTestVideo(t, cfg, userID, visibilityPublic)
+
+	complete := testMP4(256, 0)
+	if rec := uploadTestVideo(t, cfg, video.ID, userID, complete); rec.Code != http.StatusOK {
+		t.Fatalf("complete MP4: got status %d: %s", rec.Code, rec.Body)
+	}
+	if rec := uploadTestVideo(t, cfg, video.ID, userID, complete[:len(complete)-100]); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("truncated MP4: got status %d, want 422", rec.Code)
+	}
+}
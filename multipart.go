@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+)
+
+const defaultMaxMultipartParts = 10
+
+var errTooManyParts = errors.New("too many multipart parts")
+
+// partReader walks a multipart body while enforcing a cap on the total
+// number of parts, so a client can't make us churn through thousands of
+// tiny parts.
+type partReader struct {
+	mr       *multipart.Reader
+	maxParts int
+	count    int
+}
+
+func newPartReader(mr *multipart.Reader, maxParts int) *partReader {
+	return &partReader{mr: mr, maxParts: maxParts}
+}
+
+// next returns the next part, or io.EOF once the body is exhausted.
+func (p *partReader) next() (*multipart.Part, error) {
+	if p.count >= p.maxParts {
+		return nil, errTooManyParts
+	}
+	part, err := p.mr.NextPart()
+	if err != nil {
+		return nil, err
+	}
+	p.count++
+	return part, nil
+}
+
+// nextField advances until it reaches the part for the given form field,
+// discarding any others on the way.
+func (p *partReader) nextField(field string) (*multipart.Part, error) {
+	for {
+		part, err := p.next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("no %q field in form", field)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() == field {
+			return part, nil
+		}
+		if _, err := io.Copy(io.Discard, part); err != nil {
+			return nil, err
+		}
+		part.Close()
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// manyFieldsBody is a form with n filler fields ahead of the video part.
+func manyFieldsBody(t *testing.T, n int) (*bytes.Buffer, string) {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for range n {
+		mw.WriteField("filler", "x")
+	}
+	part, err := mw.CreateFormFile("video", "clip.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(testMP4(64, 0))
+	mw.Close()
+	return &body, mw.FormDataContentType()
+}
+
+func TestPartReaderCapsParts(t *testing.T) {
+	body, contentType := manyFieldsBody(t, 3)
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.Header.Set("Content-Type", contentType)
+	mr, err := req.MultipartReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newPartReader(mr, 3).nextField("video"); !errors.Is(err, errTooManyParts) {
+		t.Errorf("got %v, want errTooManyParts", err)
+	}
+}
+
+func TestUploadRejectsTooManyParts(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.maxMultipartParts = 4
+	userID := createTestUser(t, cfg)
+	video := createTestVideo(t, cfg, userID, visibilityPublic)
+
+	body, contentType := manyFieldsBody(t, 10)
+	req := newAuthedRequest(t, http.MethodPost, "/api/video_upload/"+video.ID.String(), body, userID)
+	req.Header.Set("Content-Type", contentType)
+	req.SetPathValue("videoID", video.ID.String())
+	rec := httptest.NewRecorder()
+	cfg.handlerUploadVideo(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("got status %d, want 400", rec.Code)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/smtp"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+type processingEvent struct {
+	Status string
+	Video  database.Video
+	Email  string
+	Err    error
+}
+
+type Notifier interface {
+	Notify(ctx context.Context, event processingEvent) error
+}
+
+func newNotifier(kind string) (Notifier, error) {
+	switch kind {
+	case "":
+		return nil, nil
+	case "slack":
+		webhookURL := getEnvString("SLACK_WEBHOOK_URL", "")
+		if webhookURL == "" {
+			return nil, fmt.Errorf("SLACK_WEBHOOK_URL must be set for the slack notifier")
+		}
+		return slackNotifier{webhookURL: webhookURL, client: &http.Client{Timeout: 10 * time.Second}}, nil
+	case "email":
+		n := emailNotifier{
+			host:     getEnvString("SMTP_HOST", ""),
+			port:     getEnvString("SMTP_PORT", "587"),
+			username: getEnvString("SMTP_USERNAME", ""),
+			password: getEnvString("SMTP_PASSWORD", ""),
+			from:     getEnvString("SMTP_FROM", ""),
+		}
+		if n.host == "" || n.from == "" {
+			return nil, fmt.Errorf("SMTP_HOST and SMTP_FROM must be set for the email notifier")
+		}
+		return n, nil
+	default:
+		return nil, fmt.Errorf("unknown notifier: %s", kind)
+	}
+}
+
+func describeEvent(event processingEvent) string {
+	if event.Status == processingStatusFailed {
+		return fmt.Sprintf("Processing of your video %q failed: %v", event.Video.Title, event.Err)
+	}
+	return fmt.Sprintf("Your video %q has finished processing and is ready to watch.", event.Video.Title)
+}
+
+type slackNotifier struct {
+	webhookURL string
+	client     *http.Client
+}
+
+func (n slackNotifier) Notify(ctx context.Context, event processingEvent) error {
+	body, err := json.Marshal(map[string]string{
+		"text": fmt.Sprintf("[%s] %s (video %s)", event.Status, describeEvent(event), event.Video.ID),
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("slack webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+type emailNotifier struct {
+	host     string
+	port     string
+	username string
+	password string
+	from     string
+}
+
+func (n emailNotifier) Notify(ctx context.Context, event processingEvent) error {
+	if event.Email == "" {
+		return nil
+	}
+	var auth smtp.Auth
+	if n.username != "" {
+		auth = smtp.PlainAuth("", n.username, n.password, n.host)
+	}
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: Tubely video %s\r\n\r\n%s\r\n",
+		n.from, event.Email, event.Status, describeEvent(event))
+	return smtp.SendMail(n.host+":"+n.port, auth, n.from, []string{event.Email}, []byte(msg))
+}
+
+// notifyProcessing delivers a processing event in the background, retrying
+// with backoff so a flaky mail server or webhook never blocks an upload.
+func (cfg *apiConfig) notifyProcessing(video database.Video, status string, procErr error) {
+	if cfg.notifier == nil {
+		return
+	}
+	event := processingEvent{Status: status, Video: video, Err: procErr}
+	user, err := cfg.db.GetUser(video.UserID)
+	if err == nil && user != nil {
+		event.Email = user.Email
+	}
+
+	go func() {
+		const maxAttempts = 3
+		backoff := time.Second
+		for attempt := 1; attempt <= maxAttempts; attempt++ {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			err := cfg.notifier.Notify(ctx, event)
+			cancel()
+			if err == nil {
+				return
+			}
+			log.Printf("notification attempt %d for video %s failed: %v", attempt, video.ID, err)
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}()
+}
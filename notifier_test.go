@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type fakeNotifier struct {
+	events chan processingEvent
+}
+
+func (n fakeNotifier) Notify(ctx context.Context, event processingEvent) error {
+	n.events <- event
+	return nil
+}
+
+func (n fakeNotifier) next(t *testing.T) processingEvent {
+	t.Helper()
+	select {
+	case event := <-n.events:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("notifier wasn't called")
+		return processingEvent{}
+	}
+}
+
+func TestNotifyProcessingCompletion(t *testing.T) {
+	cfg := newTestConfig(t)
+	notifier := fakeNotifier{events: make(chan processingEvent, 1)}
+	cfg.notifier = notifier
+	userID := createTestUser(t, cfg)
+	video := createTestVideo(t, cfg, userID, visibilityPublic)
+
+	cfg.notifyProcessing(video, processingStatusReady, nil)
+
+	event := notifier.next(t)
+	if event.Status != processingStatusReady || event.Video.ID != video.ID || event.Err != nil {
+		t.Errorf("got event %+v, want a ready event for video %s", event, video.ID)
+	}
+	if event.Email == "" {
+		t.Error("event has no owner email")
+	}
+}
+
+func TestNotifyProcessingFailure(t *testing.T) {
+	cfg := newTestConfig(t)
+	notifier := fakeNotifier{events: make(chan processingEvent, 1)}
+	cfg.notifier = notifier
+	userID := createTestUser(t, cfg)
+	video := createTestVideo(t, cfg, userID, visibilityPublic)
+
+	rec := httptest.NewRecorder()
+	cfg.failVideoProcessing(rec, &video, processingStageUpload, http.StatusInternalServerError, "Failed to upload", errors.New("disk full"))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("got status %d, want 500", rec.Code)
+	}
+
+	event := notifier.next(t)
+	if event.Status != processingStatusFailed || event.Video.ID != video.ID {
+		t.Errorf("got event %+v, want a failed event for video %s", event, video.ID)
+	}
+	if event.Err == nil {
+		t.Error("failed event carries no error")
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	storageBackendS3    = "s3"
+	storageBackendLocal = "local"
+)
+
+// putVideoObject stores an uploaded video under key in the configured
+// backend.
+func (cfg *apiConfig) putVideoObject(ctx context.Context, key string, body io.Reader, contentType string) error {
+	return cfg.storage.Put(ctx, key, body, contentType, "")
+}
+
+// putVideoObjectChecksum is putVideoObject for a body whose hex SHA-256 is
+// already known, so the backend can verify what it stores.
+func (cfg *apiConfig) putVideoObjectChecksum(ctx context.Context, key string, body io.Reader, contentType, sha256 string) error {
+	return cfg.storage.Put(ctx, key, body, contentType, sha256)
+}
+
+// objectExists reports whether a key is present in the store.
+func (cfg *apiConfig) objectExists(ctx context.Context, key string) (bool, error) {
+	_, err := cfg.storage.Stat(ctx, key)
+	if errors.Is(err, errObjectNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (cfg *apiConfig) copyObject(ctx context.Context, srcKey, dstKey string) error {
+	return cfg.storage.Copy(ctx, srcKey, dstKey)
+}
+
+func copyLocalFile(srcPath, dstPath string) error {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	if err := os.MkdirAll(filepath.Dir(dstPath), 0755); err != nil {
+		return err
+	}
+	dst, err := os.Create(dstPath)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+	if _, err := io.Copy(dst, src); err != nil {
+		return fmt.Errorf("failed to copy %s to %s: %v", srcPath, dstPath, err)
+	}
+	return dst.Close()
+}
+
+func (cfg *apiConfig) deleteObject(ctx context.Context, key string) error {
+	return cfg.storage.Delete(ctx, key)
+}
+
+// listObjects calls fn with the key and last-modified time of every object
+// in the store.
+func (cfg *apiConfig) listObjects(ctx context.Context, fn func(key string, modified time.Time) error) error {
+	return cfg.storage.List(ctx, fn)
+}
+
+// deleteObjectPrefix removes every object whose key starts with prefix,
+// such as a video's HLS segment tree.
+func (cfg *apiConfig) deleteObjectPrefix(ctx context.Context, prefix string) error {
+	return cfg.storage.DeletePrefix(ctx, prefix)
+}
+
+// downloadObjectToTemp copies an object into a new temp file and returns
+// its path. The caller is responsible for removing it.
+func (cfg *apiConfig) downloadObjectToTemp(ctx context.Context, key, pattern string) (string, error) {
+	body, err := cfg.storage.Get(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	tmp, err := os.CreateTemp("", pattern)
+	if err != nil {
+		return "", err
+	}
+	defer tmp.Close()
+	if _, err := io.Copy(tmp, body); err != nil {
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("failed to download %s: %v", key, err)
+	}
+	return tmp.Name(), nil
+}
+
+var errObjectNotFound = errors.New("object not found")
+
+// readObject returns the contents of a small object such as a playlist,
+// refusing anything over maxBytes. A missing key yields errObjectNotFound.
+func (cfg *apiConfig) readObject(ctx context.Context, key string, maxBytes int64) ([]byte, error) {
+	body, err := cfg.storage.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(body, maxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", key, err)
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, fmt.Errorf("%s is larger than %d bytes", key, maxBytes)
+	}
+	return data, nil
+}
+
+// objectETag returns an object's ETag without the surrounding quotes. The
+// local backend has no ETags, so a size/mtime fingerprint stands in.
+func (cfg *apiConfig) objectETag(ctx context.Context, key string) (string, error) {
+	info, err := cfg.storage.Stat(ctx, key)
+	if err != nil {
+		return "", fmt.Errorf("failed to get ETag of %s: %w", key, err)
+	}
+	return info.ETag, nil
+}
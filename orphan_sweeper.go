@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const defaultOrphanMinAge = 24 * time.Hour
+
+// sweepOrphanedObjects deletes bucket objects no video row references:
+// leftovers from uploads that failed after storing their object, or from
+// deletes that didn't get to every key. Objects younger than minAge are
+// skipped since an upload in flight stores its object before recording
+// the version. It returns how many objects were removed.
+func (cfg *apiConfig) sweepOrphanedObjects(ctx context.Context, minAge time.Duration) (int, error) {
+	keys, err := cfg.db.GetReferencedObjectKeys()
+	if err != nil {
+		return 0, err
+	}
+	referenced := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		referenced[key] = true
+	}
+	videoIDs, err := cfg.db.GetAllVideoIDs()
+	if err != nil {
+		return 0, err
+	}
+	videos := make(map[uuid.UUID]bool, len(videoIDs))
+	for _, id := range videoIDs {
+		referenced[cfg.thumbnailKey(id)] = true
+		videos[id] = true
+	}
+
+	cutoff := cfg.now().Add(-minAge)
+	removed := 0
+	err = cfg.listObjects(ctx, func(key string, modified time.Time) error {
+		if referenced[key] || modified.After(cutoff) {
+			return nil
+		}
+		// HLS trees and uploaded thumbnails belong to their video as a
+		// whole rather than key by key.
+		if _, rest, ok := strings.Cut(key, "hls/"); ok {
+			idString, _, _ := strings.Cut(rest, "/")
+			if id, err := uuid.Parse(idString); err == nil && videos[id] && strings.HasPrefix(key, cfg.hlsPrefix(id)) {
+				return nil
+			}
+		}
+		if _, rest, ok := strings.Cut(key, "thumbnails/"); ok {
+			idString, _, _ := strings.Cut(rest, "/")
+			if id, err := uuid.Parse(idString); err == nil && videos[id] && strings.HasPrefix(key, cfg.uploadedThumbnailPrefix(id)) {
+				return nil
+			}
+		}
+		if err := cfg.deleteObject(ctx, key); err != nil {
+			log.Printf("Couldn't delete orphaned object %s: %v", key, err)
+			return nil
+		}
+		removed++
+		return nil
+	})
+	return removed, err
+}
+
+func (cfg *apiConfig) runOrphanSweeper(ctx context.Context, interval, minAge time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			removed, err := cfg.sweepOrphanedObjects(ctx, minAge)
+			if err != nil {
+				log.Printf("Couldn't sweep orphaned objects: %v", err)
+			} else if removed > 0 {
+				log.Printf("Removed %d orphaned objects", removed)
+			}
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 100
+)
+
+// parsePagination reads the limit and offset query parameters shared by the
+// list endpoints.
+func parsePagination(r *http.Request) (limit, offset int, err error) {
+	limit = defaultPageLimit
+	if limitString := r.URL.Query().Get("limit"); limitString != "" {
+		limit, err = strconv.Atoi(limitString)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			return 0, 0, errors.New("limit must be between 1 and 100")
+		}
+	}
+	if offsetString := r.URL.Query().Get("offset"); offsetString != "" {
+		offset, err = strconv.Atoi(offsetString)
+		if err != nil || offset < 0 {
+			return 0, 0, errors.New("offset must be a non-negative integer")
+		}
+	}
+	return limit, offset, nil
+}
+
+// videoSortNames is the list of accepted sort values for error messages.
+func videoSortNames() string {
+	names := make([]string, len(database.VideoSorts))
+	for i, sort := range database.VideoSorts {
+		names[i] = string(sort)
+	}
+	return strings.Join(names, ", ")
+}
+
+// parseVideoSort reads the sort query parameter, using def when it's
+// absent.
+func parseVideoSort(r *http.Request, def database.VideoSort) (database.VideoSort, error) {
+	sortString := r.URL.Query().Get("sort")
+	if sortString == "" {
+		return def, nil
+	}
+	sort := database.VideoSort(sortString)
+	if !sort.Valid() {
+		return "", errors.New("sort must be one of " + videoSortNames())
+	}
+	return sort, nil
+}
+
+// page is the envelope every list endpoint responds with. Next is the
+// request's URL for the following page, and is empty on the last one, so
+// a client that sent no pagination parameters can still see there's more.
+type page[T any] struct {
+	Items   []T    `json:"items"`
+	Total   int    `json:"total"`
+	Limit   int    `json:"limit"`
+	Offset  int    `json:"offset"`
+	HasMore bool   `json:"has_more"`
+	Next    string `json:"next,omitempty"`
+}
+
+func newPage[T any](r *http.Request, items []T, total, limit, offset int) page[T] {
+	if items == nil {
+		items = []T{}
+	}
+	p := page[T]{
+		Items:   items,
+		Total:   total,
+		Limit:   limit,
+		Offset:  offset,
+		HasMore: offset+len(items) < total,
+	}
+	if p.HasMore {
+		query := r.URL.Query()
+		query.Set("limit", strconv.Itoa(limit))
+		query.Set("offset", strconv.Itoa(offset+len(items)))
+		p.Next = r.URL.Path + "?" + query.Encode()
+	}
+	return p
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewPageEnvelope(t *testing.T) {
+	tests := []struct {
+		name        string
+		items       []int
+		total       int
+		limit       int
+		offset      int
+		wantHasMore bool
+		wantNext    string
+	}{
+		{"full first page", []int{1, 2}, 5, 2, 0, true, "/api/videos?limit=2&offset=2"},
+		{"partial last page", []int{5}, 5, 2, 4, false, ""},
+		{"empty", nil, 0, 50, 0, false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/api/videos", nil)
+			p := newPage(r, tt.items, tt.total, tt.limit, tt.offset)
+			if p.Items == nil {
+				t.Error("Items is nil, want an empty list")
+			}
+			if p.Total != tt.total || p.Limit != tt.limit || p.Offset != tt.offset {
+				t.Errorf("got total=%d limit=%d offset=%d, want %d %d %d", p.Total, p.Limit, p.Offset, tt.total, tt.limit, tt.offset)
+			}
+			if p.HasMore != tt.wantHasMore || p.Next != tt.wantNext {
+				t.Errorf("got has_more=%v next=%q, want %v %q", p.HasMore, p.Next, tt.wantHasMore, tt.wantNext)
+			}
+		})
+	}
+}
+
+func TestNewPageNextKeepsFilters(t *testing.T) {
+	r := httptest.NewRequest("GET", "/api/videos?aspect=portrait&sort=oldest", nil)
+	p := newPage(r, []int{1}, 3, 1, 0)
+	want := "/api/videos?aspect=portrait&limit=1&offset=1&sort=oldest"
+	if p.Next != want {
+		t.Errorf("next = %q, want %q", p.Next, want)
+	}
+}
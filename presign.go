@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+const (
+	defaultPresignExpiry    = 15 * time.Minute
+	defaultMaxPresignExpiry = 7 * 24 * time.Hour
+	presignCacheSize        = 10000
+)
+
+func newPresignCache(expiry time.Duration, now func() time.Time) *cache[string, string] {
+	// Cached URLs are reused for half their lifetime so every URL handed
+	// out still has at least half of the expiry left.
+	return newCache[string, string](presignCacheSize, expiry/2, now)
+}
+
+// signGetURL mints a time-limited GET URL for a key in the video bucket:
+// a CloudFront signed URL when a key pair is configured, otherwise
+// whatever the storage backend presigns.
+func (cfg *apiConfig) signGetURL(key string, expiry time.Duration) (string, error) {
+	if cfg.cloudFrontSigner != nil {
+		return cfg.cloudFrontSigner.Sign(cfg.getObjectURL(key), cfg.now().Add(expiry))
+	}
+	return cfg.storage.PresignURL(key, expiry)
+}
+
+// presignGetURL returns a signed GET URL for a key in the video bucket,
+// reusing a recently minted one when possible. Only URLs with the default
+// expiry are cached, since the cache TTL is derived from it.
+func (cfg *apiConfig) presignGetURL(key string, expiry time.Duration) (string, error) {
+	if expiry != cfg.presignExpiry {
+		return cfg.signGetURL(key, expiry)
+	}
+	if url, ok := cfg.presignCache.Get(key); ok {
+		return url, nil
+	}
+	url, err := cfg.signGetURL(key, expiry)
+	if err != nil {
+		return "", err
+	}
+	cfg.presignCache.Set(key, url)
+	return url, nil
+}
+
+// presignExpiryFor returns how long a video's signed URLs should live: its
+// own url_ttl_seconds when set, otherwise the global default.
+func (cfg *apiConfig) presignExpiryFor(video database.Video) time.Duration {
+	if video.URLTTLSeconds != nil {
+		return time.Duration(*video.URLTTLSeconds) * time.Second
+	}
+	return cfg.presignExpiry
+}
+
+// validateURLTTL checks a per-video URL lifetime override.
+func (cfg *apiConfig) validateURLTTL(seconds *int) error {
+	if seconds == nil {
+		return nil
+	}
+	if *seconds <= 0 {
+		return errors.New("url_ttl_seconds must be positive")
+	}
+	if time.Duration(*seconds)*time.Second > cfg.maxPresignExpiry {
+		return fmt.Errorf("url_ttl_seconds must be at most %d", int(cfg.maxPresignExpiry/time.Second))
+	}
+	return nil
+}
+
+// videoURLRef is the value stored in video_url for an object: a
+// "store,key" pair, the store being the bucket on S3, which
+// dbVideoToSignedVideo turns into a presigned URL at request time.
+func (cfg *apiConfig) videoURLRef(key string) string {
+	return cfg.storage.Name() + "," + key
+}
+
+// dbVideoToSignedVideo swaps a stored "store,key" video_url for a freshly
+// presigned URL. Older rows that hold a plain object URL are signed too;
+// videos that were never uploaded, and URLs from elsewhere, are returned
+// unchanged.
+func (cfg *apiConfig) dbVideoToSignedVideo(video database.Video) (database.Video, error) {
+	if video.VideoURL == nil {
+		return video, nil
+	}
+	bucket, key, ok := strings.Cut(*video.VideoURL, ",")
+	if plainKey, isPlain := strings.CutPrefix(*video.VideoURL, cfg.getObjectURL("")); isPlain && plainKey != "" {
+		bucket, key, ok = cfg.storage.Name(), plainKey, true
+	}
+	if !ok || bucket == "" || key == "" {
+		return video, nil
+	}
+	var presignURL string
+	var err error
+	if bucket == cfg.storage.Name() {
+		presignURL, err = cfg.presignGetURL(key, cfg.presignExpiryFor(video))
+	} else if presigner, ok := cfg.storage.(bucketPresigner); ok {
+		presignURL, err = presigner.PresignBucketURL(bucket, key, cfg.presignExpiryFor(video))
+	} else {
+		return video, nil
+	}
+	if err != nil {
+		return video, err
+	}
+	video.VideoURL = &presignURL
+	return video, nil
+}
+
+func (cfg *apiConfig) respondWithSignedVideo(w http.ResponseWriter, video database.Video) {
+	video, err := cfg.dbVideoToSignedVideo(video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't generate presigned url", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, video)
+}
+
+// signedVideoURL presigns the latest uploaded version of a video. ok is
+// false when the video has never been uploaded.
+func (cfg *apiConfig) signedVideoURL(video database.Video) (url string, ok bool, err error) {
+	latest, err := cfg.db.GetLatestVideoVersionNumber(video.ID)
+	if err != nil {
+		return "", false, err
+	}
+	if latest == 0 {
+		return "", false, nil
+	}
+	version, err := cfg.db.GetVideoVersion(video.ID, latest)
+	if err != nil {
+		return "", false, err
+	}
+	url, err = cfg.presignGetURL(version.Key, cfg.presignExpiryFor(video))
+	if err != nil {
+		return "", false, err
+	}
+	return url, true, nil
+}
+
+// signedThumbnailURL signs a thumbnail kept in the object store with the
+// video's URL expiry. Thumbnails uploaded to the assets directory by older
+// releases aren't in the store and are returned as they are.
+func (cfg *apiConfig) signedThumbnailURL(video database.Video) (*string, error) {
+	if video.ThumbnailURL == nil {
+		return nil, nil
+	}
+	key, ok := cfg.thumbnailObjectKey(*video.ThumbnailURL)
+	if !ok {
+		return video.ThumbnailURL, nil
+	}
+	url, err := cfg.presignGetURL(key, cfg.presignExpiryFor(video))
+	if err != nil {
+		return nil, err
+	}
+	return &url, nil
+}
+
+// thumbnailObjectKey returns the store key behind a thumbnail URL. ok is
+// false for thumbnails that aren't kept in the object store.
+func (cfg *apiConfig) thumbnailObjectKey(thumbnailURL string) (key string, ok bool) {
+	key, ok = strings.CutPrefix(unversionedURL(thumbnailURL), cfg.getObjectURL(""))
+	return key, ok && key != ""
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVideoURLTTLOverride(t *testing.T) {
+	cfg := newTestConfig(t)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	setTestClock(cfg, func() time.Time { return now })
+	userID := createTestUser(t, cfg)
+
+	tests := []struct {
+		name       string
+		body       string
+		wantExpiry time.Duration
+	}{
+		{"custom ttl", `{"title":"Preview","url_ttl_seconds":60}`, time.Minute},
+		{"default ttl", `{"title":"Feature"}`, cfg.presignExpiry},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			video := createVideoAs(t, cfg, userID, tt.body)
+			key := storeTestVersion(t, cfg, video.ID, testMP4(64, byte(i)))
+			videoURL := cfg.videoURLRef(key)
+			video.VideoURL = &videoURL
+
+			signed, err := cfg.dbVideoToSignedVideo(video)
+			if err != nil {
+				t.Fatal(err)
+			}
+			query := signedQuery(t, cfg, *signed.VideoURL, key)
+			if want := strconv.FormatInt(now.Add(tt.wantExpiry).Unix(), 10); query.Get("expires") != want {
+				t.Errorf("expires = %s, want %s (%v from now)", query.Get("expires"), want, tt.wantExpiry)
+			}
+		})
+	}
+}
+
+func TestVideoURLTTLValidated(t *testing.T) {
+	cfg := newTestConfig(t)
+	userID := createTestUser(t, cfg)
+	tooLong := strconv.Itoa(int(cfg.maxPresignExpiry/time.Second) + 1)
+	for _, ttl := range []string{"0", "-5", tooLong} {
+		rec := httptest.NewRecorder()
+		body := `{"title":"Bad","url_ttl_seconds":` + ttl + `}`
+		cfg.handlerVideoMetaCreate(rec, newAuthedRequest(t, http.MethodPost, "/api/videos", strings.NewReader(body), userID))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("url_ttl_seconds %s: got status %d, want 400", ttl, rec.Code)
+		}
+	}
+}
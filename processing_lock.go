@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// processingLocks tracks which videos have a processing pipeline running in
+// this process. The database claim covers uploads across restarts; this
+// keeps reprocess and upload from running ffmpeg on the same video at once
+// and racing on its object keys.
+type processingLocks struct {
+	mu       sync.Mutex
+	inFlight map[uuid.UUID]struct{}
+}
+
+func newProcessingLocks() *processingLocks {
+	return &processingLocks{inFlight: map[uuid.UUID]struct{}{}}
+}
+
+// TryAcquire reserves videoID, returning false if it's already held. The
+// returned release func must be called once processing finishes.
+func (l *processingLocks) TryAcquire(videoID uuid.UUID) (func(), bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.inFlight[videoID]; ok {
+		return nil, false
+	}
+	l.inFlight[videoID] = struct{}{}
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		delete(l.inFlight, videoID)
+	}, true
+}
+
+// lockVideoProcessing responds 409 and returns false if videoID is already
+// being processed.
+func (cfg *apiConfig) lockVideoProcessing(w http.ResponseWriter, videoID uuid.UUID) (func(), bool) {
+	release, ok := cfg.processingLocks.TryAcquire(videoID)
+	if !ok {
+		respondWithError(w, http.StatusConflict, "This video is already being processed", nil)
+		return nil, false
+	}
+	return release, true
+}
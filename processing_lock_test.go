@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestProcessingLocks(t *testing.T) {
+	locks := newProcessingLocks()
+	videoID := uuid.New()
+
+	release, ok := locks.TryAcquire(videoID)
+	if !ok {
+		t.Fatal("first acquire failed")
+	}
+	if _, ok := locks.TryAcquire(videoID); ok {
+		t.Error("second acquire of a held video succeeded")
+	}
+	if _, ok := locks.TryAcquire(uuid.New()); !ok {
+		t.Error("another video was blocked")
+	}
+	release()
+	if _, ok := locks.TryAcquire(videoID); !ok {
+		t.Error("acquire after release failed")
+	}
+}
+
+func TestConcurrentReprocessRejected(t *testing.T) {
+	cfg := newTestConfig(t)
+	installFakeMedia(t, &fakeMedia{Width: 1920, Height: 1080})
+	userID := createTestUser(t, cfg)
+	video := createTestVideo(t, cfg, userID, visibilityPublic)
+	if rec := uploadTestVideo(t, cfg, video.ID, userID, testMP4(256, 0)); rec.Code != http.StatusOK {
+		t.Fatalf("upload: got status %d: %s", rec.Code, rec.Body)
+	}
+
+	storage := &slowStorage{objectStorage: cfg.storage, entered: make(chan string, 8), release: make(chan struct{})}
+	cfg.storage = storage
+	first := make(chan int)
+	go func() {
+		rec := httptest.NewRecorder()
+		cfg.handlerVideoReprocess(rec, reprocessRequest(t, video.ID, userID))
+		first <- rec.Code
+	}()
+	select {
+	case <-storage.entered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("first reprocess never reached storage")
+	}
+
+	rec := httptest.NewRecorder()
+	cfg.handlerVideoReprocess(rec, reprocessRequest(t, video.ID, userID))
+	if rec.Code != http.StatusConflict {
+		t.Errorf("concurrent reprocess: got status %d, want 409", rec.Code)
+	}
+
+	close(storage.release)
+	if code := <-first; code != http.StatusOK {
+		t.Fatalf("first reprocess: got status %d", code)
+	}
+	rec = httptest.NewRecorder()
+	cfg.handlerVideoReprocess(rec, reprocessRequest(t, video.ID, userID))
+	if rec.Code != http.StatusOK {
+		t.Errorf("reprocess after the first finished: got status %d: %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultProcessingWorkers   = 2
+	defaultProcessingQueueSize = 16
+)
+
+var errProcessingQueueFull = errors.New("processing queue is full")
+
+// processingJob is an upload waiting for the pipeline. done releases what
+// the handler handed over: the video's processing lock and its temp files.
+type processingJob struct {
+	ID     uuid.UUID
+	video  database.Video
+	userID uuid.UUID
+	opts   uploadOptions
+	upload uploadedFile
+	done   func()
+}
+
+// processingQueue feeds uploads to a fixed pool of in-process workers, so
+// a request only has to last as long as the upload itself. Jobs don't
+// survive a restart; their videos are left "uploaded" until the claim
+// times out and they can be uploaded again.
+type processingQueue struct {
+	jobs chan processingJob
+
+	mu     sync.Mutex
+	active map[uuid.UUID]uuid.UUID // video ID -> job ID
+}
+
+func newProcessingQueue(size int) *processingQueue {
+	return &processingQueue{
+		jobs:   make(chan processingJob, size),
+		active: map[uuid.UUID]uuid.UUID{},
+	}
+}
+
+// Enqueue adds a job without blocking, returning false if the queue is
+// full.
+func (q *processingQueue) Enqueue(job processingJob) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	select {
+	case q.jobs <- job:
+		q.active[job.video.ID] = job.ID
+		return true
+	default:
+		return false
+	}
+}
+
+// JobID returns the ID of the queued or running job for a video.
+func (q *processingQueue) JobID(videoID uuid.UUID) (uuid.UUID, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	jobID, ok := q.active[videoID]
+	return jobID, ok
+}
+
+func (q *processingQueue) finish(job processingJob) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.active[job.video.ID] == job.ID {
+		delete(q.active, job.video.ID)
+	}
+}
+
+func (cfg *apiConfig) runProcessingWorkers(ctx context.Context, workers int) {
+	for range workers {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-cfg.processingQueue.jobs:
+					cfg.runProcessingJob(ctx, job)
+				}
+			}
+		}()
+	}
+}
+
+// runProcessingJob runs the pipeline with nowhere to send a response; the
+// outcome is recorded on the video's status for clients polling it.
+func (cfg *apiConfig) runProcessingJob(ctx context.Context, job processingJob) {
+	defer cfg.processingQueue.finish(job)
+	defer job.done()
+
+	rec := &discardResponseWriter{header: http.Header{}}
+	cfg.processUploadedVideo(ctx, rec, job.video, job.userID, job.opts, job.upload)
+	if rec.status >= http.StatusBadRequest {
+		log.Printf("Processing job %s for video %s failed with status %d", job.ID, job.video.ID, rec.status)
+	}
+}
+
+// dispatchUploadProcessing processes a claimed upload. With workers
+// configured it's queued and the client gets 202 with a job ID to poll
+// GET /api/videos/{videoID}/status with; it returns true when the job
+// has taken ownership of done. Otherwise it's processed inline and the
+// caller keeps ownership.
+func (cfg *apiConfig) dispatchUploadProcessing(w http.ResponseWriter, r *http.Request, video database.Video, userID uuid.UUID, opts uploadOptions, upload uploadedFile, done func()) bool {
+	type response struct {
+		JobID     uuid.UUID `json:"job_id"`
+		VideoID   uuid.UUID `json:"video_id"`
+		Status    string    `json:"status"`
+		StatusURL string    `json:"status_url"`
+	}
+
+	if cfg.processingQueue == nil {
+		cfg.processUploadedVideo(r.Context(), w, video, userID, opts, upload)
+		return false
+	}
+
+	job := processingJob{
+		ID:     cfg.uuidgen(),
+		video:  video,
+		userID: userID,
+		opts:   opts,
+		upload: upload,
+		done:   done,
+	}
+	if !cfg.processingQueue.Enqueue(job) {
+		// Clear the claim so the client can retry straight away.
+		cfg.setProcessingStatus(&video, processingStatusFailed, video.Progress, errProcessingQueueFull)
+		w.Header().Set("Retry-After", "30")
+		respondWithError(w, http.StatusServiceUnavailable, "Too many videos are being processed; try again shortly", nil)
+		return false
+	}
+
+	statusURL := fmt.Sprintf("/api/videos/%s/status", video.ID)
+	w.Header().Set("Location", statusURL)
+	respondWithJSON(w, http.StatusAccepted, response{
+		JobID:     job.ID,
+		VideoID:   video.ID,
+		Status:    video.Status,
+		StatusURL: statusURL,
+	})
+	return true
+}
+
+// discardResponseWriter stands in for the connection when a job runs after
+// the request has finished, keeping only the status code.
+type discardResponseWriter struct {
+	header http.Header
+	status int
+}
+
+func (d *discardResponseWriter) Header() http.Header { return d.header }
+
+func (d *discardResponseWriter) Write(b []byte) (int, error) {
+	if d.status == 0 {
+		d.status = http.StatusOK
+	}
+	return len(b), nil
+}
+
+func (d *discardResponseWriter) WriteHeader(status int) {
+	if d.status == 0 {
+		d.status = status
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+const (
+	processingStatusPending    = "pending"
+	processingStatusUploaded   = "uploaded"
+	processingStatusProcessing = "processing"
+	processingStatusReady      = "ready"
+	processingStatusFailed     = "failed"
+)
+
+// Processing stages recorded alongside failures.
+const (
+	processingStageProbe     = "probe"
+	processingStageValidate  = "validate"
+	processingStageMux       = "mux"
+	processingStageTranscode = "transcode"
+	processingStageUpload    = "upload"
+	processingStageStore     = "store"
+)
+
+const maxStoredProcessingErrors = 1000
+
+// defaultUploadClaimTimeout is how long an upload may go without a
+// progress update before another upload of the same video may take over.
+const defaultUploadClaimTimeout = time.Hour
+
+// setProcessingStatus persists a processing transition on both the row and
+// the in-memory video. Failing to record progress is logged rather than
+// returned: it shouldn't abort the pipeline it's describing.
+func (cfg *apiConfig) setProcessingStatus(video *database.Video, status string, progress int, procErr error) {
+	video.Status = status
+	video.Progress = progress
+	video.ProcessingError = nil
+	if procErr != nil {
+		msg := procErr.Error()
+		video.ProcessingError = &msg
+	}
+	err := cfg.db.UpdateVideoProcessing(video.ID, video.Status, video.Progress, video.ProcessingError)
+	if err != nil {
+		log.Printf("Couldn't record %s status for video %s: %v", status, video.ID, err)
+	}
+}
+
+// claimVideoUpload marks video as uploaded, responding 409 and returning
+// false if another upload of it is still being processed.
+func (cfg *apiConfig) claimVideoUpload(w http.ResponseWriter, video *database.Video) bool {
+	busy := []string{processingStatusUploaded, processingStatusProcessing}
+	claimed, err := cfg.db.ClaimVideoProcessing(video.ID, processingStatusUploaded, 5, busy, cfg.now().Add(-cfg.uploadClaimTimeout))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't record upload", err)
+		return false
+	}
+	if !claimed {
+		respondWithError(w, http.StatusConflict, "Another upload of this video is still processing", nil)
+		return false
+	}
+	video.Status = processingStatusUploaded
+	video.Progress = 5
+	video.ProcessingError = nil
+	return true
+}
+
+// recordProcessingError adds a failure to the capped admin error log.
+func (cfg *apiConfig) recordProcessingError(video database.Video, stage string, procErr error) {
+	err := cfg.db.RecordProcessingError(database.CreateProcessingErrorParams{
+		VideoID: video.ID,
+		UserID:  video.UserID,
+		Stage:   stage,
+		Error:   procErr.Error(),
+	}, maxStoredProcessingErrors)
+	if err != nil {
+		log.Printf("Couldn't record processing error for video %s: %v", video.ID, err)
+	}
+}
+
+func (cfg *apiConfig) saveVideoTimings(timings database.VideoTimings) {
+	if err := cfg.db.SaveVideoTimings(timings); err != nil {
+		log.Printf("Couldn't record processing timings for video %s: %v", timings.VideoID, err)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// slowStorage holds every Put until release is closed, signalling on
+// entered as each one starts while there's room in its buffer.
+type slowStorage struct {
+	objectStorage
+	entered chan string
+	release chan struct{}
+}
+
+func (s *slowStorage) Put(ctx context.Context, key string, body io.Reader, contentType, sum string) error {
+	select {
+	case s.entered <- key:
+	default:
+	}
+	<-s.release
+	return s.objectStorage.Put(ctx, key, body, contentType, sum)
+}
+
+func TestUploadRecordedBeforeProcessing(t *testing.T) {
+	cfg := newTestConfig(t)
+	installFakeMedia(t, &fakeMedia{Width: 1920, Height: 1080})
+	storage := &slowStorage{objectStorage: cfg.storage, entered: make(chan string, 8), release: make(chan struct{})}
+	cfg.storage = storage
+	cfg.processingQueue = newProcessingQueue(1)
+	userID := createTestUser(t, cfg)
+	video := createTestVideo(t, cfg, userID, visibilityPublic)
+
+	status := func() string {
+		t.Helper()
+		v, err := cfg.db.GetVideo(video.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v.Status
+	}
+
+	rec := uploadTestVideo(t, cfg, video.ID, userID, testMP4(256, 0))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("got status %d, want 202: %s", rec.Code, rec.Body)
+	}
+	if got := status(); got != processingStatusUploaded {
+		t.Fatalf("queued upload has status %q, want %q", got, processingStatusUploaded)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cfg.runProcessingWorkers(ctx, 1)
+	select {
+	case <-storage.entered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("processing never reached storage")
+	}
+	if got := status(); got == processingStatusReady {
+		t.Errorf("video is %q before its object was stored", got)
+	}
+
+	close(storage.release)
+	deadline := time.Now().Add(5 * time.Second)
+	for status() != processingStatusReady {
+		if time.Now().After(deadline) {
+			t.Fatalf("video is still %q after storage finished", status())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestQueuedProcessingKeepsConcurrentEdits(t *testing.T) {
+	cfg := newTestConfig(t)
+	installFakeMedia(t, &fakeMedia{Width: 1920, Height: 1080})
+	cfg.processingQueue = newProcessingQueue(1)
+	userID := createTestUser(t, cfg)
+	video := createTestVideo(t, cfg, userID, visibilityPublic)
+
+	rec := uploadTestVideo(t, cfg, video.ID, userID, testMP4(256, 0))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("got status %d, want 202: %s", rec.Code, rec.Body)
+	}
+
+	// Edit the video while its job waits in the queue.
+	edited, err := cfg.db.GetVideo(video.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	thumbnailURL := cfg.getObjectURL(cfg.uploadedThumbnailPrefix(video.ID) + "uploaded.jpg")
+	edited.ThumbnailURL = &thumbnailURL
+	edited.Title = "Edited while queued"
+	edited.Visibility = visibilityPrivate
+	if err := cfg.db.UpdateVideo(edited); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cfg.runProcessingWorkers(ctx, 1)
+	deadline := time.Now().Add(5 * time.Second)
+	var got database.Video
+	for {
+		got, err = cfg.db.GetVideo(video.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Status == processingStatusReady {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("video is still %q", got.Status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if got.ThumbnailURL == nil || *got.ThumbnailURL != thumbnailURL {
+		t.Errorf("thumbnail = %v, want the one set while queued", got.ThumbnailURL)
+	}
+	if got.Title != edited.Title || got.Visibility != visibilityPrivate {
+		t.Errorf("title %q visibility %q, want the edits made while queued", got.Title, got.Visibility)
+	}
+	if got.VideoURL == nil {
+		t.Error("processing didn't record the video URL")
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// makeProgressiveJPEG rewrites a baseline JPEG in place as a progressive
+// one. jpegtran re-packs the existing DCT coefficients, so this is lossless.
+func makeProgressiveJPEG(path string) error {
+	tmpPath := path + ".progressive"
+	cmd := exec.Command("jpegtran", "-progressive", "-optimize", "-copy", "all", "-outfile", tmpPath, path)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("error making progressive JPEG: %s, %v", stderr.String(), err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// jpegFrameType returns the start-of-frame marker of a JPEG: 0xC0 for
+// baseline, 0xC2 for progressive.
+func jpegFrameType(t *testing.T, data []byte) byte {
+	t.Helper()
+	for i := 2; i+3 < len(data); {
+		if data[i] != 0xFF {
+			t.Fatalf("bad JPEG marker at %d", i)
+		}
+		marker := data[i+1]
+		if marker >= 0xC0 && marker <= 0xCF && marker != 0xC4 && marker != 0xC8 && marker != 0xCC {
+			return marker
+		}
+		i += 2 + int(data[i+2])<<8 + int(data[i+3])
+	}
+	t.Fatal("no start-of-frame marker")
+	return 0
+}
+
+func TestThumbnailProgressiveJPEG(t *testing.T) {
+	tests := []struct {
+		name        string
+		progressive bool
+		want        byte
+	}{
+		{"baseline", false, 0xC0},
+		{"progressive", true, 0xC2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.progressive {
+				if _, err := exec.LookPath("jpegtran"); err != nil {
+					t.Skip("jpegtran not installed")
+				}
+			}
+			cfg := newTestConfig(t)
+			cfg.progressiveThumbnails = tt.progressive
+			installFakeMedia(t, &fakeMedia{Width: 1920, Height: 1080})
+
+			videoID := uuid.New()
+			_, err := cfg.storeGeneratedThumbnail(context.Background(), videoID, writeTestFile(t, testMP4(64, 0)), time.Second, 1920, 1080)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data := getTestObject(t, cfg, cfg.thumbnailKey(videoID))
+			if got := jpegFrameType(t, data); got != tt.want {
+				t.Errorf("frame marker 0x%X, want 0x%X", got, tt.want)
+			}
+		})
+	}
+}
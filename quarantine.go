@@ -0,0 +1,29 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+const (
+	quarantineDir        = "quarantine"
+	defaultQuarantineTag = "tubely-quarantine=true"
+)
+
+// isQuarantineKey reports whether key was built by videoKey for a
+// quarantined ("other") aspect: [shard/]quarantine/other/name.
+func isQuarantineKey(key string) bool {
+	parts := strings.Split(key, "/")
+	return len(parts) >= 3 && parts[len(parts)-3] == quarantineDir
+}
+
+// objectTagging returns the S3 tag set to store with key. Quarantined
+// objects carry cfg.quarantineTag so a bucket lifecycle rule filtered on
+// that tag can expire them; nothing else is tagged.
+func (cfg *apiConfig) objectTagging(key string) *string {
+	if cfg.quarantineTag == "" || !isQuarantineKey(key) {
+		return nil
+	}
+	return aws.String(cfg.quarantineTag)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestOtherAspectUploadQuarantined(t *testing.T) {
+	tests := []struct {
+		name           string
+		width, height  int
+		wantQuarantine bool
+	}{
+		{"other", 1000, 1333, true},
+		{"landscape", 1920, 1080, false},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, fake := newTestS3Config(t, "tubely", "")
+			cfg.quarantineOther = true
+			installFakeMedia(t, &fakeMedia{Width: tt.width, Height: tt.height})
+			userID := createTestUser(t, cfg)
+			video := createTestVideo(t, cfg, userID, visibilityPublic)
+
+			if rec := uploadTestVideo(t, cfg, video.ID, userID, testMP4(256, byte(i))); rec.Code != http.StatusOK {
+				t.Fatalf("upload: got status %d: %s", rec.Code, rec.Body)
+			}
+
+			key := latestVersionKey(t, cfg, video.ID)
+			if got := strings.HasPrefix(key, "quarantine/other/"); got != tt.wantQuarantine {
+				t.Errorf("key %s under quarantine = %v, want %v", key, got, tt.wantQuarantine)
+			}
+			obj, ok := fake.object("tubely", key)
+			if !ok {
+				t.Fatalf("no object at %s: %q", key, fake.keys("tubely"))
+			}
+			wantTag := ""
+			if tt.wantQuarantine {
+				wantTag = defaultQuarantineTag
+			}
+			if obj.tagging != wantTag {
+				t.Errorf("object tagging = %q, want %q", obj.tagging, wantTag)
+			}
+
+			stored, err := cfg.db.GetVideo(video.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.VideoURL == nil || *stored.VideoURL != cfg.videoURLRef(key) {
+				t.Errorf("stored video_url %v, want %q", stored.VideoURL, cfg.videoURLRef(key))
+			}
+			if stored.Aspect != tt.name {
+				t.Errorf("aspect %q, want %q", stored.Aspect, tt.name)
+			}
+		})
+	}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	uploadQuotaWindow = 24 * time.Hour
+	uploadRateWindow  = time.Hour
+)
+
+// uploadQuota is one per-user limit and how much of it is used, in bytes
+// or uploads depending on the quota. It's also the body of the error
+// returned when the limit is hit.
+type uploadQuota struct {
+	Error     string `json:"error"`
+	Name      string `json:"quota"`
+	Limit     int64  `json:"limit"`
+	Used      int64  `json:"used"`
+	Remaining int64  `json:"remaining"`
+	status    int
+}
+
+func newUploadQuota(name, msg string, status int, limit, used int64) *uploadQuota {
+	return &uploadQuota{
+		Error:     msg,
+		Name:      name,
+		Limit:     limit,
+		Used:      used,
+		Remaining: max(limit-used, 0),
+		status:    status,
+	}
+}
+
+// allows reports whether n more units fit in the quota. An empty quota
+// allows nothing, so uploads of unknown size can be turned away up front.
+func (q *uploadQuota) allows(n int64) bool {
+	return q.Remaining > 0 && n <= q.Remaining
+}
+
+// respondQuotaExceeded reports a quota that's been hit: 413 for stored
+// bytes, which only go down when videos are deleted, and 429 for the
+// windowed quotas that recover on their own.
+func respondQuotaExceeded(w http.ResponseWriter, q *uploadQuota) {
+	w.Header().Set("X-Upload-Quota-Remaining", strconv.FormatInt(q.Remaining, 10))
+	respondWithJSON(w, q.status, q)
+}
+
+// quotaExempt reports whether userID skips the upload quotas, either as an
+// admin or through QUOTA_EXEMPT_USER_IDS.
+func (cfg *apiConfig) quotaExempt(userID uuid.UUID) bool {
+	return cfg.isAdmin(userID) || cfg.quotaExemptUserIDs[userID]
+}
+
+// uploadByteQuota returns whichever byte quota leaves the user less room:
+// bytes uploaded in the rolling 24h window, or total bytes stored. Both
+// count the bytes reserved by uploads still in flight. It returns nil when
+// neither applies.
+func (cfg *apiConfig) uploadByteQuota(userID uuid.UUID) (*uploadQuota, error) {
+	if cfg.quotaExempt(userID) {
+		return nil, nil
+	}
+	var tightest *uploadQuota
+	if cfg.dailyUploadBytesQuota > 0 {
+		used, err := cfg.db.GetUploadedBytesSince(userID, cfg.now().Add(-uploadQuotaWindow))
+		if err != nil {
+			return nil, err
+		}
+		tightest = newUploadQuota("daily_upload_bytes", "Daily upload quota exceeded", http.StatusTooManyRequests, cfg.dailyUploadBytesQuota, used)
+	}
+	if cfg.storageBytesQuota > 0 {
+		stored, err := cfg.db.GetStoredBytes(userID)
+		if err != nil {
+			return nil, err
+		}
+		pending, err := cfg.db.GetPendingUploadBytes(userID)
+		if err != nil {
+			return nil, err
+		}
+		used := stored + pending
+		q := newUploadQuota("storage_bytes", "Storage quota exceeded", http.StatusRequestEntityTooLarge, cfg.storageBytesQuota, used)
+		if tightest == nil || q.Remaining < tightest.Remaining {
+			tightest = q
+		}
+	}
+	return tightest, nil
+}
+
+// hourlyUploadQuota returns the user's uploads in the last hour against
+// HOURLY_UPLOAD_LIMIT, or nil when it doesn't apply.
+func (cfg *apiConfig) hourlyUploadQuota(userID uuid.UUID) (*uploadQuota, error) {
+	if cfg.hourlyUploadLimit <= 0 || cfg.quotaExempt(userID) {
+		return nil, nil
+	}
+	used, err := cfg.db.CountUploadsSince(userID, cfg.now().Add(-uploadRateWindow))
+	if err != nil {
+		return nil, err
+	}
+	return newUploadQuota("hourly_uploads", "Hourly upload limit exceeded", http.StatusTooManyRequests, cfg.hourlyUploadLimit, used), nil
+}
+
+// checkUploadQuotas runs every quota that can be decided before an upload
+// is read. size is the declared upload size, or -1 when it isn't known yet.
+// It returns the byte quota so the caller can enforce it on the actual
+// body, and responds and returns false when a quota is already exceeded.
+func (cfg *apiConfig) checkUploadQuotas(w http.ResponseWriter, userID uuid.UUID, size int64) (*uploadQuota, bool) {
+	hourly, err := cfg.hourlyUploadQuota(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check upload quota", err)
+		return nil, false
+	}
+	if hourly != nil && !hourly.allows(1) {
+		respondQuotaExceeded(w, hourly)
+		return nil, false
+	}
+
+	quota, err := cfg.uploadByteQuota(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check upload quota", err)
+		return nil, false
+	}
+	if quota == nil {
+		return nil, true
+	}
+	w.Header().Set("X-Upload-Quota-Remaining", strconv.FormatInt(quota.Remaining, 10))
+	if !quota.allows(size) {
+		respondQuotaExceeded(w, quota)
+		return nil, false
+	}
+	return quota, true
+}
+
+// uploadReservation holds an in-flight upload's share of the quotas, so
+// uploads running in parallel can't each see the same remaining room. It's
+// committed with the real size once the upload is stored, and released if
+// it fails. A nil reservation does nothing.
+type uploadReservation struct {
+	cfg    *apiConfig
+	id     int64
+	userID uuid.UUID
+	bytes  int64
+	quota  *uploadQuota
+	done   bool
+}
+
+// reserveUploadQuota checks the quotas like checkUploadQuotas and reserves
+// the upload against them in the same step. With a byte quota, an upload
+// of unknown size holds all the room left until resize is called with its
+// real size.
+func (cfg *apiConfig) reserveUploadQuota(w http.ResponseWriter, userID uuid.UUID, size int64) (*uploadReservation, bool) {
+	return cfg.reserveUpload(w, userID, size, func() (*uploadQuota, bool) {
+		return cfg.checkUploadQuotas(w, userID, size)
+	})
+}
+
+// reserveUploadBytes is reserveUploadQuota without the hourly limit, for
+// uploads that were already counted against it when they started.
+func (cfg *apiConfig) reserveUploadBytes(w http.ResponseWriter, userID uuid.UUID, size int64) (*uploadReservation, bool) {
+	return cfg.reserveUpload(w, userID, size, func() (*uploadQuota, bool) {
+		quota, err := cfg.uploadByteQuota(userID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't check upload quota", err)
+			return nil, false
+		}
+		if quota != nil && !quota.allows(size) {
+			respondQuotaExceeded(w, quota)
+			return nil, false
+		}
+		return quota, true
+	})
+}
+
+func (cfg *apiConfig) reserveUpload(w http.ResponseWriter, userID uuid.UUID, size int64, check func() (*uploadQuota, bool)) (*uploadReservation, bool) {
+	cfg.quotaMu.Lock()
+	defer cfg.quotaMu.Unlock()
+
+	if err := cfg.db.ReleaseStaleUploadReservations(cfg.now().Add(-cfg.uploadClaimTimeout)); err != nil {
+		log.Printf("Couldn't release stale upload reservations: %v", err)
+	}
+	quota, ok := check()
+	if !ok {
+		return nil, false
+	}
+	bytes := max(size, 0)
+	if quota != nil && size < 0 {
+		bytes = min(quota.Remaining, maxUploadSize)
+	}
+	id, err := cfg.db.ReserveUpload(userID, bytes, cfg.now())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't reserve upload quota", err)
+		return nil, false
+	}
+	return &uploadReservation{cfg: cfg, id: id, userID: userID, bytes: bytes, quota: quota}, true
+}
+
+// limit is how many bytes the upload may send, or -1 with no byte quota.
+func (res *uploadReservation) limit() int64 {
+	if res == nil || res.quota == nil {
+		return -1
+	}
+	return res.bytes
+}
+
+// resize swaps the reserved size for the upload's real one. It responds
+// and returns false when the real size no longer fits.
+func (res *uploadReservation) resize(w http.ResponseWriter, bytes int64) bool {
+	if res == nil {
+		return true
+	}
+	cfg := res.cfg
+	cfg.quotaMu.Lock()
+	defer cfg.quotaMu.Unlock()
+
+	if res.quota != nil {
+		quota, err := cfg.uploadByteQuota(res.userID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't check upload quota", err)
+			return false
+		}
+		if quota != nil {
+			// The current usage includes this upload's reservation.
+			quota = newUploadQuota(quota.Name, quota.Error, quota.status, quota.Limit, quota.Used-res.bytes)
+			if !quota.allows(bytes) {
+				respondQuotaExceeded(w, quota)
+				return false
+			}
+		}
+	}
+	if err := cfg.db.ResizeUploadReservation(res.id, bytes); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't reserve upload quota", err)
+		return false
+	}
+	res.bytes = bytes
+	return true
+}
+
+// commit records the stored upload at its real size.
+func (res *uploadReservation) commit(bytes int64) {
+	if res == nil || res.done {
+		return
+	}
+	res.done = true
+	cfg := res.cfg
+	committed, err := cfg.db.CommitUploadReservation(res.id, bytes)
+	if err == nil && !committed {
+		// The reservation outlived UPLOAD_CLAIM_TIMEOUT and was dropped,
+		// but the upload still counts.
+		err = cfg.db.RecordUpload(res.userID, bytes, cfg.now())
+	}
+	if err != nil {
+		log.Printf("Couldn't record upload usage for user %s: %v", res.userID, err)
+	}
+}
+
+// release gives the room back after a failed upload. It does nothing once
+// the reservation is committed, so it can be deferred.
+func (res *uploadReservation) release() {
+	if res == nil || res.done {
+		return
+	}
+	res.done = true
+	if err := res.cfg.db.ReleaseUploadReservation(res.id); err != nil {
+		log.Printf("Couldn't release upload reservation for user %s: %v", res.userID, err)
+	}
+}
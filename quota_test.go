@@ -0,0 +1,141 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestDailyUploadQuota(t *testing.T) {
+	cfg := newTestConfig(t)
+	installFakeMedia(t, &fakeMedia{Width: 1920, Height: 1080})
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	setTestClock(cfg, func() time.Time { return now })
+	userID := createTestUser(t, cfg)
+	video := createTestVideo(t, cfg, userID, visibilityPublic)
+
+	upload := func(seed byte) int {
+		t.Helper()
+		rec := uploadTestVideo(t, cfg, video.ID, userID, testMP4(1000, seed))
+		return rec.Code
+	}
+	cfg.dailyUploadBytesQuota = 1500
+
+	if code := upload(1); code != http.StatusOK {
+		t.Fatalf("first upload: got status %d, want 200", code)
+	}
+	if code := upload(2); code != http.StatusTooManyRequests {
+		t.Fatalf("upload over the daily quota: got status %d, want 429", code)
+	}
+
+	now = now.Add(uploadQuotaWindow + time.Minute)
+	if code := upload(3); code != http.StatusOK {
+		t.Fatalf("upload after the window: got status %d, want 200", code)
+	}
+}
+
+func TestParallelReservationsShareQuota(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.dailyUploadBytesQuota = 1500
+	userID := createTestUser(t, cfg)
+
+	const uploads = 8
+	var mu sync.Mutex
+	var granted []*uploadReservation
+	var wg sync.WaitGroup
+	for range uploads {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, ok := cfg.reserveUploadQuota(httptest.NewRecorder(), userID, 1000)
+			if ok {
+				mu.Lock()
+				granted = append(granted, res)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if len(granted) != 1 {
+		t.Fatalf("%d of %d parallel 1000-byte uploads were reserved against a 1500-byte quota, want 1", len(granted), uploads)
+	}
+
+	granted[0].release()
+	res, ok := cfg.reserveUploadQuota(httptest.NewRecorder(), userID, 1000)
+	if !ok {
+		t.Fatal("released room wasn't given back")
+	}
+	res.commit(1000)
+	rec := httptest.NewRecorder()
+	if _, ok := cfg.reserveUploadQuota(rec, userID, 1000); ok {
+		t.Error("committed upload didn't count against the quota")
+	}
+	got := decodeJSON[uploadQuota](t, rec)
+	if rec.Code != http.StatusTooManyRequests || got.Name != "daily_upload_bytes" || got.Used != 1000 || got.Remaining != 500 {
+		t.Errorf("got %d %+v, want 429 with 1000 used and 500 remaining", rec.Code, got)
+	}
+}
+
+func TestStaleReservationReleased(t *testing.T) {
+	cfg := newTestConfig(t)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	setTestClock(cfg, func() time.Time { return now })
+	cfg.storageBytesQuota = 1000
+	userID := createTestUser(t, cfg)
+
+	if _, ok := cfg.reserveUploadQuota(httptest.NewRecorder(), userID, 800); !ok {
+		t.Fatal("first reservation failed")
+	}
+	rec := httptest.NewRecorder()
+	if _, ok := cfg.reserveUploadQuota(rec, userID, 800); ok || rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("reservation over the in-flight one: got status %d, want 413", rec.Code)
+	}
+
+	// The first upload never finished; past the claim timeout its room is
+	// given back.
+	now = now.Add(cfg.uploadClaimTimeout + time.Minute)
+	if _, ok := cfg.reserveUploadQuota(httptest.NewRecorder(), userID, 800); !ok {
+		t.Error("stale reservation still held the quota")
+	}
+}
+
+func TestHourlyUploadLimit(t *testing.T) {
+	cfg := newTestConfig(t)
+	installFakeMedia(t, &fakeMedia{Width: 1920, Height: 1080})
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	setTestClock(cfg, func() time.Time { return now })
+	cfg.hourlyUploadLimit = 1
+	userID := createTestUser(t, cfg)
+	exemptID := createTestUser(t, cfg)
+	cfg.quotaExemptUserIDs = map[uuid.UUID]bool{exemptID: true}
+
+	upload := func(userID uuid.UUID, seed byte) *httptest.ResponseRecorder {
+		t.Helper()
+		video := createTestVideo(t, cfg, userID, visibilityPublic)
+		return uploadTestVideo(t, cfg, video.ID, userID, testMP4(256, seed))
+	}
+	if rec := upload(userID, 0); rec.Code != http.StatusOK {
+		t.Fatalf("first upload: got status %d: %s", rec.Code, rec.Body)
+	}
+	rec := upload(userID, 1)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("second upload in the hour: got status %d, want 429", rec.Code)
+	}
+	if got := decodeJSON[uploadQuota](t, rec); got.Name != "hourly_uploads" || got.Limit != 1 || got.Remaining != 0 {
+		t.Errorf("got %+v, want the hourly_uploads quota exhausted", got)
+	}
+	for seed := range byte(2) {
+		if rec := upload(exemptID, 10+seed); rec.Code != http.StatusOK {
+			t.Errorf("exempt user's upload %d: got status %d", seed+1, rec.Code)
+		}
+	}
+
+	now = now.Add(uploadRateWindow + time.Minute)
+	if rec := upload(userID, 2); rec.Code != http.StatusOK {
+		t.Errorf("upload after the window: got status %d: %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+const rateLimiterCapacity = 10000
+
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+// rateLimiter allows up to limit events per key in each fixed window. Keys
+// live in a bounded cache so idle clients don't accumulate.
+type rateLimiter struct {
+	mu      sync.Mutex
+	limit   int
+	window  time.Duration
+	now     func() time.Time
+	windows *cache[string, rateWindow]
+}
+
+func newRateLimiter(limit int, window time.Duration, now func() time.Time) *rateLimiter {
+	return &rateLimiter{
+		limit:   limit,
+		window:  window,
+		now:     now,
+		windows: newCache[string, rateWindow](rateLimiterCapacity, window, now),
+	}
+}
+
+func (l *rateLimiter) Allow(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	w, ok := l.windows.Get(key)
+	if !ok || now.Sub(w.start) >= l.window {
+		w = rateWindow{start: now}
+	}
+	if w.count >= l.limit {
+		return false
+	}
+	w.count++
+	l.windows.Set(key, w)
+	return true
+}
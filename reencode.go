@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+const (
+	reencodeAudioBitrate    = 128_000
+	minReencodeVideoBitrate = 200_000
+)
+
+// targetVideoBitrate picks the video bitrate (bits/s) that lands a file of
+// the given duration near targetBytes, leaving room for a fixed audio track.
+func targetVideoBitrate(targetBytes int64, durationSec float64, hasAudio bool) int64 {
+	if durationSec <= 0 {
+		return minReencodeVideoBitrate
+	}
+	bitrate := int64(float64(targetBytes*8) / durationSec)
+	if hasAudio {
+		bitrate -= reencodeAudioBitrate
+	}
+	return max(bitrate, minReencodeVideoBitrate)
+}
+
+// reencodeToTarget shrinks filePath toward targetBytes with a bitrate-capped
+// x264 pass. If the result isn't actually smaller the original is kept and
+// ok is false.
+func (cfg *apiConfig) reencodeToTarget(ctx context.Context, filePath string, probe videoProbe, targetBytes int64, pixFmt string) (outputPath string, ok bool, err error) {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return "", false, err
+	}
+
+	ctx, cancel := cfg.withCommandTimeout(ctx)
+	defer cancel()
+	bitrate := targetVideoBitrate(targetBytes, probe.DurationSec, probe.HasAudio)
+	outputPath = fmt.Sprintf("%s.reencoded.mp4", filePath)
+	args := []string{
+		"-i", filePath,
+		"-map", "0:v:0", "-map", "0:a?",
+		"-c:v", "libx264", "-preset", "medium", "-pix_fmt", pixFmt,
+		"-b:v", strconv.FormatInt(bitrate, 10),
+		"-maxrate", strconv.FormatInt(bitrate, 10),
+		"-bufsize", strconv.FormatInt(bitrate*2, 10),
+		"-c:a", "aac", "-b:a", strconv.Itoa(reencodeAudioBitrate),
+		"-movflags", "faststart",
+		"-y", outputPath,
+	}
+	cmd := cfg.ffmpegCommand(ctx, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		os.Remove(outputPath)
+		return "", false, commandFailed(ctx, "error re-encoding video", stderr.String(), err)
+	}
+
+	outInfo, err := os.Stat(outputPath)
+	if err != nil {
+		os.Remove(outputPath)
+		return "", false, fmt.Errorf("could not stat re-encoded file: %v", err)
+	}
+	if outInfo.Size() == 0 || outInfo.Size() >= info.Size() {
+		os.Remove(outputPath)
+		return "", false, nil
+	}
+	return outputPath, true, nil
+}
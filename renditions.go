@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+type rendition struct {
+	Name         string
+	Height       int
+	VideoBitrate string
+	AudioBitrate string
+}
+
+// renditionLadder lists the qualities produced for adaptive playback, from
+// lowest to highest.
+var renditionLadder = []rendition{
+	{Name: "480p", Height: 480, VideoBitrate: "1400k", AudioBitrate: "128k"},
+	{Name: "720p", Height: 720, VideoBitrate: "2800k", AudioBitrate: "128k"},
+	{Name: "1080p", Height: 1080, VideoBitrate: "5000k", AudioBitrate: "192k"},
+}
+
+func findRendition(name string) (rendition, bool) {
+	for _, r := range renditionLadder {
+		if r.Name == name {
+			return r, true
+		}
+	}
+	return rendition{}, false
+}
+
+func (cfg *apiConfig) hlsPrefix(videoID uuid.UUID) string {
+	return fmt.Sprintf("%shls/%s/", cfg.shardPrefix(videoID), videoID)
+}
+
+func (cfg *apiConfig) renditionKey(videoID uuid.UUID, quality string) string {
+	return fmt.Sprintf("%s%s/index.m3u8", cfg.hlsPrefix(videoID), quality)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+var regionPattern = regexp.MustCompile(`^[a-z]{2}(-[a-z]+)+-\d+$`)
+
+// validateS3Settings catches the misconfigurations that otherwise only show
+// up as confusing errors on the first request. The region is only checked
+// against the AWS naming scheme without a custom endpoint, since
+// S3-compatible services use their own names ("auto" on R2, whatever a
+// MinIO deployment was configured with).
+func validateS3Settings(region, bucket, endpoint string) error {
+	if strings.TrimSpace(region) == "" {
+		return errors.New("S3 region is empty")
+	}
+	if endpoint == "" && !regionPattern.MatchString(region) {
+		return fmt.Errorf("S3 region %q doesn't look like an AWS region (e.g. us-east-1)", region)
+	}
+	if strings.TrimSpace(bucket) == "" {
+		return errors.New("S3 bucket is empty")
+	}
+	if endpoint != "" {
+		u, err := url.Parse(endpoint)
+		if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("S3 endpoint %q must be an absolute http(s) URL", endpoint)
+		}
+	}
+	return nil
+}
+
+// newS3Client builds the client with the region pinned explicitly rather
+// than whatever the ambient AWS config resolves to. endpoint optionally
+// points the client at an S3-compatible service; most of those (MinIO,
+// for one) only serve path-style bucket URLs.
+func newS3Client(ctx context.Context, region, bucket, endpoint string, pathStyle bool) (*s3.Client, error) {
+	if err := validateS3Settings(region, bucket, endpoint); err != nil {
+		return nil, err
+	}
+
+	awsCfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+	if err != nil {
+		return nil, fmt.Errorf("couldn't load AWS config: %w", err)
+	}
+
+	return s3.NewFromConfig(awsCfg, func(o *s3.Options) {
+		o.Region = region
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+		}
+		o.UsePathStyle = pathStyle
+	}), nil
+}
+
+type bucketLocationGetter interface {
+	GetBucketLocation(ctx context.Context, params *s3.GetBucketLocationInput, optFns ...func(*s3.Options)) (*s3.GetBucketLocationOutput, error)
+}
+
+var errBucketRegionMismatch = errors.New("bucket region doesn't match client region")
+
+// bucketRegion normalizes a GetBucketLocation constraint: buckets in
+// us-east-1 report an empty constraint and old EU buckets report "EU".
+func bucketRegion(constraint types.BucketLocationConstraint) string {
+	switch constraint {
+	case "":
+		return "us-east-1"
+	case types.BucketLocationConstraintEu:
+		return "eu-west-1"
+	}
+	return string(constraint)
+}
+
+// checkBucketRegion compares the bucket's actual region with the one the
+// client is configured for. Cross-region requests work but are slow and
+// billed as data transfer, so a mismatch is worth flagging at startup.
+func checkBucketRegion(ctx context.Context, client bucketLocationGetter, bucket, region string) error {
+	out, err := client.GetBucketLocation(ctx, &s3.GetBucketLocationInput{
+		Bucket: aws.String(bucket),
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't get location of bucket %s: %w", bucket, err)
+	}
+	if actual := bucketRegion(out.LocationConstraint); actual != region {
+		return fmt.Errorf("%w: bucket %s is in %s, client uses %s", errBucketRegionMismatch, bucket, actual, region)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func TestValidateS3Settings(t *testing.T) {
+	tests := []struct {
+		name     string
+		region   string
+		bucket   string
+		endpoint string
+		wantErr  bool
+	}{
+		{"valid", "us-east-1", "tubely", "", false},
+		{"valid with endpoint", "eu-central-1", "tubely", "http://localhost:9000", false},
+		{"empty region", "", "tubely", "", true},
+		{"blank region", "  ", "tubely", "", true},
+		{"malformed region", "useast1", "tubely", "", true},
+		{"non-AWS region without endpoint", "auto", "tubely", "", true},
+		{"R2 region with endpoint", "auto", "tubely", "https://account.r2.cloudflarestorage.com", false},
+		{"custom MinIO region with endpoint", "home-lab", "tubely", "http://localhost:9000", false},
+		{"empty region with endpoint", "", "tubely", "http://localhost:9000", true},
+		{"empty bucket", "us-east-1", "", "", true},
+		{"relative endpoint", "us-east-1", "tubely", "localhost:9000", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateS3Settings(tt.region, tt.bucket, tt.endpoint)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateS3Settings(%q, %q, %q) = %v, want error %v", tt.region, tt.bucket, tt.endpoint, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewS3ClientRequiresRegion(t *testing.T) {
+	t.Setenv("AWS_REGION", "us-west-2")
+	if _, err := newS3Client(context.Background(), "", "tubely", "", false); err == nil {
+		t.Error("newS3Client with an empty region succeeded, want a startup error")
+	}
+
+	client, err := newS3Client(context.Background(), "eu-west-1", "tubely", "", false)
+	if err != nil {
+		t.Fatalf("newS3Client: %v", err)
+	}
+	if got := client.Options().Region; got != "eu-west-1" {
+		t.Errorf("client region %q, want the configured eu-west-1 over the environment", got)
+	}
+}
+
+type fakeLocationGetter struct {
+	constraint types.BucketLocationConstraint
+	err        error
+}
+
+func (f fakeLocationGetter) GetBucketLocation(ctx context.Context, params *s3.GetBucketLocationInput, optFns ...func(*s3.Options)) (*s3.GetBucketLocationOutput, error) {
+	return &s3.GetBucketLocationOutput{LocationConstraint: f.constraint}, f.err
+}
+
+func TestCheckBucketRegion(t *testing.T) {
+	tests := []struct {
+		name         string
+		getter       fakeLocationGetter
+		region       string
+		wantMismatch bool
+		wantErr      bool
+	}{
+		{"match", fakeLocationGetter{constraint: "eu-west-2"}, "eu-west-2", false, false},
+		{"us-east-1 reports empty", fakeLocationGetter{}, "us-east-1", false, false},
+		{"legacy EU", fakeLocationGetter{constraint: types.BucketLocationConstraintEu}, "eu-west-1", false, false},
+		{"mismatch", fakeLocationGetter{constraint: "ap-south-1"}, "us-east-1", true, true},
+		{"lookup fails", fakeLocationGetter{err: errors.New("access denied")}, "us-east-1", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkBucketRegion(context.Background(), tt.getter, "tubely", tt.region)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkBucketRegion = %v, want error %v", err, tt.wantErr)
+			}
+			if got := errors.Is(err, errBucketRegionMismatch); got != tt.wantMismatch {
+				t.Errorf("mismatch = %v (%v), want %v", got, err, tt.wantMismatch)
+			}
+		})
+	}
+}
+
+func TestCheckBucketRegionAgainstEndpoint(t *testing.T) {
+	cfg, fake := newTestS3Config(t, "tubely", "")
+	fake.location = "eu-central-1"
+	err := checkBucketRegion(context.Background(), cfg.s3Client, cfg.s3Bucket, cfg.s3Region)
+	if !errors.Is(err, errBucketRegionMismatch) {
+		t.Errorf("checkBucketRegion = %v, want errBucketRegionMismatch", err)
+	}
+}
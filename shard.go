@@ -0,0 +1,41 @@
+package main
+
+import (
+	"path"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+const shardPrefixLen = 2
+
+// shardPrefix returns the leading path segment used to spread a video's
+// objects across S3 prefixes, or "" when sharding is off. Video IDs are
+// random, so their first hex characters distribute evenly.
+func (cfg *apiConfig) shardPrefix(videoID uuid.UUID) string {
+	if !cfg.shardKeys {
+		return ""
+	}
+	return videoID.String()[:shardPrefixLen] + "/"
+}
+
+// videoKey builds the object key for a video file: [shard/]aspect/name.
+// Every upload and move goes through here and the result is stored on the
+// version row, so reads always use the key the object was written under.
+// With quarantine on, "other" videos go under [shard/]quarantine/other/.
+func (cfg *apiConfig) videoKey(videoID uuid.UUID, aspect, name string) string {
+	if cfg.quarantineOther && aspect == "other" {
+		return cfg.shardPrefix(videoID) + path.Join(quarantineDir, aspect, name)
+	}
+	return cfg.shardPrefix(videoID) + path.Join(aspect, name)
+}
+
+// splitVideoKey undoes videoKey for keys written with or without a shard
+// prefix.
+func splitVideoKey(key string) (aspect, name string) {
+	parts := strings.Split(key, "/")
+	if len(parts) < 2 {
+		return "", key
+	}
+	return parts[len(parts)-2], parts[len(parts)-1]
+}
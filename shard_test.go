@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestVideoKeySharding(t *testing.T) {
+	cfg := newTestConfig(t)
+	videoID := uuid.MustParse("3fa85f64-5717-4562-b3fc-2c963f66afa6")
+
+	if got := cfg.videoKey(videoID, "landscape", "a.mp4"); got != "landscape/a.mp4" {
+		t.Errorf("unsharded key = %q, want landscape/a.mp4", got)
+	}
+
+	cfg.shardKeys = true
+	for range 2 {
+		if got := cfg.videoKey(videoID, "landscape", "a.mp4"); got != "3f/landscape/a.mp4" {
+			t.Errorf("sharded key = %q, want 3f/landscape/a.mp4", got)
+		}
+	}
+	if got := cfg.thumbnailKey(videoID); got != "3f/thumbnails/"+videoID.String()+".jpg" {
+		t.Errorf("sharded thumbnail key = %q", got)
+	}
+	if got := cfg.hlsPrefix(videoID); got != "3f/hls/"+videoID.String()+"/" {
+		t.Errorf("sharded HLS prefix = %q", got)
+	}
+	if aspect, name := splitVideoKey("3f/landscape/a.mp4"); aspect != "landscape" || name != "a.mp4" {
+		t.Errorf("splitVideoKey = %q, %q, want landscape, a.mp4", aspect, name)
+	}
+}
+
+func TestShardedKeyUsedByEveryOperation(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.shardKeys = true
+	installFakeMedia(t, &fakeMedia{Width: 1920, Height: 1080})
+	userID := createTestUser(t, cfg)
+	video := createTestVideo(t, cfg, userID, visibilityPublic)
+
+	rec := uploadTestVideo(t, cfg, video.ID, userID, testMP4(512, 0))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("upload: got status %d: %s", rec.Code, rec.Body)
+	}
+	key := latestVersionKey(t, cfg, video.ID)
+	if want := video.ID.String()[:2] + "/landscape/"; !strings.HasPrefix(key, want) {
+		t.Fatalf("stored under %q, want prefix %q", key, want)
+	}
+
+	signedQuery(t, cfg, *decodeJSON[database.Video](t, rec).VideoURL, key)
+
+	rec = httptest.NewRecorder()
+	cfg.handlerVideoStream(rec, streamRequest(t, video.ID, userID))
+	if rec.Code != http.StatusOK {
+		t.Errorf("stream: got status %d", rec.Code)
+	}
+
+	if _, err := cfg.storage.Stat(context.Background(), cfg.thumbnailKey(video.ID)); err != nil {
+		t.Errorf("generated thumbnail isn't under the sharded key: %v", err)
+	}
+
+	rec = httptest.NewRecorder()
+	cfg.handlerVideoMetaDelete(rec, videoActionRequest(t, http.MethodDelete, "", video.ID, userID))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("delete: got status %d: %s", rec.Code, rec.Body)
+	}
+	for _, k := range []string{key, cfg.thumbnailKey(video.ID)} {
+		if _, err := cfg.storage.Stat(context.Background(), k); !errors.Is(err, errObjectNotFound) {
+			t.Errorf("Stat %s after delete = %v, want errObjectNotFound", k, err)
+		}
+	}
+}
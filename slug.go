@@ -0,0 +1,75 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	maxSlugLen   = 60
+	shortIDBytes = 6
+)
+
+// slugify turns a title into a lowercase, hyphen-separated ASCII string
+// that is safe to use in an object key. Accented letters are folded to
+// their base letter and anything else outside [a-z0-9] becomes a separator.
+// The result is cut at a word boundary when it exceeds maxSlugLen.
+func slugify(title string) string {
+	var b strings.Builder
+	pendingHyphen := false
+	for _, r := range norm.NFKD.String(title) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			// combining marks left over from decomposing accented letters
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			if pendingHyphen && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			pendingHyphen = false
+			b.WriteRune(unicode.ToLower(r))
+		default:
+			pendingHyphen = true
+		}
+	}
+
+	slug := b.String()
+	if len(slug) > maxSlugLen {
+		slug = slug[:maxSlugLen]
+		if i := strings.LastIndexByte(slug, '-'); i > 0 {
+			slug = slug[:i]
+		}
+		slug = strings.Trim(slug, "-")
+	}
+	return slug
+}
+
+func shortID() string {
+	b := make([]byte, shortIDBytes)
+	if _, err := rand.Read(b); err != nil {
+		panic("failed to generate random bytes")
+	}
+	return hex.EncodeToString(b)
+}
+
+// videoObjectName picks the file name part of a new video's key. With
+// includeTitleInKey it is "{slug}-{shortid}.ext" so keys are readable while
+// the short id keeps them unique; otherwise it's the usual random name.
+func (cfg *apiConfig) videoObjectName(title, mediaType string) (string, error) {
+	if !cfg.includeTitleInKey {
+		return getAssetPath(mediaType)
+	}
+	ext, err := mediaTypeToExt(mediaType)
+	if err != nil {
+		return "", err
+	}
+	slug := slugify(title)
+	if slug == "" {
+		return fmt.Sprintf("%s%s", shortID(), ext), nil
+	}
+	return fmt.Sprintf("%s-%s%s", slug, shortID(), ext), nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestSlugify(t *testing.T) {
+	tests := []struct {
+		title string
+		want  string
+	}{
+		{"Hello World", "hello-world"},
+		{"Café Crème Brûlée", "cafe-creme-brulee"},
+		{"🎉 Party Time 🎉", "party-time"},
+		{"  --Multiple   spaces__and___underscores--  ", "multiple-spaces-and-underscores"},
+		{"Ｆｕｌｌｗｉｄｔｈ Ｔｅｘｔ", "fullwidth-text"},
+		{"Part 2: The Sequel (2024)", "part-2-the-sequel-2024"},
+		{"../../etc/passwd", "etc-passwd"},
+		{"🎬🎬🎬", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := slugify(tt.title); got != tt.want {
+			t.Errorf("slugify(%q) = %q, want %q", tt.title, got, tt.want)
+		}
+	}
+}
+
+func TestSlugifyLongTitle(t *testing.T) {
+	title := strings.Repeat("Extraordinarily ", 10)
+	got := slugify(title)
+	if len(got) > maxSlugLen {
+		t.Errorf("slug is %d bytes, want at most %d", len(got), maxSlugLen)
+	}
+	if !regexp.MustCompile(`^extraordinarily(-extraordinarily)*$`).MatchString(got) {
+		t.Errorf("slugify cut %q mid-word or left a stray hyphen", got)
+	}
+}
+
+func TestVideoObjectNameWithTitle(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.includeTitleInKey = true
+	pattern := regexp.MustCompile(`^my-holiday-video-[0-9a-f]{12}\.mp4$`)
+
+	first, err := cfg.videoObjectName("My Holiday Video!", "video/mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := cfg.videoObjectName("My Holiday Video!", "video/mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{first, second} {
+		if !pattern.MatchString(name) {
+			t.Errorf("object name %q doesn't match %s", name, pattern)
+		}
+	}
+	if first == second {
+		t.Errorf("two videos with the same title both got %q", first)
+	}
+
+	if name, err := cfg.videoObjectName("🎬", "video/mp4"); err != nil || !regexp.MustCompile(`^[0-9a-f]{12}\.mp4$`).MatchString(name) {
+		t.Errorf("title with no slug: got %q, %v, want just the short id", name, err)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"path/filepath"
+	"strings"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+const (
+	spriteCellWidth  = 160
+	spriteCellHeight = 90
+	spriteColumns    = 10
+)
+
+type spriteCell struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// composeSprite lays images out left to right, top to bottom in fixed-size
+// cells, scaling each one to fit its cell without distorting it. The cells
+// are returned in the same order as imgs.
+func composeSprite(imgs []image.Image, cellWidth, cellHeight, columns int) (*image.RGBA, []spriteCell) {
+	if len(imgs) == 0 {
+		return image.NewRGBA(image.Rect(0, 0, 0, 0)), nil
+	}
+	cols := min(columns, len(imgs))
+	rows := (len(imgs) + cols - 1) / cols
+	sprite := image.NewRGBA(image.Rect(0, 0, cols*cellWidth, rows*cellHeight))
+	xdraw.Draw(sprite, sprite.Bounds(), image.NewUniform(color.Black), image.Point{}, xdraw.Src)
+
+	cells := make([]spriteCell, 0, len(imgs))
+	for i, img := range imgs {
+		cell := spriteCell{
+			X:      (i % cols) * cellWidth,
+			Y:      (i / cols) * cellHeight,
+			Width:  cellWidth,
+			Height: cellHeight,
+		}
+		cells = append(cells, cell)
+
+		src := img.Bounds()
+		if src.Dx() == 0 || src.Dy() == 0 {
+			continue
+		}
+		w, h := cellWidth, src.Dy()*cellWidth/src.Dx()
+		if h > cellHeight {
+			w, h = src.Dx()*cellHeight/src.Dy(), cellHeight
+		}
+		x := cell.X + (cellWidth-w)/2
+		y := cell.Y + (cellHeight-h)/2
+		xdraw.ApproxBiLinear.Scale(sprite, image.Rect(x, y, x+w, y+h), img, src, xdraw.Over, nil)
+	}
+	return sprite, cells
+}
+
+// loadThumbnailImage decodes a video's thumbnail from the object store, or
+// from the assets root for ones uploaded there by older releases.
+func (cfg *apiConfig) loadThumbnailImage(ctx context.Context, thumbnailURL string) (image.Image, error) {
+	key, ok := cfg.thumbnailObjectKey(thumbnailURL)
+	if !ok {
+		path, err := cfg.thumbnailDiskPath(thumbnailURL)
+		if err != nil {
+			return nil, err
+		}
+		return decodeImageFile(path)
+	}
+	body, err := cfg.storage.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	img, _, err := image.Decode(body)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode image: %v", err)
+	}
+	return img, nil
+}
+
+// thumbnailDiskPath maps a thumbnail URL handed out by getAssetURL back to
+// the file under the assets root.
+func (cfg apiConfig) thumbnailDiskPath(thumbnailURL string) (string, error) {
+	prefix := cfg.getAssetURL("")
+	if !strings.HasPrefix(thumbnailURL, prefix) {
+		return "", fmt.Errorf("thumbnail %q isn't a local asset", thumbnailURL)
+	}
+	assetPath := strings.TrimPrefix(thumbnailURL, prefix)
+	if assetPath == "" || assetPath != filepath.Base(assetPath) {
+		return "", fmt.Errorf("invalid thumbnail path %q", assetPath)
+	}
+	return cfg.getAssetDiskPath(assetPath), nil
+}
+
+func decodeImageFile(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode image: %v", err)
+	}
+	return img, nil
+}
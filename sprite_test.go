@@ -0,0 +1,63 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func solidImage(w, h int, c color.Color) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), image.NewUniform(c), image.Point{}, draw.Src)
+	return img
+}
+
+func TestComposeSpriteTwoThumbnails(t *testing.T) {
+	red := color.RGBA{R: 255, A: 255}
+	blue := color.RGBA{B: 255, A: 255}
+	imgs := []image.Image{solidImage(320, 180, red), solidImage(90, 160, blue)}
+
+	sprite, cells := composeSprite(imgs, 160, 90, 10)
+
+	if got := sprite.Bounds().Size(); got != image.Pt(320, 90) {
+		t.Errorf("sprite is %v, want 320x90", got)
+	}
+	want := []spriteCell{
+		{X: 0, Y: 0, Width: 160, Height: 90},
+		{X: 160, Y: 0, Width: 160, Height: 90},
+	}
+	if len(cells) != len(want) {
+		t.Fatalf("got %d cells, want %d", len(cells), len(want))
+	}
+	for i := range want {
+		if cells[i] != want[i] {
+			t.Errorf("cell %d = %+v, want %+v", i, cells[i], want[i])
+		}
+	}
+
+	// Each thumbnail lands in its own cell; the portrait one is letterboxed.
+	if got := sprite.RGBAAt(80, 45); got != red {
+		t.Errorf("centre of cell 0 is %v, want red", got)
+	}
+	if got := sprite.RGBAAt(240, 45); got != blue {
+		t.Errorf("centre of cell 1 is %v, want blue", got)
+	}
+	if got := sprite.RGBAAt(165, 45); got != (color.RGBA{A: 255}) {
+		t.Errorf("letterbox of cell 1 is %v, want black", got)
+	}
+}
+
+func TestComposeSpriteWrapsRows(t *testing.T) {
+	imgs := make([]image.Image, 5)
+	for i := range imgs {
+		imgs[i] = solidImage(16, 9, color.White)
+	}
+	sprite, cells := composeSprite(imgs, 16, 9, 2)
+	if got := sprite.Bounds().Size(); got != image.Pt(32, 27) {
+		t.Errorf("sprite is %v, want 32x27", got)
+	}
+	if last := cells[4]; last.X != 0 || last.Y != 18 {
+		t.Errorf("fifth cell at (%d, %d), want (0, 18)", last.X, last.Y)
+	}
+}
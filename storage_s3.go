@@ -0,0 +1,451 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// s3Storage keeps objects in an S3 bucket, or any S3-compatible store
+// reached through S3_ENDPOINT. With a staging bucket, uploads land there
+// first and are only copied into the bucket once they check out, so a
+// failed or partial upload never appears in production. tagging supplies
+// the object tags for a key, and distribution is the CDN base URL plain
+// object URLs are built on.
+type s3Storage struct {
+	client        *s3.Client
+	uploader      *manager.Uploader
+	bucket        string
+	stagingBucket string
+	distribution  string
+	tagging       func(key string) *string
+}
+
+func (s *s3Storage) Put(ctx context.Context, key string, body io.Reader, contentType, sum string) error {
+	checksum, err := s.checksum(body, sum)
+	if err != nil {
+		return err
+	}
+	if s.stagingBucket == "" {
+		return s.upload(ctx, s.bucket, key, body, contentType, checksum)
+	}
+
+	// Staged uploads always carry a checksum so the staging bucket records
+	// one to check against the digest of what was sent.
+	checksum.algorithm = types.ChecksumAlgorithmSha256
+	hash := sha256.New()
+	counted := &quotaReader{r: io.TeeReader(body, hash), limit: -1}
+	if err := s.upload(ctx, s.stagingBucket, key, counted, contentType, checksum); err != nil {
+		s.discardStaged(key)
+		return err
+	}
+	sent := base64.StdEncoding.EncodeToString(hash.Sum(nil))
+	if err := s.verifyStaged(ctx, key, counted.n, contentType, sent); err != nil {
+		s.discardStaged(key)
+		return err
+	}
+	if err := s.copyBetween(ctx, s.stagingBucket, key, s.bucket, key); err != nil {
+		s.discardStaged(key)
+		return fmt.Errorf("failed to promote staged upload: %w", err)
+	}
+	s.discardStaged(key)
+	return nil
+}
+
+// s3Checksum is how an upload is verified. With an algorithm set the SDK
+// checksums each part and S3 checks them; value is the whole-object
+// digest, which S3 only accepts when the upload fits in a single part.
+type s3Checksum struct {
+	algorithm types.ChecksumAlgorithm
+	value     *string
+}
+
+// checksum picks the verification for a put of body with hex digest sum.
+// Only a seekable body's size is known up front, so anything else is
+// verified part by part.
+func (s *s3Storage) checksum(body io.Reader, sum string) (s3Checksum, error) {
+	if sum == "" {
+		return s3Checksum{}, nil
+	}
+	checksum := s3Checksum{algorithm: types.ChecksumAlgorithmSha256}
+	seeker, ok := body.(io.Seeker)
+	if !ok {
+		return checksum, nil
+	}
+	start, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return checksum, nil
+	}
+	end, err := seeker.Seek(0, io.SeekEnd)
+	if err != nil {
+		return s3Checksum{}, err
+	}
+	if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+		return s3Checksum{}, err
+	}
+	partSize := s.uploader.PartSize
+	if partSize <= 0 {
+		partSize = manager.DefaultUploadPartSize
+	}
+	if end-start < partSize {
+		value, err := checksumBase64(sum)
+		if err != nil {
+			return s3Checksum{}, err
+		}
+		checksum.value = aws.String(value)
+	}
+	return checksum, nil
+}
+
+func (s *s3Storage) upload(ctx context.Context, bucket, key string, body io.Reader, contentType string, checksum s3Checksum) error {
+	_, err := s.uploader.Upload(ctx, &s3.PutObjectInput{
+		Bucket:            aws.String(bucket),
+		Key:               aws.String(key),
+		Body:              body,
+		ContentType:       aws.String(contentType),
+		Tagging:           s.tagging(key),
+		ChecksumAlgorithm: checksum.algorithm,
+		ChecksumSHA256:    checksum.value,
+	})
+	return err
+}
+
+// verifyStaged checks the staged copy is complete before promotion: its
+// size, content type and, when the store reports a full-object SHA-256,
+// that it matches sum, the base64 digest of what was sent. Multipart
+// uploads only have a checksum of their part checksums, which S3 verified
+// part by part, so size is all that's left to compare for them.
+func (s *s3Storage) verifyStaged(ctx context.Context, key string, size int64, contentType, sum string) error {
+	head, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket:       aws.String(s.stagingBucket),
+		Key:          aws.String(key),
+		ChecksumMode: types.ChecksumModeEnabled,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to check staged upload %s: %v", key, err)
+	}
+	if aws.ToInt64(head.ContentLength) != size {
+		return fmt.Errorf("staged upload %s is %d bytes, expected %d", key, aws.ToInt64(head.ContentLength), size)
+	}
+	if got := aws.ToString(head.ContentType); got != contentType {
+		return fmt.Errorf("staged upload %s has content type %q, expected %q", key, got, contentType)
+	}
+	if got := aws.ToString(head.ChecksumSHA256); got != "" && !strings.Contains(got, "-") && got != sum {
+		return fmt.Errorf("staged upload %s has SHA-256 %s, expected %s", key, got, sum)
+	}
+	return nil
+}
+
+// discardStaged removes a staged upload. Failures are only logged; a
+// bucket lifecycle rule should expire anything left behind.
+func (s *s3Storage) discardStaged(key string) {
+	_, err := s.client.DeleteObject(context.Background(), &s3.DeleteObjectInput{
+		Bucket: aws.String(s.stagingBucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		log.Printf("Couldn't delete staged upload %s: %v", key, err)
+	}
+}
+
+func (s *s3Storage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var noSuchKey *types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, errObjectNotFound
+		}
+		return nil, fmt.Errorf("failed to get %s: %v", key, err)
+	}
+	return out.Body, nil
+}
+
+func (s *s3Storage) Delete(ctx context.Context, key string) error {
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete %s: %v", key, err)
+	}
+	return nil
+}
+
+func (s *s3Storage) Copy(ctx context.Context, srcKey, dstKey string) error {
+	return s.copyBetween(ctx, s.bucket, srcKey, s.bucket, dstKey)
+}
+
+// copyBetween copies an object server-side. Tags follow the destination
+// key rather than the source, so a video moved out of quarantine loses
+// its expiry tag and one moved in gains it.
+func (s *s3Storage) copyBetween(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string) error {
+	input := &s3.CopyObjectInput{
+		Bucket:     aws.String(dstBucket),
+		Key:        aws.String(dstKey),
+		CopySource: aws.String(url.PathEscape(srcBucket + "/" + srcKey)),
+	}
+	if tagging, srcTagging := s.tagging(dstKey), s.tagging(srcKey); aws.ToString(tagging) != aws.ToString(srcTagging) {
+		input.TaggingDirective = types.TaggingDirectiveReplace
+		input.Tagging = aws.String(aws.ToString(tagging))
+	}
+	_, err := s.client.CopyObject(ctx, input)
+	if err != nil {
+		return fmt.Errorf("failed to copy %s to %s: %v", srcKey, dstKey, err)
+	}
+	return nil
+}
+
+func (s *s3Storage) Stat(ctx context.Context, key string) (objectInfo, error) {
+	head, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var notFound *types.NotFound
+		if errors.As(err, &notFound) {
+			return objectInfo{}, errObjectNotFound
+		}
+		return objectInfo{}, fmt.Errorf("failed to stat %s: %v", key, err)
+	}
+	return objectInfo{
+		Size:     aws.ToInt64(head.ContentLength),
+		ETag:     strings.Trim(aws.ToString(head.ETag), `"`),
+		Modified: aws.ToTime(head.LastModified),
+	}, nil
+}
+
+func (s *s3Storage) DeletePrefix(ctx context.Context, prefix string) error {
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list %s: %v", prefix, err)
+		}
+		if len(page.Contents) == 0 {
+			continue
+		}
+		objects := make([]types.ObjectIdentifier, 0, len(page.Contents))
+		for _, obj := range page.Contents {
+			objects = append(objects, types.ObjectIdentifier{Key: obj.Key})
+		}
+		out, err := s.client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(s.bucket),
+			Delete: &types.Delete{Objects: objects, Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to delete %s: %v", prefix, err)
+		}
+		if len(out.Errors) > 0 {
+			return fmt.Errorf("failed to delete %s: %s", aws.ToString(out.Errors[0].Key), aws.ToString(out.Errors[0].Message))
+		}
+	}
+	return nil
+}
+
+func (s *s3Storage) List(ctx context.Context, fn func(key string, modified time.Time) error) error {
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list bucket: %v", err)
+		}
+		for _, obj := range page.Contents {
+			if err := fn(aws.ToString(obj.Key), aws.ToTime(obj.LastModified)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Serve proxies the object, forwarding the client's Range header so
+// seeking works without downloading the whole file. Conditional headers
+// are forwarded too, so S3 decides whether the client's cached copy is
+// still current and a 304 is passed straight back.
+func (s *s3Storage) Serve(w http.ResponseWriter, r *http.Request, key string) error {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	}
+	if rangeHeader := r.Header.Get("Range"); rangeHeader != "" {
+		input.Range = aws.String(rangeHeader)
+	}
+	if etag := r.Header.Get("If-None-Match"); etag != "" {
+		input.IfNoneMatch = aws.String(etag)
+	} else if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil {
+		// If-None-Match takes precedence when both are sent (RFC 9110).
+		input.IfModifiedSince = aws.Time(since)
+	}
+	out, err := s.client.GetObject(r.Context(), input)
+	if err != nil {
+		var respErr *awshttp.ResponseError
+		if errors.As(err, &respErr) && respErr.HTTPStatusCode() == http.StatusNotModified {
+			if etag := respErr.Response.Header.Get("ETag"); etag != "" {
+				w.Header().Set("ETag", etag)
+			}
+			if lastModified := respErr.Response.Header.Get("Last-Modified"); lastModified != "" {
+				w.Header().Set("Last-Modified", lastModified)
+			}
+			w.WriteHeader(http.StatusNotModified)
+			return nil
+		}
+		var noSuchKey *types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return errObjectNotFound
+		}
+		return fmt.Errorf("failed to get %s: %v", key, err)
+	}
+	defer out.Body.Close()
+
+	w.Header().Set("Accept-Ranges", "bytes")
+	if out.ETag != nil {
+		w.Header().Set("ETag", *out.ETag)
+	}
+	if out.LastModified != nil {
+		w.Header().Set("Last-Modified", out.LastModified.UTC().Format(http.TimeFormat))
+	}
+	if out.ContentType != nil {
+		w.Header().Set("Content-Type", *out.ContentType)
+	}
+	if out.ContentLength != nil {
+		w.Header().Set("Content-Length", strconv.FormatInt(*out.ContentLength, 10))
+	}
+	status := http.StatusOK
+	if out.ContentRange != nil {
+		w.Header().Set("Content-Range", *out.ContentRange)
+		status = http.StatusPartialContent
+	}
+	w.WriteHeader(status)
+	io.Copy(w, out.Body)
+	return nil
+}
+
+func (s *s3Storage) ObjectURL(key string) string {
+	return fmt.Sprintf("%s/%s", s.distribution, key)
+}
+
+func (s *s3Storage) PresignURL(key string, expiry time.Duration) (string, error) {
+	return generatePresignedURL(s.client, s.bucket, key, expiry)
+}
+
+func (s *s3Storage) PresignBucketURL(bucket, key string, expiry time.Duration) (string, error) {
+	return generatePresignedURL(s.client, bucket, key, expiry)
+}
+
+func (s *s3Storage) PresignDeleteURL(key string, expiry time.Duration) (string, error) {
+	return generatePresignedDeleteURL(s.client, s.bucket, key, expiry)
+}
+
+func (s *s3Storage) Name() string {
+	return s.bucket
+}
+
+func (s *s3Storage) CreateMultipart(ctx context.Context, key, contentType string) (string, error) {
+	out, err := s.client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		ContentType: aws.String(contentType),
+	})
+	if err != nil {
+		return "", err
+	}
+	return aws.ToString(out.UploadId), nil
+}
+
+func (s *s3Storage) UploadPart(ctx context.Context, key, uploadID string, partNumber int, body io.ReadSeeker, size int64) (string, error) {
+	out, err := s.client.UploadPart(ctx, &s3.UploadPartInput{
+		Bucket:        aws.String(s.bucket),
+		Key:           aws.String(key),
+		UploadId:      aws.String(uploadID),
+		PartNumber:    aws.Int32(int32(partNumber)),
+		Body:          body,
+		ContentLength: aws.Int64(size),
+	})
+	if err != nil {
+		return "", err
+	}
+	return aws.ToString(out.ETag), nil
+}
+
+func (s *s3Storage) CompleteMultipart(ctx context.Context, key, uploadID string, parts []database.ResumableUploadPart) error {
+	completed := make([]types.CompletedPart, 0, len(parts))
+	for _, part := range parts {
+		completed = append(completed, types.CompletedPart{
+			ETag:       aws.String(part.ETag),
+			PartNumber: aws.Int32(int32(part.PartNumber)),
+		})
+	}
+	_, err := s.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(s.bucket),
+		Key:             aws.String(key),
+		UploadId:        aws.String(uploadID),
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: completed},
+	})
+	return err
+}
+
+func (s *s3Storage) AbortMultipart(ctx context.Context, key, uploadID string) error {
+	_, err := s.client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(s.bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+	})
+	var noSuchUpload *types.NoSuchUpload
+	if err != nil && !errors.As(err, &noSuchUpload) {
+		return err
+	}
+	return nil
+}
+
+func generatePresignedURL(s3Client *s3.Client, bucket, key string, expireTime time.Duration) (string, error) {
+	s3PresignClient := s3.NewPresignClient(s3Client)
+
+	req, err := s3PresignClient.PresignGetObject(context.TODO(), &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}, s3.WithPresignExpires(expireTime))
+	if err != nil {
+		return "", fmt.Errorf("failed to generate presigned url %v", err)
+	}
+
+	return req.URL, nil
+}
+
+// generatePresignedDeleteURL lets a client delete one object directly.
+func generatePresignedDeleteURL(s3Client *s3.Client, bucket, key string, expireTime time.Duration) (string, error) {
+	s3PresignClient := s3.NewPresignClient(s3Client)
+
+	req, err := s3PresignClient.PresignDeleteObject(context.TODO(), &s3.DeleteObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}, s3.WithPresignExpires(expireTime))
+	if err != nil {
+		return "", fmt.Errorf("failed to generate presigned delete url %v", err)
+	}
+
+	return req.URL, nil
+}
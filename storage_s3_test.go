@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+)
+
+func TestStagedUploadPromotedToProduction(t *testing.T) {
+	cfg, fake := newTestS3Config(t, "tubely", "tubely-staging")
+	installFakeMedia(t, &fakeMedia{Width: 1920, Height: 1080})
+	userID := createTestUser(t, cfg)
+	video := createTestVideo(t, cfg, userID, visibilityPublic)
+
+	body := testMP4(1024, 0)
+	if rec := uploadTestVideo(t, cfg, video.ID, userID, body); rec.Code != http.StatusOK {
+		t.Fatalf("upload: got status %d: %s", rec.Code, rec.Body)
+	}
+
+	key := latestVersionKey(t, cfg, video.ID)
+	if got := getTestObject(t, cfg, key); !bytes.Equal(got, body) {
+		t.Error("production object doesn't match the upload")
+	}
+	if keys := fake.keys("tubely-staging"); len(keys) != 0 {
+		t.Errorf("staging bucket still holds %q", keys)
+	}
+	var staged, promoted bool
+	for _, req := range fake.requestLog() {
+		staged = staged || req == "PUT tubely-staging/"+key
+		promoted = promoted || req == "COPY tubely/"+key
+		if req == "PUT tubely/"+key {
+			t.Error("video was put straight into production instead of being promoted from staging")
+		}
+	}
+	if !staged || !promoted {
+		t.Errorf("video wasn't staged and promoted: %q", fake.requestLog())
+	}
+}
+
+func TestFailedValidationLeavesProductionEmpty(t *testing.T) {
+	cfg, fake := newTestS3Config(t, "tubely", "tubely-staging")
+	cfg.strictDuration = true
+	installFakeMedia(t, &fakeMedia{Width: 1920, Height: 1080, Duration: 10, StreamDuration: 1})
+	userID := createTestUser(t, cfg)
+	video := createTestVideo(t, cfg, userID, visibilityPublic)
+
+	if rec := uploadTestVideo(t, cfg, video.ID, userID, testMP4(1024, 0)); rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("upload: got status %d, want 422", rec.Code)
+	}
+	if keys := fake.keys("tubely"); len(keys) != 0 {
+		t.Errorf("production bucket holds %q after a rejected upload", keys)
+	}
+	if keys := fake.keys("tubely-staging"); len(keys) != 0 {
+		t.Errorf("staging bucket holds %q after a rejected upload", keys)
+	}
+}
+
+func TestLargeUploadSentAsMultipart(t *testing.T) {
+	cfg, fake := newTestS3Config(t, "tubely", "")
+	uploader, err := newUploader(cfg.s3Client, manager.MinUploadPartSize, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.storage.(*s3Storage).uploader = uploader
+	installFakeMedia(t, &fakeMedia{Width: 1920, Height: 1080})
+	userID := createTestUser(t, cfg)
+	video := createTestVideo(t, cfg, userID, visibilityPublic)
+
+	body := testMP4(10<<20, 0)
+	if rec := uploadTestVideo(t, cfg, video.ID, userID, body); rec.Code != http.StatusOK {
+		t.Fatalf("upload: got status %d: %s", rec.Code, rec.Body)
+	}
+
+	key := latestVersionKey(t, cfg, video.ID)
+	obj, ok := fake.object("tubely", key)
+	if !ok {
+		t.Fatalf("no object at %s: %q", key, fake.keys("tubely"))
+	}
+	if !bytes.Equal(obj.data, body) {
+		t.Errorf("stored object has %d bytes, want the %d uploaded intact", len(obj.data), len(body))
+	}
+	parts := 0
+	for _, req := range fake.requestLog() {
+		if req == "PUT tubely/"+key {
+			parts++
+		}
+	}
+	if parts < 2 {
+		t.Errorf("video went up in %d part(s), want a multipart upload", parts)
+	}
+}
+
+func TestStagedUploadChecksumRecorded(t *testing.T) {
+	cfg, fake := newTestS3Config(t, "tubely", "tubely-staging")
+	body := testMP4(1024, 0)
+
+	// One body with a known digest, one streamed without.
+	if err := cfg.putVideoObjectChecksum(context.Background(), "known.mp4", bytes.NewReader(body), "video/mp4", fmt.Sprintf("%x", sha256.Sum256(body))); err != nil {
+		t.Fatalf("Put with a digest: %v", err)
+	}
+	if err := cfg.putVideoObject(context.Background(), "streamed.mp4", io.MultiReader(bytes.NewReader(body)), "video/mp4"); err != nil {
+		t.Fatalf("streamed Put: %v", err)
+	}
+	for _, key := range []string{"known.mp4", "streamed.mp4"} {
+		obj, ok := fake.object("tubely", key)
+		if !ok {
+			t.Errorf("%s wasn't promoted: %q", key, fake.keys("tubely"))
+			continue
+		}
+		if obj.checksum != fakeS3Checksum(body) {
+			t.Errorf("%s has checksum %q, want the digest of the upload", key, obj.checksum)
+		}
+	}
+}
+
+func TestStagedUploadChecksumMismatchDiscarded(t *testing.T) {
+	cfg, fake := newTestS3Config(t, "tubely", "tubely-staging")
+	fake.tamper = func(name string, data []byte) []byte {
+		if !strings.HasPrefix(name, "tubely-staging/") {
+			return data
+		}
+		data = bytes.Clone(data)
+		data[len(data)/2] ^= 0xff
+		return data
+	}
+
+	err := cfg.putVideoObject(context.Background(), "video.mp4", bytes.NewReader(testMP4(1024, 0)), "video/mp4")
+	if err == nil || !strings.Contains(err.Error(), "SHA-256") {
+		t.Fatalf("Put of a corrupted staged upload: got %v, want a checksum mismatch", err)
+	}
+	if keys := fake.keys("tubely"); len(keys) != 0 {
+		t.Errorf("production bucket holds %q after a checksum mismatch", keys)
+	}
+	if keys := fake.keys("tubely-staging"); len(keys) != 0 {
+		t.Errorf("staging bucket still holds %q", keys)
+	}
+}
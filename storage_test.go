@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestStorageBackends runs the objectStorage contract against every
+// backend, S3 through the fake server.
+func TestStorageBackends(t *testing.T) {
+	backends := map[string]func(t *testing.T) objectStorage{
+		"local": func(t *testing.T) objectStorage { return newTestConfig(t).storage },
+		"s3": func(t *testing.T) objectStorage {
+			cfg, _ := newTestS3Config(t, "tubely", "")
+			return cfg.storage
+		},
+	}
+	for name, newStorage := range backends {
+		t.Run(name, func(t *testing.T) {
+			storage := newStorage(t)
+			ctx := context.Background()
+			body := []byte("some video bytes")
+
+			if err := storage.Put(ctx, "landscape/a.mp4", bytes.NewReader(body), "video/mp4", ""); err != nil {
+				t.Fatalf("Put: %v", err)
+			}
+			info, err := storage.Stat(ctx, "landscape/a.mp4")
+			if err != nil || info.Size != int64(len(body)) || info.ETag == "" || strings.Contains(info.ETag, `"`) {
+				t.Errorf("Stat = %+v, %v; want %d bytes and an unquoted ETag", info, err, len(body))
+			}
+			if err := storage.Copy(ctx, "landscape/a.mp4", "hls/b/index.m3u8"); err != nil {
+				t.Fatalf("Copy: %v", err)
+			}
+			obj, err := storage.Get(ctx, "hls/b/index.m3u8")
+			if err != nil {
+				t.Fatalf("Get: %v", err)
+			}
+			got, _ := io.ReadAll(obj)
+			obj.Close()
+			if !bytes.Equal(got, body) {
+				t.Errorf("copy holds %q, want %q", got, body)
+			}
+
+			var keys []string
+			err = storage.List(ctx, func(key string, modified time.Time) error {
+				keys = append(keys, key)
+				return nil
+			})
+			slices.Sort(keys)
+			if err != nil || !slices.Equal(keys, []string{"hls/b/index.m3u8", "landscape/a.mp4"}) {
+				t.Errorf("List = %q, %v", keys, err)
+			}
+
+			if err := storage.DeletePrefix(ctx, "hls/b/"); err != nil {
+				t.Fatalf("DeletePrefix: %v", err)
+			}
+			if err := storage.Delete(ctx, "landscape/a.mp4"); err != nil {
+				t.Fatalf("Delete: %v", err)
+			}
+			if err := storage.Delete(ctx, "landscape/a.mp4"); err != nil {
+				t.Errorf("Delete of a missing key: %v", err)
+			}
+			for _, key := range []string{"landscape/a.mp4", "hls/b/index.m3u8"} {
+				if _, err := storage.Stat(ctx, key); !errors.Is(err, errObjectNotFound) {
+					t.Errorf("Stat of deleted %s: %v, want errObjectNotFound", key, err)
+				}
+				if _, err := storage.Get(ctx, key); !errors.Is(err, errObjectNotFound) {
+					t.Errorf("Get of deleted %s: %v, want errObjectNotFound", key, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+const defaultStreamProbeBytes = 4 << 20
+
+var errUploadQuotaExceeded = errors.New("upload quota exceeded")
+
+// bufferStreamHeader copies up to n bytes of body into a temp file and probes
+// it. The returned file is rewound so it can be replayed ahead of the rest of
+// body; ok is false when the header didn't carry enough metadata to probe.
+func (cfg *apiConfig) bufferStreamHeader(ctx context.Context, body io.Reader, ext string, n int64) (header *os.File, probe videoProbe, ok bool, err error) {
+	header, err = os.CreateTemp("", "tubely-header-*"+ext)
+	if err != nil {
+		return nil, videoProbe{}, false, err
+	}
+	if _, err := io.CopyN(header, body, n); err != nil && err != io.EOF {
+		header.Close()
+		os.Remove(header.Name())
+		return nil, videoProbe{}, false, err
+	}
+	if _, err := header.Seek(0, io.SeekStart); err != nil {
+		header.Close()
+		os.Remove(header.Name())
+		return nil, videoProbe{}, false, err
+	}
+
+	// Only a real MP4 can go straight to storage; anything else that was
+	// declared as one is spooled and converted like any other upload.
+	probe, err = cfg.probeVideo(ctx, header.Name())
+	if err != nil || probe.Width == 0 || probe.Height == 0 || probe.Container != "video/mp4" {
+		return header, videoProbe{}, false, nil
+	}
+	return header, probe, true, nil
+}
+
+// quotaReader counts bytes read and fails once more than limit have been
+// read. A negative limit disables the check. Errors from the underlying
+// reader are kept so they can be told apart from storage failures.
+type quotaReader struct {
+	r       io.Reader
+	n       int64
+	limit   int64
+	readErr error
+}
+
+func (q *quotaReader) Read(p []byte) (int, error) {
+	n, err := q.r.Read(p)
+	q.n += int64(n)
+	if q.limit >= 0 && q.n > q.limit {
+		return n, errUploadQuotaExceeded
+	}
+	if err != nil && err != io.EOF {
+		q.readErr = err
+	}
+	return n, err
+}
+
+// finishStreamedUpload sends the upload straight to storage without a full
+// disk copy, using metadata probed from the buffered header. Fast-start
+// processing, audio track muxing and re-encoding are skipped in this mode.
+func (cfg *apiConfig) finishStreamedUpload(ctx context.Context, w http.ResponseWriter, video database.Video, mediaType, headerPath string, probe videoProbe, probeTime time.Duration, body io.Reader, reservation *uploadReservation) {
+	failProcessing := func(stage string, code int, msg string, err error) {
+		cfg.failVideoProcessing(w, &video, stage, code, msg, err)
+	}
+
+	if !cfg.claimVideoUpload(w, &video) {
+		return
+	}
+	cfg.setProcessingStatus(&video, processingStatusProcessing, 10, nil)
+
+	if cfg.strictDuration {
+		if err := checkDurationConsistency(probe); err != nil {
+			clearBodyDeadline(w)
+			failProcessing(processingStageValidate, http.StatusUnprocessableEntity, "Declared duration doesn't match the video stream", err)
+			return
+		}
+	}
+	if cfg.requireThumbnail && video.ThumbnailURL == nil {
+		clearBodyDeadline(w)
+		failProcessing(processingStageValidate, http.StatusUnprocessableEntity, "A thumbnail is required: upload one before uploading the video", nil)
+		return
+	}
+
+	aspect := aspectPrefix(probe.AspectRatio)
+	latestVersion, err := cfg.db.GetLatestVideoVersionNumber(video.ID)
+	if err != nil {
+		clearBodyDeadline(w)
+		failProcessing(processingStageStore, http.StatusInternalServerError, "Couldn't look up video versions", err)
+		return
+	}
+	version := latestVersion + 1
+	objectName, err := cfg.videoObjectName(video.Title, mediaType)
+	if err != nil {
+		clearBodyDeadline(w)
+		failProcessing(processingStageStore, http.StatusInternalServerError, "Couldn't name video object", err)
+		return
+	}
+	key := versionedKey(cfg.videoKey(video.ID, aspect, objectName), version)
+
+	counted := &quotaReader{r: body, limit: reservation.limit()}
+	// The digest is only known once the object is stored, so streamed
+	// uploads are recorded for later duplicates but never deduplicated.
+	hash := sha256.New()
+	uploadStart := time.Now()
+	err = cfg.putVideoObject(ctx, key, io.TeeReader(counted, hash), mediaType)
+	uploadTime := time.Since(uploadStart)
+	clearBodyDeadline(w)
+	if err != nil {
+		switch {
+		case errors.Is(err, errUploadQuotaExceeded):
+			cfg.setProcessingStatus(&video, processingStatusFailed, video.Progress, err)
+			respondQuotaExceeded(w, reservation.quota)
+		case counted.readErr != nil:
+			cfg.setProcessingStatus(&video, processingStatusFailed, video.Progress, counted.readErr)
+			respondUploadReadError(w, "Unable to read file", counted.readErr)
+		default:
+			failProcessing(processingStageUpload, http.StatusInternalServerError, "Failed to upload", err)
+		}
+		return
+	}
+
+	sum := hex.EncodeToString(hash.Sum(nil))
+	_, err = cfg.db.CreateVideoVersion(video.ID, version, key, counted.n, sum)
+	if err != nil {
+		failProcessing(processingStageStore, http.StatusInternalServerError, "Failed to record video version", err)
+		return
+	}
+
+	audioLanguages := []string{}
+	if probe.HasAudio {
+		audioLanguages = append(audioLanguages, cfg.resolveAudioLanguage(ctx, headerPath, probe))
+	}
+
+	// The header holds the first frames, which is all a poster needs.
+	if video.ThumbnailURL == nil {
+		thumbnailURL, err := cfg.storeGeneratedThumbnail(ctx, video.ID, headerPath, cfg.thumbnailAt, probe.Width, probe.Height)
+		if err != nil {
+			log.Printf("Couldn't generate thumbnail for video %s: %v", video.ID, err)
+		} else {
+			video.ThumbnailURL = &thumbnailURL
+		}
+	}
+
+	videoURL := cfg.videoURLRef(key)
+	video.VideoURL = &videoURL
+	applyProbeMetadata(&video, probe)
+	video.Aspect = aspect
+	video.Bitrate = overallBitrate(counted.n, probe.DurationSec)
+	video.AudioLanguage = audioLanguageOrUnd(audioLanguages)
+	video.AudioLanguages = audioLanguages
+	video.OriginalSizeBytes = counted.n
+	video.FinalSizeBytes = counted.n
+	video.SHA256 = sum
+	video.Status = processingStatusReady
+	video.Progress = 100
+	video.ProcessingError = nil
+	err = cfg.db.UpdateVideo(video)
+	if err != nil {
+		failProcessing(processingStageStore, http.StatusInternalServerError, "Failed to update video", err)
+		return
+	}
+
+	reservation.commit(counted.n)
+
+	cfg.saveVideoTimings(database.VideoTimings{
+		VideoID:  video.ID,
+		ProbeMS:  probeTime.Milliseconds(),
+		UploadMS: uploadTime.Milliseconds(),
+	})
+	cfg.notifyProcessing(video, processingStatusReady, nil)
+	cfg.respondWithSignedVideo(w, video)
+}
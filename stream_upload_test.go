@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func TestStreamedUploadCapturesDimensions(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.streamUploads = true
+	cfg.streamProbeBytes = 256
+	media := &fakeMedia{Width: 1080, Height: 1920, Duration: 12}
+	installFakeMedia(t, media)
+	userID := createTestUser(t, cfg)
+	video := createTestVideo(t, cfg, userID, visibilityPublic)
+
+	body := testMP4(8192, 0)
+	rec := uploadTestVideo(t, cfg, video.ID, userID, body)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body)
+	}
+	got := decodeJSON[database.Video](t, rec)
+	if got.Width != 1080 || got.Height != 1920 || got.Aspect != "portrait" || got.DurationSec != 12 {
+		t.Errorf("got %dx%d %q %vs, want 1080x1920 portrait 12s", got.Width, got.Height, got.Aspect, got.DurationSec)
+	}
+	// Only the thumbnail is taken from the buffered header; the video itself
+	// goes to storage untouched.
+	for _, args := range media.ffmpegRuns(t) {
+		if out := args[len(args)-1]; !strings.HasSuffix(out, ".jpg") {
+			t.Errorf("streamed upload ran ffmpeg %q", args)
+		}
+	}
+
+	key := latestVersionKey(t, cfg, video.ID)
+	if !strings.HasPrefix(key, "portrait/") {
+		t.Errorf("stored under %q, want the portrait prefix", key)
+	}
+	if stored := getTestObject(t, cfg, key); !bytes.Equal(stored, body) {
+		t.Errorf("stored %d bytes that don't match the %d uploaded", len(stored), len(body))
+	}
+}
+
+func TestBufferStreamHeaderFallsBackWhenUnprobeable(t *testing.T) {
+	cfg := newTestConfig(t)
+	// A header without a usable video stream, as when the moov atom is at
+	// the end of the file.
+	installFakeMedia(t, &fakeMedia{})
+
+	body := testMP4(1024, 0)
+	rest := bytes.NewReader(body)
+	header, _, ok, err := cfg.bufferStreamHeader(context.Background(), rest, ".mp4", 256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(header.Name())
+	defer header.Close()
+	if ok {
+		t.Error("ok = true for a header that can't be probed")
+	}
+	replayed, err := io.ReadAll(io.MultiReader(header, rest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(replayed, body) {
+		t.Error("header followed by the rest of the body doesn't replay the upload")
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// thumbnailArgs builds the ffmpeg arguments to grab a single JPEG frame.
+// With fastSeek, -ss comes before -i so ffmpeg jumps to the nearest
+// keyframe instead of decoding everything up to the timestamp; without it
+// the seek is frame-accurate but slow for frames deep into long videos.
+// With autorotate the frame is turned to match the rotation metadata the
+// player honours, so portrait phone footage doesn't get a sideways poster.
+func thumbnailArgs(input, output string, at time.Duration, fastSeek, autorotate bool) []string {
+	ts := strconv.FormatFloat(at.Seconds(), 'f', 3, 64)
+	rotateArg := "-autorotate"
+	if !autorotate {
+		rotateArg = "-noautorotate"
+	}
+	frameArgs := []string{"-frames:v", "1", "-q:v", "2", "-y", output}
+	if fastSeek {
+		return append([]string{rotateArg, "-ss", ts, "-i", input}, frameArgs...)
+	}
+	return append([]string{rotateArg, "-i", input, "-ss", ts}, frameArgs...)
+}
+
+// extractThumbnail writes a JPEG of the frame at the given offset to a new
+// temp file and returns its path. If the fast seek produces nothing and the
+// accurate fallback is enabled, it retries with an accurate seek.
+func (cfg *apiConfig) extractThumbnail(ctx context.Context, filePath string, at time.Duration) (string, error) {
+	out, err := os.CreateTemp("", "tubely-thumbnail-*.jpg")
+	if err != nil {
+		return "", err
+	}
+	out.Close()
+
+	err = cfg.runThumbnailExtraction(ctx, filePath, out.Name(), at, true)
+	if err != nil && cfg.thumbnailSeekFallback && ctx.Err() == nil {
+		log.Printf("Fast-seek thumbnail failed for %s, retrying with accurate seek: %v", filePath, err)
+		err = cfg.runThumbnailExtraction(ctx, filePath, out.Name(), at, false)
+	}
+	if err != nil {
+		os.Remove(out.Name())
+		return "", err
+	}
+	return out.Name(), nil
+}
+
+// generateThumbnail grabs a poster frame at the given offset, falling back
+// to the first frame for clips too short to have one there.
+func (cfg *apiConfig) generateThumbnail(ctx context.Context, filePath string, at time.Duration) (string, error) {
+	path, err := cfg.extractThumbnail(ctx, filePath, at)
+	if err == nil || at == 0 || ctx.Err() != nil {
+		return path, err
+	}
+	log.Printf("No thumbnail at %s for %s, using the first frame: %v", at, filePath, err)
+	return cfg.extractThumbnail(ctx, filePath, 0)
+}
+
+// parseThumbnailOffset reads an offset such as "2.5s" or a plain number of
+// seconds.
+func parseThumbnailOffset(value string) (time.Duration, error) {
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		if seconds < 0 {
+			return 0, fmt.Errorf("offset can't be negative")
+		}
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("offset can't be negative")
+	}
+	return d, nil
+}
+
+// thumbnailKey is where a generated poster frame is stored.
+func (cfg *apiConfig) thumbnailKey(videoID uuid.UUID) string {
+	return fmt.Sprintf("%sthumbnails/%s.jpg", cfg.shardPrefix(videoID), videoID)
+}
+
+// uploadedThumbnailPrefix holds a thumbnail the owner uploaded. It's kept
+// apart from the generated poster so reprocessing doesn't replace it.
+func (cfg *apiConfig) uploadedThumbnailPrefix(videoID uuid.UUID) string {
+	return fmt.Sprintf("%sthumbnails/%s/", cfg.shardPrefix(videoID), videoID)
+}
+
+// storeGeneratedThumbnail extracts a poster frame at the given offset from
+// filePath, reshapes it to the video's width:height like an uploaded one,
+// uploads it and returns its URL.
+func (cfg *apiConfig) storeGeneratedThumbnail(ctx context.Context, videoID uuid.UUID, filePath string, at time.Duration, width, height int) (string, error) {
+	thumbPath, err := cfg.generateThumbnail(ctx, filePath, at)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(thumbPath)
+
+	if err := cfg.matchThumbnailAspect(thumbPath, width, height); err != nil {
+		log.Printf("Couldn't match thumbnail aspect for video %s: %v", videoID, err)
+	}
+	if cfg.progressiveThumbnails {
+		if err := makeProgressiveJPEG(thumbPath); err != nil {
+			log.Printf("Keeping baseline thumbnail for video %s: %v", videoID, err)
+		}
+	}
+
+	f, err := os.Open(thumbPath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	key := cfg.thumbnailKey(videoID)
+	if err := cfg.putVideoObject(ctx, key, f, "image/jpeg"); err != nil {
+		return "", err
+	}
+	return cfg.getVersionedObjectURL(ctx, key), nil
+}
+
+func (cfg *apiConfig) runThumbnailExtraction(ctx context.Context, input, output string, at time.Duration, fastSeek bool) error {
+	ctx, cancel := cfg.withCommandTimeout(ctx)
+	defer cancel()
+	cmd := cfg.ffmpegCommand(ctx, thumbnailArgs(input, output, at, fastSeek, cfg.thumbnailAutorotate)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return commandFailed(ctx, "error extracting thumbnail", stderr.String(), err)
+	}
+
+	info, err := os.Stat(output)
+	if err != nil {
+		return fmt.Errorf("could not stat thumbnail: %v", err)
+	}
+	if info.Size() == 0 {
+		return fmt.Errorf("thumbnail is empty")
+	}
+	return nil
+}
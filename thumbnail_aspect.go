@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"strconv"
+	"strings"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+const (
+	thumbnailAspectOff  = ""
+	thumbnailAspectCrop = "crop"
+	thumbnailAspectPad  = "pad"
+)
+
+func parseHexColor(s string) (color.RGBA, error) {
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) != 6 {
+		return color.RGBA{}, fmt.Errorf("color %q must be #rrggbb", s)
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("color %q must be #rrggbb", s)
+	}
+	return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 0xff}, nil
+}
+
+// reshapeToAspect returns img cropped (centered) or padded so its aspect
+// ratio is width:height. Cropping keeps the original pixels at their size;
+// padding letterboxes or pillarboxes with padColor.
+func reshapeToAspect(img image.Image, width, height int, mode string, padColor color.Color) image.Image {
+	src := img.Bounds()
+	w, h := src.Dx(), src.Dy()
+	if w == 0 || h == 0 || width <= 0 || height <= 0 {
+		return img
+	}
+
+	// Compare w/h with width/height without floating point.
+	switch cmp := w * height; {
+	case cmp == h*width:
+		return img
+	case mode == thumbnailAspectCrop && cmp > h*width:
+		// too wide: trim the sides
+		newW := h * width / height
+		x0 := src.Min.X + (w-newW)/2
+		return cropImage(img, image.Rect(x0, src.Min.Y, x0+newW, src.Max.Y))
+	case mode == thumbnailAspectCrop:
+		// too tall: trim top and bottom
+		newH := w * height / width
+		y0 := src.Min.Y + (h-newH)/2
+		return cropImage(img, image.Rect(src.Min.X, y0, src.Max.X, y0+newH))
+	case cmp > h*width:
+		// too wide: pad top and bottom
+		newH := w * height / width
+		return padImage(img, w, newH, padColor)
+	default:
+		// too tall: pad the sides
+		newW := h * width / height
+		return padImage(img, newW, h, padColor)
+	}
+}
+
+func cropImage(img image.Image, r image.Rectangle) image.Image {
+	dst := image.NewRGBA(image.Rect(0, 0, r.Dx(), r.Dy()))
+	xdraw.Draw(dst, dst.Bounds(), img, r.Min, xdraw.Src)
+	return dst
+}
+
+func padImage(img image.Image, w, h int, padColor color.Color) image.Image {
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	xdraw.Draw(dst, dst.Bounds(), image.NewUniform(padColor), image.Point{}, xdraw.Src)
+	src := img.Bounds()
+	offset := image.Pt((w-src.Dx())/2, (h-src.Dy())/2)
+	xdraw.Draw(dst, src.Sub(src.Min).Add(offset), img, src.Min, xdraw.Over)
+	return dst
+}
+
+// matchThumbnailAspect rewrites the image at path in place so it matches
+// the video's width:height, according to the configured mode. It does
+// nothing when the mode is off or the video hasn't been probed yet.
+func (cfg *apiConfig) matchThumbnailAspect(path string, width, height int) error {
+	if cfg.thumbnailAspectMode == thumbnailAspectOff || width <= 0 || height <= 0 {
+		return nil
+	}
+
+	img, err := decodeImageFile(path)
+	if err != nil {
+		return err
+	}
+	reshaped := reshapeToAspect(img, width, height, cfg.thumbnailAspectMode, cfg.thumbnailPadColor)
+	if reshaped == img {
+		return nil
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if strings.HasSuffix(path, ".png") {
+		return png.Encode(f, reshaped)
+	}
+	return jpeg.Encode(f, reshaped, &jpeg.Options{Quality: 90})
+}
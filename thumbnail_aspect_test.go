@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"net/http"
+	"testing"
+)
+
+func TestReshapeToAspectLandscapeToPortrait(t *testing.T) {
+	red := color.RGBA{R: 255, A: 255}
+	pad := color.RGBA{G: 255, A: 255}
+	// 16:9 thumbnail, 9:16 video.
+	thumb := solidImage(320, 180, red)
+
+	cropped := reshapeToAspect(thumb, 1080, 1920, thumbnailAspectCrop, pad)
+	if got := cropped.Bounds().Size(); got != image.Pt(101, 180) {
+		t.Errorf("cropped to %v, want 101x180", got)
+	}
+	if got := color.RGBAModel.Convert(cropped.At(0, 0)); got != red {
+		t.Errorf("cropped corner is %v, want the original pixels", got)
+	}
+
+	padded := reshapeToAspect(thumb, 1080, 1920, thumbnailAspectPad, pad)
+	if got := padded.Bounds().Size(); got != image.Pt(320, 568) {
+		t.Errorf("padded to %v, want 320x568", got)
+	}
+	if got := color.RGBAModel.Convert(padded.At(0, 0)); got != pad {
+		t.Errorf("padded corner is %v, want the pad color", got)
+	}
+	if got := color.RGBAModel.Convert(padded.At(160, 284)); got != red {
+		t.Errorf("padded centre is %v, want the original pixels", got)
+	}
+
+	if same := reshapeToAspect(thumb, 1920, 1080, thumbnailAspectCrop, pad); same != thumb {
+		t.Error("a thumbnail that already matches was rewritten")
+	}
+}
+
+func TestGeneratedThumbnailMatchesPortraitVideo(t *testing.T) {
+	tests := []struct {
+		mode string
+		want image.Point
+	}{
+		{thumbnailAspectCrop, image.Pt(20, 36)},
+		{thumbnailAspectPad, image.Pt(64, 113)},
+	}
+	for i, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			cfg := newTestConfig(t)
+			cfg.thumbnailAspectMode = tt.mode
+			cfg.thumbnailPadColor = color.RGBA{A: 255}
+			installFakeMedia(t, &fakeMedia{Width: 1080, Height: 1920, Thumb: image.Pt(64, 36)})
+			userID := createTestUser(t, cfg)
+			video := createTestVideo(t, cfg, userID, visibilityPublic)
+
+			if rec := uploadTestVideo(t, cfg, video.ID, userID, testMP4(256, byte(i))); rec.Code != http.StatusOK {
+				t.Fatalf("upload: got status %d: %s", rec.Code, rec.Body)
+			}
+			img, err := jpeg.Decode(bytes.NewReader(getTestObject(t, cfg, cfg.thumbnailKey(video.ID))))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := img.Bounds().Size(); got != tt.want {
+				t.Errorf("thumbnail is %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"image"
+	_ "image/jpeg"
+	"os"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestThumbnailArgsSeekPosition(t *testing.T) {
+	tests := []struct {
+		name     string
+		fastSeek bool
+		wantSeek bool // whether -ss comes before -i
+	}{
+		{"fast seek", true, true},
+		{"accurate seek", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := thumbnailArgs("in.mp4", "out.jpg", 1500*time.Millisecond, tt.fastSeek, true)
+			ss := slices.Index(args, "-ss")
+			in := slices.Index(args, "-i")
+			if ss < 0 || in < 0 {
+				t.Fatalf("args %q lack -ss or -i", args)
+			}
+			if got := ss < in; got != tt.wantSeek {
+				t.Errorf("args %q: -ss before -i = %v, want %v", args, got, tt.wantSeek)
+			}
+			if args[ss+1] != "1.500" {
+				t.Errorf("seek to %q, want 1.500", args[ss+1])
+			}
+			if args[len(args)-1] != "out.jpg" {
+				t.Errorf("output %q, want out.jpg", args[len(args)-1])
+			}
+		})
+	}
+}
+
+func TestThumbnailAutorotate(t *testing.T) {
+	tests := []struct {
+		name       string
+		autorotate bool
+		wantArg    string
+		want       image.Point
+	}{
+		{"autorotate", true, "-autorotate", image.Pt(36, 64)},
+		{"stored orientation", false, "-noautorotate", image.Pt(64, 36)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestConfig(t)
+			cfg.thumbnailAutorotate = tt.autorotate
+			media := &fakeMedia{Width: 1920, Height: 1080, Thumb: image.Pt(64, 36), Rotated: true}
+			installFakeMedia(t, media)
+			input := writeTestFile(t, testMP4(256, 0))
+
+			path, err := cfg.extractThumbnail(context.Background(), input, time.Second)
+			if err != nil {
+				t.Fatalf("extractThumbnail: %v", err)
+			}
+			defer os.Remove(path)
+
+			runs := media.ffmpegRuns(t)
+			if len(runs) != 1 || !slices.Contains(runs[0], tt.wantArg) {
+				t.Errorf("ffmpeg runs %q, want one with %s", runs, tt.wantArg)
+			}
+			f, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			img, _, err := image.DecodeConfig(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := image.Pt(img.Width, img.Height); got != tt.want {
+				t.Errorf("thumbnail is %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+)
+
+// transcodeToMP4 re-encodes a non-MP4 upload (QuickTime, WebM, MKV) to
+// H.264/AAC in an MP4 container so everything stored has the same format.
+// It returns the path of the new file.
+func (cfg *apiConfig) transcodeToMP4(ctx context.Context, filePath, pixFmt string) (string, error) {
+	ctx, cancel := cfg.withCommandTimeout(ctx)
+	defer cancel()
+
+	outputPath := fmt.Sprintf("%s.transcoded.mp4", filePath)
+	cmd := cfg.ffmpegCommand(ctx,
+		"-i", filePath,
+		"-map", "0:v:0", "-map", "0:a?",
+		"-c:v", "libx264", "-preset", "veryfast", "-crf", "23", "-pix_fmt", pixFmt,
+		"-c:a", "aac", "-b:a", "128k",
+		"-f", "mp4", "-y", outputPath,
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		os.Remove(outputPath)
+		return "", commandFailed(ctx, "error transcoding to mp4", stderr.String(), err)
+	}
+	return outputPath, nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// cache is a concurrency-safe map bounded both by size and by age. Entries
+// expire ttl after they were last set, and once the cache is full the least
+// recently used entry is evicted to make room. Expired entries are dropped
+// lazily when they're looked up or when the cache needs space.
+type cache[K comparable, V any] struct {
+	mu       sync.Mutex
+	capacity int
+	ttl      time.Duration
+	now      func() time.Time
+	order    *list.List
+	items    map[K]*list.Element
+}
+
+type cacheEntry[K comparable, V any] struct {
+	key       K
+	value     V
+	expiresAt time.Time
+}
+
+func newCache[K comparable, V any](capacity int, ttl time.Duration, now func() time.Time) *cache[K, V] {
+	return &cache[K, V]{
+		capacity: capacity,
+		ttl:      ttl,
+		now:      now,
+		order:    list.New(),
+		items:    map[K]*list.Element{},
+	}
+}
+
+func (c *cache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var zero V
+	elem, ok := c.items[key]
+	if !ok {
+		return zero, false
+	}
+	entry := elem.Value.(*cacheEntry[K, V])
+	if !c.now().Before(entry.expiresAt) {
+		c.removeElement(elem)
+		return zero, false
+	}
+	c.order.MoveToFront(elem)
+	return entry.value, true
+}
+
+func (c *cache[K, V]) Set(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expiresAt := c.now().Add(c.ttl)
+	if elem, ok := c.items[key]; ok {
+		entry := elem.Value.(*cacheEntry[K, V])
+		entry.value = value
+		entry.expiresAt = expiresAt
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	if c.order.Len() >= c.capacity {
+		c.removeExpired()
+	}
+	for c.order.Len() >= c.capacity {
+		c.removeElement(c.order.Back())
+	}
+	c.items[key] = c.order.PushFront(&cacheEntry[K, V]{key: key, value: value, expiresAt: expiresAt})
+}
+
+func (c *cache[K, V]) Delete(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.items[key]; ok {
+		c.removeElement(elem)
+	}
+}
+
+func (c *cache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+func (c *cache[K, V]) removeExpired() {
+	now := c.now()
+	for elem := c.order.Front(); elem != nil; {
+		next := elem.Next()
+		if !now.Before(elem.Value.(*cacheEntry[K, V]).expiresAt) {
+			c.removeElement(elem)
+		}
+		elem = next
+	}
+}
+
+func (c *cache[K, V]) removeElement(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.items, elem.Value.(*cacheEntry[K, V]).key)
+}
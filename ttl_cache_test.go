@@ -0,0 +1,85 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCacheExpiresEntries(t *testing.T) {
+	now := time.Unix(1000, 0)
+	c := newCache[string, int](10, time.Minute, func() time.Time { return now })
+	c.Set("a", 1)
+
+	now = now.Add(59 * time.Second)
+	if v, ok := c.Get("a"); !ok || v != 1 {
+		t.Fatalf("before the TTL: got %d, %v; want 1, true", v, ok)
+	}
+	now = now.Add(time.Second)
+	if _, ok := c.Get("a"); ok {
+		t.Fatal("entry is still there at its TTL")
+	}
+	if c.Len() != 0 {
+		t.Errorf("expired entry wasn't dropped: len %d", c.Len())
+	}
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := newCache[string, int](2, time.Hour, time.Now)
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Get("a")
+	c.Set("c", 3)
+
+	if _, ok := c.Get("b"); ok {
+		t.Error("least recently used entry b wasn't evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := c.Get(key); !ok {
+			t.Errorf("entry %s was evicted", key)
+		}
+	}
+	if c.Len() != 2 {
+		t.Errorf("got len %d, want the capacity 2", c.Len())
+	}
+}
+
+func TestCacheEvictsExpiredBeforeLive(t *testing.T) {
+	now := time.Unix(1000, 0)
+	c := newCache[string, int](2, time.Minute, func() time.Time { return now })
+	c.Set("old", 1)
+	now = now.Add(30 * time.Second)
+	c.Set("live", 2)
+	c.Get("old")
+	now = now.Add(45 * time.Second)
+	c.Set("new", 3)
+
+	if _, ok := c.Get("live"); !ok {
+		t.Error("a live entry was evicted while an expired one was there")
+	}
+}
+
+func TestCacheConcurrentAccess(t *testing.T) {
+	c := newCache[int, int](64, time.Hour, time.Now)
+	var wg sync.WaitGroup
+	for g := range 16 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 1000 {
+				key := (g*1000 + i) % 128
+				c.Set(key, i)
+				if v, ok := c.Get(key); ok && v < 0 {
+					t.Errorf("got corrupted value %d", v)
+				}
+				if i%10 == 0 {
+					c.Delete(key)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if n := c.Len(); n > 64 {
+		t.Errorf("cache grew to %d entries past its capacity of 64", n)
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// uploadOptions are the processing switches a client can pass as query
+// parameters on POST /api/video_upload/{videoID}.
+type uploadOptions struct {
+	AutoCaption bool
+	PixFmt      string
+}
+
+// uploadOptionSpec describes one query parameter. uploadOptionSpecs is the
+// single list both parseUploadOptions and the /api/videos/options manifest
+// are built from, so a parameter can't be accepted without being
+// advertised or vice versa.
+type uploadOptionSpec struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Default     any    `json:"default"`
+	Description string `json:"description"`
+	Constraints string `json:"constraints,omitempty"`
+
+	apply func(value string, opts *uploadOptions) error
+}
+
+// profileOptionName is the query parameter naming a server-defined
+// processing profile. It's applied before the other options so any of them
+// passed explicitly override the profile's value.
+const profileOptionName = "profile"
+
+var uploadOptionSpecs = []uploadOptionSpec{
+	{
+		Name:        profileOptionName,
+		Type:        "string",
+		Default:     nil,
+		Description: "Named preset of the other options, configured with PROCESSING_PROFILES. Explicit options override its values.",
+	},
+	{
+		Name:        "autocaption",
+		Type:        "bool",
+		Default:     false,
+		Description: "Generate WebVTT captions from the audio with the server's speech-to-text tool.",
+		Constraints: "ignored for videos without audio or when no tool is configured",
+		apply: func(value string, opts *uploadOptions) error {
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return err
+			}
+			opts.AutoCaption = b
+			return nil
+		},
+	},
+	{
+		Name:        "pixfmt",
+		Type:        "string",
+		Default:     "server default (DEFAULT_PIX_FMT)",
+		Description: "Pixel format forced on the output whenever the video is re-encoded.",
+		Constraints: "one of " + strings.Join(supportedPixFmts, ", ") + "; not applied when the stream is copied",
+		apply: func(value string, opts *uploadOptions) error {
+			if err := validatePixFmt(value); err != nil {
+				return err
+			}
+			opts.PixFmt = value
+			return nil
+		},
+	},
+}
+
+// supportedPixFmts are the output pixel formats the transcode path accepts.
+// yuv420p is the one phones and browsers reliably play.
+var supportedPixFmts = []string{"yuv420p", "yuvj420p", "yuv422p", "yuv444p", "yuv420p10le", "nv12"}
+
+func validatePixFmt(pixFmt string) error {
+	if slices.Contains(supportedPixFmts, pixFmt) {
+		return nil
+	}
+	return fmt.Errorf("unsupported pixel format %q", pixFmt)
+}
+
+// processingProfiles maps a profile name to the option values it expands
+// to, keyed by the same names as the query parameters.
+type processingProfiles map[string]map[string]string
+
+// parseProcessingProfiles decodes PROCESSING_PROFILES, a JSON object such as
+// {"web-hd":{"pixfmt":"yuv420p","autocaption":"true"}}. Every value is run
+// through its option's parser so a bad profile fails at startup rather than
+// on the first upload that names it.
+func parseProcessingProfiles(raw string) (processingProfiles, error) {
+	profiles := processingProfiles{}
+	if raw == "" {
+		return profiles, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &profiles); err != nil {
+		return nil, err
+	}
+	for name, values := range profiles {
+		if name == "" {
+			return nil, fmt.Errorf("profile name can't be empty")
+		}
+		if err := applyOptionValues(values, &uploadOptions{}); err != nil {
+			return nil, fmt.Errorf("profile %q: %v", name, err)
+		}
+	}
+	return profiles, nil
+}
+
+// applyOptionValues applies values in uploadOptionSpecs order, rejecting
+// names that aren't options a profile can set.
+func applyOptionValues(values map[string]string, opts *uploadOptions) error {
+	for name := range values {
+		if !slices.ContainsFunc(uploadOptionSpecs, func(spec uploadOptionSpec) bool {
+			return spec.Name == name && spec.apply != nil
+		}) {
+			return fmt.Errorf("unknown option %q", name)
+		}
+	}
+	for _, spec := range uploadOptionSpecs {
+		value, ok := values[spec.Name]
+		if !ok {
+			continue
+		}
+		if err := spec.apply(value, opts); err != nil {
+			return fmt.Errorf("invalid %s: %v", spec.Name, err)
+		}
+	}
+	return nil
+}
+
+func (cfg *apiConfig) parseUploadOptions(r *http.Request) (uploadOptions, error) {
+	opts := uploadOptions{}
+	query := r.URL.Query()
+	if query.Has(profileOptionName) {
+		name := query.Get(profileOptionName)
+		values, ok := cfg.processingProfiles[name]
+		if !ok {
+			return uploadOptions{}, fmt.Errorf("unknown profile %q", name)
+		}
+		if err := applyOptionValues(values, &opts); err != nil {
+			return uploadOptions{}, fmt.Errorf("profile %q: %v", name, err)
+		}
+	}
+	for _, spec := range uploadOptionSpecs {
+		if spec.apply == nil || !query.Has(spec.Name) {
+			continue
+		}
+		if err := spec.apply(query.Get(spec.Name), &opts); err != nil {
+			return uploadOptions{}, fmt.Errorf("invalid %s: %v", spec.Name, err)
+		}
+	}
+	return opts, nil
+}
+
+func (cfg *apiConfig) handlerVideoOptions(w http.ResponseWriter, r *http.Request) {
+	specs := slices.Clone(uploadOptionSpecs)
+	for i := range specs {
+		if specs[i].Name != profileOptionName {
+			continue
+		}
+		if len(cfg.processingProfiles) == 0 {
+			specs[i].Constraints = "no profiles are configured"
+		} else {
+			specs[i].Constraints = "one of " + strings.Join(slices.Sorted(maps.Keys(cfg.processingProfiles)), ", ")
+		}
+	}
+	respondWithJSON(w, http.StatusOK, specs)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// sampleOptionValues holds a non-default value for every upload option. A
+// new option needs an entry here, and a new uploadOptions field needs an
+// option that sets it, or TestUploadOptionsManifestInSync fails.
+var sampleOptionValues = map[string]string{
+	"autocaption": "true",
+	"pixfmt":      "yuv444p",
+}
+
+func TestUploadOptionsManifestInSync(t *testing.T) {
+	cfg := newTestConfig(t)
+	rec := httptest.NewRecorder()
+	cfg.handlerVideoOptions(rec, httptest.NewRequest(http.MethodGet, "/api/videos/options", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body)
+	}
+	manifest := decodeJSON[[]uploadOptionSpec](t, rec)
+	advertised := map[string]bool{}
+	for _, spec := range manifest {
+		if spec.Type == "" || spec.Description == "" {
+			t.Errorf("option %q is missing its type or description", spec.Name)
+		}
+		advertised[spec.Name] = true
+	}
+
+	set := map[string]bool{}
+	optsType := reflect.TypeOf(uploadOptions{})
+	for _, spec := range uploadOptionSpecs {
+		if !advertised[spec.Name] {
+			t.Errorf("option %q is parsed but not in the manifest", spec.Name)
+		}
+		if spec.apply == nil {
+			continue
+		}
+		value, ok := sampleOptionValues[spec.Name]
+		if !ok {
+			t.Errorf("option %q has no sample value", spec.Name)
+			continue
+		}
+		req := httptest.NewRequest(http.MethodPost, "/api/video_upload/x?"+spec.Name+"="+value, nil)
+		opts, err := cfg.parseUploadOptions(req)
+		if err != nil {
+			t.Errorf("parsing %s=%s: %v", spec.Name, value, err)
+			continue
+		}
+		got := reflect.ValueOf(opts)
+		for i := range optsType.NumField() {
+			if !got.Field(i).IsZero() {
+				set[optsType.Field(i).Name] = true
+			}
+		}
+	}
+	for i := range optsType.NumField() {
+		if name := optsType.Field(i).Name; !set[name] {
+			t.Errorf("uploadOptions.%s isn't set by any advertised option", name)
+		}
+	}
+	if len(manifest) != len(uploadOptionSpecs) {
+		t.Errorf("manifest has %d options, parser has %d", len(manifest), len(uploadOptionSpecs))
+	}
+}
+
+func TestParseUploadOptionsRejectsInvalidValues(t *testing.T) {
+	cfg := newTestConfig(t)
+	for _, query := range []string{"autocaption=maybe", "pixfmt=rgb48", "profile=missing"} {
+		req := httptest.NewRequest(http.MethodPost, "/api/video_upload/x?"+query, nil)
+		if _, err := cfg.parseUploadOptions(req); err == nil {
+			t.Errorf("parseUploadOptions(%q) succeeded, want an error", query)
+		}
+	}
+}
+
+func TestProcessingProfiles(t *testing.T) {
+	profiles, err := parseProcessingProfiles(`{"web-hd":{"pixfmt":"yuv444p","autocaption":"true"}}`)
+	if err != nil {
+		t.Fatalf("parseProcessingProfiles: %v", err)
+	}
+	cfg := newTestConfig(t)
+	cfg.processingProfiles = profiles
+
+	tests := []struct {
+		query   string
+		want    uploadOptions
+		wantErr bool
+	}{
+		{"profile=web-hd", uploadOptions{AutoCaption: true, PixFmt: "yuv444p"}, false},
+		{"profile=web-hd&pixfmt=yuv420p", uploadOptions{AutoCaption: true, PixFmt: "yuv420p"}, false},
+		{"profile=web-hd&autocaption=false", uploadOptions{PixFmt: "yuv444p"}, false},
+		{"profile=mobile", uploadOptions{}, true},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/api/video_upload/x?"+tt.query, nil)
+		got, err := cfg.parseUploadOptions(req)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseUploadOptions(%q) error = %v, want error %v", tt.query, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseUploadOptions(%q) = %+v, want %+v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestParseProcessingProfilesRejectsBadValues(t *testing.T) {
+	for _, raw := range []string{
+		`{"web-hd":{"pixfmt":"rgb48"}}`,
+		`{"web-hd":{"resolution":"720p"}}`,
+		`{"":{"pixfmt":"yuv420p"}}`,
+		`not json`,
+	} {
+		if _, err := parseProcessingProfiles(raw); err == nil {
+			t.Errorf("parseProcessingProfiles(%s) succeeded, want an error", raw)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// uploadProgressFunc is called with the request body bytes received so far
+// for an upload. total is the request's Content-Length, or -1 if the client
+// didn't send one.
+type uploadProgressFunc func(videoID uuid.UUID, received, total int64)
+
+// progressReader reports the bytes read through it to onProgress at most
+// once per interval, plus once when the body ends, so subscribers see a
+// final count without being called on every read.
+type progressReader struct {
+	body       io.ReadCloser
+	total      int64
+	received   int64
+	interval   time.Duration
+	last       time.Time
+	now        func() time.Time
+	onProgress func(received, total int64)
+}
+
+func newProgressReader(body io.ReadCloser, total int64, interval time.Duration, now func() time.Time, onProgress func(received, total int64)) *progressReader {
+	return &progressReader{
+		body:       body,
+		total:      total,
+		interval:   interval,
+		last:       now(),
+		now:        now,
+		onProgress: onProgress,
+	}
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.body.Read(b)
+	p.received += int64(n)
+	if err == io.EOF {
+		p.onProgress(p.received, p.total)
+		return n, err
+	}
+	if n > 0 {
+		if now := p.now(); now.Sub(p.last) >= p.interval {
+			p.last = now
+			p.onProgress(p.received, p.total)
+		}
+	}
+	return n, err
+}
+
+func (p *progressReader) Close() error {
+	return p.body.Close()
+}
+
+// onUploadProgress registers fn to be called as upload bodies arrive. It
+// must be called before the server starts.
+func (cfg *apiConfig) onUploadProgress(fn uploadProgressFunc) {
+	cfg.uploadProgressHooks = append(cfg.uploadProgressHooks, fn)
+}
+
+// trackUploadProgress wraps an upload body so every registered hook sees
+// its progress. Without hooks the body is returned unchanged.
+func (cfg *apiConfig) trackUploadProgress(videoID uuid.UUID, body io.ReadCloser, total int64) io.ReadCloser {
+	if len(cfg.uploadProgressHooks) == 0 {
+		return body
+	}
+	return newProgressReader(body, total, cfg.progressInterval, cfg.now, func(received, total int64) {
+		for _, hook := range cfg.uploadProgressHooks {
+			hook(videoID, received, total)
+		}
+	})
+}
+
+type uploadProgress struct {
+	ReceivedBytes int64 `json:"received_bytes"`
+	TotalBytes    int64 `json:"total_bytes"`
+}
+
+// uploadProgressTracker keeps the latest progress of uploads in flight so
+// GET /api/videos/{videoID}/state can report it while the body is still
+// arriving.
+type uploadProgressTracker struct {
+	mu       sync.Mutex
+	progress map[uuid.UUID]uploadProgress
+}
+
+func newUploadProgressTracker() *uploadProgressTracker {
+	return &uploadProgressTracker{progress: map[uuid.UUID]uploadProgress{}}
+}
+
+func (t *uploadProgressTracker) Update(videoID uuid.UUID, received, total int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.progress[videoID] = uploadProgress{ReceivedBytes: received, TotalBytes: total}
+}
+
+func (t *uploadProgressTracker) Get(videoID uuid.UUID) (uploadProgress, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	p, ok := t.progress[videoID]
+	return p, ok
+}
+
+func (t *uploadProgressTracker) Clear(videoID uuid.UUID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.progress, videoID)
+}
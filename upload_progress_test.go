@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	c.n += int64(n)
+	return n, err
+}
+
+func TestProgressReaderReportsMonotonicCounts(t *testing.T) {
+	data := bytes.Repeat([]byte("x"), 4096)
+	source := &countingReader{r: iotest.OneByteReader(bytes.NewReader(data))}
+	clock := time.Date(2026, 5, 1, 9, 0, 0, 0, time.UTC)
+	now := func() time.Time {
+		clock = clock.Add(300 * time.Millisecond)
+		return clock
+	}
+
+	var seen []int64
+	reader := newProgressReader(io.NopCloser(source), int64(len(data)), time.Second, now, func(received, total int64) {
+		if total != int64(len(data)) {
+			t.Errorf("callback total %d, want %d", total, len(data))
+		}
+		if received > source.n {
+			t.Errorf("callback reported %d bytes, only %d read", received, source.n)
+		}
+		seen = append(seen, received)
+	})
+	if _, err := io.Copy(io.Discard, reader); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(seen) < 2 {
+		t.Fatalf("callback ran %d times, want several", len(seen))
+	}
+	for i := 1; i < len(seen); i++ {
+		if seen[i] < seen[i-1] {
+			t.Errorf("counts went backwards: %v", seen)
+			break
+		}
+	}
+	if last := seen[len(seen)-1]; last != int64(len(data)) {
+		t.Errorf("final count %d, want %d", last, len(data))
+	}
+	// One byte per read, with the clock moving 300ms per read against a 1s
+	// interval, should report about every fourth read.
+	if limit := len(data)/3 + 1; len(seen) > limit {
+		t.Errorf("callback ran %d times for %d reads, want at most %d", len(seen), len(data), limit)
+	}
+}
+
+func TestUploadProgressHooksSeeBody(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.progressInterval = 0
+	installFakeMedia(t, &fakeMedia{Width: 1920, Height: 1080})
+	userID := createTestUser(t, cfg)
+	video := createTestVideo(t, cfg, userID, visibilityPublic)
+
+	var seen []int64
+	cfg.onUploadProgress(func(videoID uuid.UUID, received, total int64) {
+		if videoID != video.ID {
+			t.Errorf("hook called for %s, want %s", videoID, video.ID)
+		}
+		seen = append(seen, received)
+	})
+	req := uploadRequest(t, video.ID, userID, testMP4(64<<10, 0), "video/mp4")
+	rec := httptest.NewRecorder()
+	cfg.handlerUploadVideo(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body)
+	}
+
+	if len(seen) == 0 {
+		t.Fatal("progress hook never ran")
+	}
+	for i := 1; i < len(seen); i++ {
+		if seen[i] < seen[i-1] {
+			t.Fatalf("counts went backwards: %v", seen)
+		}
+	}
+	if last := seen[len(seen)-1]; last != req.ContentLength {
+		t.Errorf("final count %d, want the body's %d bytes", last, req.ContentLength)
+	}
+}
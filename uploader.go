@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const (
+	defaultS3PartSize          = 16 << 20
+	defaultS3UploadConcurrency = 4
+)
+
+// newUploader builds the multipart uploader used for video objects. Each
+// in-flight part is buffered, so a single upload can hold up to
+// partSize × concurrency bytes in memory (64 MB with the defaults).
+func newUploader(client *s3.Client, partSize int64, concurrency int) (*manager.Uploader, error) {
+	if partSize < manager.MinUploadPartSize {
+		return nil, fmt.Errorf("S3 part size must be at least %d bytes, got %d", manager.MinUploadPartSize, partSize)
+	}
+	if concurrency < 1 {
+		return nil, fmt.Errorf("S3 upload concurrency must be at least 1, got %d", concurrency)
+	}
+	return manager.NewUploader(client, func(u *manager.Uploader) {
+		u.PartSize = partSize
+		u.Concurrency = concurrency
+	}), nil
+}
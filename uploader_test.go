@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+func TestNewUploader(t *testing.T) {
+	client := s3.New(s3.Options{Region: "us-east-1", Credentials: aws.AnonymousCredentials{}})
+
+	u, err := newUploader(client, 32<<20, 8)
+	if err != nil {
+		t.Fatalf("newUploader: %v", err)
+	}
+	if u.PartSize != 32<<20 || u.Concurrency != 8 {
+		t.Errorf("got part size %d and concurrency %d, want %d and 8", u.PartSize, u.Concurrency, 32<<20)
+	}
+
+	tests := []struct {
+		name        string
+		partSize    int64
+		concurrency int
+	}{
+		{"part size under the S3 minimum", manager.MinUploadPartSize - 1, 4},
+		{"zero concurrency", defaultS3PartSize, 0},
+		{"negative concurrency", defaultS3PartSize, -2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newUploader(client, tt.partSize, tt.concurrency); err == nil {
+				t.Error("invalid settings were accepted")
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func TestReuploadCreatesNewVersionedKey(t *testing.T) {
+	cfg := newTestConfig(t)
+	installFakeMedia(t, &fakeMedia{Width: 1920, Height: 1080})
+	userID := createTestUser(t, cfg)
+	video := createTestVideo(t, cfg, userID, visibilityPublic)
+
+	for seed := range 2 {
+		rec := uploadTestVideo(t, cfg, video.ID, userID, testMP4(1024, byte(seed)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("upload %d: got status %d: %s", seed+1, rec.Code, rec.Body)
+		}
+	}
+
+	versions, err := cfg.db.GetVideoVersions(video.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 {
+		t.Fatalf("got %d versions, want 2", len(versions))
+	}
+	keys := map[int]string{}
+	for _, v := range versions {
+		keys[v.Version] = v.Key
+		if ok, err := cfg.objectExists(context.Background(), v.Key); err != nil || !ok {
+			t.Errorf("version %d object %s is gone (err %v)", v.Version, v.Key, err)
+		}
+	}
+	if !strings.Contains(keys[1], ".v1.") || !strings.Contains(keys[2], ".v2.") || keys[1] == keys[2] {
+		t.Fatalf("got keys %v, want distinct .v1 and .v2 keys", keys)
+	}
+
+	get := func(query string) database.Video {
+		t.Helper()
+		req := newAuthedRequest(t, http.MethodGet, "/api/videos/"+video.ID.String()+query, nil, userID)
+		req.SetPathValue("videoID", video.ID.String())
+		rec := httptest.NewRecorder()
+		cfg.handlerVideoGet(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET%s: got status %d: %s", query, rec.Code, rec.Body)
+		}
+		return decodeJSON[database.Video](t, rec)
+	}
+	if latest := get(""); latest.VideoURL == nil || !strings.Contains(*latest.VideoURL, keys[2]) {
+		t.Errorf("default URL %v doesn't serve the latest key %s", latest.VideoURL, keys[2])
+	}
+	if old := get("?version=1"); old.VideoURL == nil || !strings.Contains(*old.VideoURL, keys[1]) {
+		t.Errorf("?version=1 URL %v doesn't serve %s", old.VideoURL, keys[1])
+	}
+}
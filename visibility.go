@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+const (
+	visibilityPublic  = "public"
+	visibilityPrivate = "private"
+)
+
+func validateVisibility(visibility string) error {
+	switch visibility {
+	case visibilityPublic, visibilityPrivate:
+		return nil
+	default:
+		return fmt.Errorf("visibility must be %q or %q", visibilityPublic, visibilityPrivate)
+	}
+}
+
+// defaultVisibilityFor returns the visibility a new video gets when the
+// request doesn't specify one: the user's preference if set, otherwise the
+// global default.
+func (cfg *apiConfig) defaultVisibilityFor(userID uuid.UUID) (string, error) {
+	user, err := cfg.db.GetUser(userID)
+	if err != nil {
+		return "", err
+	}
+	if user != nil && user.DefaultVisibility != nil {
+		return *user.DefaultVisibility, nil
+	}
+	return cfg.defaultVisibility, nil
+}